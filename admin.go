@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// maintenanceHandler broadcasts a maintenance notice to every socket,
+// stops accepting new ones and closes the remaining sockets after the
+// grace period. It is mounted on the admin group.
+//
+//	curl -u admin:secret -X POST 'localhost:8080/admin/maintenance?grace=2m'
+func maintenanceHandler(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		grace := time.Minute
+		if v := r.FormValue("grace"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				http.Error(w, "invalid grace period: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			grace = d
+		}
+		notice := r.FormValue("message")
+		if notice == "" {
+			notice = fmt.Sprintf("The server is going down for maintenance in %s.", grace)
+		}
+
+		app.Broadcast("maintenance", notice)
+		app.Sockets.Drain(grace)
+		app.Audit.RecordRequest(r, AuditMaintenance, "", fmt.Sprintf("grace %s: %s", grace, notice))
+
+		fmt.Fprintf(w, "draining %d sockets, closing them in %s\n", app.Sockets.Count(), grace)
+	}
+}
+
+// noticeHandler flashes an admin notice on every connected page, adds it
+// to the notification center and posts it to the chat notifiers.
+//
+//	curl -u admin:secret -X POST localhost:8080/admin/notice -d 'message=Hello&level=info'
+func noticeHandler(app *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		msg := r.FormValue("message")
+		if msg == "" {
+			http.Error(w, "message is required", http.StatusBadRequest)
+			return
+		}
+		level := FlashLevel(r.FormValue("level"))
+		switch level {
+		case "":
+			level = FlashInfo
+		case FlashInfo, FlashSuccess, FlashWarning, FlashError:
+		default:
+			http.Error(w, fmt.Sprintf("unknown level %q", level), http.StatusBadRequest)
+			return
+		}
+
+		app.Broadcast("flash", FlashMessage{Level: level, Message: msg})
+		app.Notifications.Notify("", NotifySystem, Message{Key: msg})
+		app.Notifiers.Send(Notice{Kind: NotifySystem, Level: level, Text: msg})
+		app.Audit.RecordRequest(r, AuditNotice, "", fmt.Sprintf("%s: %s", level, msg))
+
+		fmt.Fprintf(w, "notice sent to %d sockets\n", app.Sockets.Count())
+	}
+}
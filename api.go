@@ -0,0 +1,318 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jfyne/live"
+
+	"my-app.com/live/store"
+)
+
+const (
+	// apiSocket is the socket of the events the API logs.
+	apiSocket = "api"
+	// apiMessages is the number of chat messages GET /api/messages returns
+	// by default, and at most.
+	apiMessages = 100
+)
+
+// API is the JSON API mirroring the shared actions of the live pages: the
+// setpoints of the zones and the thermostat chat. It goes through the same
+// validation, recording and audit as the events of the sockets, and the
+// changes show on the connected dashboard and thermostat pages, see
+// Setpoints. The actions
+// private to a socket, the counter and the todos, have nothing to share.
+type API struct {
+	app        *App
+	thermostat Broadcaster
+}
+
+// NewAPI creates the API of app. The setpoints show on the pages the
+// Setpoints of app watch, the chat messages on those of thermostat.
+func NewAPI(app *App, thermostat Broadcaster) *API {
+	return &API{app: app, thermostat: thermostat}
+}
+
+// Routes serves the API under /api on r, its OpenAPI document at
+// /api/openapi.json with the Swagger UI at /api/docs/, and its websocket
+// at /ws/api. The changes take the basic auth of the admin pages, see
+// Router.Auth, and are audited as its user.
+//
+//	curl localhost:8080/api/zones
+//	curl -u admin:secret -X PUT localhost:8080/api/zones/kitchen/setpoint -d '{"temperature": 21.5}'
+//	curl -u admin:secret -X POST localhost:8080/api/zones/kitchen/up
+//	curl -u admin:secret -X POST localhost:8080/api/zones/kitchen/change -d '{"temperature": -2}'
+//	curl -u admin:secret -X POST localhost:8080/api/messages -d '{"name": "Alice", "message": "Hello"}'
+func (a *API) Routes(r *Router) {
+	routes := a.routes()
+	auth := r.Auth
+	r.Route("/api", func(r chi.Router) {
+		for _, route := range routes {
+			var h http.Handler = route.Handler
+			if route.Auth {
+				h = auth(h)
+			}
+			r.Method(route.Method, route.Path, h)
+		}
+		r.Get("/openapi.json", serveOpenAPI(routes))
+		r.Handle("/docs/*", swaggerUI)
+		r.Get("/docs", http.RedirectHandler("/api/docs/", http.StatusMovedPermanently).ServeHTTP)
+	})
+	r.Get("/ws/api", a.socket)
+}
+
+// routes are the routes of the API under /api, that the OpenAPI document
+// describes.
+func (a *API) routes() []apiRoute {
+	zone := apiParam{Name: "zone", In: "path", Description: "the zone, main, living, kitchen…"}
+	zoneErrors := []int{http.StatusNotFound}
+	setErrors := []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity}
+	return []apiRoute{
+		{Method: http.MethodGet, Path: "/zones", Tag: "zones", Summary: "List the zones with their setpoints",
+			Handler: a.zones, Response: []apiZone{}},
+		{Method: http.MethodGet, Path: "/zones/{zone}", Tag: "zones", Summary: "Get the setpoint of a zone",
+			Handler: a.zone, Params: []apiParam{zone}, Response: apiZone{}, Errors: zoneErrors},
+		// The setpoint form, temp-set, and the buttons: temp-up, temp-down
+		// and temp-change.
+		{Method: http.MethodPut, Path: "/zones/{zone}/setpoint", Tag: "zones", Auth: true, Summary: "Set the setpoint of a zone",
+			Description: "A setpoint over the warning limit needs \"confirmed\": true.",
+			Handler:     a.setpoint(func(c *TempControl, v float32) float32 { return v }, setpointForm),
+			Params:      []apiParam{zone}, Body: apiSetpointBody{}, Response: apiZone{}, Errors: setErrors},
+		{Method: http.MethodPost, Path: "/zones/{zone}/up", Tag: "zones", Auth: true, Summary: "Raise the setpoint of a zone by 0.1 °C",
+			Handler: a.setpoint(func(c *TempControl, _ float32) float32 { return c.Temperature + 0.1 }, nil),
+			Params:  []apiParam{zone}, Body: apiConfirmBody{}, Response: apiZone{}, Errors: setErrors},
+		{Method: http.MethodPost, Path: "/zones/{zone}/down", Tag: "zones", Auth: true, Summary: "Lower the setpoint of a zone by 0.1 °C",
+			Handler: a.setpoint(func(c *TempControl, _ float32) float32 { return c.Temperature - 0.1 }, nil),
+			Params:  []apiParam{zone}, Body: apiConfirmBody{}, Response: apiZone{}, Errors: setErrors},
+		{Method: http.MethodPost, Path: "/zones/{zone}/change", Tag: "zones", Auth: true, Summary: "Change the setpoint of a zone by the temperature",
+			Handler: a.setpoint(func(c *TempControl, v float32) float32 { return c.Temperature + v }, changeForm),
+			Params:  []apiParam{zone}, Body: apiSetpointBody{}, Response: apiZone{}, Errors: setErrors},
+		{Method: http.MethodGet, Path: "/messages", Tag: "chat", Summary: "List the latest chat messages, oldest first",
+			Handler: a.messages, Response: []apiMessage{}, Errors: []int{http.StatusBadRequest},
+			Params: []apiParam{{Name: "limit", In: "query", Type: "integer", Description: fmt.Sprintf("the number of messages, from 1 to %d", apiMessages)}}},
+		{Method: http.MethodPost, Path: "/messages", Tag: "chat", Auth: true, Summary: "Send a message to the thermostat chat",
+			Handler: a.postMessage, Body: apiMessageBody{}, Status: http.StatusCreated, Response: apiMessage{},
+			Errors: []int{http.StatusBadRequest, http.StatusUnprocessableEntity}},
+	}
+}
+
+// changeForm validates the body of a temp-change, the change of the
+// setpoint.
+var changeForm = Form{
+	"temperature": {Required()},
+}
+
+// apiZone is a zone as the API returns it.
+type apiZone struct {
+	Zone     string    `json:"zone"`
+	Setpoint float32   `json:"setpoint"`
+	Updated  time.Time `json:"updated"`
+	TooHot   bool      `json:"too_hot"`
+}
+
+func newAPIZone(c *TempControl) apiZone {
+	return apiZone{Zone: c.Zone, Setpoint: c.Temperature, Updated: c.Changed(), TooHot: c.TooHot()}
+}
+
+// apiSetpointBody is the body of a setpoint change.
+type apiSetpointBody struct {
+	Temperature *float32 `json:"temperature" doc:"°C, the setpoint or the change of the setpoint"`
+	Confirmed   bool     `json:"confirmed,omitempty" doc:"confirms a setpoint over the warning limit"`
+}
+
+// apiConfirmBody is the optional body of a step of the setpoint.
+type apiConfirmBody struct {
+	Confirmed bool `json:"confirmed,omitempty" doc:"confirms a setpoint over the warning limit"`
+}
+
+// apiMessageBody is the body of a chat message.
+type apiMessageBody struct {
+	Name    string `json:"name,omitempty" doc:"the author, anonymous without"`
+	Message string `json:"message"`
+}
+
+// apiErrorBody is the body of the errors of the API.
+type apiErrorBody struct {
+	Error  string            `json:"error"`
+	Fields map[string]string `json:"fields,omitempty" doc:"the errors of the fields of an invalid request"`
+}
+
+// apiMessage is a chat message as the API returns it.
+type apiMessage struct {
+	ID     int64     `json:"id"`
+	Author string    `json:"author"`
+	Text   string    `json:"text"`
+	Time   time.Time `json:"time"`
+}
+
+// zones lists the zones with their setpoints.
+func (a *API) zones(w http.ResponseWriter, r *http.Request) {
+	var zones []apiZone
+	for _, zone := range a.app.Setpoints.Zones() {
+		c, err := a.app.Setpoints.Control(r.Context(), zone)
+		if err != nil {
+			apiFail(w, err)
+			return
+		}
+		zones = append(zones, newAPIZone(c))
+	}
+	writeJSON(w, http.StatusOK, zones)
+}
+
+// zone returns the setpoint of a zone.
+func (a *API) zone(w http.ResponseWriter, r *http.Request) {
+	c, err := a.app.Setpoints.Control(r.Context(), chi.URLParam(r, "zone"))
+	if err != nil {
+		apiFail(w, err)
+		return
+	}
+	if c == nil {
+		apiError(w, http.StatusNotFound, "unknown zone")
+		return
+	}
+	writeJSON(w, http.StatusOK, newAPIZone(c))
+}
+
+// setpoint returns the handler of a setpoint change, to the temperature to
+// returns for the control and the "temperature" of the body. The body is
+// validated with form, up and down have neither. Like on the controls, a
+// change over the warning limit needs "confirmed": true.
+func (a *API) setpoint(to func(c *TempControl, value float32) float32, form Form) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body apiSetpointBody
+		if err := decodeJSON(w, r, &body); err != nil {
+			apiError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		var v float32
+		if form != nil {
+			p := live.Params{}
+			if body.Temperature != nil {
+				v = *body.Temperature
+				p["temperature"] = strconv.FormatFloat(float64(v), 'f', -1, 32)
+			}
+			if errs := form.Validate(p); len(errs) > 0 {
+				a.invalid(w, r, errs)
+				return
+			}
+		}
+		ctx := r.Context()
+		c, err := a.app.Setpoints.Control(ctx, chi.URLParam(r, "zone"))
+		if err != nil {
+			apiFail(w, err)
+			return
+		}
+		if c == nil {
+			apiError(w, http.StatusNotFound, "unknown zone")
+			return
+		}
+
+		setpoint := to(c, v)
+		if errs := validSetpoint(setpoint); len(errs) > 0 {
+			a.invalid(w, r, errs)
+			return
+		}
+		// The ±0.1C steps don't report, as on the pages.
+		o := SetpointOrigin{Actor: a.app.Router.User(r), Socket: apiSocket, Page: r.URL.Path, Step: form == nil}
+		err = a.app.Setpoints.Set(ctx, c, setpoint, body.Confirmed, o)
+		if errors.Is(err, ErrNotConfirmed) {
+			apiError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if err != nil {
+			apiFail(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newAPIZone(c))
+	}
+}
+
+// messages returns the latest chat messages, oldest first, at most ?limit.
+func (a *API) messages(w http.ResponseWriter, r *http.Request) {
+	n := apiMessages
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > apiMessages {
+			apiError(w, http.StatusBadRequest, fmt.Sprintf("limit is a number from 1 to %d", apiMessages))
+			return
+		}
+		n = limit
+	}
+	messages, err := a.app.Repos.Messages.Recent(r.Context(), chatRoom, n)
+	if err != nil {
+		apiFail(w, err)
+		return
+	}
+	list := make([]apiMessage, 0, len(messages))
+	for _, msg := range messages {
+		list = append(list, apiMessage{ID: msg.ID, Author: msg.Author, Text: msg.Text, Time: msg.Time})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// postMessage sends a message to the thermostat chat.
+func (a *API) postMessage(w http.ResponseWriter, r *http.Request) {
+	var body apiMessageBody
+	if err := decodeJSON(w, r, &body); err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errs := chatForm.Validate(live.Params{"message": body.Message}); len(errs) > 0 {
+		a.invalid(w, r, errs)
+		return
+	}
+	msg := store.Message{Author: strings.TrimSpace(body.Name), Text: strings.TrimSpace(body.Message), Time: time.Now()}
+	msg, err := postMessage(r.Context(), a.app.Repos.Messages, a.thermostat, msg)
+	if err != nil {
+		apiFail(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, apiMessage{ID: msg.ID, Author: msg.Author, Text: msg.Text, Time: msg.Time})
+}
+
+// invalid responds with the errors of a form, translated for the request.
+func (a *API) invalid(w http.ResponseWriter, r *http.Request, errs Errors) {
+	locale := a.app.Locales.Negotiate(r)
+	fields := map[string]string{}
+	for field, msg := range errs {
+		fields[field] = locale.Format(msg)
+	}
+	writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{"error": "invalid request", "fields": fields})
+}
+
+// decodeJSON reads the JSON body of r into v. An empty body leaves v as
+// it is.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(v)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid JSON body: %w", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("could not write the response:", err)
+	}
+}
+
+func apiError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// apiFail logs an internal error, the client only learns it failed.
+func apiFail(w http.ResponseWriter, err error) {
+	log.Println("api error:", err)
+	apiError(w, http.StatusInternalServerError, genericError)
+}
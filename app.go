@@ -0,0 +1,595 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-redis/redis/v8"
+	"github.com/jfyne/live"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc"
+	"nhooyr.io/websocket"
+
+	"my-app.com/live/store"
+)
+
+// App holds the infrastructure shared by every live page: the router,
+// the session store, the socket registry, the event middleware and the
+// message bus. Pages create their handler with NewHandler and register it
+// with Live.
+type App struct {
+	Config   Config
+	Router   *Router
+	Sessions live.HttpSessionStore
+	Assigns  AssignsStore
+	Sockets  *Sockets
+	// State runs the events of every socket in order, one at a time, see
+	// State.
+	State     *State
+	Templates *Templates
+	Locales   *Locales
+	// Store keeps the data of the pages, such as the todo lists: in Redis
+	// when it is configured, in memory otherwise.
+	Store AssignsStore
+	// History records the setpoint changes of every zone.
+	History *ZoneHistory
+	// Recorder records the setpoints of the temperature controls: in the
+	// history and the database, or only the database when the history is
+	// projected from the event log. It is the Setpoints, which tell their
+	// watchers.
+	Recorder ReadingRecorder
+	// Broadcasts is the bus of the broadcasts of the thermostat and the
+	// dashboard.
+	Broadcasts *Broadcasts
+	// Setpoints are the setpoints of the zones behind the controls, the API
+	// and the gRPC service.
+	Setpoints *Setpoints
+	// Zones are the zones added with the setup wizard.
+	Zones *ZoneConfigs
+	// Preferences are the email preferences of the users.
+	Preferences *UserPreferences
+	// Push pushes the alerts and mentions to the subscribed browsers, nil
+	// without the VAPID keys.
+	Push *Push
+	// Mailer emails the alerts and the daily summary, nil without
+	// --smtp-addr.
+	Mailer *Mailer
+	// Rules are the zone rules of the admin rules page.
+	Rules *ZoneRules
+	// Clock sends the time to the pages while the server runs.
+	Clock *Ticker
+	// Bus is the message bus, NATS or MQTT, nil when it is not reachable.
+	Bus Bus
+	// Logs keeps the latest log lines for the logs page.
+	Logs *LogTail
+	// Metrics are the Prometheus metrics served at /metrics.
+	Metrics *Metrics
+	// ZoneGauges are the temperatures and setpoints of the zones as
+	// metrics.
+	ZoneGauges *ZoneGauges
+	// Notifications feed the notification center of the layout.
+	Notifications *Notifications
+	// Invites are the invitation links of the QR codes, see Invites.
+	Invites *Invites
+	// DB is the database behind Repos, see openDatabase.
+	DB store.Database
+	// Repos keep the setpoints, chat messages and users shared by the
+	// sockets and kept across restarts.
+	Repos store.Repos
+	// EventLog logs the live events, nil without --event-log.
+	EventLog *EventLog
+	// Audit records who changed what, see the audit page.
+	Audit *Audit
+	// Webhooks post the alerts and chat messages to the configured URLs.
+	Webhooks *Webhooks
+	// Notifiers post the alerts and admin notices to the chat services.
+	Notifiers Notifiers
+	// Tracing exports the spans to the OTLP collector, nil without
+	// --otlp-endpoint.
+	Tracing *sdktrace.TracerProvider
+
+	middleware []EventMiddleware
+
+	enginesMu sync.Mutex
+	engines   []*live.HttpEngine
+}
+
+// NewApp creates the shared infrastructure from the config.
+func NewApp(cfg Config) (*App, error) {
+	locales := mustLoadLocales()
+	state := NewState()
+	a := &App{
+		Config:    cfg,
+		Router:    NewRouter(cfg.AdminUser, cfg.AdminPassword),
+		Sessions:  live.NewCookieStore("session-name", []byte(cfg.SessionSecret)),
+		Sockets:   NewSockets(cfg.Keepalive, cfg.MaxSockets, state),
+		State:     state,
+		Templates: NewTemplates(templateFS(cfg), cfg.Dev, locales),
+		Locales:   locales,
+		Store:     NewMemoryAssigns(),
+		History:   NewZoneHistory(historyRetention),
+		Logs:      NewLogTail(logTailSize),
+		Invites:   NewInvites(),
+
+		Broadcasts: NewBroadcasts(),
+		Webhooks:   NewWebhooks(cfg.Webhooks),
+		Notifiers:  newNotifiers(cfg),
+	}
+	if err := a.Templates.ParseAll(); err != nil {
+		return nil, err
+	}
+	if cfg.OTLPEndpoint != "" {
+		var err error
+		if a.Tracing, err = setupTracing(context.Background(), cfg.OTLPEndpoint); err != nil {
+			return nil, err
+		}
+	}
+	a.Sockets.Overflow = overflowPage(a.Templates, a.Sockets)
+	a.Metrics = NewMetrics(a.Sockets)
+	a.ZoneGauges = NewZoneGauges(a.Metrics)
+	a.Notifications = NewNotifications(a.Broadcast)
+	a.History.OnAlert = func(zone string, alert Alert) {
+		text := Message{Key: "%s is set to %.1f °C, over the limit of %.1f °C.", Args: []interface{}{zone, alert.Value, tempLimit}}
+		a.Notifications.Notify("", NotifyAlert, text)
+		a.Notifiers.Send(Notice{Kind: NotifyAlert, Level: FlashWarning, Text: a.Locales.Get("").Format(text), Time: alert.Time})
+		a.Webhooks.Send(WebhookAlert, webhookAlert{Zone: zone, Setpoint: alert.Value, Limit: tempLimit, Time: alert.Time})
+		if a.Mailer != nil {
+			a.Mailer.Alert(zone, alert)
+		}
+	}
+	if a.Webhooks.Enabled() {
+		go a.Webhooks.Run(context.Background())
+	}
+	go a.Metrics.Sample(context.Background(), metricsInterval)
+
+	var rdb *redis.Client
+	if cfg.RedisURL != "" {
+		opts, err := redis.ParseURL(cfg.RedisURL)
+		if err != nil {
+			return nil, err
+		}
+		rdb = redis.NewClient(opts)
+		a.Sessions = NewRedisStore(rdb, "session-name", []byte(cfg.SessionSecret))
+		a.Store = NewRedisAssigns(rdb)
+		if cfg.PersistAssigns {
+			a.Assigns = NewRedisAssigns(rdb)
+		}
+	}
+
+	zones, err := LoadZoneConfigs(context.Background(), a.Store)
+	if err != nil {
+		return nil, err
+	}
+	a.Zones = zones
+	if a.Preferences, err = LoadUserPreferences(context.Background(), a.Store); err != nil {
+		return nil, err
+	}
+	if cfg.Push.PublicKey != "" {
+		if a.Push, err = LoadPush(context.Background(), cfg.Push, a.Store, a.Locales); err != nil {
+			return nil, err
+		}
+		a.Notifications.OnNotify = a.Push.Notify
+	}
+
+	if a.DB, err = openDatabase(context.Background(), cfg); err != nil {
+		return nil, err
+	}
+	if err := a.DB.Migrate(context.Background()); err != nil {
+		return nil, fmt.Errorf("could not migrate the database: %w", err)
+	}
+	a.Repos = a.DB.Repos()
+	if cfg.CacheTTL > 0 {
+		a.Repos = store.NewCache(rdb, cfg.CacheTTL).Wrap(a.Repos)
+	}
+	a.Repos.Messages = webhookMessages{MessageRepo: a.Repos.Messages, hooks: a.Webhooks}
+	a.Repos.Readings = gaugedReadings{ReadingRepo: a.Repos.Readings, gauges: a.ZoneGauges}
+	saveReading := func(zone string, r Reading) {
+		ctx := context.Background()
+		t := store.Thermostat{Zone: zone, Setpoint: r.Value, Updated: r.Time}
+		if err := a.Repos.Thermostats.Save(ctx, t); err != nil {
+			log.Println("could not save the setpoint of", zone, err)
+		}
+		if err := a.Repos.Readings.Add(ctx, store.Sample(zone, store.Temperature, r.Time, float64(r.Value))); err != nil {
+			log.Println("could not save the reading of", zone, err)
+		}
+	}
+	go store.RunCompaction(context.Background(), a.Repos, cfg.Retention, cfg.CompactInterval)
+
+	a.middleware = append(a.middleware, traceEvents, trackActivity, renderErrors(cfg.Dev), clearFlashes)
+	if cfg.Dev {
+		a.middleware = append(a.middleware, logEvents)
+	}
+	if cfg.EventLog {
+		a.EventLog = NewEventLog(a.Repos.Events)
+		a.middleware = append(a.middleware, a.EventLog.Middleware)
+		// The handlers only save the readings; the history is projected
+		// from the log, the events of earlier runs included.
+		a.Recorder = RecorderFunc(saveReading)
+		projector := NewProjector(a.Repos.Events, newHistoryProjection(a.History))
+		if err := projector.Rebuild(context.Background()); err != nil {
+			return nil, err
+		}
+		go projector.Run(context.Background(), projectionInterval)
+	} else {
+		a.History.OnRecord = saveReading
+		a.Recorder = a.History
+	}
+	if err := loadHistory(context.Background(), a.Repos.Readings, a.History); err != nil {
+		return nil, err
+	}
+	a.Audit = NewAudit(a.Repos.Audit, a.Repos.Users)
+	var events store.EventRepo
+	if a.EventLog != nil {
+		events = a.Repos.Events
+	}
+	a.Setpoints = NewSetpoints(a.Recorder, a.Repos.Thermostats, a.Zones, events, a.Audit)
+	a.Recorder = a.Setpoints
+	go a.ZoneGauges.Follow(context.Background(), a.Setpoints)
+	if cfg.SMTP.Addr != "" {
+		a.Mailer = NewMailer(cfg.SMTP, a.Templates, a.Locales, a.Preferences, a.History, a.Setpoints)
+		go a.Mailer.RunSummaries(context.Background())
+	}
+	if a.Rules, err = LoadZoneRules(context.Background(), a); err != nil {
+		return nil, err
+	}
+	go a.Rules.Run(context.Background())
+	if cfg.PushgatewayURL != "" {
+		go a.ZoneGauges.Push(context.Background(), cfg.PushgatewayURL, cfg.PushInterval)
+	}
+	a.middleware = append(a.middleware, a.Audit.Middleware)
+	if a.Assigns != nil {
+		a.middleware = append(a.middleware, saveAssigns(a.Assigns))
+	}
+	a.middleware = append(a.middleware, a.Metrics.Middleware)
+
+	if bus, err := openBus(cfg); err != nil {
+		log.Printf("the %s bus is not available, running without it: %v", cfg.Bus, err)
+	} else {
+		a.Bus = bus
+	}
+
+	if cfg.IdleTimeout > 0 {
+		go a.Sockets.ReapIdle(context.Background(), cfg.IdleTimeout)
+	}
+	a.Clock = NewTicker(cfg.TimeInterval, func(now time.Time) { a.Patch("time", now) })
+	a.Clock.PauseWhen(func() bool { return a.Sockets.Count() == 0 })
+
+	a.Router.Handle("/live.js", live.Javascript{})
+	a.Router.Handle("/static/*", staticAssets)
+	a.Router.Get("/favicon.ico", staticAssets.Favicon)
+	a.Router.Get("/version", versionHandler)
+	a.Router.Get("/events", sseHandler(a.Broadcasts, a.Setpoints))
+	a.Router.Handle("/metrics", a.Metrics)
+	a.Router.Post("/session/theme", themeHandler(a.Sessions))
+	a.Router.Admin.Post("/maintenance", maintenanceHandler(a))
+	a.Router.Admin.Post("/notice", noticeHandler(a))
+	a.Router.Admin.Post("/notify", notifyHandler(a.Notifications, a.Audit))
+	a.Router.Get("/invite/{token}", a.Invites.ServeHTTP)
+	a.Router.Admin.Get("/export/{entity}", exportHandler(a.Repos))
+	a.Router.Admin.Post("/import/readings", importHandler(a))
+	a.Router.Admin.Get("/events/{session}", eventsHandler(a.Repos.Events))
+
+	return a, nil
+}
+
+// openDatabase opens the database of the repositories: Postgres when
+// --database-url is set, the SQLite, Bolt or snapshot file of --db
+// otherwise.
+func openDatabase(ctx context.Context, cfg Config) (store.Database, error) {
+	if cfg.DatabaseURL != "" {
+		return store.OpenPostgres(ctx, cfg.DatabaseURL, cfg.DBPool)
+	}
+	switch cfg.DBDriver {
+	case "bolt":
+		return store.OpenBolt(cfg.DBPath)
+	case "memory":
+		return store.OpenMemory(cfg.DBPath, cfg.SnapshotInterval)
+	}
+	path := cfg.DBPath
+	if path == "" {
+		path = ":memory:"
+	}
+	return store.OpenSQLite(path)
+}
+
+// NewHandler creates a live handler wired with the shared middleware and
+// the self events every page handles. The page model has to embed Page.
+func (a *App) NewHandler() *Handler {
+	h := NewHandler(a.middleware...)
+	h.UseState(a.State)
+	h.UseMount(traceMount)
+	if a.EventLog != nil {
+		h.UseMount(a.EventLog.Mount)
+	}
+	h.UseMount(negotiateLocale(a.Locales), sessionTheme)
+	if a.Assigns != nil {
+		h.UseMount(restoreAssigns(a.Assigns))
+	}
+	h.UseMount(trackSocket, a.Config.Keepalive.Mount, a.Notifications.Mount)
+	h.HandleError(errorPage(a.Templates, a.Config.Dev))
+	// The client answers every ping, a tick of the keepalive.
+	h.handleEvent("tick", "pong", a.Config.Keepalive.Pong)
+	h.HandleEvent("flash-dismiss", flashDismiss)
+	h.HandleEvent("set-locale", setLocale(a.Locales))
+	h.HandleEvent("toggle-theme", toggleTheme)
+	h.HandleEvent("feed-toggle", feedToggle)
+	h.HandleEvent("paginate", paginate)
+	h.HandleEvent("modal-cancel", modalCancel)
+	h.HandleThrottled("feed-filter", 250*time.Millisecond, feedFilter)
+	h.HandleSelf("flash", flashSelf)
+	a.Notifications.handle(h)
+
+	h.HandleEvent("timezone", setTimezone)
+	h.HandlePatch("time", patchTime(false))
+	h.HandleSelf("maintenance", updatePage(func(p *Page, data interface{}) {
+		p.Maintenance = data.(string)
+	}))
+	return h
+}
+
+// Render returns a render handler for the named page template. The renders
+// are memoized, except in dev mode where the templates change under them.
+func (a *App) Render(name string) live.RenderHandler {
+	render := a.Templates.Render(name)
+	if !a.Config.Dev {
+		render = NewRenderMemo(render).Render
+	}
+	return traceRender(name, a.Metrics.Render(name, render))
+}
+
+// Live serves the handler at the given route patterns.
+func (a *App) Live(h *Handler, patterns ...string) *live.HttpEngine {
+	return a.live(a.Router, h, patterns)
+}
+
+// AdminLive serves the handler on the admin group, the patterns being
+// relative to /admin.
+func (a *App) AdminLive(h *Handler, patterns ...string) *live.HttpEngine {
+	return a.live(a.Router.Admin, h, patterns)
+}
+
+func (a *App) live(r chi.Router, h *Handler, patterns []string) *live.HttpEngine {
+	// The connection reads the messages of the client and the events of
+	// the send queue off the frames, they can't be compressed.
+	engine := live.NewHttpHandler(a.Sessions, h, live.WithWebsocketAcceptOptions(&websocket.AcceptOptions{
+		CompressionMode: websocket.CompressionDisabled,
+	}))
+	// A broadcast goes through the queues of the sockets like their other
+	// events.
+	engine.HandleBroadcast(a.State.broadcast(func() []live.Socket { return a.Sockets.Sockets(engine) }))
+
+	a.enginesMu.Lock()
+	a.engines = append(a.engines, engine)
+	a.enginesMu.Unlock()
+
+	handler := a.Sockets.Handler(engine)
+	for _, pattern := range patterns {
+		r.Handle(pattern, handler)
+	}
+	return engine
+}
+
+// Broadcast sends a self event to the sockets of every live page. The
+// pages without a connected socket are skipped, nothing would render the
+// event.
+func (a *App) Broadcast(event string, data interface{}) {
+	a.enginesMu.Lock()
+	engines := make([]*live.HttpEngine, len(a.engines))
+	copy(engines, a.engines)
+	a.enginesMu.Unlock()
+
+	for _, e := range engines {
+		if a.Sockets.On(e) == 0 {
+			continue
+		}
+		if err := e.Broadcast(event, data); err != nil {
+			log.Println("broadcast error:", err)
+		}
+	}
+}
+
+// Patch sends the patch event to the sockets of every live page, see
+// HandlePatch. The pages don't render, their handlers of the event send
+// the regions it changed.
+func (a *App) Patch(event string, data interface{}) {
+	a.enginesMu.Lock()
+	engines := make([]*live.HttpEngine, len(a.engines))
+	copy(engines, a.engines)
+	a.enginesMu.Unlock()
+
+	for _, e := range engines {
+		for _, s := range a.Sockets.Sockets(e) {
+			a.State.Patch(s, event, data)
+		}
+	}
+}
+
+// shutdownTimeout is how long a shutdown waits for the running requests.
+const shutdownTimeout = 10 * time.Second
+
+// ListenAndServe serves the app on the configured address.
+//
+// On SIGINT or SIGTERM it stops accepting requests, waits for the running
+// ones up to shutdownTimeout and closes the database, so the memory store
+// writes its last snapshot.
+func (a *App) ListenAndServe() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{Addr: a.Config.Addr, Handler: a.Router}
+	// The event streams aren't hijacked like the websockets, the shutdown
+	// would wait for them.
+	srv.RegisterOnShutdown(a.Broadcasts.Close)
+	errc := make(chan error, 2)
+	go func() { errc <- srv.ListenAndServe() }()
+	var gs *grpc.Server
+	if a.Config.GRPCAddr != "" {
+		lis, err := net.Listen("tcp", a.Config.GRPCAddr)
+		if err != nil {
+			return fmt.Errorf("could not start the gRPC service: %w", err)
+		}
+		gs = newGRPCServer(a.Setpoints, a.Locales, ctx.Done())
+		go func() { errc <- gs.Serve(lis) }()
+		log.Println("gRPC service listening on", lis.Addr())
+	}
+	go a.Clock.Run(ctx)
+	if a.Config.Telegram.Token != "" {
+		go NewTelegramBot(a.Config.Telegram, a.Setpoints, a.Locales).Run(ctx)
+	}
+	if a.Config.HomeKit.Pin != "" {
+		hk, err := NewHomeKitBridge(ctx, a.Config.HomeKit, a.Setpoints)
+		if err != nil {
+			return err
+		}
+		go func() {
+			if err := hk.ListenAndServe(ctx); err != nil && ctx.Err() == nil {
+				log.Println("homekit:", err)
+			}
+		}()
+	}
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	log.Println("Application is shutting down ...")
+	shutdown, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if gs != nil {
+		gs.GracefulStop()
+	}
+	err := srv.Shutdown(shutdown)
+	// The handlers of the sockets still use the bus and the database.
+	if serr := a.Sockets.Shutdown(shutdown); serr != nil {
+		log.Println("could not close the sockets:", serr)
+	}
+	if a.Tracing != nil {
+		if terr := a.Tracing.Shutdown(shutdown); terr != nil {
+			log.Println("could not flush the spans:", terr)
+		}
+	}
+	if a.Bus != nil {
+		if berr := a.Bus.Close(); berr != nil {
+			log.Println("could not close the bus:", berr)
+		}
+	}
+	if cerr := a.DB.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Page holds the assigns shared by every live page. Page models embed it,
+// so the app wide self events can update any of them.
+type Page struct {
+	Time string
+	// Timezone is the IANA timezone of the user, the clock is shown in it.
+	Timezone string
+	timezone *time.Location
+	// Locale is the language code the page renders in, see Locales.
+	Locale string
+	// Theme is "light" or "dark". It is kept in the session rather than
+	// with the assigns, so it applies to every page.
+	Theme string `json:"-"`
+	// Maintenance is not persisted with the assigns, a notice must not
+	// outlive the drain it announced.
+	Maintenance string `json:"-"`
+	// Error is the message of the last failed event, see renderErrors.
+	Error string `json:"-"`
+	// Flashes are the messages of the flash area, see Flash.
+	Flashes []FlashMessage `json:"-"`
+	// Modal is the open confirmation dialog, see Confirm.
+	Modal *Modal `json:"-"`
+	// Shortcuts are the keyboard shortcuts of the page, see AddShortcut.
+	Shortcuts []Shortcut `json:"-"`
+	// Notifications is the notification dropdown of the navbar.
+	Notifications NotificationCenter `json:"-"`
+	// Invite is the open invitation to the page's room, see Invites.
+	Invite *InviteCode `json:"-"`
+}
+
+func (p *Page) page() *Page { return p }
+
+// location returns the timezone of the user, the server's local time until
+// the page reports it.
+func (p *Page) location() *time.Location {
+	if p.timezone == nil && p.Timezone != "" {
+		if loc, err := time.LoadLocation(p.Timezone); err == nil {
+			p.timezone = loc
+		}
+	}
+	if p.timezone == nil {
+		return time.Local
+	}
+	return p.timezone
+}
+
+// backgroundEvents are sent by the page on its own rather than by the user.
+var backgroundEvents = map[string]bool{
+	"pong":              true,
+	"timezone":          true,
+	"chart-ready":       true,
+	"temp-slider-ready": true,
+	"pad-ready":         true,
+	"map-ready":         true,
+	"draw-ready":        true,
+	"call-ready":        true,
+	"call-signal":       true,
+}
+
+// setTimezone handles the "timezone" event the page sends once connected
+// with the timezone of the browser.
+func setTimezone(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+	m, ok := s.Assigns().(pageModel)
+	if !ok {
+		return s.Assigns(), nil
+	}
+	loc, err := time.LoadLocation(p.String("timezone"))
+	if err != nil {
+		return s.Assigns(), fmt.Errorf("invalid timezone: %w", err)
+	}
+	page := m.page()
+	page.Timezone, page.timezone = loc.String(), loc
+	return s.Assigns(), nil
+}
+
+type pageModel interface {
+	page() *Page
+}
+
+// patchTime returns the patch handler of the time, keeping the time of the
+// page in its timezone. With show, the page shows it in its "time" regions.
+func patchTime(show bool) PatchFunc {
+	return func(ctx context.Context, s live.Socket, data interface{}) (interface{}, Regions, error) {
+		m, ok := s.Assigns().(pageModel)
+		if !ok {
+			return s.Assigns(), nil, nil
+		}
+		p := m.page()
+		p.Time = data.(time.Time).In(p.location()).Format(time.RFC1123)
+		if !show {
+			return m, nil, nil
+		}
+		return m, Regions{"time": p.Time}, nil
+	}
+}
+
+// updatePage adapts a function updating the shared page assigns to a self
+// handler.
+func updatePage(update func(p *Page, data interface{})) live.SelfHandler {
+	return func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		if m, ok := s.Assigns().(pageModel); ok {
+			update(m.page(), data)
+		}
+		return s.Assigns(), nil
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+//go:embed static
+var embeddedStatic embed.FS
+
+// staticAssets are the assets served at /static/.
+var staticAssets = mustLoadAssets()
+
+// Assets are the static files of the app: its CSS, scripts, icons and the
+// client hooks. URLs carry a hash of the content as version, so browsers
+// cache a file for good and fetch it again once it changes.
+//
+// A hook is a script in static/hooks adding itself to window.Hooks under
+// its file name. The layout loads the hooks every page needs and a page
+// loads its own with {{hooks "name" ...}} in its "hooks" block.
+type Assets struct {
+	files map[string]assetFile
+}
+
+type assetFile struct {
+	content []byte
+	version string
+}
+
+// LoadAssets loads the files in the static directory of fsys.
+func LoadAssets(fsys fs.FS) (*Assets, error) {
+	a := &Assets{files: map[string]assetFile{}}
+	err := fs.WalkDir(fsys, "static", func(file string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(content)
+		a.files[strings.TrimPrefix(file, "static/")] = assetFile{content: content, version: hex.EncodeToString(sum[:])[:12]}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func mustLoadAssets() *Assets {
+	a, err := LoadAssets(embeddedStatic)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// URL returns the versioned URL of the named asset.
+func (a *Assets) URL(name string) (string, error) {
+	f, ok := a.files[name]
+	if !ok {
+		return "", fmt.Errorf("unknown asset %q", name)
+	}
+	return "/static/" + name + "?v=" + f.version, nil
+}
+
+// Hooks returns the script tags loading the named hooks. They have to come
+// after app.js defines window.Hooks and before the page loads.
+func (a *Assets) Hooks(names ...string) (template.HTML, error) {
+	var b strings.Builder
+	for _, name := range names {
+		url, err := a.URL("hooks/" + name + ".js")
+		if err != nil {
+			return "", fmt.Errorf("unknown hook %q", name)
+		}
+		fmt.Fprintf(&b, "<script src=\"%s\"></script>\n", template.HTMLEscapeString(url))
+	}
+	return template.HTML(b.String()), nil
+}
+
+// ServeHTTP serves an asset at its path under /static/. Requests for the
+// current version may be cached for good, any other is revalidated.
+func (a *Assets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.serve(w, r, strings.TrimPrefix(r.URL.Path, "/static/"))
+}
+
+// Favicon serves the icon of the app at /favicon.ico, for the browsers
+// asking for it without looking at the page.
+func (a *Assets) Favicon(w http.ResponseWriter, r *http.Request) {
+	a.serve(w, r, "favicon.svg")
+}
+
+func (a *Assets) serve(w http.ResponseWriter, r *http.Request, name string) {
+	f, ok := a.files[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.URL.Query().Get("v") == f.version {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.Header().Set("ETag", `"`+f.version+`"`)
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(f.content))
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jfyne/live"
+
+	"my-app.com/live/store"
+)
+
+const (
+	// auditPageSize is the number of entries the audit page shows at once.
+	auditPageSize = 25
+	// auditAddedEvent is the self event telling the audit pages about a new
+	// entry.
+	auditAddedEvent = "audit-added"
+)
+
+// The actions of the audit log.
+const (
+	AuditSetpoint         = "setpoint"
+	AuditZoneAdd          = "zone-add"
+	AuditSocketMessage    = "socket-message"
+	AuditSocketDisconnect = "socket-disconnect"
+	AuditNotice           = "notice"
+	AuditMaintenance      = "maintenance"
+	AuditNotify           = "notify"
+	AuditPoll             = "poll"
+	AuditWebhookRetry     = "webhook-retry"
+	AuditImport           = "import"
+	AuditRule             = "rule"
+)
+
+// auditActions are the actions the audit page filters by.
+var auditActions = []string{
+	AuditSetpoint, AuditZoneAdd, AuditSocketMessage, AuditSocketDisconnect,
+	AuditNotice, AuditMaintenance, AuditNotify, AuditPoll, AuditWebhookRetry,
+	AuditImport, AuditRule,
+}
+
+// Audit records who changed what in the audit log of the store: the
+// setpoints of the temperature controls, the zones of the setup wizard and
+// the moderation actions of the admin. The actor is the admin user on the
+// admin routes, the name of the user of the session otherwise.
+type Audit struct {
+	repo  store.AuditRepo
+	users store.UserRepo
+
+	mu      sync.Mutex
+	engines []*live.HttpEngine
+}
+
+// NewAudit creates an audit log appending to repo, naming the users from
+// users.
+func NewAudit(repo store.AuditRepo, users store.UserRepo) *Audit {
+	return &Audit{repo: repo, users: users}
+}
+
+// Watch has the sockets of engine told about every new entry, see
+// auditAddedEvent.
+func (a *Audit) Watch(engine *live.HttpEngine) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.engines = append(a.engines, engine)
+}
+
+// Record logs an action of the user of s. A failure is logged but doesn't
+// fail the action.
+func (a *Audit) Record(ctx context.Context, s live.Socket, action, target, detail string) {
+	session := live.SessionID(s.Session())
+	a.add(ctx, store.AuditEntry{Actor: a.actor(ctx, live.Request(ctx), session), Session: session, Action: action, Target: target, Detail: detail})
+}
+
+// RecordRequest logs an action of the admin routes.
+func (a *Audit) RecordRequest(r *http.Request, action, target, detail string) {
+	a.RecordAs(r.Context(), a.actor(r.Context(), r, ""), "", action, target, detail)
+}
+
+// RecordAs logs an action of the named actor, made outside of the pages
+// and the admin routes.
+func (a *Audit) RecordAs(ctx context.Context, actor, session, action, target, detail string) {
+	a.add(ctx, store.AuditEntry{Actor: actor, Session: session, Action: action, Target: target, Detail: detail})
+}
+
+func (a *Audit) add(ctx context.Context, e store.AuditEntry) {
+	e.Time = time.Now()
+	if _, err := a.repo.Add(ctx, e); err != nil {
+		log.Printf("could not audit the %s of %q: %v", e.Action, e.Target, err)
+		return
+	}
+	a.mu.Lock()
+	engines := append([]*live.HttpEngine(nil), a.engines...)
+	a.mu.Unlock()
+	for _, engine := range engines {
+		if err := engine.Broadcast(auditAddedEvent, nil); err != nil {
+			log.Println("broadcast error:", err)
+		}
+	}
+}
+
+// actor names the user of a request: the admin user behind basic auth, the
+// user of session, or a guest.
+func (a *Audit) actor(ctx context.Context, r *http.Request, session string) string {
+	if r != nil {
+		if user, _, ok := r.BasicAuth(); ok {
+			return user
+		}
+	}
+	if session != "" {
+		if u, err := a.users.Get(ctx, session); err == nil && u.Name != "" {
+			return u.Name
+		}
+	}
+	return "guest"
+}
+
+// Middleware is the event middleware auditing the setpoint changes of the
+// temperature controls, on every page with TempControls.
+func (a *Audit) Middleware(kind, event string, next EventFunc) EventFunc {
+	if kind != "event" || !tempControlEvents[event] {
+		return next
+	}
+	return func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		id := data.(live.Params).String("id")
+		// The control is changed in place, its setpoint is kept first.
+		var from float32
+		if m, ok := s.Assigns().(TempControls); ok {
+			if c := m.TempControl(id); c != nil {
+				from = c.Temperature
+			}
+		}
+		result, err := next(ctx, s, data)
+		if m, ok := result.(TempControls); ok && err == nil {
+			if c := m.TempControl(id); c != nil && c.Temperature != from {
+				a.Record(ctx, s, AuditSetpoint, c.Zone, fmt.Sprintf("%.1f → %.1f", from, c.Temperature))
+			}
+		}
+		return result, err
+	}
+}
+
+// AuditModel is the model of the admin audit page.
+type AuditModel struct {
+	Page
+	Filter  store.AuditFilter
+	Actions []string
+	Pages   Pager
+	// Entries are the entries of the page shown, Total the number of
+	// entries the filter selects.
+	Entries []store.AuditEntry `json:"-"`
+	Total   int
+}
+
+func auditModel(s live.Socket) *AuditModel {
+	if m, ok := s.Assigns().(*AuditModel); ok {
+		return m
+	}
+	return &AuditModel{Actions: auditActions, Pages: Pager{ID: "audit", Page: 1, Size: auditPageSize}}
+}
+
+// Pager returns the pager of the entries.
+func (m *AuditModel) Pager(id string) *Pager {
+	if m.Pages.ID == id {
+		return &m.Pages
+	}
+	return nil
+}
+
+// View is the page of the entries shown.
+func (m *AuditModel) View() PageView {
+	return m.Pages.View(m.Total)
+}
+
+// load reads the entries of the page shown from repo. A page past the end,
+// as the filter changed, shows the last page instead.
+func (m *AuditModel) load(ctx context.Context, repo store.AuditRepo) error {
+	if m.Pages.Page < 1 {
+		m.Pages.Page = 1
+	}
+	entries, total, err := repo.List(ctx, m.Filter, (m.Pages.Page-1)*m.Pages.Size, m.Pages.Size)
+	if err == nil && len(entries) == 0 && total > 0 {
+		m.Pages.Page = m.Pages.View(total).Page
+		entries, total, err = repo.List(ctx, m.Filter, (m.Pages.Page-1)*m.Pages.Size, m.Pages.Size)
+	}
+	if err != nil {
+		return fmt.Errorf("could not load the audit log: %w", err)
+	}
+	m.Entries, m.Total = entries, total
+	return nil
+}
+
+// newAuditPage creates the admin page listing the audit log, newest first,
+// filtered by actor, action and target. ?actor=, ?action= and ?target=
+// set the filter when it opens. The page follows the new entries.
+func newAuditPage(app *App, repo store.AuditRepo) *Handler {
+	h := app.NewHandler()
+	h.HandleRender(app.Render("audit.html"))
+	h.HandleMount(func(ctx context.Context, s live.Socket) (interface{}, error) {
+		m := auditModel(s)
+		if r := live.Request(ctx); r != nil {
+			q := r.URL.Query()
+			m.Filter = store.AuditFilter{Actor: strings.TrimSpace(q.Get("actor")), Action: q.Get("action"), Target: strings.TrimSpace(q.Get("target"))}
+		}
+		return m, m.load(ctx, repo)
+	})
+	h.HandleThrottled("audit-filter", 250*time.Millisecond, func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := auditModel(s)
+		m.Filter = store.AuditFilter{Actor: strings.TrimSpace(p.String("actor")), Action: p.String("action"), Target: strings.TrimSpace(p.String("target"))}
+		m.Pages.Page = 1
+		return m, m.load(ctx, repo)
+	})
+	// The pages are read from the store, paginate loads the one it shows.
+	h.HandleEvent("paginate", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		if _, err := paginate(ctx, s, p); err != nil {
+			return s.Assigns(), err
+		}
+		m := auditModel(s)
+		return m, m.load(ctx, repo)
+	})
+	h.HandleSelf(auditAddedEvent, func(ctx context.Context, s live.Socket, _ interface{}) (interface{}, error) {
+		m := auditModel(s)
+		return m, m.load(ctx, repo)
+	})
+	return h
+}
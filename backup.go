@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"my-app.com/live/store"
+)
+
+// backupPrefix starts the names of the backup archives, the time they were
+// made follows.
+const backupPrefix = "live-backup-"
+
+// writeBackup writes a backup of repos to a new timestamped archive in dir.
+// The archive only appears once it's complete.
+func writeBackup(ctx context.Context, repos store.Repos, dir string) (string, store.Manifest, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", store.Manifest{}, err
+	}
+	path := filepath.Join(dir, backupPrefix+time.Now().UTC().Format("20060102-150405")+".tar.gz")
+	tmp, err := os.CreateTemp(dir, ".backup-*")
+	if err != nil {
+		return "", store.Manifest{}, err
+	}
+	defer os.Remove(tmp.Name())
+	m, err := store.Backup(ctx, repos, tmp)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", m, fmt.Errorf("could not back up: %w", err)
+	}
+	return path, m, os.Rename(tmp.Name(), path)
+}
+
+// pruneBackups removes the oldest archives of dir but keep. The names sort
+// by time.
+func pruneBackups(dir string, keep int) error {
+	matches, err := filepath.Glob(filepath.Join(dir, backupPrefix+"*.tar.gz"))
+	if err != nil || len(matches) <= keep {
+		return err
+	}
+	sort.Strings(matches)
+	for _, old := range matches[:len(matches)-keep] {
+		if err := os.Remove(old); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runBackups writes a backup every interval, keeping the latest keep,
+// until ctx is done.
+func runBackups(ctx context.Context, repos store.Repos, dir string, interval time.Duration, keep int) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			path, m, err := writeBackup(ctx, repos, dir)
+			if err != nil {
+				log.Println("backup error:", err)
+				continue
+			}
+			log.Println("backup written to", path, backupCounts(m))
+			if err := pruneBackups(dir, keep); err != nil {
+				log.Println("could not remove the old backups:", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// backupCounts describes the contents of an archive.
+func backupCounts(m store.Manifest) string {
+	var counts []string
+	for name, n := range m.Counts {
+		counts = append(counts, fmt.Sprintf("%s %d", strings.TrimSuffix(name, ".jsonl"), n))
+	}
+	sort.Strings(counts)
+	return strings.Join(counts, ", ")
+}
+
+// backup is the backup command, it writes an archive of the database of
+// the flags to --backup-dir. An embedded database has to be closed by the
+// server first, or backed up with --backup-interval.
+//
+//	live backup --db live.db --backup-dir backups
+func backup(args []string) error {
+	cfg, err := LoadConfig(args)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	db, err := openDatabase(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if n, err := db.Pending(ctx); err != nil {
+		return err
+	} else if n > 0 {
+		return fmt.Errorf("the database has %d pending migrations, start the server once first", n)
+	}
+	path, m, err := writeBackup(ctx, db.Repos(), cfg.BackupDir)
+	if err != nil {
+		return err
+	}
+	fmt.Println("backup written to", path+":", backupCounts(m))
+	return nil
+}
+
+// restore is the restore command, it loads an archive of backup into the
+// empty database of the flags.
+//
+//	live restore --db new.db backups/live-backup-20240101-120000.tar.gz
+func restore(args []string) error {
+	cfg, err := LoadConfig(args)
+	if err != nil {
+		return err
+	}
+	if len(cfg.Args) != 1 {
+		return fmt.Errorf("usage: live restore [flags] archive")
+	}
+	f, err := os.Open(cfg.Args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	ctx := context.Background()
+	db, err := openDatabase(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := db.Migrate(ctx); err != nil {
+		return err
+	}
+	m, err := store.Restore(ctx, db.Repos(), f)
+	if err != nil {
+		return fmt.Errorf("could not restore %s: %w", cfg.Args[0], err)
+	}
+	fmt.Printf("restored the backup of %s: %s\n", m.Created.Format(time.RFC3339), backupCounts(m))
+	return nil
+}
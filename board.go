@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jfyne/live"
+)
+
+// boardForm validates the form adding a card.
+var boardForm = Form{
+	"title": {Required(), Length(1, 120)},
+}
+
+// Card is a card on the board.
+type Card struct {
+	ID    int
+	Title string
+}
+
+// Column is a column of the board and its cards, top first.
+type Column struct {
+	ID    string
+	Title string
+	Cards []Card
+}
+
+// Board is the kanban board shared by every user of the board page.
+type Board struct {
+	mu      sync.Mutex
+	columns []Column
+	nextID  int
+}
+
+// NewBoard creates a board with the usual three columns.
+func NewBoard() *Board {
+	return &Board{columns: []Column{
+		{ID: "todo", Title: "To do"},
+		{ID: "doing", Title: "Doing"},
+		{ID: "done", Title: "Done"},
+	}}
+}
+
+// Columns returns a copy of the columns.
+func (b *Board) Columns() []Column {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	columns := make([]Column, len(b.columns))
+	for i, c := range b.columns {
+		columns[i] = c
+		columns[i].Cards = append([]Card(nil), c.Cards...)
+	}
+	return columns
+}
+
+// Add puts a new card at the bottom of a column.
+func (b *Board) Add(column, title string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.column(column)
+	if c == nil {
+		return fmt.Errorf("unknown column %q", column)
+	}
+	b.nextID++
+	c.Cards = append(c.Cards, Card{ID: b.nextID, Title: title})
+	return nil
+}
+
+// Move puts a card at index of a column, at the bottom when the index is
+// past the end.
+func (b *Board) Move(id int, column string, index int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	to := b.column(column)
+	if to == nil {
+		return fmt.Errorf("unknown column %q", column)
+	}
+	card, ok := b.take(id)
+	if !ok {
+		return fmt.Errorf("unknown card %d", id)
+	}
+	if index < 0 || index > len(to.Cards) {
+		index = len(to.Cards)
+	}
+	to.Cards = append(to.Cards[:index], append([]Card{card}, to.Cards[index:]...)...)
+	return nil
+}
+
+// Delete removes a card.
+func (b *Board) Delete(id int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.take(id); !ok {
+		return fmt.Errorf("unknown card %d", id)
+	}
+	return nil
+}
+
+func (b *Board) column(id string) *Column {
+	for i := range b.columns {
+		if b.columns[i].ID == id {
+			return &b.columns[i]
+		}
+	}
+	return nil
+}
+
+// take removes a card from its column and returns it.
+func (b *Board) take(id int) (Card, bool) {
+	for i := range b.columns {
+		c := &b.columns[i]
+		for j, card := range c.Cards {
+			if card.ID == id {
+				c.Cards = append(c.Cards[:j], c.Cards[j+1:]...)
+				return card, true
+			}
+		}
+	}
+	return Card{}, false
+}
+
+// BoardModel is the model of the board page.
+type BoardModel struct {
+	Page
+	Columns []Column
+	// Errors are the errors of the form adding a card.
+	Errors Errors `json:"-"`
+}
+
+func boardModel(s live.Socket) *BoardModel {
+	if m, ok := s.Assigns().(*BoardModel); ok {
+		return m
+	}
+	return &BoardModel{}
+}
+
+// newBoardPage creates the board live handler. Every change is broadcast,
+// so all viewers see the same board.
+func newBoardPage(app *App, board *Board) *Handler {
+	// changed refreshes the board of the socket and tells the others.
+	changed := func(s live.Socket, err error) (interface{}, error) {
+		m := boardModel(s)
+		if err != nil {
+			return m, err
+		}
+		m.Columns = board.Columns()
+		s.Broadcast("board", nil)
+		return m, nil
+	}
+
+	h := app.NewHandler()
+	h.HandleRender(app.Render("board.html"))
+	h.HandleMount(func(ctx context.Context, s live.Socket) (interface{}, error) {
+		m := boardModel(s)
+		m.Columns = board.Columns()
+		return m, nil
+	})
+	h.HandleEvent("board-add", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := boardModel(s)
+		if m.Errors = boardForm.Validate(p); len(m.Errors) > 0 {
+			return m, nil
+		}
+		return changed(s, board.Add(p.String("column"), strings.TrimSpace(p.String("title"))))
+	})
+	// The board hook sends board-move when a card is dropped.
+	h.HandleEvent("board-move", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		return changed(s, board.Move(p.Int("card"), p.String("column"), p.Int("index")))
+	})
+	h.HandleEvent("board-delete", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		return changed(s, board.Delete(p.Int("card")))
+	})
+	h.HandleSelf("board", func(ctx context.Context, s live.Socket, _ interface{}) (interface{}, error) {
+		m := boardModel(s)
+		m.Columns = board.Columns()
+		return m, nil
+	})
+	return h
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"sync"
+)
+
+// Broadcast is a self event sent to every socket of a page.
+type Broadcast struct {
+	// Page names the page, "thermostat" or "dashboard".
+	Page  string
+	Event string
+	Data  interface{}
+}
+
+// Broadcasts is the bus of the broadcasts of the pages, for the streams
+// outside of them such as /events. A page broadcasts through On, which
+// sends to its sockets as before and publishes on the bus.
+type Broadcasts struct {
+	mu     sync.Mutex
+	subs   map[chan Broadcast]struct{}
+	closed bool
+}
+
+// NewBroadcasts creates an empty bus.
+func NewBroadcasts() *Broadcasts {
+	return &Broadcasts{subs: map[chan Broadcast]struct{}{}}
+}
+
+// On returns a Broadcaster of page sending to to, a socket or an engine,
+// and publishing on the bus.
+func (b *Broadcasts) On(page string, to Broadcaster) Broadcaster {
+	return pageBroadcaster{bus: b, page: page, to: to}
+}
+
+type pageBroadcaster struct {
+	bus  *Broadcasts
+	page string
+	to   Broadcaster
+}
+
+func (p pageBroadcaster) Broadcast(event string, data interface{}) error {
+	p.bus.publish(Broadcast{Page: p.page, Event: event, Data: data})
+	return p.to.Broadcast(event, data)
+}
+
+func (b *Broadcasts) publish(msg Broadcast) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+// Subscribe returns the broadcasts until cancel is called. A subscriber
+// falling behind misses broadcasts, like the watchers of Setpoints. The
+// channel is closed by cancel and Close.
+func (b *Broadcasts) Subscribe() (broadcasts <-chan Broadcast, cancel func()) {
+	ch := make(chan Broadcast, watchBuffer)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	b.subs[ch] = struct{}{}
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Close ends the subscriptions, their channels are closed.
+func (b *Broadcasts) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.subs {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// busTimeout bounds the connection to the bus, and a publish.
+const busTimeout = 5 * time.Second
+
+// The transports of the bus.
+const (
+	BusNATS  = "nats"
+	BusMQTT  = "mqtt"
+	BusKafka = "kafka"
+)
+
+// busTransports are the transports --bus selects from.
+var busTransports = []string{BusNATS, BusMQTT, BusKafka}
+
+// BusMessage is a message of the bus.
+type BusMessage struct {
+	Subject string
+	Data    []byte
+	// Header carries the trace context, where the transport has headers.
+	Header http.Header
+}
+
+// Subscription is a subscription to a subject of the bus.
+type Subscription interface {
+	Unsubscribe() error
+}
+
+// Bus is the message bus between the instances and the devices, NATS, MQTT
+// or Kafka as --bus selects. The subjects are named like those of NATS,
+// "devices.positions"; the handlers don't see the transport, publishTraced
+// and subscribeTraced encode the messages for them.
+type Bus interface {
+	Publish(ctx context.Context, msg BusMessage) error
+	// Subscribe calls handler with the messages of subject until the
+	// subscription is unsubscribed.
+	Subscribe(subject string, handler func(BusMessage)) (Subscription, error)
+	Close() error
+}
+
+// openBus connects to the bus of cfg.
+func openBus(cfg Config) (Bus, error) {
+	switch cfg.Bus {
+	case BusMQTT:
+		return newMQTTBus(cfg.MQTTURL)
+	case BusKafka:
+		return newKafkaBus(cfg.KafkaBrokers, cfg.KafkaGroup)
+	default:
+		return newNATSBus(cfg.NatsURL)
+	}
+}
+
+// busURL returns the URL of the server of the bus of cfg.
+func busURL(cfg Config) string {
+	switch cfg.Bus {
+	case BusMQTT:
+		return cfg.MQTTURL
+	case BusKafka:
+		return strings.Join(cfg.KafkaBrokers, ",")
+	}
+	return cfg.NatsURL
+}
+
+// natsBus is the bus over a NATS connection.
+type natsBus struct {
+	nc *nats.Conn
+}
+
+func newNATSBus(url string) (*natsBus, error) {
+	nc, err := nats.Connect(url, nats.Timeout(busTimeout))
+	if err != nil {
+		return nil, err
+	}
+	return &natsBus{nc: nc}, nil
+}
+
+func (b *natsBus) Publish(ctx context.Context, msg BusMessage) error {
+	m := nats.NewMsg(msg.Subject)
+	m.Data = msg.Data
+	for k, v := range msg.Header {
+		m.Header[k] = v
+	}
+	return b.nc.PublishMsg(m)
+}
+
+func (b *natsBus) Subscribe(subject string, handler func(BusMessage)) (Subscription, error) {
+	return b.nc.Subscribe(subject, func(m *nats.Msg) {
+		handler(BusMessage{Subject: m.Subject, Data: m.Data, Header: http.Header(m.Header)})
+	})
+}
+
+func (b *natsBus) Close() error {
+	return b.nc.Drain()
+}
+
+// busFanout spreads the messages of a subject to the subscriptions of the
+// instance, for the transports with a single handler per subject. The
+// first subscription to a subject subscribes to the transport with
+// subscribe, the last one to go unsubscribes with unsubscribe.
+type busFanout struct {
+	subscribe   func(subject string) error
+	unsubscribe func(subject string) error
+
+	mu       sync.Mutex
+	last     int
+	handlers map[string]map[int]func(BusMessage)
+}
+
+func newBusFanout(subscribe, unsubscribe func(subject string) error) *busFanout {
+	return &busFanout{subscribe: subscribe, unsubscribe: unsubscribe, handlers: map[string]map[int]func(BusMessage){}}
+}
+
+// Subscribe adds handler to the handlers of subject.
+func (f *busFanout) Subscribe(subject string, handler func(BusMessage)) (Subscription, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.handlers[subject]) == 0 {
+		if err := f.subscribe(subject); err != nil {
+			return nil, fmt.Errorf("could not subscribe to %s: %w", subject, err)
+		}
+		f.handlers[subject] = map[int]func(BusMessage){}
+	}
+	f.last++
+	f.handlers[subject][f.last] = handler
+	return fanoutSubscription{f: f, subject: subject, id: f.last}, nil
+}
+
+// deliver calls the handlers of the subject of msg.
+func (f *busFanout) deliver(msg BusMessage) {
+	f.mu.Lock()
+	handlers := make([]func(BusMessage), 0, len(f.handlers[msg.Subject]))
+	for _, h := range f.handlers[msg.Subject] {
+		handlers = append(handlers, h)
+	}
+	f.mu.Unlock()
+	for _, h := range handlers {
+		h(msg)
+	}
+}
+
+type fanoutSubscription struct {
+	f       *busFanout
+	subject string
+	id      int
+}
+
+func (s fanoutSubscription) Unsubscribe() error {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	handlers, ok := s.f.handlers[s.subject]
+	if _, subscribed := handlers[s.id]; !ok || !subscribed {
+		return nil
+	}
+	delete(handlers, s.id)
+	if len(handlers) > 0 {
+		return nil
+	}
+	delete(s.f.handlers, s.subject)
+	return s.f.unsubscribe(s.subject)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jfyne/live"
+)
+
+// callMaxSignal is the largest SDP or ICE candidate relayed, in bytes. An
+// offer with audio and video is a few kilobytes.
+const callMaxSignal = 16 << 10
+
+// callSignalKinds are the signals peers exchange.
+var callSignalKinds = map[string]bool{"offer": true, "answer": true, "candidate": true}
+
+// errCallFull is returned when joining a room with two peers in it.
+var errCallFull = errors.New("call: the room is full")
+
+// callPeer is a socket in a call room.
+type callPeer struct {
+	id     string
+	socket live.Socket
+}
+
+// CallSignal is relayed from a peer to the other one.
+type CallSignal struct {
+	Kind string `json:"kind"`
+	// Data is the JSON of the session description or ICE candidate, the
+	// server doesn't look into it.
+	Data string `json:"data"`
+}
+
+// CallRooms pairs the sockets of the call page by room, two per room, so
+// the server can relay the signals of one peer to the other only.
+type CallRooms struct {
+	mu    sync.Mutex
+	rooms map[string][]callPeer
+}
+
+// NewCallRooms creates empty call rooms.
+func NewCallRooms() *CallRooms {
+	return &CallRooms{rooms: map[string][]callPeer{}}
+}
+
+// Join adds s to room and returns the peer already in it, nil if s is
+// alone.
+func (c *CallRooms) Join(room string, s live.Socket) (live.Socket, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	peers := c.rooms[room]
+	for _, p := range peers {
+		if p.id == string(s.ID()) {
+			// Joined already, the hook mounted again.
+			return c.peer(room, s), nil
+		}
+	}
+	if len(peers) >= 2 {
+		return nil, errCallFull
+	}
+	c.rooms[room] = append(peers, callPeer{id: string(s.ID()), socket: s})
+	if len(peers) == 1 {
+		return peers[0].socket, nil
+	}
+	return nil, nil
+}
+
+// Leave removes s from room and returns the peer left in it, if any.
+func (c *CallRooms) Leave(room string, s live.Socket) live.Socket {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var left []callPeer
+	for _, p := range c.rooms[room] {
+		if p.id != string(s.ID()) {
+			left = append(left, p)
+		}
+	}
+	if len(left) == 0 {
+		delete(c.rooms, room)
+		return nil
+	}
+	c.rooms[room] = left
+	return left[0].socket
+}
+
+// Peer returns the other socket in the room of s.
+func (c *CallRooms) Peer(room string, s live.Socket) live.Socket {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.peer(room, s)
+}
+
+func (c *CallRooms) peer(room string, s live.Socket) live.Socket {
+	for _, p := range c.rooms[room] {
+		if p.id != string(s.ID()) {
+			return p.socket
+		}
+	}
+	return nil
+}
+
+// CallModel is the model of the call page. The video elements belong to
+// the call hook, the server only relays the signals.
+type CallModel struct {
+	Page
+	Room string
+	// Peer reports whether another socket is in the room.
+	Peer bool
+	// Full is set when the room had two peers already.
+	Full bool
+}
+
+func callModel(s live.Socket) *CallModel {
+	if m, ok := s.Assigns().(*CallModel); ok {
+		return m
+	}
+	return &CallModel{}
+}
+
+// newCall creates the handler of the call page, a WebRTC call between the
+// two sockets of a room, /call?room=name. The live socket is the
+// signaling channel: the hook sends its offer, answer and ICE candidates
+// with call-signal and the server hands them to the other peer of the
+// room as a self event. Once the hook of the second peer is ready, the
+// first one is told to make the offer.
+func newCall(app *App, rooms *CallRooms) *Handler {
+	h := app.NewHandler()
+	h.HandleRender(app.Render("call.html"))
+	h.HandleMount(func(ctx context.Context, s live.Socket) (interface{}, error) {
+		m := callModel(s)
+		m.Room = strings.TrimSpace(live.Request(ctx).URL.Query().Get("room"))
+		if m.Room == "" || Slug()(m.Room) != nil || len(m.Room) > 40 {
+			m.Room = "lobby"
+		}
+		if s.Connected() {
+			go func() {
+				<-ctx.Done()
+				if peer := rooms.Leave(m.Room, s); peer != nil {
+					app.State.Send(peer, "call-peer", false)
+				}
+			}()
+		}
+		return m, nil
+	})
+
+	// The socket joins the room once its hook is ready for the signals, a
+	// change made while mounting the connected socket isn't rendered.
+	h.HandleEvent("call-ready", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := callModel(s)
+		peer, err := rooms.Join(m.Room, s)
+		if errors.Is(err, errCallFull) {
+			m.Full = true
+			return m, nil
+		}
+		m.Peer = peer != nil
+		if peer != nil {
+			app.State.Send(peer, "call-peer", true)
+		}
+		// The hook waits for the offer of the peer who was there first.
+		return m, s.Send("call-peer", map[string]bool{"peer": m.Peer, "offer": false})
+	})
+	h.HandleEvent("call-start", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := callModel(s)
+		if rooms.Peer(m.Room, s) == nil {
+			return m, fmt.Errorf("nobody to call")
+		}
+		return m, s.Send("call-peer", map[string]bool{"peer": true, "offer": true})
+	})
+	h.HandleEvent("call-signal", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := callModel(s)
+		signal := CallSignal{Kind: p.String("kind"), Data: p.String("data")}
+		if !callSignalKinds[signal.Kind] {
+			return m, fmt.Errorf("unknown signal %q", signal.Kind)
+		}
+		if len(signal.Data) > callMaxSignal {
+			return m, fmt.Errorf("the %s is too large", signal.Kind)
+		}
+		peer := rooms.Peer(m.Room, s)
+		if peer == nil {
+			return m, fmt.Errorf("nobody to call")
+		}
+		app.State.Send(peer, "call-signal", signal)
+		return m, nil
+	})
+	h.HandleEvent("call-hangup", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := callModel(s)
+		if peer := rooms.Peer(m.Room, s); peer != nil {
+			app.State.Send(peer, "call-hangup", nil)
+		}
+		return m, s.Send("call-hangup", nil)
+	})
+
+	app.Invites.handle(h, func(ctx context.Context, s live.Socket) string {
+		return "/call?room=" + callModel(s).Room
+	})
+
+	h.HandleSelf("call-peer", func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		m := callModel(s)
+		m.Peer = data.(bool)
+		// The peer who was there first makes the offer.
+		return m, s.Send("call-peer", map[string]bool{"peer": m.Peer, "offer": m.Peer})
+	})
+	h.HandleSelf("call-signal", func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		return s.Assigns(), s.Send("call-signal", data)
+	})
+	h.HandleSelf("call-hangup", func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		return s.Assigns(), s.Send("call-hangup", nil)
+	})
+	return h
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jfyne/live"
+)
+
+// Reading is a temperature at a point in time.
+type Reading struct {
+	Time  time.Time
+	Value float32
+}
+
+// chartPoint is a data point as the chart hook receives it.
+type chartPoint struct {
+	Chart string  `json:"chart"`
+	Time  int64   `json:"t"`
+	Value float32 `json:"v"`
+}
+
+func newChartPoint(chart string, r Reading) chartPoint {
+	return chartPoint{Chart: chart, Time: r.Time.UnixMilli(), Value: r.Value}
+}
+
+// PushPoint appends a reading to the chart hook with the given ID. The
+// chart is drawn by the page, so nothing is re-rendered.
+func PushPoint(s live.Socket, chart string, r Reading) error {
+	return s.Send("chart-point", newChartPoint(chart, r))
+}
+
+// SendChart replaces the data of the chart hook with the given ID. The hook
+// asks for it with a "chart-ready" event once mounted.
+func SendChart(s live.Socket, chart string, readings []Reading) error {
+	points := make([]chartPoint, len(readings))
+	for i, r := range readings {
+		points[i] = newChartPoint(chart, r)
+	}
+	return s.Send("chart-points", map[string]interface{}{
+		"chart":  chart,
+		"points": points,
+	})
+}
+
+// sparkline returns the SVG path of readings scaled to a width x height
+// box, for the "sparkline" template func. Higher values are drawn higher,
+// a flat history as a line across the middle.
+func sparkline(readings []Reading, width, height float64) string {
+	if len(readings) == 0 {
+		return ""
+	}
+	min, max := readings[0].Value, readings[0].Value
+	for _, r := range readings {
+		if r.Value < min {
+			min = r.Value
+		}
+		if r.Value > max {
+			max = r.Value
+		}
+	}
+	span := float64(max - min)
+	step := 0.0
+	if len(readings) > 1 {
+		step = width / float64(len(readings)-1)
+	}
+
+	var b strings.Builder
+	for i, r := range readings {
+		x := float64(i) * step
+		y := height / 2
+		if span > 0 {
+			y = height - float64(r.Value-min)/span*height
+		}
+		if i == 0 {
+			fmt.Fprintf(&b, "M%.1f,%.1f", x, y)
+		} else {
+			fmt.Fprintf(&b, " L%.1f,%.1f", x, y)
+		}
+	}
+	return b.String()
+}
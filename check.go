@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// check is a single startup self-check.
+type check struct {
+	name string
+	run  func(cfg Config) error
+}
+
+// errSkipped is returned by checks of features that are not configured.
+var errSkipped = errors.New("not configured")
+
+// checks are run by `serve --check` before deploying.
+var checks = []check{
+	{"configuration", checkConfig},
+	{"templates", checkTemplates},
+	{"bus", checkBus},
+	{"redis", checkRedis},
+	{"storage migrations", checkMigrations},
+}
+
+// selfCheck runs every check, reporting each result to w. It returns an
+// error when any of them failed.
+func selfCheck(cfg Config, w io.Writer) error {
+	failed := 0
+	for _, c := range checks {
+		err := c.run(cfg)
+		if errors.Is(err, errSkipped) {
+			fmt.Fprintf(w, "skip  %s: %v\n", c.name, err)
+			continue
+		}
+		if err != nil {
+			failed++
+			fmt.Fprintf(w, "FAIL  %s: %v\n", c.name, err)
+			continue
+		}
+		fmt.Fprintf(w, "ok    %s\n", c.name)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
+
+func checkConfig(cfg Config) error {
+	if _, _, err := net.SplitHostPort(cfg.Addr); err != nil {
+		return fmt.Errorf("invalid --addr: %w", err)
+	}
+	if cfg.SessionSecret == "" {
+		return errors.New("--session-secret is empty")
+	}
+	k := cfg.Keepalive
+	if k.PingInterval < 0 || k.PongTimeout < 0 || k.WriteTimeout < 0 {
+		return errors.New("keepalive durations must not be negative")
+	}
+	if k.MaxMessageSize < 0 {
+		return errors.New("--max-message-size must not be negative")
+	}
+	if cfg.IdleTimeout < 0 {
+		return errors.New("--idle-timeout must not be negative")
+	}
+	if cfg.MaxSockets < 0 {
+		return errors.New("--max-sockets must not be negative")
+	}
+	return nil
+}
+
+// checkTemplates parses every template.
+func checkTemplates(cfg Config) error {
+	return NewTemplates(templateFS(cfg), false, mustLoadLocales()).ParseAll()
+}
+
+// checkBus connects to the bus of --bus.
+func checkBus(cfg Config) error {
+	bus, err := openBus(cfg)
+	if err != nil {
+		return fmt.Errorf("could not connect to %s: %w", busURL(cfg), err)
+	}
+	return bus.Close()
+}
+
+func checkRedis(cfg Config) error {
+	if cfg.RedisURL == "" {
+		return errSkipped
+	}
+	opts, err := redis.ParseURL(cfg.RedisURL)
+	if err != nil {
+		return err
+	}
+	rdb := redis.NewClient(opts)
+	defer rdb.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return rdb.Ping(ctx).Err()
+}
+
+// checkMigrations verifies the database can be opened and its schema is
+// one this build can migrate. Pending migrations are fine, the server
+// applies them when it starts.
+func checkMigrations(cfg Config) error {
+	if cfg.DatabaseURL == "" && cfg.DBPath == "" {
+		return errSkipped
+	}
+	if cfg.DatabaseURL == "" {
+		if _, err := os.Stat(cfg.DBPath); errors.Is(err, os.ErrNotExist) {
+			// Created on the first start.
+			return nil
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	db, err := openDatabase(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	_, err = db.Pending(ctx)
+	return err
+}
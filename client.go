@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const clientUsage = `usage: live client [flags] command [args]
+
+commands:
+  zones                   list the zones and their setpoints
+  get ZONE                show the setpoint of a zone
+  set ZONE TEMPERATURE    set the setpoint of a zone, see --confirm
+  up ZONE, down ZONE      move the setpoint of a zone by 0.1 °C
+  say NAME MESSAGE...     send a message to the thermostat chat
+  tail [ZONE]             follow the status feeds and the setpoint changes
+
+flags:
+`
+
+// apiClient calls the API of a running server.
+type apiClient struct {
+	base           string
+	user, password string
+	http           *http.Client
+}
+
+// client is the client command: it sends the commands to the API of a
+// running server, for the demos and the scripts.
+//
+//	live client set kitchen 21.5
+//	live client tail kitchen
+func client(args []string) error {
+	fs := flag.NewFlagSet("client", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), clientUsage)
+		fs.PrintDefaults()
+	}
+	base := fs.String("url", envOr("LIVE_URL", "http://localhost:8080"), "URL of the server")
+	user := fs.String("user", envOr("LIVE_USER", "admin"), "basic auth user of the admin pages, which the changes need")
+	password := fs.String("password", os.Getenv("LIVE_PASSWORD"), "basic auth password of the admin pages")
+	confirm := fs.Bool("confirm", false, "confirm a setpoint over the warning limit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	c := &apiClient{base: strings.TrimSuffix(*base, "/"), user: *user, password: *password, http: &http.Client{Timeout: 10 * time.Second}}
+	args = fs.Args()
+	if len(args) == 0 {
+		fs.Usage()
+		return errors.New("no command")
+	}
+	cmd, args := args[0], args[1:]
+	need := func(n int, usage string) error {
+		if len(args) < n {
+			return fmt.Errorf("usage: live client %s", usage)
+		}
+		return nil
+	}
+
+	var zone apiZone
+	switch cmd {
+	case "zones":
+		var zones []apiZone
+		if err := c.call(http.MethodGet, "/api/zones", nil, &zones); err != nil {
+			return err
+		}
+		for _, z := range zones {
+			printZone(z)
+		}
+		return nil
+	case "get":
+		if err := need(1, "get ZONE"); err != nil {
+			return err
+		}
+		if err := c.call(http.MethodGet, "/api/zones/"+url.PathEscape(args[0]), nil, &zone); err != nil {
+			return err
+		}
+	case "set":
+		if err := need(2, "set ZONE TEMPERATURE"); err != nil {
+			return err
+		}
+		t, err := strconv.ParseFloat(strings.Replace(args[1], ",", ".", 1), 32)
+		if err != nil {
+			return fmt.Errorf("invalid temperature %q", args[1])
+		}
+		body := map[string]interface{}{"temperature": t, "confirmed": *confirm}
+		if err := c.call(http.MethodPut, "/api/zones/"+url.PathEscape(args[0])+"/setpoint", body, &zone); err != nil {
+			return err
+		}
+	case "up", "down":
+		if err := need(1, cmd+" ZONE"); err != nil {
+			return err
+		}
+		if err := c.call(http.MethodPost, "/api/zones/"+url.PathEscape(args[0])+"/"+cmd, nil, &zone); err != nil {
+			return err
+		}
+	case "say":
+		if err := need(2, "say NAME MESSAGE..."); err != nil {
+			return err
+		}
+		var msg apiMessage
+		body := map[string]string{"name": args[0], "message": strings.Join(args[1:], " ")}
+		if err := c.call(http.MethodPost, "/api/messages", body, &msg); err != nil {
+			return err
+		}
+		fmt.Printf("%s  %s: %s\n", msg.Time.Local().Format(time.Kitchen), msg.Author, msg.Text)
+		return nil
+	case "tail":
+		q := ""
+		if len(args) > 0 {
+			q = "?zone=" + url.QueryEscape(args[0])
+		}
+		return c.tail("/events" + q)
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown client command %q", cmd)
+	}
+	printZone(zone)
+	return nil
+}
+
+func printZone(z apiZone) {
+	hot := ""
+	if z.TooHot {
+		hot = "  too hot"
+	}
+	fmt.Printf("%-12s %5.1f °C  %s%s\n", z.Zone, z.Setpoint, z.Updated.Local().Format(time.Stamp), hot)
+}
+
+func (c *apiClient) request(method, path string, body interface{}) (*http.Request, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, c.base+path, r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.password)
+	}
+	return req, nil
+}
+
+// call calls the API, decoding the answer into v. The error of a failed
+// call is the one of the API, with the field errors.
+func (c *apiClient) call(method, path string, body, v interface{}) error {
+	req, err := c.request(method, path, body)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var failure struct {
+			Error  string            `json:"error"`
+			Fields map[string]string `json:"fields"`
+		}
+		if resp.StatusCode == http.StatusUnauthorized {
+			return fmt.Errorf("the server answered %s (see --user and --password)", resp.Status)
+		}
+		if json.NewDecoder(resp.Body).Decode(&failure) != nil || failure.Error == "" {
+			return fmt.Errorf("the server answered %s", resp.Status)
+		}
+		msg := failure.Error
+		for field, e := range failure.Fields {
+			msg += fmt.Sprintf("; %s: %s", field, e)
+		}
+		if resp.StatusCode == http.StatusConflict {
+			msg += " (see --confirm)"
+		}
+		return errors.New(msg)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// tail prints the events of the event stream at path until it ends.
+func (c *apiClient) tail(path string) error {
+	req, err := c.request(http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	// The stream has no end, the timeout of the calls doesn't apply.
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("the server answered %s", resp.Status)
+	}
+	var event string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			printEvent(event, []byte(strings.TrimPrefix(line, "data: ")))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("the server closed the stream")
+}
+
+func printEvent(event string, data []byte) {
+	now := time.Now().Format(time.Kitchen)
+	switch event {
+	case "status":
+		var s sseStatus
+		if json.Unmarshal(data, &s) == nil {
+			fmt.Printf("%s  [%s] %s\n", now, s.Page, s.Text)
+		}
+	case "temperature":
+		var t sseTemperature
+		if json.Unmarshal(data, &t) == nil {
+			fmt.Printf("%s  %s is set to %.1f °C\n", now, t.Zone, t.Setpoint)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jfyne/live"
+)
+
+// clockZones are suggested by the zone picker of the clock page.
+var clockZones = []string{
+	"UTC", "Europe/London", "Europe/Prague", "Europe/Berlin", "America/New_York",
+	"America/Los_Angeles", "America/Sao_Paulo", "Asia/Tokyo", "Asia/Kolkata", "Australia/Sydney",
+}
+
+// clockForm validates the form adding a timezone.
+var clockForm = Form{
+	"zone": {Required(), Length(1, 64)},
+}
+
+// ClockTime is the time in one timezone of the clock page.
+type ClockTime struct {
+	Zone string
+	Time time.Time
+}
+
+// ClockModel is the model of the clock page.
+type ClockModel struct {
+	Page
+	Zones []string
+	Now   time.Time
+	// Errors are the errors of the form adding a timezone.
+	Errors Errors `json:"-"`
+}
+
+// Times returns the current time in every picked timezone.
+func (m *ClockModel) Times() []ClockTime {
+	times := make([]ClockTime, 0, len(m.Zones))
+	for _, zone := range m.Zones {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			continue
+		}
+		times = append(times, ClockTime{Zone: zone, Time: m.Now.In(loc)})
+	}
+	return times
+}
+
+// Suggestions returns the zones of the picker.
+func (m *ClockModel) Suggestions() []string {
+	return clockZones
+}
+
+func clockModel(s live.Socket) *ClockModel {
+	if m, ok := s.Assigns().(*ClockModel); ok {
+		return m
+	}
+	return &ClockModel{Zones: []string{"UTC"}, Now: time.Now()}
+}
+
+// newClock creates the world clock live handler. Unlike the server time
+// every page shows, which app.Broadcast sends to all sockets at once, each
+// connected socket runs its own ticker and sends itself the time with
+// app.State.Send, so the work follows the sockets on the page and every
+// socket renders only its own timezones.
+func newClock(app *App) *Handler {
+	h := app.NewHandler()
+	h.HandleRender(app.Render("clock.html"))
+	h.HandleMount(func(ctx context.Context, s live.Socket) (interface{}, error) {
+		m := clockModel(s)
+		if s.Connected() {
+			go func() {
+				t := time.NewTicker(time.Second)
+				defer t.Stop()
+				for {
+					select {
+					case now := <-t.C:
+						app.State.Send(s, "clock-tick", now)
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+		}
+		return m, nil
+	})
+	h.HandleTick("clock-tick", func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		m := clockModel(s)
+		m.Now = data.(time.Time)
+		return m, nil
+	})
+	h.HandleEvent("clock-add", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := clockModel(s)
+		if m.Errors = clockForm.Validate(p); len(m.Errors) > 0 {
+			return m, nil
+		}
+		zone := strings.TrimSpace(p.String("zone"))
+		if _, err := time.LoadLocation(zone); err != nil {
+			m.Errors = Errors{"zone": {Key: "Unknown timezone %s.", Args: []interface{}{zone}}}
+			return m, nil
+		}
+		for _, z := range m.Zones {
+			if z == zone {
+				return m, nil
+			}
+		}
+		m.Zones = append(m.Zones, zone)
+		return m, nil
+	})
+	h.HandleEvent("clock-remove", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := clockModel(s)
+		zone := p.String("zone")
+		for i, z := range m.Zones {
+			if z == zone {
+				m.Zones = append(m.Zones[:i], m.Zones[i+1:]...)
+				return m, nil
+			}
+		}
+		return m, fmt.Errorf("unknown timezone %q", zone)
+	})
+	return h
+}
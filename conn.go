@@ -0,0 +1,422 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jfyne/live"
+)
+
+// Websocket close codes used when the server closes a connection itself.
+const (
+	closeGoingAway       = 1001
+	closeInvalidData     = 1007
+	closePolicyViolation = 1008
+	closeMessageTooBig   = 1009
+	closeInternalError   = 1011
+)
+
+// clientMessageLimit is the limit of the websocket library on the messages
+// of the client, which MaxMessageSize can only lower.
+const clientMessageLimit = 32 << 10
+
+var errMessageTooBig = errors.New("websocket message exceeds the configured maximum size")
+
+// Keepalive tunes the websocket connections of live handlers. Proxies
+// often drop connections that stay silent, so the server pings every
+// socket and closes the ones that stop answering.
+type Keepalive struct {
+	// PingInterval is how often a ping is sent to the client.
+	PingInterval time.Duration
+	// PongTimeout is how long after a ping is due the client may stay
+	// silent before the connection is considered dead.
+	PongTimeout time.Duration
+	// WriteTimeout is the deadline for every write to the connection.
+	WriteTimeout time.Duration
+	// MaxMessageSize is the largest message accepted from the client in
+	// bytes, up to the 32KiB of the websocket library, which 0 leaves.
+	MaxMessageSize int64
+	// SendQueue is the number of messages queued for a client reading
+	// slower than the server writes to it. SendPolicy is what a full queue
+	// does, SendDisconnect or SendDropOldest.
+	SendQueue  int
+	SendPolicy string
+}
+
+// Mount wraps a mount handler so connected sockets receive pings until
+// they disconnect.
+func (k Keepalive) Mount(mount live.MountHandler) live.MountHandler {
+	return func(ctx context.Context, s live.Socket) (interface{}, error) {
+		if s.Connected() && k.PingInterval > 0 {
+			go func() {
+				t := time.NewTicker(k.PingInterval)
+				defer t.Stop()
+				for {
+					select {
+					case <-t.C:
+						s.Send("ping", nil)
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+		}
+		return mount(ctx, s)
+	}
+}
+
+// Pong handles the client answer to a ping. Receiving it is all that is
+// needed, it pushes the read deadline forward.
+func (k Keepalive) Pong(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+	return s.Assigns(), nil
+}
+
+func isUpgrade(r *http.Request) bool {
+	for _, h := range r.Header["Upgrade"] {
+		if h == "websocket" {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey string
+
+const wsConnKey contextKey = "ws-conn"
+
+// connFromContext returns the websocket connection serving the request
+// of ctx, nil for plain HTTP requests.
+func connFromContext(ctx context.Context) *wsConn {
+	c, _ := ctx.Value(wsConnKey).(*wsConn)
+	return c
+}
+
+// hijackWriter hands the websocket library a wrapped connection when it
+// hijacks the response.
+type hijackWriter struct {
+	http.ResponseWriter
+	conn *wsConn
+}
+
+func (w *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	nc, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.conn.attach(nc)
+	// The websocket library would read the bytes the server buffered past
+	// the request straight from brw, they go through the connection too.
+	reader := brw.Reader
+	if buffered, _ := brw.Reader.Peek(brw.Reader.Buffered()); len(buffered) > 0 {
+		if err := w.conn.receive(buffered); err != nil {
+			return nil, nil, err
+		}
+		reader = bufio.NewReader(w.conn)
+	}
+	return w.conn, bufio.NewReadWriter(reader, bufio.NewWriterSize(w.conn, brw.Writer.Size())), nil
+}
+
+// wsConn is the network connection of a live socket. It sets deadlines
+// on every read and write and can close the connection with a websocket
+// close code. The messages of the client are checked for size and handed
+// to the queue of the socket in state, the live engine reads only the
+// control frames. The writes are queued and sent by flush.
+type wsConn struct {
+	net.Conn
+	keepalive Keepalive
+	state     *socketState
+
+	// reader and readErr belong to Read.
+	reader  clientReader
+	readErr error
+
+	writeMu sync.Mutex
+	closed  bool
+	queue   *sendQueue
+	// dropped is told about the messages the queue drops, and about the
+	// connection closed for a full queue.
+	dropped func(n int, disconnect bool)
+
+	// id, page, remote, agent and connected describe the connection for
+	// the sockets page, handler serves it. They are set before it is
+	// registered.
+	id        int
+	handler   http.Handler
+	page      string
+	remote    string
+	agent     string
+	connected time.Time
+
+	mu          sync.Mutex
+	socket      live.Socket
+	lastActive  time.Time
+	lastEvent   string
+	lastEventAt time.Time
+}
+
+// setSocket records the live socket served over the connection.
+func (c *wsConn) setSocket(s live.Socket) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.socket = s
+}
+
+// Socket returns the live socket served over the connection, nil until
+// the socket is mounted.
+func (c *wsConn) Socket() live.Socket {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.socket
+}
+
+// touch records a client event on the connection, user activity unless
+// it's a background event.
+func (c *wsConn) touch(event string, active bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastEvent, c.lastEventAt = event, time.Now()
+	if active {
+		c.lastActive = c.lastEventAt
+	}
+}
+
+// LastActive returns the time of the last user activity.
+func (c *wsConn) LastActive() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastActive
+}
+
+// Info describes the connection.
+func (c *wsConn) Info() SocketInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	info := SocketInfo{
+		ID:          c.id,
+		Page:        c.page,
+		Remote:      c.remote,
+		UserAgent:   c.agent,
+		Connected:   c.connected,
+		LastActive:  c.lastActive,
+		LastEvent:   c.lastEvent,
+		LastEventAt: c.lastEventAt,
+	}
+	info.Queued, info.Dropped = c.queue.stats()
+	if c.socket != nil {
+		info.Socket = string(c.socket.ID())
+		info.Session = live.SessionID(c.socket.Session())
+	}
+	return info
+}
+
+func (c *wsConn) attach(nc net.Conn) {
+	c.Conn = nc
+	c.reader.max = c.keepalive.MaxMessageSize
+	if c.reader.max <= 0 || c.reader.max > clientMessageLimit {
+		c.reader.max = clientMessageLimit
+	}
+	go c.flush()
+}
+
+// Read returns the control frames of the client to the websocket library,
+// reading on until there are some.
+func (c *wsConn) Read(p []byte) (int, error) {
+	for len(c.reader.control) == 0 {
+		if c.readErr != nil {
+			return 0, c.readErr
+		}
+		if c.keepalive.PingInterval > 0 && c.keepalive.PongTimeout > 0 {
+			c.Conn.SetReadDeadline(time.Now().Add(c.keepalive.PingInterval + c.keepalive.PongTimeout))
+		}
+		n, err := c.Conn.Read(p)
+		if n > 0 {
+			if rerr := c.receive(p[:n]); rerr != nil {
+				return 0, rerr
+			}
+		}
+		c.readErr = err
+	}
+	n := copy(p, c.reader.control)
+	c.reader.control = c.reader.control[n:]
+	return n, nil
+}
+
+// receive reads the frames of the client in p, a message too big or not
+// a live event closes the connection.
+func (c *wsConn) receive(p []byte) error {
+	err := c.reader.feed(p, func(opcode byte, payload []byte) error {
+		if opcode != 1 {
+			log.Println("binary messages unhandled")
+			return nil
+		}
+		var m live.Event
+		if err := json.Unmarshal(payload, &m); err != nil {
+			c.CloseWith(closeInvalidData, "invalid message")
+			return err
+		}
+		c.state.event(m)
+		return nil
+	})
+	if errors.Is(err, errMessageTooBig) {
+		c.CloseWith(closeMessageTooBig, "message too big")
+	}
+	return err
+}
+
+func (c *wsConn) Write(p []byte) (int, error) {
+	n, dropped, full, err := c.queue.write(p)
+	if dropped > 0 || full {
+		c.dropped(dropped, full)
+	}
+	if full {
+		// The write blocked by the client ends at once, the close
+		// frame gets the second of CloseWith.
+		c.Conn.SetWriteDeadline(time.Now())
+		go c.CloseWith(closePolicyViolation, "too slow to keep up")
+	}
+	return n, err
+}
+
+// flush sends the messages of the queue until it is closed. A failed
+// write closes the connection, a frame may have been cut.
+func (c *wsConn) flush() {
+	for {
+		msg, ok := c.queue.next()
+		if !ok {
+			return
+		}
+		if _, err := c.write(msg); err != nil {
+			if c.queue.close() {
+				c.Conn.Close()
+			}
+			return
+		}
+	}
+}
+
+// Close closes the connection, dropping the messages still queued.
+func (c *wsConn) Close() error {
+	c.queue.close()
+	return c.Conn.Close()
+}
+
+func (c *wsConn) write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.keepalive.WriteTimeout > 0 {
+		c.Conn.SetWriteDeadline(time.Now().Add(c.keepalive.WriteTimeout))
+	}
+	return c.Conn.Write(p)
+}
+
+// CloseWith sends a close frame with the code and reason, then closes the
+// connection. Browsers don't reconnect after closeGoingAway.
+func (c *wsConn) CloseWith(code uint16, reason string) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.Conn == nil || c.closed {
+		return nil
+	}
+	c.closed = true
+	c.queue.close()
+
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	frame := make([]byte, 4, 4+len(reason))
+	frame[0] = 0x88 // FIN + close opcode.
+	frame[1] = byte(2 + len(reason))
+	binary.BigEndian.PutUint16(frame[2:], code)
+	frame = append(frame, reason...)
+
+	c.Conn.SetWriteDeadline(time.Now().Add(time.Second))
+	if _, err := c.Conn.Write(frame); err != nil {
+		log.Println("could not write close frame:", err)
+	}
+	return c.Conn.Close()
+}
+
+// clientReader takes the messages out of the frames the client sends and
+// checks their size. The control frames are kept for the websocket
+// library.
+type clientReader struct {
+	max int64
+	// buf are the bytes of a frame not read whole yet, message the
+	// payload of the fragments before it.
+	buf     []byte
+	opcode  byte
+	message []byte
+	control []byte
+}
+
+// feed consumes bytes read from the client, handing the opcode and the
+// payload of every message completed to m.
+func (f *clientReader) feed(p []byte, m func(opcode byte, payload []byte) error) error {
+	f.buf = append(f.buf, p...)
+	for {
+		header, length, ok := frameHeader(f.buf)
+		if !ok {
+			break
+		}
+		// Control frames (opcode >= 8) are not part of a message.
+		opcode := f.buf[0] & 0x0f
+		if opcode < 8 && int64(len(f.message))+length > f.max {
+			return errMessageTooBig
+		}
+		if int64(len(f.buf)-header) < length {
+			break
+		}
+		size := header + int(length)
+		frame := f.buf[:size:size]
+		f.buf = f.buf[size:]
+		if opcode >= 8 {
+			f.control = append(f.control, frame...)
+			continue
+		}
+		if opcode != 0 {
+			f.opcode = opcode
+		}
+		// The frames of the client are masked.
+		payload := frame[header:]
+		if frame[1]&0x80 != 0 {
+			key := frame[header-4 : header]
+			for i := range payload {
+				payload[i] ^= key[i%4]
+			}
+		}
+		f.message = append(f.message, payload...)
+		if frame[0]&0x80 != 0 {
+			message := f.message
+			f.message = nil
+			if err := m(f.opcode, message); err != nil {
+				return err
+			}
+		}
+	}
+	if len(f.buf) == 0 {
+		f.buf = nil
+	}
+	return nil
+}
+
+func extendedLength(b byte) int {
+	switch b & 0x7f {
+	case 126:
+		return 2
+	case 127:
+		return 8
+	}
+	return 0
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+
+	"github.com/jfyne/live"
+)
+
+// CounterModel is the model of the counter page.
+type CounterModel struct {
+	Page
+	Count int
+}
+
+func counterModel(s live.Socket) *CounterModel {
+	if m, ok := s.Assigns().(*CounterModel); ok {
+		return m
+	}
+	return &CounterModel{}
+}
+
+// newCounter creates the counter live handler, the smallest page of the
+// app: one number and three events.
+func newCounter(app *App) *Handler {
+	h := app.NewHandler()
+	h.HandleRender(app.Render("counter.html"))
+	h.HandleMount(func(ctx context.Context, s live.Socket) (interface{}, error) {
+		return counterModel(s), nil
+	})
+	h.HandleEvent("increment", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := counterModel(s)
+		m.Count++
+		return m, nil
+	})
+	h.HandleEvent("decrement", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := counterModel(s)
+		m.Count--
+		return m, nil
+	})
+	h.HandleEvent("reset", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := counterModel(s)
+		m.Count = 0
+		return m, nil
+	})
+	return h
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jfyne/live"
+)
+
+// dashboardZones are the zones on the dashboard.
+var dashboardZones = []string{"living", "kitchen", "bedroom", "office"}
+
+// DashboardModel is the model of the dashboard: a control per zone, the
+// status feed, the number of connected users and the clock.
+type DashboardModel struct {
+	Page
+	Controls []*TempControl
+	Feed     Feed
+	// Users is the number of connected sockets, on every page.
+	Users int
+}
+
+// TempControl returns the control of a zone.
+func (m *DashboardModel) TempControl(id string) *TempControl {
+	for _, c := range m.Controls {
+		if c.ID == id {
+			return c
+		}
+	}
+	return nil
+}
+
+// StatusFeed returns the status feed of the dashboard.
+func (m *DashboardModel) StatusFeed() *Feed {
+	return &m.Feed
+}
+
+// Pager returns the pager of the status feed.
+func (m *DashboardModel) Pager(id string) *Pager {
+	if m.Feed.Pager.ID == id {
+		return &m.Feed.Pager
+	}
+	return nil
+}
+
+func dashboardModel(s live.Socket) *DashboardModel {
+	if m, ok := s.Assigns().(*DashboardModel); ok {
+		return m
+	}
+	m := &DashboardModel{Feed: NewFeed("feed")}
+	for _, zone := range dashboardZones {
+		m.Controls = append(m.Controls, NewTempControl(zone))
+	}
+	return m
+}
+
+// newDashboard creates the dashboard live handler. It is made of the same
+// components as the other pages: the temperature controls, the status
+// feed and the server time the layout keeps up to date.
+func newDashboard(app *App) *Handler {
+	h := app.NewHandler()
+	h.HandleRender(app.Render("dashboard.html"))
+	h.HandlePatch("time", patchTime(true))
+	h.HandleMount(func(ctx context.Context, s live.Socket) (interface{}, error) {
+		m := dashboardModel(s)
+		m.Users = app.Sockets.Count()
+		for _, c := range m.Controls {
+			if err := LoadSetpoint(ctx, app.Repos.Thermostats, c); err != nil {
+				return nil, err
+			}
+		}
+		if s.Connected() {
+			go func() {
+				t := time.NewTicker(5 * time.Second)
+				defer t.Stop()
+				for {
+					select {
+					case <-t.C:
+						app.State.Send(s, "users", app.Sockets.Count())
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+		}
+		return m, nil
+	})
+
+	HandleTempControl(h, func(ctx context.Context, s live.Socket) TempControls {
+		return dashboardModel(s)
+	}, func(ctx context.Context, s live.Socket, c *TempControl, from float32) {
+		app.Broadcasts.On("dashboard", s).Broadcast("status", dashboardStatus(c.Zone, from, c.Temperature))
+	}, app.Recorder)
+
+	h.HandleSelf("status", func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		m := dashboardModel(s)
+		m.Feed.Add(data.(string))
+		return m, nil
+	})
+	h.HandleTick("users", func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		m := dashboardModel(s)
+		m.Users = data.(int)
+		return m, nil
+	})
+	return h
+}
+
+// dashboardStatus is the status of a setpoint change of zone.
+func dashboardStatus(zone string, from, to float32) string {
+	return fmt.Sprintf("%s: Temperature changed from %.1f to %.1f", zone, from, to)
+}
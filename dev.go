@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/jfyne/live"
+)
+
+// logEvents is the dev mode middleware. It logs every live event with its
+// params and the fields of the assigns the handler changed.
+func logEvents(kind, event string, next EventFunc) EventFunc {
+	if event == logsTailEvent {
+		return next
+	}
+	return func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		before := snapshot(s.Assigns())
+		result, err := next(ctx, s, data)
+		if err != nil {
+			log.Printf("[dev] %s %q socket=%s params=%v error: %v", kind, event, s.ID(), data, err)
+			return result, err
+		}
+		log.Printf("[dev] %s %q socket=%s params=%v diff: %s", kind, event, s.ID(), data, assignsDiff(before, snapshot(result)))
+		return result, nil
+	}
+}
+
+// snapshot captures the exported fields of assigns. Handlers usually
+// mutate the model in place, so it has to be copied before the handler runs.
+func snapshot(assigns interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+	b, err := json.Marshal(assigns)
+	if err != nil {
+		return fields
+	}
+	json.Unmarshal(b, &fields)
+	return fields
+}
+
+// assignsDiff describes the fields that differ between two snapshots.
+func assignsDiff(before, after map[string]interface{}) string {
+	var changes []string
+	for k, v := range after {
+		old, ok := before[k]
+		if !ok || fmt.Sprint(old) != fmt.Sprint(v) {
+			changes = append(changes, fmt.Sprintf("%s: %v -> %v", k, old, v))
+		}
+	}
+	for k, v := range before {
+		if _, ok := after[k]; !ok {
+			changes = append(changes, fmt.Sprintf("%s: %v -> <nil>", k, v))
+		}
+	}
+	if len(changes) == 0 {
+		return "no changes"
+	}
+	sort.Strings(changes)
+	return strings.Join(changes, ", ")
+}
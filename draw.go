@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/jfyne/live"
+)
+
+// Limits of the whiteboard.
+const (
+	drawMaxStrokes = 2000
+	drawMaxPoints  = 1000
+)
+
+// drawColors and drawWidths are the pens the whiteboard offers.
+var (
+	drawColors = []string{"#212529", "#dc3545", "#198754", "#0d6efd", "#ffc107"}
+	drawWidths = []int{2, 4, 8, 16}
+)
+
+// Stroke is a line drawn on the whiteboard. Points are relative to the
+// size of the canvas, from 0 to 1, so every screen size draws the same.
+type Stroke struct {
+	ID     int          `json:"id"`
+	Color  string       `json:"color"`
+	Width  int          `json:"width"`
+	Points [][2]float64 `json:"points"`
+
+	// session is the session that drew it, for undo.
+	session string
+}
+
+// normalizePoints reads the points the draw hook sends, clamping them to
+// the canvas, rounding them and dropping repeated points.
+func normalizePoints(raw interface{}) ([][2]float64, error) {
+	list, ok := raw.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("a stroke needs points")
+	}
+	if len(list) > drawMaxPoints {
+		return nil, fmt.Errorf("a stroke has at most %d points", drawMaxPoints)
+	}
+	points := make([][2]float64, 0, len(list))
+	for _, item := range list {
+		xy, ok := item.([]interface{})
+		if !ok || len(xy) != 2 {
+			return nil, fmt.Errorf("a point is a pair of numbers")
+		}
+		var p [2]float64
+		for i, v := range xy {
+			f, ok := v.(float64)
+			if !ok || math.IsNaN(f) {
+				return nil, fmt.Errorf("a point is a pair of numbers")
+			}
+			p[i] = math.Round(math.Max(0, math.Min(1, f))*10000) / 10000
+		}
+		if n := len(points); n == 0 || points[n-1] != p {
+			points = append(points, p)
+		}
+	}
+	return points, nil
+}
+
+// Whiteboard is the drawing shared by every user of the draw page.
+type Whiteboard struct {
+	mu      sync.Mutex
+	strokes []Stroke
+	nextID  int
+}
+
+// NewWhiteboard creates an empty whiteboard.
+func NewWhiteboard() *Whiteboard {
+	return &Whiteboard{}
+}
+
+// Add adds a stroke drawn by session, dropping the oldest beyond
+// drawMaxStrokes.
+func (w *Whiteboard) Add(session string, st Stroke) Stroke {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.nextID++
+	st.ID, st.session = w.nextID, session
+	w.strokes = append(w.strokes, st)
+	if len(w.strokes) > drawMaxStrokes {
+		w.strokes = w.strokes[len(w.strokes)-drawMaxStrokes:]
+	}
+	return st
+}
+
+// Undo removes the latest stroke of session.
+func (w *Whiteboard) Undo(session string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i := len(w.strokes) - 1; i >= 0; i-- {
+		if w.strokes[i].session == session {
+			w.strokes = append(w.strokes[:i], w.strokes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Clear removes every stroke.
+func (w *Whiteboard) Clear() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.strokes = nil
+}
+
+// Strokes returns the strokes, oldest first.
+func (w *Whiteboard) Strokes() []Stroke {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]Stroke(nil), w.strokes...)
+}
+
+// DrawModel is the model of the draw page. The drawing belongs to the draw
+// hook, it's sent the strokes as draw-stroke and draw-strokes events.
+type DrawModel struct {
+	Page
+	Color string
+	Width int
+}
+
+// Colors returns the colors of the pens.
+func (m *DrawModel) Colors() []string {
+	return drawColors
+}
+
+// Widths returns the widths of the pens.
+func (m *DrawModel) Widths() []int {
+	return drawWidths
+}
+
+// sendPen tells the hook the pen to preview strokes with.
+func (m *DrawModel) sendPen(s live.Socket) error {
+	return s.Send("draw-pen", map[string]interface{}{"color": m.Color, "width": m.Width})
+}
+
+func drawModel(s live.Socket) *DrawModel {
+	if m, ok := s.Assigns().(*DrawModel); ok {
+		return m
+	}
+	return &DrawModel{Color: drawColors[0], Width: drawWidths[1]}
+}
+
+// sendStrokes sends the whole drawing to the hook.
+func sendStrokes(s live.Socket, board *Whiteboard) error {
+	return s.Send("draw-strokes", map[string]interface{}{"strokes": board.Strokes()})
+}
+
+// newDraw creates the whiteboard live handler. The hook sends the points
+// of a stroke once it's drawn, the server draws it with the pen of the
+// socket and broadcasts it. Undo and clear redraw every board.
+func newDraw(app *App, board *Whiteboard) *Handler {
+	h := app.NewHandler()
+	h.HandleRender(app.Render("draw.html"))
+	h.HandleMount(func(ctx context.Context, s live.Socket) (interface{}, error) {
+		return drawModel(s), nil
+	})
+	h.HandleEvent("draw-ready", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := drawModel(s)
+		if err := m.sendPen(s); err != nil {
+			return m, err
+		}
+		return m, sendStrokes(s, board)
+	})
+	h.HandleEvent("draw-stroke", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := drawModel(s)
+		points, err := normalizePoints(p["points"])
+		if err != nil {
+			return m, err
+		}
+		st := board.Add(live.SessionID(s.Session()), Stroke{Color: m.Color, Width: m.Width, Points: points})
+		s.Broadcast("draw-stroke", st)
+		return m, nil
+	})
+	h.HandleEvent("draw-undo", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		if board.Undo(live.SessionID(s.Session())) {
+			s.Broadcast("draw-strokes", nil)
+		}
+		return s.Assigns(), nil
+	})
+	h.HandleEvent("draw-clear", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		board.Clear()
+		s.Broadcast("draw-strokes", nil)
+		return s.Assigns(), nil
+	})
+	h.HandleEvent("draw-pen", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := drawModel(s)
+		if color := p.String("color"); color != "" {
+			if !containsString(drawColors, color) {
+				return m, fmt.Errorf("unknown color %q", color)
+			}
+			m.Color = color
+		}
+		if width := p.Int("width"); width != 0 {
+			if !containsInt(drawWidths, width) {
+				return m, fmt.Errorf("unknown width %d", width)
+			}
+			m.Width = width
+		}
+		return m, m.sendPen(s)
+	})
+
+	h.HandleSelf("draw-stroke", func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		return s.Assigns(), s.Send("draw-stroke", data)
+	})
+	h.HandleSelf("draw-strokes", func(ctx context.Context, s live.Socket, _ interface{}) (interface{}, error) {
+		return s.Assigns(), sendStrokes(s, board)
+	})
+	return h
+}
+
+func containsString(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(list []int, v int) bool {
+	for _, i := range list {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/jfyne/live"
+)
+
+// genericError is shown in place of error details outside of dev mode.
+const genericError = "Something went wrong, please try again."
+
+// errorMessage returns the text shown to the user for err. Details are
+// only shown in dev mode, otherwise they stay in the log.
+func errorMessage(err error, dev bool) string {
+	if dev {
+		return err.Error()
+	}
+	return genericError
+}
+
+// renderErrors is an event middleware turning the errors of event handlers
+// into the inline error region of the page, instead of an error event the
+// page ignores. The error is cleared by the next client event that
+// succeeds.
+func renderErrors(dev bool) EventMiddleware {
+	return func(kind, event string, next EventFunc) EventFunc {
+		return func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+			result, err := next(ctx, s, data)
+			if err != nil {
+				m, ok := s.Assigns().(pageModel)
+				if !ok {
+					return result, err
+				}
+				log.Printf("%s %q socket=%s error: %v", kind, event, s.ID(), err)
+				m.page().Error = errorMessage(err, dev)
+				return m, nil
+			}
+			if m, ok := result.(pageModel); ok && kind == "event" {
+				m.page().Error = ""
+			}
+			return result, nil
+		}
+	}
+}
+
+// errorPage is the error handler of the live pages. A failing mount of a
+// page request renders the error page, failures on a websocket connection
+// are only logged as the connection is already gone.
+func errorPage(templates *Templates, dev bool) live.ErrorHandler {
+	return func(ctx context.Context, err error) {
+		log.Println("live error:", err)
+
+		w, r := live.Writer(ctx), live.Request(ctx)
+		if w == nil || r == nil || isUpgrade(r) {
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+
+		tmpl, terr := templates.Lookup("error.html")
+		if terr != nil {
+			w.Write([]byte(template.HTMLEscapeString(errorMessage(err, dev))))
+			return
+		}
+		tmpl.Execute(w, map[string]interface{}{
+			"Status":  http.StatusInternalServerError,
+			"Message": errorMessage(err, dev),
+		})
+	}
+}
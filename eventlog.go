@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jfyne/live"
+
+	"my-app.com/live/store"
+)
+
+// EventLog appends the live events handled by the sockets to the event log
+// of the database, so the events of a session can be replayed when
+// debugging it. The connected mount is logged with the whole model, every
+// event after it with the fields it changed.
+type EventLog struct {
+	repo store.EventRepo
+}
+
+// NewEventLog creates an event log appending to repo.
+func NewEventLog(repo store.EventRepo) *EventLog {
+	return &EventLog{repo: repo}
+}
+
+// Middleware is the event middleware logging the events, but for the
+// ticks every socket handles every few seconds. It has to come after
+// renderErrors to see the errors of the handlers.
+func (l *EventLog) Middleware(kind, event string, next EventFunc) EventFunc {
+	if kind == "tick" {
+		return next
+	}
+	return func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		before := snapshot(s.Assigns())
+		result, err := next(ctx, s, data)
+		l.append(ctx, s, kind, event, data, assignsDelta(before, snapshot(result)), err)
+		return result, err
+	}
+}
+
+// Mount is the mount middleware logging the mount of the connected
+// sockets. It has to be the outermost one to log the complete model.
+func (l *EventLog) Mount(mount live.MountHandler) live.MountHandler {
+	return func(ctx context.Context, s live.Socket) (interface{}, error) {
+		model, err := mount(ctx, s)
+		if s.Connected() {
+			var query interface{}
+			if r := live.Request(ctx); r != nil {
+				query = r.URL.Query()
+			}
+			l.append(ctx, s, store.EventMount, store.EventMount, query, assignsDelta(nil, snapshot(model)), err)
+		}
+		return model, err
+	}
+}
+
+// append logs an event, a failure is logged but doesn't fail the event.
+func (l *EventLog) append(ctx context.Context, s live.Socket, kind, event string, data interface{}, delta map[string]interface{}, handlerErr error) {
+	e := store.Event{
+		Session: live.SessionID(s.Session()),
+		Socket:  string(s.ID()),
+		Kind:    kind,
+		Name:    event,
+		Time:    time.Now(),
+	}
+	if r := live.Request(ctx); r != nil {
+		e.Page = r.URL.Path
+	}
+	var err error
+	if e.Params, err = json.Marshal(data); err != nil {
+		// Self events may carry values JSON can't encode.
+		e.Params = json.RawMessage("null")
+	}
+	if e.Delta, err = json.Marshal(delta); err != nil {
+		e.Delta = json.RawMessage("{}")
+	}
+	if handlerErr != nil {
+		e.Error = handlerErr.Error()
+	}
+	if _, err := l.repo.Append(ctx, e); err != nil {
+		log.Printf("could not log the %s %q: %v", kind, event, err)
+	}
+}
+
+// assignsDelta returns the fields of after that differ from before, and
+// the fields of before missing in after as nil.
+func assignsDelta(before, after map[string]interface{}) map[string]interface{} {
+	delta := map[string]interface{}{}
+	for k, v := range after {
+		if old, ok := before[k]; !ok || !reflect.DeepEqual(old, v) {
+			delta[k] = v
+		}
+	}
+	for k := range before {
+		if _, ok := after[k]; !ok {
+			delta[k] = nil
+		}
+	}
+	return delta
+}
+
+// replayedEvent is an event as the replay API writes it.
+type replayedEvent struct {
+	ID     int64           `json:"id"`
+	Socket string          `json:"socket"`
+	Page   string          `json:"page"`
+	Kind   string          `json:"kind"`
+	Name   string          `json:"name"`
+	Params json.RawMessage `json:"params"`
+	Delta  json.RawMessage `json:"delta"`
+	Error  string          `json:"error,omitempty"`
+	Time   time.Time       `json:"time"`
+	// Model is the model of the socket after the event, with ?model=1.
+	Model map[string]json.RawMessage `json:"model,omitempty"`
+}
+
+// eventsHandler replays the events of a session as JSON lines, oldest
+// first, from after the event ID ?after=. With ?model=1 every event comes
+// with the model of its socket rebuilt from the log. It is mounted on the
+// admin group.
+//
+//	curl -u admin:secret 'localhost:8080/admin/events/{session}?after=0&model=1'
+func eventsHandler(repo store.EventRepo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var after int64
+		if v := r.URL.Query().Get("after"); v != "" {
+			var err error
+			if after, err = strconv.ParseInt(v, 10, 64); err != nil {
+				http.Error(w, "after must be an event ID", http.StatusBadRequest)
+				return
+			}
+		}
+		withModel := r.URL.Query().Get("model") == "1"
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		flusher, _ := w.(http.Flusher)
+		enc := json.NewEncoder(w)
+		count := 0
+		err := store.Replay(r.Context(), repo, chi.URLParam(r, "session"), after, func(e store.Event, model map[string]json.RawMessage) error {
+			out := replayedEvent{ID: e.ID, Socket: e.Socket, Page: e.Page, Kind: e.Kind, Name: e.Name, Params: e.Params, Delta: e.Delta, Error: e.Error, Time: e.Time}
+			if withModel {
+				out.Model = model
+			}
+			if err := enc.Encode(out); err != nil {
+				return err
+			}
+			if count++; count%exportFlush == 0 && flusher != nil {
+				flusher.Flush()
+			}
+			return nil
+		})
+		if err != nil {
+			// The status is sent already, the client sees a truncated log.
+			log.Println("events replay error:", err)
+		}
+	}
+}
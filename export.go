@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"my-app.com/live/store"
+)
+
+// exportFlush is the number of records written between flushes, so a long
+// export reaches the client while it's read.
+const exportFlush = 100
+
+// exportHeaders are the entities of the export and their CSV columns.
+var exportHeaders = map[string][]string{
+	"zones":    {"zone", "setpoint", "updated"},
+	"readings": {"zone", "kind", "resolution", "start", "min", "max", "avg", "count"},
+	"messages": {"id", "room", "author", "text", "time"},
+	"users":    {"session", "name", "seen"},
+}
+
+// The records as the JSON export writes them.
+type (
+	exportZone struct {
+		Zone     string    `json:"zone"`
+		Setpoint float32   `json:"setpoint"`
+		Updated  time.Time `json:"updated"`
+	}
+	exportReading struct {
+		Zone       string           `json:"zone"`
+		Kind       string           `json:"kind"`
+		Resolution store.Resolution `json:"resolution"`
+		Start      time.Time        `json:"start"`
+		Min        float64          `json:"min"`
+		Max        float64          `json:"max"`
+		Avg        float64          `json:"avg"`
+		Count      int              `json:"count"`
+	}
+	exportMessage struct {
+		ID     int64     `json:"id"`
+		Room   string    `json:"room"`
+		Author string    `json:"author"`
+		Text   string    `json:"text"`
+		Time   time.Time `json:"time"`
+	}
+	exportUser struct {
+		Session string    `json:"session"`
+		Name    string    `json:"name"`
+		Seen    time.Time `json:"seen"`
+	}
+)
+
+// exportWriter writes the records of an export one at a time, as JSON or
+// as a CSV row.
+type exportWriter struct {
+	w     io.Writer
+	csv   *csv.Writer
+	count int
+}
+
+func (e *exportWriter) write(record interface{}, row []string) error {
+	e.count++
+	if e.csv != nil {
+		if err := e.csv.Write(row); err != nil {
+			return err
+		}
+	} else {
+		b, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		sep := ",\n"
+		if e.count == 1 {
+			sep = ""
+		}
+		if _, err := io.WriteString(e.w, sep); err != nil {
+			return err
+		}
+		if _, err := e.w.Write(b); err != nil {
+			return err
+		}
+	}
+	if e.count%exportFlush == 0 {
+		e.flush()
+	}
+	return nil
+}
+
+func (e *exportWriter) flush() {
+	if e.csv != nil {
+		e.csv.Flush()
+	}
+	if f, ok := e.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// exportTime formats the times of the CSV export.
+func exportTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// exportRange parses the "from" and "to" query params, RFC 3339 times or
+// dates. Without them the export has every record.
+func exportRange(r *http.Request) (from, to time.Time, err error) {
+	parse := func(key string, fallback time.Time) (time.Time, error) {
+		v := r.URL.Query().Get(key)
+		if v == "" {
+			return fallback, nil
+		}
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t, nil
+		}
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return t, fmt.Errorf("invalid %s, use 2006-01-02 or RFC 3339", key)
+		}
+		return t, nil
+	}
+	if from, err = parse("from", time.Unix(0, 0)); err != nil {
+		return from, to, err
+	}
+	// The end of time as far as the databases agree.
+	to, err = parse("to", time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC))
+	return from, to, err
+}
+
+// exportHandler streams an entity of the repositories, the rows are
+// written as they are read. The entity is zones, readings, messages or
+// users, filtered by the from/to time range. It is mounted on the admin
+// group.
+//
+//	curl -u admin:secret 'localhost:8080/admin/export/readings?format=csv&from=2024-01-01&to=2024-02-01'
+func exportHandler(repos store.Repos) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entity := chi.URLParam(r, "entity")
+		header, ok := exportHeaders[entity]
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown entity %q", entity), http.StatusNotFound)
+			return
+		}
+		from, to, err := exportRange(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		e := &exportWriter{w: w}
+		switch format := r.URL.Query().Get("format"); format {
+		case "csv":
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			e.csv = csv.NewWriter(w)
+			if err := e.csv.Write(header); err != nil {
+				return
+			}
+		case "", "json":
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, "[\n")
+		default:
+			http.Error(w, fmt.Sprintf("unknown format %q", format), http.StatusBadRequest)
+			return
+		}
+		ctx := r.Context()
+		switch entity {
+		case "zones":
+			var zones []store.Thermostat
+			if zones, err = repos.Thermostats.List(ctx); err != nil {
+				break
+			}
+			for _, t := range zones {
+				if t.Updated.Before(from) || !t.Updated.Before(to) {
+					continue
+				}
+				row := []string{t.Zone, strconv.FormatFloat(float64(t.Setpoint), 'f', -1, 32), exportTime(t.Updated)}
+				if err = e.write(exportZone{t.Zone, t.Setpoint, t.Updated}, row); err != nil {
+					break
+				}
+			}
+		case "readings":
+			err = repos.Readings.Each(ctx, from, to, func(a store.Aggregate) error {
+				avg := a.Avg()
+				row := []string{a.Zone, a.Kind, string(a.Resolution), exportTime(a.Start),
+					strconv.FormatFloat(a.Min, 'f', -1, 64), strconv.FormatFloat(a.Max, 'f', -1, 64),
+					strconv.FormatFloat(avg, 'f', -1, 64), strconv.Itoa(a.Count)}
+				return e.write(exportReading{a.Zone, a.Kind, a.Resolution, a.Start, a.Min, a.Max, avg, a.Count}, row)
+			})
+		case "messages":
+			err = repos.Messages.Each(ctx, from, to, func(m store.Message) error {
+				row := []string{strconv.FormatInt(m.ID, 10), m.Room, m.Author, m.Text, exportTime(m.Time)}
+				return e.write(exportMessage{m.ID, m.Room, m.Author, m.Text, m.Time}, row)
+			})
+		case "users":
+			err = repos.Users.Each(ctx, from, to, func(u store.User) error {
+				return e.write(exportUser{u.Session, u.Name, u.Seen}, []string{u.Session, u.Name, exportTime(u.Seen)})
+			})
+		}
+		if err != nil {
+			// The status is sent already, the export is cut short.
+			log.Printf("export of %s failed after %d records: %v", entity, e.count, err)
+			return
+		}
+		if e.csv == nil {
+			io.WriteString(w, "\n]\n")
+		}
+		e.flush()
+	}
+}
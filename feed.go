@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jfyne/live"
+)
+
+const (
+	// feedLimit is the number of entries a collapsed feed shows.
+	feedLimit = 10
+	// feedBacklog is the number of entries a feed keeps for "show all".
+	feedBacklog = 100
+)
+
+// Feed is a bounded list of status entries, newest first, rendered by the
+// "status-feed" partial. Unlike a live-update="prepend" region it doesn't
+// grow forever: only the latest feedLimit entries are rendered unless the
+// feed is expanded to the paginated history, and entries past feedBacklog
+// are dropped.
+type Feed struct {
+	Entries  []string
+	Expanded bool
+	// Pager pages through the expanded feed.
+	Pager Pager
+	// Query filters the entries, case insensitive.
+	Query string `json:"-"`
+}
+
+// NewFeed creates an empty feed whose pager has the given ID.
+func NewFeed(id string) Feed {
+	return Feed{Pager: Pager{ID: id, Page: 1, Size: feedLimit}}
+}
+
+// Add puts an entry on top of the feed.
+func (f *Feed) Add(entry string) {
+	f.Entries = append([]string{entry}, f.Entries...)
+	if len(f.Entries) > feedBacklog {
+		f.Entries = f.Entries[:feedBacklog]
+	}
+}
+
+// Matching returns the entries matching the query.
+func (f *Feed) Matching() []string {
+	if f.Query == "" {
+		return f.Entries
+	}
+	q := strings.ToLower(f.Query)
+	var entries []string
+	for _, e := range f.Entries {
+		if strings.Contains(strings.ToLower(e), q) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// Visible returns the entries to render: the latest ones, or the current
+// page once expanded.
+func (f *Feed) Visible() []string {
+	entries := f.Matching()
+	if f.Expanded {
+		v := f.Pager.View(len(entries))
+		return entries[v.Start:v.End]
+	}
+	if len(entries) <= feedLimit {
+		return entries
+	}
+	return entries[:feedLimit]
+}
+
+// PageView returns the pagination of the expanded feed.
+func (f *Feed) PageView() PageView {
+	return f.Pager.View(len(f.Matching()))
+}
+
+// More reports whether more entries match than a collapsed feed shows.
+func (f *Feed) More() bool {
+	return len(f.Matching()) > feedLimit
+}
+
+// feedModel is implemented by page models with a status feed.
+type feedModel interface {
+	StatusFeed() *Feed
+}
+
+// feedToggle expands or collapses the status feed of the page.
+func feedToggle(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+	if m, ok := s.Assigns().(feedModel); ok {
+		f := m.StatusFeed()
+		f.Expanded = !f.Expanded
+		f.Pager.Page = 1
+	}
+	return s.Assigns(), nil
+}
+
+// feedFilter filters the status feed of the page by the "q" param. It is
+// throttled, see HandleThrottled.
+func feedFilter(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+	if m, ok := s.Assigns().(feedModel); ok {
+		f := m.StatusFeed()
+		f.Query = strings.TrimSpace(p.String("q"))
+		f.Pager.Page = 1
+	}
+	return s.Assigns(), nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+
+	"github.com/jfyne/live"
+)
+
+// FlashLevel is the kind of a flash message, named after the alert class
+// it is rendered with.
+type FlashLevel string
+
+const (
+	FlashInfo    FlashLevel = "info"
+	FlashSuccess FlashLevel = "success"
+	FlashWarning FlashLevel = "warning"
+	FlashError   FlashLevel = "danger"
+)
+
+// FlashMessage is a message shown in the flash area of the layout.
+type FlashMessage struct {
+	Level   FlashLevel
+	Message string
+}
+
+// Flash adds a message to the flash area of the socket's page. Messages
+// are shown until the user dismisses them or the page handles the next
+// client event. The page model has to embed Page.
+func Flash(s live.Socket, level FlashLevel, msg string) {
+	if m, ok := s.Assigns().(pageModel); ok {
+		p := m.page()
+		p.Flashes = append(p.Flashes, FlashMessage{Level: level, Message: msg})
+	}
+}
+
+// clearFlashes is an event middleware dropping the flash messages already
+// shown before a client event is handled, so only messages added by the
+// handler are rendered. Background events don't clear anything.
+func clearFlashes(kind, event string, next EventFunc) EventFunc {
+	if kind != "event" || backgroundEvents[event] || event == "flash-dismiss" {
+		return next
+	}
+	return func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		if m, ok := s.Assigns().(pageModel); ok {
+			m.page().Flashes = nil
+		}
+		return next(ctx, s, data)
+	}
+}
+
+// flashDismiss removes the flash message at the "index" param.
+func flashDismiss(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+	if m, ok := s.Assigns().(pageModel); ok {
+		page, i := m.page(), p.Int("index")
+		if i >= 0 && i < len(page.Flashes) {
+			page.Flashes = append(page.Flashes[:i], page.Flashes[i+1:]...)
+		}
+	}
+	return s.Assigns(), nil
+}
+
+// flashSelf handles the "flash" self event, adding the FlashMessage sent
+// with it. Broadcast it to flash every page.
+func flashSelf(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+	if f, ok := data.(FlashMessage); ok {
+		Flash(s, f.Level, f.Message)
+	}
+	return s.Assigns(), nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"html/template"
+	"time"
+
+	"golang.org/x/text/number"
+)
+
+// templateFuncs are available to every template.
+var templateFuncs = template.FuncMap{
+	"version":   func() string { return footerVersion },
+	"sparkline": sparkline,
+	"safe":      safeHTML,
+	"shortcuts": shortcutsJSON,
+	"asset":     staticAssets.URL,
+	"hooks":     staticAssets.Hooks,
+}
+
+// localeFuncs are the template functions formatting for a locale. Every
+// page template is parsed once per locale with them, see Templates.
+func localeFuncs(locales *Locales, loc *Locale) template.FuncMap {
+	return template.FuncMap{
+		"t":          loc.T,
+		"msg":        loc.Format,
+		"temp":       loc.Temp,
+		"formatTemp": loc.FormatTemp,
+		"decimal":    loc.Decimal,
+		"money":      loc.Money,
+		"percent":    loc.Percent,
+		"duration":   loc.Duration,
+		"ago":        loc.Ago,
+		"locale":     loc.Code,
+		"locales":    locales.All,
+	}
+}
+
+// FormatTemp formats a temperature given in degrees Celsius in the unit,
+// "C" or "F".
+func (l *Locale) FormatTemp(celsius float32, unit string) string {
+	if unit == "F" {
+		return l.Decimal(float64(celsius)*9/5+32, 1) + " °F"
+	}
+	return l.Decimal(float64(celsius), 1) + " °C"
+}
+
+// Money formats a price given in cents.
+func (l *Locale) Money(cents int) string {
+	return l.Decimal(float64(cents)/100, 2) + " €"
+}
+
+// Percent formats a ratio, 0.25 being 25%.
+func (l *Locale) Percent(ratio float64) string {
+	return l.printer.Sprint(number.Percent(ratio, number.MaxFractionDigits(1)))
+}
+
+// durationUnits are the units a humanized duration is written in, largest
+// first, with the messages for a single and several units.
+var durationUnits = []struct {
+	size      time.Duration
+	one, many string
+}{
+	{24 * time.Hour, "1 day", "%d days"},
+	{time.Hour, "1 hour", "%d hours"},
+	{time.Minute, "1 minute", "%d minutes"},
+	{time.Second, "1 second", "%d seconds"},
+}
+
+// Duration humanizes d in its largest whole unit, "3 minutes".
+func (l *Locale) Duration(d time.Duration) string {
+	for _, u := range durationUnits {
+		if n := int(d / u.size); n >= 1 || u.size == time.Second {
+			if n == 1 {
+				return l.T(u.one)
+			}
+			return l.T(u.many, n)
+		}
+	}
+	return ""
+}
+
+// Ago tells how long ago t was, "3 minutes ago". The zero time is "never".
+func (l *Locale) Ago(t time.Time) string {
+	if t.IsZero() {
+		return l.T("never")
+	}
+	d := time.Since(t)
+	if d < 10*time.Second {
+		return l.T("just now")
+	}
+	return l.T("%s ago", l.Duration(d))
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-chi/chi/v5"
+	"github.com/jfyne/live"
+)
+
+// gallerySettle is how long the gallery waits for a directory to stop
+// changing before it scans it again, copying a file fires several events.
+const gallerySettle = 300 * time.Millisecond
+
+// galleryTypes are the file extensions the gallery lists. SVG is left out,
+// it could run scripts served from our origin.
+var galleryTypes = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true}
+
+// Image is an image of the gallery. Its tags are the directories it is in.
+type Image struct {
+	// Path is relative to the gallery directory, with slashes.
+	Path     string
+	Name     string
+	Tags     []string
+	Size     int64
+	Modified time.Time
+}
+
+// URL returns where the image is served.
+func (i Image) URL() string {
+	parts := strings.Split(i.Path, "/")
+	for n, p := range parts {
+		parts[n] = url.PathEscape(p)
+	}
+	return "/gallery/images/" + strings.Join(parts, "/")
+}
+
+// HasTags reports whether the image has all the tags.
+func (i Image) HasTags(tags []string) bool {
+	for _, t := range tags {
+		if !containsString(i.Tags, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// TagCount is a tag and the number of images with it.
+type TagCount struct {
+	Tag   string
+	Count int
+}
+
+// Gallery lists the images of a directory and its subdirectories, newest
+// first. Watch keeps the list up to date.
+type Gallery struct {
+	dir string
+
+	mu     sync.Mutex
+	images []Image
+}
+
+// NewGallery creates a gallery of dir. It is empty until scanned.
+func NewGallery(dir string) *Gallery {
+	return &Gallery{dir: dir}
+}
+
+// Scan lists the images of the directory again.
+func (g *Gallery) Scan() error {
+	var images []Image
+	err := filepath.WalkDir(g.dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && file != g.dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || !galleryTypes[strings.ToLower(filepath.Ext(file))] {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			// The file is gone already.
+			return nil
+		}
+		rel, err := filepath.Rel(g.dir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		var tags []string
+		if dir := path.Dir(rel); dir != "." {
+			tags = strings.Split(strings.ToLower(dir), "/")
+		}
+		images = append(images, Image{Path: rel, Name: path.Base(rel), Tags: tags, Size: info.Size(), Modified: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(images, func(i, j int) bool { return images[i].Modified.After(images[j].Modified) })
+
+	g.mu.Lock()
+	g.images = images
+	g.mu.Unlock()
+	return nil
+}
+
+// Images returns the images with all the tags.
+func (g *Gallery) Images(tags []string) []Image {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var images []Image
+	for _, i := range g.images {
+		if i.HasTags(tags) {
+			images = append(images, i)
+		}
+	}
+	return images
+}
+
+// Image returns the image at p.
+func (g *Gallery) Image(p string) (Image, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, i := range g.images {
+		if i.Path == p {
+			return i, true
+		}
+	}
+	return Image{}, false
+}
+
+// Tags returns the tags of the images, by name.
+func (g *Gallery) Tags() []TagCount {
+	g.mu.Lock()
+	counts := map[string]int{}
+	for _, i := range g.images {
+		for _, t := range i.Tags {
+			counts[t]++
+		}
+	}
+	g.mu.Unlock()
+
+	tags := make([]TagCount, 0, len(counts))
+	for t, n := range counts {
+		tags = append(tags, TagCount{Tag: t, Count: n})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Tag < tags[j].Tag })
+	return tags
+}
+
+// Watch scans the directory whenever something in it changes, until ctx is
+// done, and calls changed after each scan.
+func (g *Gallery) Watch(ctx context.Context, changed func()) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	// fsnotify doesn't watch subdirectories, every one is added on its own.
+	watch := func() error {
+		return filepath.WalkDir(g.dir, func(file string, d fs.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return err
+			}
+			return w.Add(file)
+		})
+	}
+	if err := watch(); err != nil {
+		return err
+	}
+
+	settle := time.NewTimer(gallerySettle)
+	settle.Stop()
+	for {
+		select {
+		case ev := <-w.Events:
+			if ev.Op&fsnotify.Create != 0 {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					if err := watch(); err != nil {
+						log.Println("gallery: could not watch", ev.Name, err)
+					}
+				}
+			}
+			settle.Reset(gallerySettle)
+		case err := <-w.Errors:
+			log.Println("gallery watch error:", err)
+		case <-settle.C:
+			if err := g.Scan(); err != nil {
+				log.Println("gallery scan error:", err)
+				continue
+			}
+			changed()
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// ServeHTTP serves the image at the wildcard of the route. Only files the
+// gallery lists are served.
+func (g *Gallery) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p := chi.URLParam(r, "*")
+	if r.URL.RawPath != "" {
+		// chi routes on the escaped path when there is one.
+		p, _ = url.PathUnescape(p)
+	}
+	img, ok := g.Image(p)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeFile(w, r, filepath.Join(g.dir, filepath.FromSlash(img.Path)))
+}
+
+// GalleryModel is the model of the gallery page.
+type GalleryModel struct {
+	Page
+	// Tags are the selected tags, an image needs all of them.
+	Tags    []string
+	AllTags []TagCount `json:"-"`
+	Images  []Image    `json:"-"`
+	// Open is the path of the image shown in the lightbox.
+	Open string
+}
+
+// Selected reports whether the tag is selected.
+func (m *GalleryModel) Selected(tag string) bool {
+	return containsString(m.Tags, tag)
+}
+
+// Lightbox returns the index of the open image in Images, -1 if the
+// lightbox is closed.
+func (m *GalleryModel) Lightbox() int {
+	for i, img := range m.Images {
+		if img.Path == m.Open {
+			return i
+		}
+	}
+	return -1
+}
+
+// Position returns the position of the open image in Images, counting
+// from 1.
+func (m *GalleryModel) Position() int {
+	return m.Lightbox() + 1
+}
+
+// OpenImage returns the image in the lightbox.
+func (m *GalleryModel) OpenImage() Image {
+	if i := m.Lightbox(); i >= 0 {
+		return m.Images[i]
+	}
+	return Image{}
+}
+
+// move opens the image by steps from the open one, wrapping around.
+func (m *GalleryModel) move(steps int) {
+	i := m.Lightbox()
+	if i < 0 {
+		return
+	}
+	n := len(m.Images)
+	m.Open = m.Images[((i+steps)%n+n)%n].Path
+}
+
+// load lists the images with the selected tags. The lightbox closes when
+// its image is gone or filtered out.
+func (m *GalleryModel) load(g *Gallery) {
+	m.AllTags = g.Tags()
+	m.Images = g.Images(m.Tags)
+	if m.Lightbox() < 0 {
+		m.Open = ""
+	}
+}
+
+func galleryModel(s live.Socket) *GalleryModel {
+	if m, ok := s.Assigns().(*GalleryModel); ok {
+		return m
+	}
+	return &GalleryModel{}
+}
+
+// newGallery creates the gallery live handler. The tags to filter by can
+// come with the URL, /gallery?tag=cats&tag=night.
+func newGallery(app *App, g *Gallery) *Handler {
+	h := app.NewHandler()
+	h.HandleRender(app.Render("gallery.html"))
+	h.HandleMount(func(ctx context.Context, s live.Socket) (interface{}, error) {
+		m := galleryModel(s)
+		if m.Tags == nil {
+			for _, t := range live.Request(ctx).URL.Query()["tag"] {
+				if t = strings.ToLower(strings.TrimSpace(t)); t != "" && !containsString(m.Tags, t) {
+					m.Tags = append(m.Tags, t)
+				}
+			}
+		}
+		m.AddShortcut(
+			Shortcut{Key: "ArrowLeft", Event: "gallery-prev", Label: Message{Key: "Previous image"}},
+			Shortcut{Key: "ArrowRight", Event: "gallery-next", Label: Message{Key: "Next image"}},
+		)
+		m.load(g)
+		return m, nil
+	})
+
+	h.HandleEvent("gallery-tag", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := galleryModel(s)
+		tag := p.String("tag")
+		if m.Selected(tag) {
+			var tags []string
+			for _, t := range m.Tags {
+				if t != tag {
+					tags = append(tags, t)
+				}
+			}
+			m.Tags = tags
+		} else {
+			m.Tags = append(m.Tags, tag)
+		}
+		m.load(g)
+		return m, nil
+	})
+	h.HandleEvent("gallery-clear", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := galleryModel(s)
+		m.Tags = nil
+		m.load(g)
+		return m, nil
+	})
+	h.HandleEvent("gallery-open", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := galleryModel(s)
+		m.Open = p.String("path")
+		if m.Lightbox() < 0 {
+			m.Open = ""
+		}
+		return m, nil
+	})
+	h.HandleEvent("gallery-close", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := galleryModel(s)
+		m.Open = ""
+		return m, nil
+	})
+	h.HandleEvent("gallery-prev", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := galleryModel(s)
+		m.move(-1)
+		return m, nil
+	})
+	h.HandleEvent("gallery-next", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := galleryModel(s)
+		m.move(1)
+		return m, nil
+	})
+	h.HandleSelf("gallery", func(ctx context.Context, s live.Socket, _ interface{}) (interface{}, error) {
+		m := galleryModel(s)
+		m.load(g)
+		return m, nil
+	})
+	return h
+}
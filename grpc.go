@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/jfyne/live"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"my-app.com/live/rpc"
+)
+
+// grpcName is the actor of the changes of the gRPC service.
+const grpcName = "gRPC"
+
+// thermostatService is the gRPC service of the thermostat over the
+// Setpoints of the pages: a change made with it shows on the pages, and
+// the watchers follow the changes of the pages.
+type thermostatService struct {
+	rpc.UnimplementedThermostatServer
+	setpoints *Setpoints
+	locales   *Locales
+	// done ends the watches, a graceful stop waits for them otherwise.
+	done <-chan struct{}
+}
+
+// newGRPCServer creates the gRPC server of the thermostat service. The
+// watches end with done.
+//
+//	grpcurl -plaintext -d '{"zone": "kitchen", "temperature": 21.5}' localhost:9090 live.thermostat.v1.Thermostat/SetTemperature
+func newGRPCServer(setpoints *Setpoints, locales *Locales, done <-chan struct{}) *grpc.Server {
+	srv := grpc.NewServer()
+	rpc.RegisterThermostatServer(srv, &thermostatService{setpoints: setpoints, locales: locales, done: done})
+	return srv
+}
+
+func newState(zone string, r Reading) *rpc.State {
+	return &rpc.State{Zone: zone, Setpoint: r.Value, Updated: timestamppb.New(r.Time), TooHot: r.Value > tempLimit}
+}
+
+// control loads the control of the zone of a request.
+func (t *thermostatService) control(ctx context.Context, zone string) (*TempControl, error) {
+	c, err := t.setpoints.Control(ctx, zone)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if c == nil {
+		return nil, status.Errorf(codes.NotFound, "unknown zone %q", zone)
+	}
+	return c, nil
+}
+
+func (t *thermostatService) GetState(ctx context.Context, req *rpc.GetStateRequest) (*rpc.State, error) {
+	c, err := t.control(ctx, req.Zone)
+	if err != nil {
+		return nil, err
+	}
+	return newState(c.Zone, c.History[len(c.History)-1]), nil
+}
+
+func (t *thermostatService) SetTemperature(ctx context.Context, req *rpc.SetTemperatureRequest) (*rpc.State, error) {
+	p := live.Params{"temperature": strconv.FormatFloat(float64(req.Temperature), 'f', -1, 32)}
+	if errs := setpointForm.Validate(p); len(errs) > 0 {
+		return nil, status.Error(codes.InvalidArgument, "temperature: "+t.locales.Get("").Format(errs["temperature"]))
+	}
+	c, err := t.control(ctx, req.Zone)
+	if err != nil {
+		return nil, err
+	}
+	o := SetpointOrigin{Actor: grpcName, Socket: grpcName, Page: rpc.Thermostat_SetTemperature_FullMethodName}
+	err = t.setpoints.Set(ctx, c, req.Temperature, req.Confirmed, o)
+	if errors.Is(err, ErrNotConfirmed) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return newState(c.Zone, c.History[len(c.History)-1]), nil
+}
+
+func (t *thermostatService) WatchState(req *rpc.WatchStateRequest, stream rpc.Thermostat_WatchStateServer) error {
+	ctx := stream.Context()
+	zones := []string{req.Zone}
+	if req.Zone == "" {
+		zones = t.setpoints.Zones()
+	}
+	// Subscribed first, a change made meanwhile follows the states.
+	changes, cancel := t.setpoints.Subscribe(req.Zone)
+	defer cancel()
+	for _, zone := range zones {
+		c, err := t.control(ctx, zone)
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(newState(c.Zone, c.History[len(c.History)-1])); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case change := <-changes:
+			if err := stream.Send(newState(change.Zone, change.Reading)); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.done:
+			return status.Error(codes.Unavailable, "the server is shutting down")
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+
+	"github.com/jfyne/live"
+)
+
+// EventFunc is the common shape of client and self event handlers, used so
+// middleware can wrap both kinds.
+type EventFunc func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error)
+
+// EventMiddleware wraps the handler of an event. kind is "event" for events
+// sent by the client, "self" for events sent by the server and "tick" for
+// those a timer sends every few seconds, see HandleTick.
+type EventMiddleware func(kind, event string, next EventFunc) EventFunc
+
+// MountMiddleware wraps the mount handler of a live handler.
+type MountMiddleware func(next live.MountHandler) live.MountHandler
+
+// Handler is a live handler that applies middleware to every event and
+// self handler registered on it, and to its mount handler. With a State
+// the events of its connected sockets run in their queues, see UseState.
+type Handler struct {
+	*live.BaseHandler
+	middleware []EventMiddleware
+	mounts     []MountMiddleware
+	patches    map[string]PatchFunc
+	selfs      map[string]EventFunc
+	state      *State
+}
+
+// Regions are the texts of the regions of a page by name, the elements
+// with a data-region attribute.
+type Regions map[string]string
+
+// PatchFunc handles a patch event: it updates the model of the socket and
+// returns it with the regions of the page the change shows in.
+type PatchFunc func(ctx context.Context, s live.Socket, data interface{}) (interface{}, Regions, error)
+
+// NewHandler creates a handler with the given event middleware. Middleware
+// run in the order given, the first one being the outermost.
+func NewHandler(middleware ...EventMiddleware) *Handler {
+	return &Handler{
+		BaseHandler: live.NewHandler(),
+		middleware:  middleware,
+		selfs:       map[string]EventFunc{},
+	}
+}
+
+// UseState runs the events of every connected socket in its queue of st.
+// It has to be called before the handlers are registered.
+func (h *Handler) UseState(st *State) {
+	h.state = st
+}
+
+// UseMount adds middleware around the mount handler. It has to be called
+// before HandleMount.
+func (h *Handler) UseMount(middleware ...MountMiddleware) {
+	h.mounts = append(h.mounts, middleware...)
+}
+
+// HandleMount registers the mount handler wrapped in the mount middleware.
+func (h *Handler) HandleMount(mount live.MountHandler) {
+	for i := len(h.mounts) - 1; i >= 0; i-- {
+		mount = h.mounts[i](mount)
+	}
+	if h.state == nil {
+		h.BaseHandler.HandleMount(mount)
+		return
+	}
+	// The socket is registered first, for the goroutines the mount starts
+	// to send it self events. They wait for its first render.
+	h.BaseHandler.HandleMount(func(ctx context.Context, s live.Socket) (interface{}, error) {
+		if c := connFromContext(ctx); c != nil && s.Connected() {
+			if engine, ok := c.handler.(live.Engine); ok {
+				c.state.mount(ctx, s, engine, h)
+				defer s.Send(stateReady, nil)
+			}
+		}
+		return mount(ctx, s)
+	})
+}
+
+// HandleEvent registers a client event handler wrapped in the middleware.
+func (h *Handler) HandleEvent(t string, handler live.EventHandler) {
+	h.handleEvent("event", t, handler)
+}
+
+func (h *Handler) handleEvent(kind, t string, handler live.EventHandler) {
+	fn := h.wrap(kind, t, func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		return handler(ctx, s, data.(live.Params))
+	})
+	h.BaseHandler.HandleEvent(t, func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		return fn(ctx, s, p)
+	})
+}
+
+// HandleParams registers a handler of the URL query changes of live-patch
+// links and the browser history, wrapped in the middleware as the "params"
+// event.
+func (h *Handler) HandleParams(handler live.EventHandler) {
+	fn := h.wrap("params", "params", func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		return handler(ctx, s, data.(live.Params))
+	})
+	h.BaseHandler.HandleParams(func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		return fn(ctx, s, p)
+	})
+}
+
+// HandleSelf registers a self event handler wrapped in the middleware.
+// With a State the handler is kept for the queues of the sockets, which
+// don't take the events of Self.
+func (h *Handler) HandleSelf(t string, handler live.SelfHandler) {
+	h.handleSelf("self", t, handler)
+}
+
+// HandleTick registers the handler of a self event a timer sends every few
+// seconds, such as the refresh of a page, wrapped in the middleware as a
+// "tick". The event log leaves the ticks out.
+func (h *Handler) HandleTick(t string, handler live.SelfHandler) {
+	h.handleSelf("tick", t, handler)
+}
+
+func (h *Handler) handleSelf(kind, t string, handler live.SelfHandler) {
+	fn := h.wrap(kind, t, EventFunc(handler))
+	if h.state != nil {
+		h.selfs[t] = fn
+		return
+	}
+	h.BaseHandler.HandleSelf(t, live.SelfHandler(fn))
+}
+
+// HandlePatch registers the handler of a patch event, sent to every page
+// with App.Patch. A patch doesn't render the page: the "regions" hook of
+// the layout replaces the text of the regions the handler returns, and the
+// next render shows the patched model. It suits the small changes of every
+// socket, such as the time, whose render and diff would cost more than the
+// change. A patch isn't wrapped in the event middleware, it doesn't render.
+func (h *Handler) HandlePatch(t string, handler PatchFunc) {
+	if h.patches == nil {
+		h.patches = map[string]PatchFunc{}
+	}
+	h.patches[t] = handler
+}
+
+// patch handles the patch event t on s, sending the changed regions to the
+// client. Without a handler of t the event is ignored.
+func (h *Handler) patch(ctx context.Context, s live.Socket, t string, data interface{}) error {
+	handler, ok := h.patches[t]
+	if !ok {
+		return nil
+	}
+	assigns, regions, err := handler(ctx, s, data)
+	if err != nil {
+		return err
+	}
+	s.Assign(assigns)
+	if len(regions) == 0 {
+		return nil
+	}
+	return s.Send("regions", regions)
+}
+
+func (h *Handler) wrap(kind, event string, fn EventFunc) EventFunc {
+	for i := len(h.middleware) - 1; i >= 0; i-- {
+		fn = h.middleware[i](kind, event, fn)
+	}
+	return fn
+}
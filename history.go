@@ -0,0 +1,181 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// historyRetention is how long the setpoint changes of a zone are kept.
+const historyRetention = 7 * 24 * time.Hour
+
+// Alert is a setpoint change taking a zone over the warning limit.
+type Alert struct {
+	Time  time.Time
+	Value float32
+}
+
+// DayStats summarizes the setpoint changes of a zone on one day.
+type DayStats struct {
+	Day           time.Time
+	Min, Max, Avg float32
+	Changes       int
+	Alerts        int
+}
+
+// ZoneHistory keeps the setpoint changes and alerts of every zone, shared
+// by the sockets of all pages. Entries older than the retention are
+// dropped.
+type ZoneHistory struct {
+	retention time.Duration
+	// OnAlert, when set, is called with every new alert.
+	OnAlert func(zone string, a Alert)
+	// OnRecord, when set, is called with every reading recorded.
+	OnRecord func(zone string, r Reading)
+
+	mu    sync.Mutex
+	zones map[string]*zoneLog
+}
+
+type zoneLog struct {
+	readings []Reading
+	alerts   []Alert
+}
+
+// NewZoneHistory creates a history keeping entries for retention.
+func NewZoneHistory(retention time.Duration) *ZoneHistory {
+	return &ZoneHistory{retention: retention, zones: map[string]*zoneLog{}}
+}
+
+// Record adds a setpoint of zone. Crossing the warning limit adds an alert.
+func (h *ZoneHistory) Record(zone string, r Reading) {
+	if alert, ok := h.record(zone, r); ok && h.OnAlert != nil {
+		h.OnAlert(zone, alert)
+	}
+	if h.OnRecord != nil {
+		h.OnRecord(zone, r)
+	}
+}
+
+// Restore adds a setpoint of zone recorded before, without the callbacks:
+// an alert it raises was notified already.
+func (h *ZoneHistory) Restore(zone string, r Reading) {
+	h.record(zone, r)
+}
+
+func (h *ZoneHistory) record(zone string, r Reading) (alert Alert, alerted bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	z := h.zones[zone]
+	if z == nil {
+		z = &zoneLog{}
+		h.zones[zone] = z
+	}
+	hot := r.Value > tempLimit
+	if n := len(z.readings); hot && (n == 0 || z.readings[n-1].Value <= tempLimit) {
+		alert, alerted = Alert{Time: r.Time, Value: r.Value}, true
+		z.alerts = append(z.alerts, alert)
+	}
+	z.readings = append(z.readings, r)
+
+	cutoff := r.Time.Add(-h.retention)
+	for len(z.readings) > 0 && z.readings[0].Time.Before(cutoff) {
+		z.readings = z.readings[1:]
+	}
+	for len(z.alerts) > 0 && z.alerts[0].Time.Before(cutoff) {
+		z.alerts = z.alerts[1:]
+	}
+	return alert, alerted
+}
+
+// Import merges readings recorded elsewhere, by zone, into the history in
+// the order of their times, without the callbacks; a reading at the time of
+// one it has, to the millisecond the databases keep, is skipped. The alerts are those of the merged readings.
+func (h *ZoneHistory) Import(zones map[string][]Reading) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for zone, readings := range zones {
+		z := h.zones[zone]
+		if z == nil {
+			z = &zoneLog{}
+			h.zones[zone] = z
+		}
+		merged := append(append([]Reading(nil), z.readings...), readings...)
+		sort.SliceStable(merged, func(i, j int) bool { return merged[i].Time.Before(merged[j].Time) })
+		z.readings, z.alerts = z.readings[:0], nil
+		for _, r := range merged {
+			n := len(z.readings)
+			if n > 0 && z.readings[n-1].Time.UnixMilli() == r.Time.UnixMilli() {
+				continue
+			}
+			if r.Value > tempLimit && (n == 0 || z.readings[n-1].Value <= tempLimit) {
+				z.alerts = append(z.alerts, Alert{Time: r.Time, Value: r.Value})
+			}
+			z.readings = append(z.readings, r)
+		}
+		if n := len(z.readings); n > 0 {
+			cutoff := z.readings[n-1].Time.Add(-h.retention)
+			for len(z.readings) > 0 && z.readings[0].Time.Before(cutoff) {
+				z.readings = z.readings[1:]
+			}
+			for len(z.alerts) > 0 && z.alerts[0].Time.Before(cutoff) {
+				z.alerts = z.alerts[1:]
+			}
+		}
+	}
+}
+
+// Readings returns the setpoints of zone, oldest first.
+func (h *ZoneHistory) Readings(zone string) []Reading {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if z := h.zones[zone]; z != nil {
+		return append([]Reading(nil), z.readings...)
+	}
+	return nil
+}
+
+// Alerts returns the alerts of zone, oldest first.
+func (h *ZoneHistory) Alerts(zone string) []Alert {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if z := h.zones[zone]; z != nil {
+		return append([]Alert(nil), z.alerts...)
+	}
+	return nil
+}
+
+// Daily returns the statistics of zone per day in loc, oldest first.
+func (h *ZoneHistory) Daily(zone string, loc *time.Location) []DayStats {
+	var days []DayStats
+	var sum float64
+	for _, r := range h.Readings(zone) {
+		t := r.Time.In(loc)
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		if n := len(days); n == 0 || !days[n-1].Day.Equal(day) {
+			days = append(days, DayStats{Day: day, Min: r.Value, Max: r.Value})
+			sum = 0
+		}
+		d := &days[len(days)-1]
+		if r.Value < d.Min {
+			d.Min = r.Value
+		}
+		if r.Value > d.Max {
+			d.Max = r.Value
+		}
+		d.Changes++
+		sum += float64(r.Value)
+		d.Avg = float32(sum / float64(d.Changes))
+	}
+	for _, a := range h.Alerts(zone) {
+		t := a.Time.In(loc)
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		for i := range days {
+			if days[i].Day.Equal(day) {
+				days[i].Alerts++
+			}
+		}
+	}
+	return days
+}
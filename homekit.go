@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/characteristic"
+)
+
+// homekitSocket is the socket of the events the HomeKit bridge logs.
+const homekitSocket = "homekit"
+
+// HomeKitConfig configures the HomeKit bridge.
+type HomeKitConfig struct {
+	// Pin is the setup code the Home app pairs with, the bridge is
+	// disabled without one.
+	Pin string
+	// Addr is the address the bridge listens on, a random port when empty.
+	Addr string
+	// Dir keeps the keys and the pairings of the bridge.
+	Dir string
+}
+
+// HomeKitBridge bridges the zones to HomeKit, a thermostat accessory per
+// zone, so the thermostat is controlled from the Home app of iOS. A target
+// temperature set in Home goes through the Setpoints like the setpoint
+// form, and the changes of the pages and the other services show in Home.
+// Home has no confirmation, so a setpoint over the warning limit is refused
+// unless the zone already is over it. The zones are those of the start,
+// one added later shows after a restart.
+type HomeKitBridge struct {
+	cfg       HomeKitConfig
+	setpoints *Setpoints
+	server    *hap.Server
+	zones     map[string]*accessory.Thermostat
+}
+
+// NewHomeKitBridge creates the bridge of cfg over setpoints, with the
+// setpoints the zones have now.
+func NewHomeKitBridge(ctx context.Context, cfg HomeKitConfig, setpoints *Setpoints) (*HomeKitBridge, error) {
+	b := &HomeKitBridge{cfg: cfg, setpoints: setpoints, zones: map[string]*accessory.Thermostat{}}
+	bridge := accessory.NewBridge(accessory.Info{Name: "Live", Manufacturer: "Live", Model: "Bridge", Firmware: Version})
+	var thermostats []*accessory.A
+	for _, zone := range setpoints.Zones() {
+		c, err := setpoints.Control(ctx, zone)
+		if err != nil {
+			return nil, fmt.Errorf("could not load the setpoint of %s: %w", zone, err)
+		}
+		t := b.thermostat(zone, c.Temperature)
+		b.zones[zone] = t
+		thermostats = append(thermostats, t.A)
+	}
+	server, err := hap.NewServer(hap.NewFsStore(cfg.Dir), bridge.A, thermostats...)
+	if err != nil {
+		return nil, fmt.Errorf("could not create the HomeKit bridge: %w", err)
+	}
+	server.Pin, server.Addr = cfg.Pin, cfg.Addr
+	b.server = server
+	return b, nil
+}
+
+// thermostat returns the accessory of zone, heating to setpoint.
+func (b *HomeKitBridge) thermostat(zone string, setpoint float32) *accessory.Thermostat {
+	t := accessory.NewThermostat(accessory.Info{Name: zone, SerialNumber: zone, Manufacturer: "Live", Model: "Zone", Firmware: Version})
+	// The IDs of the accessories follow the zones, not their order, so Home
+	// keeps its rooms and scenes when the zones change. 1 is the bridge.
+	h := fnv.New32a()
+	h.Write([]byte(zone))
+	t.Id = uint64(h.Sum32()) + 2
+
+	// The zones only heat, the minimum and maximum are those of the
+	// setpoint form.
+	s := t.Thermostat
+	s.TargetHeatingCoolingState.ValidVals = []int{characteristic.TargetHeatingCoolingStateHeat}
+	s.TargetHeatingCoolingState.SetValue(characteristic.TargetHeatingCoolingStateHeat)
+	s.CurrentHeatingCoolingState.SetValue(characteristic.CurrentHeatingCoolingStateHeat)
+	s.TargetTemperature.SetMinValue(5)
+	s.TargetTemperature.SetMaxValue(35)
+	s.TargetTemperature.SetValue(float64(setpoint))
+	// The zones of the demo have no sensor of their own, the readings are
+	// their setpoints.
+	s.CurrentTemperature.SetValue(float64(setpoint))
+	s.TargetTemperature.OnSetRemoteValue(func(v float64) error {
+		return b.set(zone, float32(v))
+	})
+	return t
+}
+
+// set sets the setpoint of zone from Home. An error answers Home that the
+// change failed.
+func (b *HomeKitBridge) set(zone string, to float32) error {
+	ctx := context.Background()
+	c, err := b.setpoints.Control(ctx, zone)
+	if err != nil {
+		log.Println("homekit:", err)
+		return err
+	}
+	if c == nil {
+		return fmt.Errorf("unknown zone %s", zone)
+	}
+	o := SetpointOrigin{Actor: "HomeKit", Socket: homekitSocket, Page: "/homekit"}
+	if err := b.setpoints.Set(ctx, c, to, false, o); err != nil {
+		log.Println("homekit:", err)
+		return err
+	}
+	return nil
+}
+
+// ListenAndServe announces the bridge on the local network and serves it
+// until ctx is done; the changes of the setpoints show in Home meanwhile.
+func (b *HomeKitBridge) ListenAndServe(ctx context.Context) error {
+	changes, cancel := b.setpoints.Subscribe("")
+	defer cancel()
+	go func() {
+		for {
+			select {
+			case change := <-changes:
+				b.update(change)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	log.Printf("HomeKit bridge pairing with the setup code %s", b.cfg.Pin)
+	return b.server.ListenAndServe(ctx)
+}
+
+// update shows a change of the setpoints in Home. The change Home made
+// itself is already its value.
+func (b *HomeKitBridge) update(change SetpointChange) {
+	t, ok := b.zones[change.Zone]
+	if !ok {
+		return
+	}
+	v := float64(change.Reading.Value)
+	t.Thermostat.TargetTemperature.SetValue(v)
+	t.Thermostat.CurrentTemperature.SetValue(v)
+}
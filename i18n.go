@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/jfyne/live"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// defaultLocale is used when no supported locale matches the request.
+const defaultLocale = "en"
+
+// Locale holds the message catalog of a language and formats numbers the
+// way it writes them. Messages are keyed by their English text, so a
+// missing translation falls back to English.
+type Locale struct {
+	Tag  language.Tag
+	Name string
+
+	messages map[string]string
+	printer  *message.Printer
+}
+
+// Code returns the language code of the locale.
+func (l *Locale) Code() string {
+	return l.Tag.String()
+}
+
+// T translates msg. With args the translation is used as a format string.
+func (l *Locale) T(msg string, args ...interface{}) string {
+	if m, ok := l.messages[msg]; ok {
+		msg = m
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return l.printer.Sprintf(msg, args...)
+}
+
+// Message is a text to translate with its format arguments, for texts
+// built before the locale is known.
+type Message struct {
+	Key  string
+	Args []interface{}
+}
+
+// Format translates msg.
+func (l *Locale) Format(msg Message) string {
+	return l.T(msg.Key, msg.Args...)
+}
+
+// Decimal formats v with the given number of decimals.
+func (l *Locale) Decimal(v float64, decimals int) string {
+	return l.printer.Sprintf("%.*f", decimals, v)
+}
+
+// Temp formats a temperature in degrees Celsius.
+func (l *Locale) Temp(v float32) string {
+	return l.FormatTemp(v, "C")
+}
+
+// Locales is the set of supported locales.
+type Locales struct {
+	list    []*Locale
+	byCode  map[string]*Locale
+	matcher language.Matcher
+}
+
+// LoadLocales loads the message catalogs from the JSON files of fsys, one
+// file per language named after its code. The "_name" message is the name
+// of the language in the language switcher.
+func LoadLocales(fsys fs.FS) (*Locales, error) {
+	files, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+	l := &Locales{byCode: map[string]*Locale{}}
+	for _, file := range files {
+		code := strings.TrimSuffix(path.Base(file), ".json")
+		tag, err := language.Parse(code)
+		if err != nil {
+			return nil, fmt.Errorf("locale %s: %w", file, err)
+		}
+		b, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		messages := map[string]string{}
+		if err := json.Unmarshal(b, &messages); err != nil {
+			return nil, fmt.Errorf("locale %s: %w", file, err)
+		}
+		loc := &Locale{
+			Tag:      tag,
+			Name:     messages["_name"],
+			messages: messages,
+			printer:  message.NewPrinter(tag),
+		}
+		l.list = append(l.list, loc)
+		l.byCode[loc.Code()] = loc
+	}
+	if l.byCode[defaultLocale] == nil {
+		return nil, fmt.Errorf("missing catalog of the default locale %q", defaultLocale)
+	}
+
+	// The matcher falls back to its first tag.
+	sort.SliceStable(l.list, func(i, j int) bool { return l.list[i].Code() == defaultLocale })
+	tags := make([]language.Tag, len(l.list))
+	for i, loc := range l.list {
+		tags[i] = loc.Tag
+	}
+	l.matcher = language.NewMatcher(tags)
+	return l, nil
+}
+
+// mustLoadLocales loads the embedded message catalogs.
+func mustLoadLocales() *Locales {
+	sub, err := fs.Sub(localeFiles, "locales")
+	if err != nil {
+		panic(err)
+	}
+	l, err := LoadLocales(sub)
+	if err != nil {
+		panic(err)
+	}
+	return l
+}
+
+// All returns the supported locales, the default one first.
+func (l *Locales) All() []*Locale {
+	return l.list
+}
+
+// Get returns the locale with the given code, the default locale if it is
+// not supported.
+func (l *Locales) Get(code string) *Locale {
+	if loc, ok := l.byCode[code]; ok {
+		return loc
+	}
+	return l.byCode[defaultLocale]
+}
+
+// Negotiate returns the locale for a request, from the "lang" query param
+// or the Accept-Language header.
+func (l *Locales) Negotiate(r *http.Request) *Locale {
+	tags, _, _ := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	if lang := r.URL.Query().Get("lang"); lang != "" {
+		if tag, err := language.Parse(lang); err == nil {
+			tags = append([]language.Tag{tag}, tags...)
+		}
+	}
+	_, i, _ := l.matcher.Match(tags...)
+	return l.list[i]
+}
+
+// negotiateLocale is a mount middleware picking the locale of the page,
+// unless the model already has one, for example restored from the stored
+// assigns. The "lang" query param always wins.
+func negotiateLocale(locales *Locales) MountMiddleware {
+	return func(mount live.MountHandler) live.MountHandler {
+		return func(ctx context.Context, s live.Socket) (interface{}, error) {
+			model, err := mount(ctx, s)
+			if err != nil {
+				return model, err
+			}
+			m, ok := model.(pageModel)
+			r := live.Request(ctx)
+			if !ok || r == nil {
+				return model, nil
+			}
+			if p := m.page(); p.Locale == "" || r.URL.Query().Get("lang") != "" {
+				p.Locale = locales.Negotiate(r).Code()
+			}
+			return model, nil
+		}
+	}
+}
+
+// setLocale switches the page to the locale in the "locale" param.
+func setLocale(locales *Locales) live.EventHandler {
+	return func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		if m, ok := s.Assigns().(pageModel); ok {
+			m.page().Locale = locales.Get(p.String("locale")).Code()
+		}
+		return s.Assigns(), nil
+	}
+}
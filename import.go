@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"my-app.com/live/store"
+)
+
+const (
+	// importMaxSize is the largest CSV file the import endpoint reads.
+	importMaxSize = 32 << 20
+	// importMaxErrors is the number of invalid rows an import reports,
+	// the count has them all.
+	importMaxErrors = 20
+)
+
+// importTimeFormats are the formats of the times of a sensor log besides
+// Unix seconds, without a zone in the timezone of the import.
+var importTimeFormats = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02T15:04:05"}
+
+// importRanges are the plausible values of each kind, a row outside of
+// them is a broken sensor.
+var importRanges = map[string][2]float64{
+	store.Temperature: {-50, 100},
+	store.Humidity:    {0, 100},
+}
+
+// ImportRow is a valid row of a sensor log.
+type ImportRow struct {
+	Zone, Kind string
+	Time       time.Time
+	Value      float64
+}
+
+// ImportResult is what an import did: the rows read, those added to the
+// readings, the duplicates skipped and the first invalid rows.
+type ImportResult struct {
+	Rows       int           `json:"rows"`
+	Imported   int           `json:"imported"`
+	Duplicates int           `json:"duplicates"`
+	Invalid    int           `json:"invalid"`
+	Errors     []ImportError `json:"errors,omitempty"`
+}
+
+// ImportError is an invalid row, by its line in the file.
+type ImportError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// ParseReadings parses a CSV sensor log: a header naming the columns zone,
+// time and value, and optionally kind, temperature by default, in any
+// order. The separator is the one of the header, a comma, a semicolon or a
+// tab; with a semicolon or a tab the values may have a decimal comma. The
+// times are RFC 3339, "2006-01-02 15:04:05" in loc or Unix seconds. The
+// invalid rows are counted in the result, the first ones with their error,
+// and the rows repeating a zone, kind and time are dropped.
+func ParseReadings(r io.Reader, loc *time.Location) ([]ImportRow, ImportResult, error) {
+	var res ImportResult
+	text, err := io.ReadAll(r)
+	if err != nil {
+		return nil, res, err
+	}
+	header, _, _ := strings.Cut(string(text), "\n")
+	c := csv.NewReader(strings.NewReader(string(text)))
+	c.Comment = '#'
+	c.FieldsPerRecord = -1
+	switch {
+	case strings.Contains(header, ";"):
+		c.Comma = ';'
+	case strings.Contains(header, "\t"):
+		c.Comma = '\t'
+	}
+	names, err := c.Read()
+	if err == io.EOF {
+		return nil, res, errors.New("the file is empty")
+	}
+	if err != nil {
+		return nil, res, err
+	}
+	col := map[string]int{}
+	for i, name := range names {
+		col[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, name := range []string{"zone", "time", "value"} {
+		if _, ok := col[name]; !ok {
+			return nil, res, fmt.Errorf("the header has no %s column", name)
+		}
+	}
+
+	type key struct {
+		zone, kind string
+		time       int64
+	}
+	seen := map[key]bool{}
+	var rows []ImportRow
+	for {
+		record, err := c.Read()
+		if err == io.EOF {
+			break
+		}
+		res.Rows++
+		var row ImportRow
+		var line int
+		if perr := (*csv.ParseError)(nil); errors.As(err, &perr) {
+			line, err = perr.StartLine, perr.Err
+		} else if err == nil {
+			line, _ = c.FieldPos(0)
+			row, err = parseReadingRow(record, col, c.Comma != ',', loc)
+		}
+		if err != nil {
+			res.Invalid++
+			if len(res.Errors) < importMaxErrors {
+				res.Errors = append(res.Errors, ImportError{Line: line, Error: err.Error()})
+			}
+			continue
+		}
+		k := key{row.Zone, row.Kind, row.Time.UnixMilli()}
+		if seen[k] {
+			res.Duplicates++
+			continue
+		}
+		seen[k] = true
+		rows = append(rows, row)
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Time.Before(rows[j].Time) })
+	return rows, res, nil
+}
+
+// parseReadingRow parses and validates the record of a row, decimalComma
+// accepts "21,5".
+func parseReadingRow(record []string, col map[string]int, decimalComma bool, loc *time.Location) (ImportRow, error) {
+	field := func(name string) string {
+		if i, ok := col[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	row := ImportRow{Zone: field("zone"), Kind: strings.ToLower(field("kind"))}
+	if row.Zone == "" || len(row.Zone) > 40 || Slug()(row.Zone) != nil {
+		return row, fmt.Errorf("invalid zone %q, use lowercase letters, digits and dashes", row.Zone)
+	}
+	if row.Kind == "" {
+		row.Kind = store.Temperature
+	}
+	limits, ok := importRanges[row.Kind]
+	if !ok {
+		return row, fmt.Errorf("unknown kind %q", row.Kind)
+	}
+	t, err := parseReadingTime(field("time"), loc)
+	if err != nil {
+		return row, err
+	}
+	if t.After(time.Now().Add(time.Minute)) {
+		return row, fmt.Errorf("the time %s is in the future", field("time"))
+	}
+	// The databases keep the times to the millisecond.
+	row.Time = t.Truncate(time.Millisecond)
+	v := field("value")
+	if decimalComma {
+		v = strings.Replace(v, ",", ".", 1)
+	}
+	if row.Value, err = strconv.ParseFloat(v, 64); err != nil {
+		return row, fmt.Errorf("invalid value %q", field("value"))
+	}
+	if row.Value < limits[0] || row.Value > limits[1] {
+		return row, fmt.Errorf("the %s %g is out of %g to %g", row.Kind, row.Value, limits[0], limits[1])
+	}
+	return row, nil
+}
+
+func parseReadingTime(v string, loc *time.Location) (time.Time, error) {
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	for _, layout := range importTimeFormats {
+		if t, err := time.ParseInLocation(layout, v, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, use RFC 3339, 2006-01-02 15:04:05 or Unix seconds", v)
+}
+
+// ImportReadings adds rows to the raw samples of readings, skipping the
+// rows a raw sample of the repository already has the time of, so a log
+// imported twice is imported once. The samples already compacted into
+// hourly or daily aggregates aren't compared. It returns the rows added.
+func ImportReadings(ctx context.Context, readings store.ReadingRepo, rows []ImportRow, res *ImportResult) ([]ImportRow, error) {
+	type series struct{ zone, kind string }
+	spans := map[series][2]time.Time{}
+	for _, row := range rows {
+		s := series{row.Zone, row.Kind}
+		span, ok := spans[s]
+		if !ok || row.Time.Before(span[0]) {
+			span[0] = row.Time
+		}
+		if !ok || row.Time.After(span[1]) {
+			span[1] = row.Time
+		}
+		spans[s] = span
+	}
+	stored := map[series]map[int64]bool{}
+	for s, span := range spans {
+		existing, err := readings.Range(ctx, s.zone, s.kind, store.Raw, span[0], span[1].Add(time.Millisecond))
+		if err != nil {
+			return nil, fmt.Errorf("could not load the readings of %s: %w", s.zone, err)
+		}
+		times := map[int64]bool{}
+		for _, a := range existing {
+			times[a.Start.UnixMilli()] = true
+		}
+		stored[s] = times
+	}
+	var added []ImportRow
+	for _, row := range rows {
+		if stored[series{row.Zone, row.Kind}][row.Time.UnixMilli()] {
+			res.Duplicates++
+			continue
+		}
+		if err := readings.Add(ctx, store.Sample(row.Zone, row.Kind, row.Time, row.Value)); err != nil {
+			return added, fmt.Errorf("could not add the reading of %s at %s: %w", row.Zone, row.Time.Format(time.RFC3339), err)
+		}
+		added = append(added, row)
+		res.Imported++
+	}
+	return added, nil
+}
+
+// importHandler imports a CSV sensor log posted as the body into the
+// readings, the temperatures within the retention of the zone history
+// show on the report and the charts too. The times without a zone are in
+// the timezone of the "tz" query param, the server's by default. It answers the
+// ImportResult, 422 when no row is valid. It is mounted on the admin
+// group.
+//
+//	curl -u admin:secret -X POST 'localhost:8080/admin/import/readings?tz=Europe/Prague' --data-binary @sensors.csv
+func importHandler(a *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		loc := time.Local
+		if tz := r.URL.Query().Get("tz"); tz != "" {
+			var err error
+			if loc, err = time.LoadLocation(tz); err != nil {
+				apiError(w, http.StatusBadRequest, fmt.Sprintf("unknown timezone %q", tz))
+				return
+			}
+		}
+		rows, res, err := ParseReadings(http.MaxBytesReader(w, r.Body, importMaxSize), loc)
+		if err != nil {
+			apiError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if len(rows) == 0 && res.Invalid > 0 {
+			writeJSON(w, http.StatusUnprocessableEntity, res)
+			return
+		}
+		added, err := ImportReadings(r.Context(), a.Repos.Readings, rows, &res)
+		a.History.Import(historyReadings(added))
+		if err != nil {
+			apiFail(w, err)
+			return
+		}
+		a.Audit.RecordRequest(r, AuditImport, "readings", fmt.Sprintf("%d of %d rows", res.Imported, res.Rows))
+		writeJSON(w, http.StatusOK, res)
+	}
+}
+
+// historyReadings returns the temperatures of rows by zone, as the zone
+// history records them.
+func historyReadings(rows []ImportRow) map[string][]Reading {
+	zones := map[string][]Reading{}
+	for _, row := range rows {
+		if row.Kind == store.Temperature {
+			zones[row.Zone] = append(zones[row.Zone], Reading{Time: row.Time, Value: float32(row.Value)})
+		}
+	}
+	return zones
+}
+
+// loadHistory loads the temperatures of readings within the retention of
+// history into it, the raw samples and the hourly averages of those
+// already compacted, so the history has the imported readings and, without
+// the event log, those of the runs before. A raw sample at the time of a
+// reading of the history, and an hourly average of an hour it has readings
+// of, are those of the projected events.
+func loadHistory(ctx context.Context, readings store.ReadingRepo, history *ZoneHistory) error {
+	now := time.Now()
+	type known struct{ times, hours map[int64]bool }
+	has := map[string]known{}
+	zones := map[string][]Reading{}
+	err := readings.Each(ctx, now.Add(-history.retention), now, func(a store.Aggregate) error {
+		if a.Kind != store.Temperature || a.Resolution == store.Daily {
+			return nil
+		}
+		k, ok := has[a.Zone]
+		if !ok {
+			k = known{times: map[int64]bool{}, hours: map[int64]bool{}}
+			for _, r := range history.Readings(a.Zone) {
+				k.times[r.Time.UnixMilli()] = true
+				k.hours[store.Hourly.Truncate(r.Time).Unix()] = true
+			}
+			has[a.Zone] = k
+		}
+		if a.Resolution == store.Raw && k.times[a.Start.UnixMilli()] || a.Resolution == store.Hourly && k.hours[a.Start.Unix()] {
+			return nil
+		}
+		zones[a.Zone] = append(zones[a.Zone], Reading{Time: a.Start, Value: float32(a.Avg())})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not load the zone history: %w", err)
+	}
+	history.Import(zones)
+	return nil
+}
+
+// importCommand is the import command, it imports a CSV sensor log into
+// the readings of the database of the flags, see ParseReadings. The times
+// without a zone are in the local timezone, that of $TZ.
+//
+//	TZ=Europe/Prague live import --db live.db sensors.csv
+func importCommand(args []string) error {
+	cfg, err := LoadConfig(args)
+	if err != nil {
+		return err
+	}
+	if len(cfg.Args) != 1 {
+		return fmt.Errorf("usage: live import [flags] file.csv")
+	}
+	f, err := os.Open(cfg.Args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	rows, res, err := ParseReadings(f, time.Local)
+	if err != nil {
+		return fmt.Errorf("could not import %s: %w", cfg.Args[0], err)
+	}
+	ctx := context.Background()
+	db, err := openDatabase(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := db.Migrate(ctx); err != nil {
+		return err
+	}
+	if _, err := ImportReadings(ctx, db.Repos().Readings, rows, &res); err != nil {
+		return err
+	}
+	for _, e := range res.Errors {
+		fmt.Fprintf(os.Stderr, "%s:%d: %s\n", cfg.Args[0], e.Line, e.Error)
+	}
+	fmt.Printf("imported %d of %d rows, %d duplicates, %d invalid\n", res.Imported, res.Rows, res.Duplicates, res.Invalid)
+	return nil
+}
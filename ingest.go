@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jfyne/live"
+)
+
+// The events the ingest rules send.
+const (
+	// IngestFlash flashes Text at Level on every page, or on the page of the
+	// socket Socket only.
+	IngestFlash = "flash"
+	// IngestStatus shows Text in the status feed of Page.
+	IngestStatus = "status"
+	// IngestSetpoint sets the setpoint of Zone to Temperature through the
+	// Setpoints, with the validation of the setpoint form.
+	IngestSetpoint = "setpoint"
+)
+
+// ingestSocket is the socket of the events the ingested setpoints log.
+const ingestSocket = "ingest"
+
+// IngestSource is a system posting to /ingest/{token}, IFTTT, a sensor or a
+// CI job, with the rules its payloads go through.
+type IngestSource struct {
+	Name  string       `json:"name"`
+	Token string       `json:"token"`
+	Rules []IngestRule `json:"rules"`
+}
+
+// IngestRule maps the payloads it matches to an event. The texts, the
+// socket, the zone and the temperature are templates of the payload,
+// "{{.sensor.name}} is open".
+type IngestRule struct {
+	// When are the fields the payload must have, by dotted path, with
+	// their values as text; a rule without matches every payload.
+	When map[string]string `json:"when"`
+	// Event is IngestFlash, IngestStatus or IngestSetpoint.
+	Event       string     `json:"event"`
+	Page        string     `json:"page,omitempty"`
+	Socket      string     `json:"socket,omitempty"`
+	Level       FlashLevel `json:"level,omitempty"`
+	Text        string     `json:"text,omitempty"`
+	Zone        string     `json:"zone,omitempty"`
+	Temperature string     `json:"temperature,omitempty"`
+	// Confirmed sets the setpoints over the warning limit, refused
+	// otherwise.
+	Confirmed bool `json:"confirmed,omitempty"`
+
+	templates map[string]*template.Template
+}
+
+// Ingest serves /ingest/{token}: the JSON payloads of the sources go through
+// the rules of their source, each matching rule sends its event. A token of
+// no source is refused.
+//
+//	curl -X POST localhost:8080/ingest/s3cret -d '{"sensor": {"name": "door", "state": "open"}}'
+type Ingest struct {
+	app     *App
+	pages   map[string]Broadcaster
+	sources []IngestSource
+}
+
+// LoadIngest loads the sources of the JSON file path. The status events go
+// to the pages of pages, by name.
+func LoadIngest(path string, app *App, pages map[string]Broadcaster) (*Ingest, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the ingest rules: %w", err)
+	}
+	in := &Ingest{app: app, pages: pages}
+	if err := json.Unmarshal(b, &in.sources); err != nil {
+		return nil, fmt.Errorf("invalid ingest rules %s: %w", path, err)
+	}
+	for i := range in.sources {
+		src := &in.sources[i]
+		if src.Name == "" || src.Token == "" {
+			return nil, fmt.Errorf("ingest source %d: a source needs a name and a token", i+1)
+		}
+		for j := range src.Rules {
+			if err := in.prepare(&src.Rules[j]); err != nil {
+				return nil, fmt.Errorf("ingest source %s, rule %d: %w", src.Name, j+1, err)
+			}
+		}
+	}
+	return in, nil
+}
+
+// prepare checks r and parses its templates.
+func (in *Ingest) prepare(r *IngestRule) error {
+	fields := map[string]string{"text": r.Text}
+	switch r.Event {
+	case IngestFlash:
+		switch r.Level {
+		case "":
+			r.Level = FlashInfo
+		case FlashInfo, FlashSuccess, FlashWarning, FlashError:
+		default:
+			return fmt.Errorf("unknown level %q", r.Level)
+		}
+		fields["socket"] = r.Socket
+	case IngestStatus:
+		if _, ok := in.pages[r.Page]; !ok {
+			return fmt.Errorf("unknown page %q", r.Page)
+		}
+	case IngestSetpoint:
+		if r.Zone == "" || r.Temperature == "" {
+			return errors.New("a setpoint needs a zone and a temperature")
+		}
+		fields = map[string]string{"zone": r.Zone, "temperature": r.Temperature}
+	default:
+		return fmt.Errorf("unknown event %q", r.Event)
+	}
+	r.templates = map[string]*template.Template{}
+	for name, text := range fields {
+		t, err := template.New(name).Option("missingkey=error").Parse(text)
+		if err != nil {
+			return err
+		}
+		r.templates[name] = t
+	}
+	return nil
+}
+
+// source returns the source of token, nil if there is none. Every token is
+// compared, in constant time.
+func (in *Ingest) source(token string) *IngestSource {
+	var found *IngestSource
+	for i := range in.sources {
+		if subtle.ConstantTimeCompare([]byte(in.sources[i].Token), []byte(token)) == 1 {
+			found = &in.sources[i]
+		}
+	}
+	return found
+}
+
+func (in *Ingest) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	src := in.source(chi.URLParam(r, "token"))
+	if src == nil {
+		apiError(w, http.StatusNotFound, "unknown token")
+		return
+	}
+	var payload map[string]interface{}
+	if err := decodeJSON(w, r, &payload); err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	sent := 0
+	for i := range src.Rules {
+		rule := &src.Rules[i]
+		if !rule.matches(payload) {
+			continue
+		}
+		if err := in.send(r, src, rule, payload); err != nil {
+			var invalid ingestError
+			if errors.As(err, &invalid) {
+				apiError(w, http.StatusUnprocessableEntity, err.Error())
+				return
+			}
+			apiFail(w, err)
+			return
+		}
+		sent++
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"events": sent})
+}
+
+// ingestError is a payload a rule can't make an event of.
+type ingestError string
+
+func (e ingestError) Error() string { return string(e) }
+
+// send sends the event of rule for payload, the source is the actor of
+// the audit log.
+func (in *Ingest) send(r *http.Request, src *IngestSource, rule *IngestRule, payload map[string]interface{}) error {
+	fields := map[string]string{}
+	for name, t := range rule.templates {
+		var b bytes.Buffer
+		if err := t.Execute(&b, payload); err != nil {
+			return ingestError(fmt.Sprintf("rule %s: %v", name, err))
+		}
+		fields[name] = strings.TrimSpace(b.String())
+	}
+	actor := "ingest " + src.Name
+	switch rule.Event {
+	case IngestFlash:
+		msg := FlashMessage{Level: rule.Level, Message: fields["text"]}
+		if fields["socket"] == "" {
+			in.app.Broadcast("flash", msg)
+			in.app.Audit.RecordAs(r.Context(), actor, "", AuditNotice, "", fmt.Sprintf("%s: %s", msg.Level, msg.Message))
+			return nil
+		}
+		id, err := strconv.Atoi(fields["socket"])
+		if err != nil || !in.app.Sockets.Message(id, msg) {
+			return ingestError(fmt.Sprintf("no socket %q", fields["socket"]))
+		}
+		in.app.Audit.RecordAs(r.Context(), actor, "", AuditSocketMessage, fields["socket"], msg.Message)
+	case IngestStatus:
+		if err := in.pages[rule.Page].Broadcast("status", fields["text"]); err != nil {
+			log.Println("broadcast error:", err)
+		}
+	case IngestSetpoint:
+		p := live.Params{"temperature": fields["temperature"]}
+		if errs := setpointForm.Validate(p); len(errs) > 0 {
+			return ingestError(fmt.Sprintf("invalid temperature %q", fields["temperature"]))
+		}
+		c, err := in.app.Setpoints.Control(r.Context(), fields["zone"])
+		if err != nil {
+			return err
+		}
+		if c == nil {
+			return ingestError(fmt.Sprintf("unknown zone %q", fields["zone"]))
+		}
+		o := SetpointOrigin{Actor: actor, Socket: ingestSocket, Page: "/ingest/" + src.Name}
+		err = in.app.Setpoints.Set(r.Context(), c, p.Float32("temperature"), rule.Confirmed, o)
+		if errors.Is(err, ErrNotConfirmed) {
+			return ingestError(err.Error())
+		}
+		return err
+	}
+	return nil
+}
+
+// matches reports whether payload has the fields of r.When.
+func (r *IngestRule) matches(payload map[string]interface{}) bool {
+	for path, want := range r.When {
+		var v interface{} = payload
+		for _, key := range strings.Split(path, ".") {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return false
+			}
+			if v, ok = m[key]; !ok {
+				return false
+			}
+		}
+		if fmt.Sprint(v) != want {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jfyne/live"
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	// inviteTTL is how long an invitation link works.
+	inviteTTL = 10 * time.Minute
+	// inviteQRSize is the width and height of the QR code, in pixels.
+	inviteQRSize = 256
+)
+
+// invite is a token standing for a page path until it expires.
+type invite struct {
+	path    string
+	expires time.Time
+}
+
+// Invites hands out short-lived tokens for the room a page is in, so
+// another device can join it by scanning a QR code. /invite/{token}
+// redirects to the room while the token is valid.
+type Invites struct {
+	mu      sync.Mutex
+	invites map[string]invite
+}
+
+// NewInvites creates an empty set of invitations.
+func NewInvites() *Invites {
+	return &Invites{invites: map[string]invite{}}
+}
+
+// Create returns a new token for path, valid for inviteTTL.
+func (i *Invites) Create(path string) (string, time.Time, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	now := time.Now()
+	expires := now.Add(inviteTTL)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for t, inv := range i.invites {
+		if now.After(inv.expires) {
+			delete(i.invites, t)
+		}
+	}
+	i.invites[token] = invite{path: path, expires: expires}
+	return token, expires, nil
+}
+
+// Resolve returns the path of token if it is still valid.
+func (i *Invites) Resolve(token string) (string, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	inv, ok := i.invites[token]
+	if !ok || time.Now().After(inv.expires) {
+		return "", false
+	}
+	return inv.path, true
+}
+
+// ServeHTTP redirects to the room of the "token" URL param.
+func (i *Invites) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path, ok := i.Resolve(chi.URLParam(r, "token"))
+	if !ok {
+		http.Error(w, "the invitation has expired", http.StatusGone)
+		return
+	}
+	http.Redirect(w, r, path, http.StatusFound)
+}
+
+// InviteCode is the open invitation of a page, part of Page.
+type InviteCode struct {
+	URL string
+	// QR is the QR code of URL as a PNG data URL.
+	QR      template.URL
+	Expires time.Time
+}
+
+// code creates an invitation to path. The link is absolute, it is opened
+// on another device, so it takes the host of the page's request.
+func (i *Invites) code(ctx context.Context, path string) (*InviteCode, error) {
+	token, expires, err := i.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not create the invitation: %w", err)
+	}
+	base := "/invite/" + token
+	if r := live.Request(ctx); r != nil {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		base = scheme + "://" + r.Host + base
+	}
+	png, err := qrcode.Encode(base, qrcode.Medium, inviteQRSize)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode the QR code: %w", err)
+	}
+	return &InviteCode{
+		URL:     base,
+		QR:      template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png)),
+		Expires: expires,
+	}, nil
+}
+
+// handle registers the events opening and closing the invitation of the
+// page on h. path returns the room of the socket.
+func (i *Invites) handle(h *Handler, path func(ctx context.Context, s live.Socket) string) {
+	h.HandleEvent("invite", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m, ok := s.Assigns().(pageModel)
+		if !ok {
+			return s.Assigns(), nil
+		}
+		code, err := i.code(ctx, path(ctx, s))
+		if err != nil {
+			return s.Assigns(), err
+		}
+		m.page().Invite = code
+		return s.Assigns(), nil
+	})
+	h.HandleEvent("invite-close", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		if m, ok := s.Assigns().(pageModel); ok {
+			m.page().Invite = nil
+		}
+		return s.Assigns(), nil
+	})
+}
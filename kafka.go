@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kafkaBus is the bus over Kafka: a topic per subject, named like it, and a
+// consumer group per instance, so every instance gets every message like
+// with NATS; an instance reads the messages published after it subscribed.
+// The consumer of a topic joins the group of the instance named after the
+// topic, "live-host.devices.positions", that the topics don't rebalance
+// each other. The trace context is in the headers of the records.
+type kafkaBus struct {
+	brokers []string
+	group   string
+	writer  *kafka.Writer
+	*busFanout
+
+	readersMu sync.Mutex
+	readers   map[string]context.CancelFunc
+	done      sync.WaitGroup
+}
+
+// newKafkaBus connects to the brokers, the consumers join group.
+func newKafkaBus(brokers []string, group string) (*kafkaBus, error) {
+	if len(brokers) == 0 {
+		return nil, errors.New("no Kafka broker")
+	}
+	// The writer connects when it writes, a broker is dialed to know it's
+	// there.
+	ctx, cancel := context.WithTimeout(context.Background(), busTimeout)
+	defer cancel()
+	conn, err := kafka.DialContext(ctx, "tcp", brokers[0])
+	if err != nil {
+		return nil, err
+	}
+	conn.Close()
+	b := &kafkaBus{
+		brokers: brokers,
+		group:   group,
+		writer: &kafka.Writer{
+			Addr:                   kafka.TCP(brokers...),
+			Balancer:               &kafka.LeastBytes{},
+			AllowAutoTopicCreation: true,
+			// Like NATS, a publish doesn't wait for the other replicas.
+			RequiredAcks: kafka.RequireOne,
+			WriteTimeout: busTimeout,
+		},
+		readers: map[string]context.CancelFunc{},
+	}
+	b.busFanout = newBusFanout(b.read, b.stop)
+	return b, nil
+}
+
+func (b *kafkaBus) Publish(ctx context.Context, msg BusMessage) error {
+	record := kafka.Message{Topic: msg.Subject, Value: msg.Data}
+	for k, values := range msg.Header {
+		for _, v := range values {
+			record.Headers = append(record.Headers, kafka.Header{Key: k, Value: []byte(v)})
+		}
+	}
+	return b.writer.WriteMessages(ctx, record)
+}
+
+// read starts the consumer of the topic of subject.
+func (b *kafkaBus) read(subject string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     b.brokers,
+		GroupID:     b.group + "." + subject,
+		Topic:       subject,
+		StartOffset: kafka.LastOffset,
+	})
+	b.readersMu.Lock()
+	b.readers[subject] = cancel
+	b.readersMu.Unlock()
+	b.done.Add(1)
+	go func() {
+		defer b.done.Done()
+		defer r.Close()
+		for {
+			m, err := r.ReadMessage(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				log.Printf("could not read %s from Kafka: %v", subject, err)
+				select {
+				case <-time.After(busTimeout):
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+			header := http.Header{}
+			for _, h := range m.Headers {
+				header.Add(h.Key, string(h.Value))
+			}
+			b.deliver(BusMessage{Subject: subject, Data: m.Value, Header: header})
+		}
+	}()
+	return nil
+}
+
+// stop stops the consumer of the topic of subject.
+func (b *kafkaBus) stop(subject string) error {
+	b.readersMu.Lock()
+	defer b.readersMu.Unlock()
+	if cancel, ok := b.readers[subject]; ok {
+		cancel()
+		delete(b.readers, subject)
+	}
+	return nil
+}
+
+func (b *kafkaBus) Close() error {
+	b.readersMu.Lock()
+	for subject, cancel := range b.readers {
+		cancel()
+		delete(b.readers, subject)
+	}
+	b.readersMu.Unlock()
+	b.done.Wait()
+	if err := b.writer.Close(); err != nil {
+		return fmt.Errorf("could not flush the Kafka writer: %w", err)
+	}
+	return nil
+}
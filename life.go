@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/jfyne/live"
+)
+
+// Size of the Game of Life grid.
+const (
+	lifeWidth  = 40
+	lifeHeight = 24
+)
+
+// lifeSpeeds are the intervals between two generations the page offers,
+// slowest first.
+var lifeSpeeds = []time.Duration{
+	time.Second,
+	500 * time.Millisecond,
+	200 * time.Millisecond,
+	100 * time.Millisecond,
+	50 * time.Millisecond,
+}
+
+// LifeModel is the model of the Game of Life page.
+type LifeModel struct {
+	Page
+	Cells      [][]bool
+	Running    bool
+	Generation int
+	// Speed is the index of the interval in lifeSpeeds.
+	Speed int
+
+	// ticker drives the generations of a connected socket.
+	ticker *time.Ticker
+}
+
+// NewLifeModel creates an empty grid.
+func NewLifeModel() *LifeModel {
+	m := &LifeModel{Speed: 2}
+	m.Clear()
+	return m
+}
+
+// Clear kills every cell.
+func (m *LifeModel) Clear() {
+	m.Cells = make([][]bool, lifeHeight)
+	for y := range m.Cells {
+		m.Cells[y] = make([]bool, lifeWidth)
+	}
+	m.Generation = 0
+}
+
+// Randomize brings a quarter of the cells to life.
+func (m *LifeModel) Randomize() {
+	m.Clear()
+	for y := range m.Cells {
+		for x := range m.Cells[y] {
+			m.Cells[y][x] = rand.Intn(4) == 0
+		}
+	}
+}
+
+// Step advances the grid by a generation. The edges wrap around.
+func (m *LifeModel) Step() {
+	next := make([][]bool, lifeHeight)
+	for y := range next {
+		next[y] = make([]bool, lifeWidth)
+		for x := range next[y] {
+			n := 0
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					if (dx != 0 || dy != 0) && m.Cells[(y+dy+lifeHeight)%lifeHeight][(x+dx+lifeWidth)%lifeWidth] {
+						n++
+					}
+				}
+			}
+			next[y][x] = n == 3 || (n == 2 && m.Cells[y][x])
+		}
+	}
+	m.Cells = next
+	m.Generation++
+}
+
+// Alive returns the number of living cells.
+func (m *LifeModel) Alive() int {
+	n := 0
+	for _, row := range m.Cells {
+		for _, alive := range row {
+			if alive {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// Interval returns the time between two generations.
+func (m *LifeModel) Interval() time.Duration {
+	return lifeSpeeds[m.Speed]
+}
+
+// Speeds returns the intervals the page offers.
+func (m *LifeModel) Speeds() []time.Duration {
+	return lifeSpeeds
+}
+
+// run starts or stops the ticker of a connected socket to match the model.
+func (m *LifeModel) run() {
+	if m.ticker == nil {
+		return
+	}
+	if m.Running {
+		m.ticker.Reset(m.Interval())
+	} else {
+		m.ticker.Stop()
+	}
+}
+
+func lifeModel(s live.Socket) *LifeModel {
+	if m, ok := s.Assigns().(*LifeModel); ok {
+		return m
+	}
+	return NewLifeModel()
+}
+
+// newLife creates the Game of Life live handler. A connected socket runs
+// the generations on its own ticker, every one of them sending a diff of
+// the cells that changed.
+func newLife(app *App) *Handler {
+	h := app.NewHandler()
+	h.HandleRender(app.Render("life.html"))
+	h.HandleMount(func(ctx context.Context, s live.Socket) (interface{}, error) {
+		m := lifeModel(s)
+		if s.Connected() {
+			// The first tick stops the ticker again unless the game runs,
+			// also when the model was restored.
+			m.ticker = time.NewTicker(m.Interval())
+			go func() {
+				defer m.ticker.Stop()
+				for {
+					select {
+					case <-m.ticker.C:
+						app.State.Send(s, "life-tick", nil)
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+		}
+		return m, nil
+	})
+	h.HandleTick("life-tick", func(ctx context.Context, s live.Socket, _ interface{}) (interface{}, error) {
+		m := lifeModel(s)
+		if !m.Running {
+			m.run()
+			return m, nil
+		}
+		m.Step()
+		return m, nil
+	})
+	h.HandleEvent("life-toggle", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := lifeModel(s)
+		x, y := p.Int("x"), p.Int("y")
+		if x < 0 || x >= lifeWidth || y < 0 || y >= lifeHeight {
+			return m, fmt.Errorf("cell %d,%d is off the grid", x, y)
+		}
+		m.Cells[y][x] = !m.Cells[y][x]
+		return m, nil
+	})
+	h.HandleEvent("life-play", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := lifeModel(s)
+		m.Running = !m.Running
+		m.run()
+		return m, nil
+	})
+	h.HandleEvent("life-step", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := lifeModel(s)
+		m.Step()
+		return m, nil
+	})
+	h.HandleEvent("life-random", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := lifeModel(s)
+		m.Randomize()
+		return m, nil
+	})
+	h.HandleEvent("life-clear", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := lifeModel(s)
+		m.Clear()
+		return m, nil
+	})
+	h.HandleEvent("life-speed", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := lifeModel(s)
+		speed := p.Int("speed")
+		if speed < 0 || speed >= len(lifeSpeeds) {
+			return m, fmt.Errorf("unknown speed %d", speed)
+		}
+		m.Speed = speed
+		m.run()
+		return m, nil
+	})
+	return h
+}
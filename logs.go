@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jfyne/live"
+)
+
+const (
+	// logTailSize is how many lines the log tail keeps.
+	logTailSize = 1000
+	// logPageSize is how many lines the logs page shows at first and adds
+	// for every "Show older".
+	logPageSize = 200
+	// logRefresh is the shortest interval between two updates of a logs
+	// page, so a burst of lines is rendered at once.
+	logRefresh = 250 * time.Millisecond
+	// logPoll is how often a followed log file is checked for new lines.
+	logPoll = 500 * time.Millisecond
+	// logsTailEvent is the self event telling a logs page about new lines.
+	// Dev mode doesn't log it, every such log line would trigger it again.
+	logsTailEvent = "logs-tail"
+)
+
+// LogLevel is the severity of a log line.
+type LogLevel int
+
+// The log levels, least severe first.
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// logLevels are the names of the levels.
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+func (l LogLevel) String() string {
+	return logLevels[l]
+}
+
+// ParseLogLevel parses the name of a level, as slog and most structured
+// loggers write them.
+func ParseLogLevel(name string) (LogLevel, error) {
+	switch strings.ToLower(name) {
+	case "debug", "trace":
+		return LevelDebug, nil
+	case "info", "":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error", "fatal", "panic":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", name)
+}
+
+// LogLine is a line of the log.
+type LogLine struct {
+	Seq   int
+	Time  time.Time
+	Level LogLevel
+	Text  string
+}
+
+// stdLogTime is the time prefix of the standard logger.
+const stdLogTime = "2006/01/02 15:04:05"
+
+// parseLogLine reads the time and level of a line. JSON lines use their
+// "time", "level" and "msg" fields. The lines of the standard logger have
+// no level: dev mode lines are debug, lines mentioning an error are errors.
+func parseLogLine(text string) LogLine {
+	l := LogLine{Time: time.Now(), Level: LevelInfo, Text: text}
+	if strings.HasPrefix(text, "{") {
+		var rec struct {
+			Time  time.Time `json:"time"`
+			Level string    `json:"level"`
+			Msg   string    `json:"msg"`
+		}
+		if json.Unmarshal([]byte(text), &rec) == nil {
+			if !rec.Time.IsZero() {
+				l.Time = rec.Time
+			}
+			l.Level, _ = ParseLogLevel(rec.Level)
+			if rec.Msg != "" {
+				l.Text = rec.Msg
+			}
+			return l
+		}
+	}
+	if len(text) > len(stdLogTime) {
+		if t, err := time.ParseInLocation(stdLogTime, text[:len(stdLogTime)], time.Local); err == nil {
+			l.Time = t
+			text = strings.TrimSpace(text[len(stdLogTime):])
+			l.Text = text
+		}
+	}
+	lower := strings.ToLower(text)
+	switch {
+	case strings.HasPrefix(text, "[dev]"):
+		l.Level = LevelDebug
+	case strings.Contains(lower, "panic") || strings.Contains(lower, "error"):
+		l.Level = LevelError
+	case strings.Contains(lower, "warn") || strings.Contains(lower, "not available"):
+		l.Level = LevelWarn
+	}
+	return l
+}
+
+// LogTail keeps the latest lines of a log and tells its subscribers about
+// new ones. It's an io.Writer, so it can be given to log.SetOutput, and can
+// follow a file written by something else with Follow.
+type LogTail struct {
+	size int
+
+	mu      sync.Mutex
+	lines   []LogLine
+	seq     int
+	partial []byte
+	subs    map[chan struct{}]struct{}
+}
+
+// NewLogTail creates a tail keeping size lines.
+func NewLogTail(size int) *LogTail {
+	return &LogTail{size: size, subs: map[chan struct{}]struct{}{}}
+}
+
+// Write adds the complete lines of p, keeping an incomplete last line
+// until the rest of it is written.
+func (t *LogTail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.partial = append(t.partial, p...)
+	added := false
+	for {
+		i := bytes.IndexByte(t.partial, '\n')
+		if i < 0 {
+			break
+		}
+		if text := strings.TrimRight(string(t.partial[:i]), "\r"); text != "" {
+			t.add(text)
+			added = true
+		}
+		t.partial = t.partial[i+1:]
+	}
+	if added {
+		t.notify()
+	}
+	return len(p), nil
+}
+
+func (t *LogTail) add(text string) {
+	t.seq++
+	l := parseLogLine(text)
+	l.Seq = t.seq
+	t.lines = append(t.lines, l)
+	if len(t.lines) > t.size {
+		t.lines = t.lines[len(t.lines)-t.size:]
+	}
+}
+
+func (t *LogTail) notify() {
+	for c := range t.subs {
+		select {
+		case c <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Lines returns up to limit of the latest lines at level or above up to
+// line until, oldest first, and whether there are older ones.
+func (t *LogTail) Lines(level LogLevel, limit, until int) ([]LogLine, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var lines []LogLine
+	for i := len(t.lines) - 1; i >= 0; i-- {
+		if t.lines[i].Seq > until || t.lines[i].Level < level {
+			continue
+		}
+		if len(lines) == limit {
+			return reverseLines(lines), true
+		}
+		lines = append(lines, t.lines[i])
+	}
+	return reverseLines(lines), false
+}
+
+func reverseLines(lines []LogLine) []LogLine {
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return lines
+}
+
+// Seq returns the number of the latest line.
+func (t *LogTail) Seq() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.seq
+}
+
+// Subscribe returns a channel receiving a value when lines are added, and
+// the function ending the subscription.
+func (t *LogTail) Subscribe() (<-chan struct{}, func()) {
+	c := make(chan struct{}, 1)
+	t.mu.Lock()
+	t.subs[c] = struct{}{}
+	t.mu.Unlock()
+	return c, func() {
+		t.mu.Lock()
+		delete(t.subs, c)
+		t.mu.Unlock()
+	}
+}
+
+// Follow adds the lines of the file at path until ctx is done, starting
+// with the lines it already has and reading again from the start when it
+// gets truncated or replaced, as log rotation does.
+func (t *LogTail) Follow(ctx context.Context, path string) error {
+	var f *os.File
+	var offset int64
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+	tick := time.NewTicker(logPoll)
+	defer tick.Stop()
+	for {
+		if info, err := os.Stat(path); err == nil && f != nil {
+			if current, err := f.Stat(); err != nil || !os.SameFile(info, current) || info.Size() < offset {
+				f.Close()
+				f = nil
+			}
+		}
+		if f == nil {
+			var err error
+			if f, err = os.Open(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			offset = 0
+		}
+		if f != nil {
+			n, err := io.Copy(t, bufio.NewReader(f))
+			if err != nil {
+				return err
+			}
+			offset += n
+		}
+
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// LogsModel is the model of the logs page.
+type LogsModel struct {
+	Page
+	Lines []LogLine
+	Older bool
+	// Level is the least severe level shown.
+	Level LogLevel
+	// Limit is how many lines are shown, raised by "Show older".
+	Limit int
+	// Paused stops adding lines, New counts the ones added since.
+	Paused bool
+	New    int
+
+	// seq is the latest line shown.
+	seq int
+}
+
+// Levels returns the levels the page filters by.
+func (m *LogsModel) Levels() []LogLevel {
+	return []LogLevel{LevelDebug, LevelInfo, LevelWarn, LevelError}
+}
+
+// load reloads the lines, up to the one the page was paused at.
+func (m *LogsModel) load(tail *LogTail) {
+	latest := tail.Seq()
+	if !m.Paused {
+		m.seq = latest
+	}
+	m.New = latest - m.seq
+	m.Lines, m.Older = tail.Lines(m.Level, m.Limit, m.seq)
+}
+
+func logsModel(s live.Socket) *LogsModel {
+	if m, ok := s.Assigns().(*LogsModel); ok {
+		return m
+	}
+	return &LogsModel{Level: LevelInfo, Limit: logPageSize}
+}
+
+// newLogs creates the live handler of the logs admin page. A connected
+// socket subscribes to the tail and reloads its lines when there are new
+// ones, at most every logRefresh.
+func newLogs(app *App, tail *LogTail) *Handler {
+	h := app.NewHandler()
+	h.HandleRender(app.Render("logs.html"))
+	h.HandleMount(func(ctx context.Context, s live.Socket) (interface{}, error) {
+		m := logsModel(s)
+		m.load(tail)
+		if s.Connected() {
+			added, stop := tail.Subscribe()
+			go func() {
+				defer stop()
+				for {
+					select {
+					case <-added:
+						app.State.Send(s, logsTailEvent, nil)
+					case <-ctx.Done():
+						return
+					}
+					select {
+					case <-time.After(logRefresh):
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+		}
+		return m, nil
+	})
+	h.HandleTick(logsTailEvent, func(ctx context.Context, s live.Socket, _ interface{}) (interface{}, error) {
+		m := logsModel(s)
+		m.load(tail)
+		return m, nil
+	})
+	h.HandleEvent("logs-level", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := logsModel(s)
+		level, err := ParseLogLevel(p.String("level"))
+		if err != nil {
+			return m, err
+		}
+		m.Level = level
+		m.load(tail)
+		return m, nil
+	})
+	h.HandleEvent("logs-pause", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := logsModel(s)
+		m.Paused = !m.Paused
+		m.load(tail)
+		return m, nil
+	})
+	h.HandleEvent("logs-older", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := logsModel(s)
+		if m.Limit += logPageSize; m.Limit > logTailSize {
+			m.Limit = logTailSize
+		}
+		m.load(tail)
+		return m, nil
+	})
+	return h
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// mailTimeout bounds the delivery of an email to the SMTP server.
+const mailTimeout = 30 * time.Second
+
+// SMTPConfig configures the emails.
+type SMTPConfig struct {
+	// Addr is the host:port of the SMTP server, the emails are disabled
+	// without one.
+	Addr           string
+	User, Password string
+	From           string
+	// SummaryAt is the time of the day the daily summary is sent, since
+	// midnight in the timezone of each user.
+	SummaryAt time.Duration
+	// URL is the URL of the server the emails link to, no links when empty.
+	URL string
+}
+
+// Mailer sends the threshold alerts and the daily summary by email to the
+// users who opted in on the preferences page. The emails are templates
+// like the pages, rendered in the language and timezone of each user with
+// the "email" layout of partials/email.html: a template defines its
+// "subject" and its "email-content".
+type Mailer struct {
+	cfg       SMTPConfig
+	templates *Templates
+	locales   *Locales
+	prefs     *UserPreferences
+	history   *ZoneHistory
+	setpoints *Setpoints
+}
+
+// NewMailer creates the mailer of cfg.
+func NewMailer(cfg SMTPConfig, templates *Templates, locales *Locales, prefs *UserPreferences, history *ZoneHistory, setpoints *Setpoints) *Mailer {
+	return &Mailer{cfg: cfg, templates: templates, locales: locales, prefs: prefs, history: history, setpoints: setpoints}
+}
+
+// Alert emails a threshold alert of zone to the users opted in to the
+// alerts, in the background.
+func (m *Mailer) Alert(zone string, alert Alert) {
+	for _, p := range m.prefs.Subscribers(func(p Preferences) bool { return p.Alerts }) {
+		go func(p Preferences) {
+			data := map[string]interface{}{
+				"Zone":     zone,
+				"Setpoint": alert.Value,
+				"Limit":    float32(tempLimit),
+				"Time":     alert.Time.In(loadTimezone(p.Timezone)),
+			}
+			if err := m.mail(p, "email-alert.html", data); err != nil {
+				log.Printf("could not email the alert to %s: %v", p.Email, err)
+			}
+		}(p)
+	}
+}
+
+// Rule emails what a zone rule fired for to the address to, in the
+// language and timezone of the server.
+func (m *Mailer) Rule(to string, data map[string]interface{}) error {
+	return m.mail(Preferences{Email: to}, "email-rule.html", data)
+}
+
+// summaryZone is a zone in the daily summary, Day is nil without changes
+// that day.
+type summaryZone struct {
+	Zone     string
+	Setpoint float32
+	Day      *DayStats
+}
+
+// RunSummaries emails the summary of the day before to the users opted in
+// to it, at SummaryAt in their timezone, until ctx is done.
+func (m *Mailer) RunSummaries(ctx context.Context) {
+	t := time.NewTicker(time.Minute)
+	defer t.Stop()
+	// sent are the days each address got its summary for. A summary due
+	// before the start isn't sent, a restart sends none twice.
+	sent := map[string]string{}
+	started := time.Now()
+	for {
+		select {
+		case now := <-t.C:
+			for _, p := range m.prefs.Subscribers(func(p Preferences) bool { return p.Summary }) {
+				local := now.In(loadTimezone(p.Timezone))
+				midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+				day := midnight.AddDate(0, 0, -1).Format("2006-01-02")
+				due := midnight.Add(m.cfg.SummaryAt)
+				if local.Before(due) || due.Before(started) || sent[p.Email] == day {
+					continue
+				}
+				sent[p.Email] = day
+				if err := m.summary(ctx, p, midnight.AddDate(0, 0, -1)); err != nil {
+					log.Printf("could not email the summary to %s: %v", p.Email, err)
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// summary emails the summary of day to p.
+func (m *Mailer) summary(ctx context.Context, p Preferences, day time.Time) error {
+	var zones []summaryZone
+	for _, zone := range m.setpoints.Zones() {
+		c, err := m.setpoints.Control(ctx, zone)
+		if err != nil {
+			return err
+		}
+		z := summaryZone{Zone: zone, Setpoint: c.Temperature}
+		for _, d := range m.history.Daily(zone, day.Location()) {
+			if d.Day.Equal(day) {
+				d := d
+				z.Day = &d
+			}
+		}
+		zones = append(zones, z)
+	}
+	return m.mail(p, "email-summary.html", map[string]interface{}{"Day": day, "Zones": zones, "Limit": float32(tempLimit)})
+}
+
+// loadTimezone returns the timezone tz, the server's when it is unknown.
+func loadTimezone(tz string) *time.Location {
+	if loc, err := time.LoadLocation(tz); err == nil && tz != "" {
+		return loc
+	}
+	return time.Local
+}
+
+// mail renders the email template name with data for p and sends it. The
+// data gets the URL of the server, "URL".
+func (m *Mailer) mail(p Preferences, name string, data map[string]interface{}) error {
+	tmpl, err := m.templates.LookupLocale(name, m.locales.Get(p.Locale))
+	if err != nil {
+		return err
+	}
+	data["URL"] = strings.TrimSuffix(m.cfg.URL, "/")
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return err
+	}
+	if err := tmpl.Execute(&body, data); err != nil {
+		return err
+	}
+
+	var msg bytes.Buffer
+	header := func(k, v string) { fmt.Fprintf(&msg, "%s: %s\r\n", k, v) }
+	header("From", m.cfg.From)
+	header("To", p.Email)
+	header("Subject", mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject.String())))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/html; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	msg.WriteString("\r\n")
+	qp := quotedprintable.NewWriter(&msg)
+	if _, err := body.WriteTo(qp); err != nil {
+		return err
+	}
+	if err := qp.Close(); err != nil {
+		return err
+	}
+	return m.send(p.Email, msg.Bytes())
+}
+
+// send delivers msg to the address to, like smtp.SendMail within
+// mailTimeout: over STARTTLS when the server has it, authenticated when a
+// user is configured.
+func (m *Mailer) send(to string, msg []byte) error {
+	host, _, err := net.SplitHostPort(m.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	from, err := mail.ParseAddress(m.cfg.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender: %w", err)
+	}
+	conn, err := net.DialTimeout("tcp", m.cfg.Addr, mailTimeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(mailTimeout))
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if m.cfg.User != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.cfg.User, m.cfg.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
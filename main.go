@@ -1,199 +1,179 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"html/template"
 	"io"
 	"log"
 	"net/http"
-	"time"
+	"os"
+	"strings"
 
-	"github.com/jfyne/live"
-	"github.com/nats-io/nats.go"
+	// Embedded zoneinfo, the live clock is shown in the user's timezone
+	// also where the system has no timezone database.
+	_ "time/tzdata"
 )
 
-type ThermoModel struct {
-	Name        string
-	Temperature float32
-	Status      string
-	Time        string
-}
+const usage = `usage: live [command] [flags]
 
-type NatsMessage struct {
-	Name string
-	Value int64
-}
+commands:
+  serve    run the server (default)
+  backup   write an archive of the database to --backup-dir
+  restore  load an archive into an empty database: live restore [flags] archive
+  seed     fill an empty database with demo data
+  import   load a CSV sensor log into the readings: live import [flags] file.csv
+  client   send commands to the API of a running server, see "live client -h"
+  vapid    print new VAPID keys for the Web Push notifications
 
-var ec *nats.EncodedConn
+Run "live serve -h" for the server flags, backup, restore, seed and import
+take the database flags of the server.
+`
 
-func NewThermoModel(ctx context.Context, s live.Socket) *ThermoModel {
-	m, ok := s.Assigns().(*ThermoModel)
+func main() {
+	cmd, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
 
-	if !ok {
-		m = &ThermoModel{
-			Name:        live.Request(ctx).URL.Query().Get("name"),
-			Temperature: 19.5,
-			Status:      "-",
-			Time:        "",
+	switch cmd {
+	case "serve":
+		serve(args)
+	case "backup", "restore", "seed", "import", "client", "vapid":
+		run := backup
+		switch cmd {
+		case "restore":
+			run = restore
+		case "seed":
+			run = seed
+		case "import":
+			run = importCommand
+		case "client":
+			run = client
+		case "vapid":
+			run = vapid
+		}
+		if err := run(args); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
 		}
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
 	}
-
-	return m
-}
-
-func thermoMount(ctx context.Context, s live.Socket) (interface{}, error) {
-	log.Println("Mounting application")
-
-	ec.Subscribe("go-live", func(m *NatsMessage) {
-		timeUnix := time.UnixMilli(m.Value)
-		s.Self(ctx, "status", "Nats message: "+timeUnix.Format(time.RFC1123))
-	})
-
-	return NewThermoModel(ctx, s), nil
-}
-
-func tempUp(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
-	model := NewThermoModel(ctx, s)
-	model.Temperature += 0.1
-	return model, nil
-}
-
-func tempDown(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
-	model := NewThermoModel(ctx, s)
-	model.Temperature -= 0.1
-	return model, nil
-}
-
-func tempChange(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
-	model := NewThermoModel(ctx, s)
-
-	t0 := model.Temperature
-
-	model.Temperature += p.Float32("temperature")
-
-	// local
-	//model.Status = fmt.Sprintf("Temperature changed from %f to %f", t0, model.Temperature)
-
-	// shared
-	s.Broadcast("status", fmt.Sprintf(model.Name+": Temperature changed from %f to %f", t0, model.Temperature))
-
-	return model, nil
 }
 
-// send chat like event
-func saveEvent(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
-	model := NewThermoModel(ctx, s)
-	message := p.String("message")
-
-	s.Broadcast("status", model.Name+": "+message)
-
-	return model, nil
-}
-
-func render(ctx context.Context, data *live.RenderContext) (io.Reader, error) {
-	tmpl, err := template.New("thermo").Parse(`
-		<html>
-			<head>
-				<link href="https://cdn.jsdelivr.net/npm/bootstrap@5.2.2/dist/css/bootstrap.min.css" rel="stylesheet" integrity="sha384-Zenh87qX5JnK2Jl0vWa8Ck2rdkQ2Bzep5IDxbcnCeuOxjzrPF/et3URy9Bv1WTRi" crossorigin="anonymous" />
-				<script src="https://cdn.jsdelivr.net/npm/bootstrap@5.2.2/dist/js/bootstrap.bundle.min.js" integrity="sha384-OERcA2EqjJCMA+/3y+gxIOqMEjwtxJY7qPCqsdltbNJuaOe923+mo//f6V8Qbsw3" crossorigin="anonymous"></script>
-			</head>
-			<body>
-			  <div class="container" style="text-align: center">
-			    <h4>User: {{.Assigns.Name}}</h4>
-				<h2>Temperature: {{.Assigns.Temperature}}C</h2>
-				<div>
-					{{if gt .Assigns.Temperature 25.0}}
-						<h4 style="color: red">Warning: Temperature is too high!!! (over 25C)</h4>
-					{{end}}
-				</div>
-				<div style="padding-top: 20px">
-                   <button live-click="temp-up" live-window-keyup="temp-up" live-key="ArrowUp" class="btn btn-success btn-sm">+0.1C</button> - 
-				   <button live-click="temp-down" live-window-keyup="temp-down" live-key="ArrowDown"  class="btn btn-success btn-sm">-0.1C</button>
-				</div>
-				<div style="padding-top: 20px; padding-bottom: 20px">
-                   <button live-click="temp-change" live-value-temperature="2" class="btn btn-success btn-sm">+2C</button> - 
-				   <button live-click="temp-change" live-value-temperature="-2" class="btn btn-success btn-sm">-2C</button>
-				</div>
-				<div style="border: 1px solid black; padding: 5px">
-				   <span>{{.Assigns.Time}}</span>
-				</div>
-				<div style="padding: 10px">
-                 <form live-submit="save" live-hook="submit">
-				   <input type="text" name="message" />&#160;
-				   <input type="submit" value="send ..." class="btn btn-success btn-sm" />
-				 </form>
-				</div>
-				<div live-update="prepend">
-                  {{.Assigns.Status}}
-				</div>
-			  </div>
-				<!-- Include to make live work -->
-				<script src="/live.js"></script>
-				<script>
-					window.Hooks = {
-						"submit": {
-							mounted: function() {
-								this.el.addEventListener("submit", () => {
-									this.el.querySelector("input").value = "";
-								});
-							}
-						}
-					};
-				</script>
-			</body>
-		</html>
-	`)
+func serve(args []string) {
+	cfg, err := LoadConfig(args)
 	if err != nil {
-		return nil, err
+		log.Println(err)
+		os.Exit(2)
 	}
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, data); err != nil {
-		return nil, err
+
+	if cfg.Check {
+		if err := selfCheck(cfg, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
 	}
-	return &buf, nil
-}
 
-func main() {
 	log.Println("Application is starting ...")
+	if cfg.Dev {
+		log.Println("Development mode: templates are reloaded from", cfg.TemplateDir)
+	}
 
-	nc, _ := nats.Connect(nats.DefaultURL)
-	ec,_ = nats.NewEncodedConn(nc, nats.JSON_ENCODER)
-
-
-	h := live.NewHandler()
-	h.HandleRender(render)
-	h.HandleMount(thermoMount)
-
-	h.HandleEvent("temp-up", tempUp)
-	h.HandleEvent("temp-down", tempDown)
-	h.HandleEvent("temp-change", tempChange)
-	h.HandleEvent("save", saveEvent)
-
-	h.HandleSelf("status", func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
-		model := NewThermoModel(ctx, s)
-		model.Status = data.(string)
+	app, err := NewApp(cfg)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if cfg.LogFile != "" {
+		go func() {
+			if err := app.Logs.Follow(context.Background(), cfg.LogFile); err != nil {
+				log.Println("log file:", err)
+			}
+		}()
+	} else {
+		log.SetOutput(io.MultiWriter(os.Stderr, app.Logs))
+	}
 
-		return model, nil
+	dashboard := app.Live(newDashboard(app), "/")
+	thermostat := app.Live(newThermostat(app), "/thermostat", "/thermostat/{zone}")
+	app.Setpoints.Watch(app.Broadcasts.On("dashboard", dashboard), func(_ string, c *TempControl, from float32) string {
+		return dashboardStatus(c.Zone, from, c.Temperature)
 	})
-
-	h.HandleSelf("time", func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
-		model := NewThermoModel(ctx, s)
-		model.Time = data.(string)
-
-		return model, nil
+	app.Setpoints.Watch(app.Broadcasts.On("thermostat", thermostat), func(actor string, c *TempControl, from float32) string {
+		return thermoStatus(actor, from, c.Temperature)
 	})
-
-	lh := live.NewHttpHandler(live.NewCookieStore("session-name", []byte("weak-secret")), h)
+	NewAPI(app, app.Broadcasts.On("thermostat", thermostat)).Routes(app.Router)
+	if cfg.IngestRules != "" {
+		ingest, err := LoadIngest(cfg.IngestRules, app, map[string]Broadcaster{
+			"dashboard":  app.Broadcasts.On("dashboard", dashboard),
+			"thermostat": app.Broadcasts.On("thermostat", thermostat),
+		})
+		if err != nil {
+			log.Fatalln(err)
+		}
+		app.Router.Post("/ingest/{token}", ingest.ServeHTTP)
+	}
+	app.Router.Get("/thermostat/{zone}/report", reportHandler(app))
+	app.Live(newCounter(app), "/counter")
+	app.Live(newTodos(app), "/todos")
+
+	prices := NewPriceFeed(tickerSymbols, tickInterval)
+	go prices.Run(context.Background())
+	app.Live(newTicker(app, prices), "/ticker")
+	app.Live(newClock(app), "/clock")
+	app.Live(newLife(app), "/life")
+	app.Live(newPad(app, NewPad()), "/pad")
+	app.Live(newBoardPage(app, NewBoard()), "/board")
+	uploads := NewUploads()
+	app.Live(newUpload(app, uploads), "/upload")
+	app.Router.Get("/uploads/{id}", uploads.ServeHTTP)
+	if app.Bus != nil {
+		go SimulateDevices(context.Background(), app.Bus, mapDevices, mapInterval)
+	}
+	app.Live(newMap(app), "/map")
+	app.Live(newDraw(app, NewWhiteboard()), "/draw")
+	app.Live(newSearch(app), "/search")
+	app.Live(newPosts(app, NewPostStore(1000, 1)), "/feed")
+	app.Live(newShop(app), "/shop")
+	app.Live(newTTT(app, NewTTTGames()), "/ttt")
+	app.Live(newSetup(app, app.Zones), "/setup")
+	app.Live(newCall(app, NewCallRooms()), "/call")
+	app.Live(newPreferences(app, app.Preferences), "/preferences")
+	gallery := NewGallery(cfg.GalleryDir)
+	if err := gallery.Scan(); err != nil {
+		log.Println("the gallery is empty:", err)
+	}
+	galleryEngine := app.Live(newGallery(app, gallery), "/gallery")
+	app.Router.Get("/gallery/images/*", gallery.ServeHTTP)
 	go func() {
-		for {
-			lh.Broadcast("time", time.Now().Format(time.RFC1123))
-			time.Sleep(1 * time.Second)
+		err := gallery.Watch(context.Background(), func() {
+			if err := galleryEngine.Broadcast("gallery", nil); err != nil {
+				log.Println("broadcast error:", err)
+			}
+		})
+		if err != nil {
+			log.Println("not watching the gallery:", err)
 		}
 	}()
+	poll := NewPoll(pollQuestion, pollOptions)
+	app.Router.Admin.Post("/poll", pollAdminHandler(poll, app.Live(newPoll(app, poll), "/poll"), app.Audit))
+	app.AdminLive(newLogs(app, app.Logs), "/logs")
+	app.AdminLive(newMetricsPage(app, app.Metrics), "/metrics")
+	app.AdminLive(newSocketsPage(app, app.Sockets), "/sockets")
+	app.Audit.Watch(app.AdminLive(newAuditPage(app, app.Repos.Audit), "/audit"))
+	app.Webhooks.Watch(app.AdminLive(newWebhooksPage(app, app.Webhooks), "/webhooks"))
+	app.Rules.Watch(app.AdminLive(newRulesPage(app, app.Rules), "/rules"))
+	app.Router.Get("/logs", http.RedirectHandler("/admin/logs", http.StatusFound).ServeHTTP)
+
+	if cfg.BackupInterval > 0 {
+		go runBackups(context.Background(), app.Repos, cfg.BackupDir, cfg.BackupInterval, cfg.BackupKeep)
+	}
 
-	http.Handle("/thermostat", lh)
-	http.Handle("/live.js", live.Javascript{})
-	http.ListenAndServe(":8080", nil)
+	if err := app.ListenAndServe(); err != nil {
+		log.Fatalln(err)
+	}
 }
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/jfyne/live"
+)
+
+const (
+	// mapSubject is the subject of the bus the simulated devices report on.
+	mapSubject = "devices.positions"
+	// mapInterval is how often the devices report their positions.
+	mapInterval = time.Second
+	// mapDevices is the number of simulated devices.
+	mapDevices = 8
+)
+
+// mapCenter is where the simulated devices start, Prague.
+var mapCenter = [2]float64{50.0755, 14.4378}
+
+// Device is a simulated device and its last reported position.
+type Device struct {
+	ID      string  `json:"id"`
+	Name    string  `json:"name"`
+	Lat     float64 `json:"lat"`
+	Lng     float64 `json:"lng"`
+	Heading float64 `json:"heading"`
+	// Speed is in meters per second.
+	Speed float64 `json:"speed"`
+}
+
+// KMH returns the speed in kilometers per hour.
+func (d Device) KMH() float64 {
+	return d.Speed * 3.6
+}
+
+// move advances the device by dt, turning a little on the way.
+func (d *Device) move(dt time.Duration) {
+	d.Heading = math.Mod(d.Heading+rand.NormFloat64()*15+360, 360)
+	d.Speed = math.Max(2, math.Min(25, d.Speed+rand.NormFloat64()))
+	dist := d.Speed * dt.Seconds()
+	rad := d.Heading * math.Pi / 180
+	d.Lat += dist * math.Cos(rad) / 111320
+	d.Lng += dist * math.Sin(rad) / (111320 * math.Cos(d.Lat*math.Pi/180))
+	// The devices stay within about 5 km of the center.
+	if math.Abs(d.Lat-mapCenter[0]) > 0.045 || math.Abs(d.Lng-mapCenter[1]) > 0.07 {
+		d.Heading = math.Mod(d.Heading+180, 360)
+	}
+}
+
+// SimulateDevices publishes the positions of n devices on mapSubject
+// every interval until ctx is done.
+func SimulateDevices(ctx context.Context, bus Bus, n int, interval time.Duration) {
+	devices := make([]Device, n)
+	for i := range devices {
+		devices[i] = Device{
+			ID:      fmt.Sprintf("d%d", i+1),
+			Name:    fmt.Sprintf("Device %d", i+1),
+			Lat:     mapCenter[0] + rand.NormFloat64()*0.01,
+			Lng:     mapCenter[1] + rand.NormFloat64()*0.015,
+			Heading: rand.Float64() * 360,
+			Speed:   5 + rand.Float64()*10,
+		}
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+		for i := range devices {
+			devices[i].move(interval)
+		}
+		if err := publishTraced(ctx, bus, mapSubject, devices); err != nil {
+			log.Println("devices:", err)
+		}
+	}
+}
+
+// MapModel is the model of the map page. The map itself belongs to the
+// map hook, the positions are sent to it as map-positions events.
+type MapModel struct {
+	Page
+	Devices []Device
+	// Follow is the ID of the device the map keeps centered, if any.
+	Follow string
+	// Offline is set when the bus isn't available and nothing moves.
+	Offline bool
+}
+
+// Center returns where the map starts.
+func (m *MapModel) Center() [2]float64 {
+	return mapCenter
+}
+
+func mapModel(s live.Socket) *MapModel {
+	if m, ok := s.Assigns().(*MapModel); ok {
+		return m
+	}
+	return &MapModel{}
+}
+
+// sendPositions sends the positions and the followed device to the hook.
+func (m *MapModel) sendPositions(s live.Socket) error {
+	return s.Send("map-positions", map[string]interface{}{"devices": m.Devices, "follow": m.Follow})
+}
+
+// newMap creates the live map handler. Like the thermostat, every
+// connected socket subscribes to the bus, here for the positions of the
+// devices, and forwards them to its hook.
+func newMap(app *App) *Handler {
+	h := app.NewHandler()
+	h.HandleRender(app.Render("map.html"))
+	h.HandleMount(func(ctx context.Context, s live.Socket) (interface{}, error) {
+		m := mapModel(s)
+		m.Offline = app.Bus == nil
+		if app.Bus != nil && s.Connected() {
+			sub, err := subscribeTraced(ctx, app.Bus, mapSubject, func() interface{} { return &[]Device{} }, func(ctx context.Context, v interface{}) {
+				app.State.Send(s, "map-positions", *v.(*[]Device))
+			})
+			if err != nil {
+				return nil, fmt.Errorf("could not subscribe to the bus: %w", err)
+			}
+			go func() {
+				<-ctx.Done()
+				sub.Unsubscribe()
+			}()
+		}
+		return m, nil
+	})
+	h.HandleTick("map-positions", func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		m := mapModel(s)
+		m.Devices = data.([]Device)
+		return m, m.sendPositions(s)
+	})
+	h.HandleEvent("map-ready", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := mapModel(s)
+		return m, m.sendPositions(s)
+	})
+	h.HandleEvent("map-follow", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := mapModel(s)
+		if id := p.String("id"); id == m.Follow {
+			m.Follow = ""
+		} else {
+			m.Follow = id
+		}
+		return m, m.sendPositions(s)
+	})
+	return h
+}
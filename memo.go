@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/binary"
+	"hash/maphash"
+	"io"
+	"math"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/jfyne/live"
+)
+
+const (
+	// renderMemoSize is the number of renders a page keeps, the latest of
+	// every socket mostly.
+	renderMemoSize = 1024
+	// renderMemoTTL is how long a render is reused. The templates tell how
+	// long ago things happened to the second, with "ago".
+	renderMemoTTL = time.Second
+)
+
+// RenderMemo caches the HTML a render handler returns by a hash of what
+// the templates see: the assigns, the socket and its uploads. A render
+// with the same hash reuses the HTML without executing the templates,
+// when an event or a self event left the model as it was. The hash
+// follows every field, the ones left out of the JSON too, and the
+// unexported ones, which the methods the templates call may read. A field
+// tagged memo:"-", such as the content of a file, is left out: the pages
+// never show it, and hashing it on every render would cost more than the
+// render.
+type RenderMemo struct {
+	next live.RenderHandler
+	seed maphash.Seed
+
+	mu      sync.Mutex
+	entries map[uint64]*list.Element
+	// order has the most recently used entry first.
+	order *list.List
+}
+
+type memoEntry struct {
+	key     uint64
+	html    []byte
+	expires time.Time
+}
+
+// NewRenderMemo memoizes the renders of next.
+func NewRenderMemo(next live.RenderHandler) *RenderMemo {
+	return &RenderMemo{next: next, seed: maphash.MakeSeed(), entries: map[uint64]*list.Element{}, order: list.New()}
+}
+
+// Render is the memoized render handler.
+func (m *RenderMemo) Render(ctx context.Context, data *live.RenderContext) (io.Reader, error) {
+	key := m.hash(data)
+	now := time.Now()
+	m.mu.Lock()
+	if el, ok := m.entries[key]; ok {
+		if e := el.Value.(*memoEntry); now.Before(e.expires) {
+			m.order.MoveToFront(el)
+			m.mu.Unlock()
+			return bytes.NewReader(e.html), nil
+		}
+	}
+	m.mu.Unlock()
+
+	r, err := m.next(ctx, data)
+	if err != nil {
+		return r, err
+	}
+	html, err := readRender(r)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.entries[key]; ok {
+		m.order.Remove(el)
+	}
+	m.entries[key] = m.order.PushFront(&memoEntry{key: key, html: html, expires: now.Add(renderMemoTTL)})
+	for m.order.Len() > renderMemoSize {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.entries, oldest.Value.(*memoEntry).key)
+	}
+	return bytes.NewReader(html), nil
+}
+
+// hash returns the hash of the render context: the socket ID, rather than
+// the socket and its engine, and the uploads and assigns in depth.
+func (m *RenderMemo) hash(data *live.RenderContext) uint64 {
+	var h maphash.Hash
+	h.SetSeed(m.seed)
+	if data.Socket != nil {
+		h.WriteString(string(data.Socket.ID()))
+		if data.Socket.Connected() {
+			h.WriteByte(1)
+		}
+	}
+	h.WriteByte(0)
+	w := hashWalker{seed: m.seed, seen: map[uintptr]bool{}}
+	w.value(&h, reflect.ValueOf(data.Uploads))
+	w.value(&h, reflect.ValueOf(data.Assigns))
+	return h.Sum64()
+}
+
+// hashWalker hashes a value in depth with reflection.
+type hashWalker struct {
+	seed maphash.Seed
+	// seen are the pointers followed already, a cycle would never end.
+	seen map[uintptr]bool
+}
+
+func (w hashWalker) uint(h *maphash.Hash, n uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], n)
+	h.Write(b[:])
+}
+
+func (w hashWalker) value(h *maphash.Hash, v reflect.Value) {
+	if !v.IsValid() {
+		h.WriteByte(0)
+		return
+	}
+	h.WriteByte(byte(v.Kind()))
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			h.WriteByte(1)
+		} else {
+			h.WriteByte(0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		w.uint(h, uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		w.uint(h, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		w.uint(h, math.Float64bits(v.Float()))
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		w.uint(h, math.Float64bits(real(c)))
+		w.uint(h, math.Float64bits(imag(c)))
+	case reflect.String:
+		w.uint(h, uint64(v.Len()))
+		h.WriteString(v.String())
+	case reflect.Pointer:
+		if v.IsNil() {
+			h.WriteByte(0)
+			return
+		}
+		p := v.Pointer()
+		w.uint(h, uint64(p))
+		if w.seen[p] {
+			return
+		}
+		w.seen[p] = true
+		w.value(h, v.Elem())
+	case reflect.Interface:
+		if v.IsNil() {
+			h.WriteByte(0)
+			return
+		}
+		h.WriteString(v.Elem().Type().String())
+		w.value(h, v.Elem())
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			if t.Field(i).Tag.Get("memo") == "-" {
+				continue
+			}
+			w.value(h, v.Field(i))
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			w.uint(h, uint64(v.Len()))
+			h.Write(v.Bytes())
+			return
+		}
+		w.uint(h, uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			w.value(h, v.Index(i))
+		}
+	case reflect.Map:
+		w.uint(h, uint64(v.Len()))
+		// The order of a map is random, the entries are summed.
+		var sum uint64
+		iter := v.MapRange()
+		for iter.Next() {
+			var entry maphash.Hash
+			entry.SetSeed(w.seed)
+			w.value(&entry, iter.Key())
+			w.value(&entry, iter.Value())
+			sum += entry.Sum64()
+		}
+		w.uint(h, sum)
+	default:
+		// Funcs, channels and unsafe pointers are told apart by address.
+		w.uint(h, uint64(v.Pointer()))
+	}
+}
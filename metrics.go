@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jfyne/live"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	// metricsInterval is how often the metrics page samples the metrics.
+	metricsInterval = time.Second
+	// metricsSamples is how many samples the sparklines of the metrics
+	// page show.
+	metricsSamples = 60
+)
+
+// Metrics are the Prometheus metrics of the app, served at /metrics: the
+// connected sockets, the live events handled and how long renders take.
+// Their latest values are sampled for the metrics page.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	events  *prometheus.CounterVec
+	errors  *prometheus.CounterVec
+	renders *prometheus.HistogramVec
+
+	mu      sync.Mutex
+	samples []MetricsSample
+}
+
+// MetricsSample are the rates of the metrics over a sampling interval.
+type MetricsSample struct {
+	Time    time.Time
+	Sockets int
+	// Events and Errors are the client events and their errors per second.
+	Events float64
+	Errors float64
+	// RenderMs is the average render time in milliseconds.
+	RenderMs float64
+}
+
+// NewMetrics registers the metrics of the app and of the Go runtime.
+func NewMetrics(sockets *Sockets) *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		events: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "live_events_total",
+			Help: "Live events handled, by kind (event or self) and event.",
+		}, []string{"kind", "event"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "live_event_errors_total",
+			Help: "Live events whose handler returned an error.",
+		}, []string{"kind", "event"}),
+		renders: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "live_render_duration_seconds",
+			Help:    "Time taken to render a page template.",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25},
+		}, []string{"page"}),
+	}
+	m.Registry.MustRegister(
+		m.events,
+		m.errors,
+		m.renders,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "live_sockets",
+			Help: "Connected live sockets.",
+		}, func() float64 { return float64(sockets.Count()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "live_send_dropped_total",
+			Help: "Messages the send queues of slow sockets dropped.",
+		}, func() float64 { dropped, _ := sockets.SendDrops(); return float64(dropped) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "live_send_disconnects_total",
+			Help: "Sockets closed for a full send queue.",
+		}, func() float64 { _, slow := sockets.SendDrops(); return float64(slow) }),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Middleware is the event middleware counting the events and their errors.
+// It has to come after renderErrors, which turns the errors into a message
+// on the page.
+func (m *Metrics) Middleware(kind, event string, next EventFunc) EventFunc {
+	events, errors := m.events.WithLabelValues(kind, event), m.errors.WithLabelValues(kind, event)
+	return func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		events.Inc()
+		result, err := next(ctx, s, data)
+		if err != nil {
+			errors.Inc()
+		}
+		return result, err
+	}
+}
+
+// Render times the render handler of the named page.
+func (m *Metrics) Render(name string, next live.RenderHandler) live.RenderHandler {
+	observer := m.renders.WithLabelValues(name)
+	return func(ctx context.Context, data *live.RenderContext) (io.Reader, error) {
+		start := time.Now()
+		r, err := next(ctx, data)
+		observer.Observe(time.Since(start).Seconds())
+		return r, err
+	}
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// metricsTotals are the totals the samples are computed from.
+type metricsTotals struct {
+	sockets                float64
+	events, errors         float64
+	renders, renderSeconds float64
+}
+
+func (m *Metrics) totals() (metricsTotals, error) {
+	families, err := m.Registry.Gather()
+	if err != nil {
+		return metricsTotals{}, err
+	}
+	var t metricsTotals
+	for _, f := range families {
+		for _, metric := range f.GetMetric() {
+			switch f.GetName() {
+			case "live_sockets":
+				t.sockets = metric.GetGauge().GetValue()
+			case "live_events_total":
+				if clientEvent(metric) {
+					t.events += metric.GetCounter().GetValue()
+				}
+			case "live_event_errors_total":
+				if clientEvent(metric) {
+					t.errors += metric.GetCounter().GetValue()
+				}
+			case "live_render_duration_seconds":
+				t.renders += float64(metric.GetHistogram().GetSampleCount())
+				t.renderSeconds += metric.GetHistogram().GetSampleSum()
+			}
+		}
+	}
+	return t, nil
+}
+
+// clientEvent reports whether metric counts events sent by the client.
+func clientEvent(metric *dto.Metric) bool {
+	for _, l := range metric.GetLabel() {
+		if l.GetName() == "kind" {
+			return l.GetValue() == "event"
+		}
+	}
+	return false
+}
+
+// Sample samples the metrics every interval until ctx is done.
+func (m *Metrics) Sample(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	prev, _ := m.totals()
+	last := time.Now()
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+		cur, err := m.totals()
+		if err != nil {
+			continue
+		}
+		now := time.Now()
+		secs := now.Sub(last).Seconds()
+		s := MetricsSample{
+			Time:    now,
+			Sockets: int(cur.sockets),
+			Events:  (cur.events - prev.events) / secs,
+			Errors:  (cur.errors - prev.errors) / secs,
+		}
+		if n := cur.renders - prev.renders; n > 0 {
+			s.RenderMs = (cur.renderSeconds - prev.renderSeconds) / n * 1000
+		}
+		prev, last = cur, now
+
+		m.mu.Lock()
+		m.samples = append(m.samples, s)
+		if len(m.samples) > metricsSamples {
+			m.samples = m.samples[len(m.samples)-metricsSamples:]
+		}
+		m.mu.Unlock()
+	}
+}
+
+// Samples returns the latest samples, oldest first.
+func (m *Metrics) Samples() []MetricsSample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]MetricsSample(nil), m.samples...)
+}
+
+// MetricsModel is the model of the metrics page.
+type MetricsModel struct {
+	Page
+	Samples []MetricsSample
+}
+
+// MetricCard is a metric of the metrics page, its latest value and a
+// sparkline of the samples.
+type MetricCard struct {
+	Title    string
+	Value    float64
+	Decimals int
+	Unit     string
+	Series   []Reading
+}
+
+// Cards returns the metrics the page shows.
+func (m *MetricsModel) Cards() []MetricCard {
+	cards := []MetricCard{
+		{Title: "Sockets"},
+		{Title: "Events per second", Decimals: 1},
+		{Title: "Errors per second", Decimals: 1},
+		{Title: "Render time", Decimals: 2, Unit: "ms"},
+	}
+	for _, s := range m.Samples {
+		for i, v := range []float64{float64(s.Sockets), s.Events, s.Errors, s.RenderMs} {
+			cards[i].Value = v
+			cards[i].Series = append(cards[i].Series, Reading{Time: s.Time, Value: float32(v)})
+		}
+	}
+	return cards
+}
+
+func metricsModel(s live.Socket) *MetricsModel {
+	if m, ok := s.Assigns().(*MetricsModel); ok {
+		return m
+	}
+	return &MetricsModel{}
+}
+
+// newMetricsPage creates the live handler of the metrics admin page. A
+// connected socket picks up the latest samples every metricsInterval.
+func newMetricsPage(app *App, metrics *Metrics) *Handler {
+	h := app.NewHandler()
+	h.HandleRender(app.Render("metrics.html"))
+	h.HandleMount(func(ctx context.Context, s live.Socket) (interface{}, error) {
+		m := metricsModel(s)
+		m.Samples = metrics.Samples()
+		if s.Connected() {
+			go func() {
+				t := time.NewTicker(metricsInterval)
+				defer t.Stop()
+				for {
+					select {
+					case <-t.C:
+						app.State.Send(s, "metrics-tick", nil)
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+		}
+		return m, nil
+	})
+	h.HandleTick("metrics-tick", func(ctx context.Context, s live.Socket, _ interface{}) (interface{}, error) {
+		m := metricsModel(s)
+		m.Samples = metrics.Samples()
+		return m, nil
+	})
+	return h
+}
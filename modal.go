@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+
+	"github.com/jfyne/live"
+)
+
+// Modal is a confirmation dialog rendered by the "modal" partial. Its state
+// lives in the assigns of the page: it is shown while set, and confirming
+// sends Event again with Params and a "confirmed" param.
+type Modal struct {
+	Title   Message
+	Message Message
+	Event   string
+	Params  map[string]string
+}
+
+// Confirm opens the modal of the socket's page. The page model has to
+// embed Page.
+func Confirm(s live.Socket, modal Modal) {
+	if m, ok := s.Assigns().(pageModel); ok {
+		m.page().Modal = &modal
+	}
+}
+
+// Confirmed reports whether the event was sent by confirming the modal,
+// which is closed.
+func Confirmed(s live.Socket, p live.Params) bool {
+	if p.String("confirmed") == "" {
+		return false
+	}
+	if m, ok := s.Assigns().(pageModel); ok {
+		m.page().Modal = nil
+	}
+	return true
+}
+
+// modalCancel closes the modal of the page.
+func modalCancel(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+	if m, ok := s.Assigns().(pageModel); ok {
+		m.page().Modal = nil
+	}
+	return s.Assigns(), nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// mqttBus is the bus over an MQTT broker, at most once like NATS. The
+// subjects are topics with slashes for the dots, "devices/positions".
+// MQTT 3.1.1 has no headers, the traces of the publishers aren't continued
+// by the subscribers.
+type mqttBus struct {
+	client mqtt.Client
+	*busFanout
+}
+
+func newMQTTBus(url string) (*mqttBus, error) {
+	opts := mqtt.NewClientOptions().
+		AddBroker(url).
+		SetClientID(fmt.Sprintf("live-%s-%d", hostname(), os.Getpid())).
+		SetConnectTimeout(busTimeout).
+		SetAutoReconnect(true).
+		// The handlers run apart from the client, a subscription waiting
+		// for the broker doesn't hold the messages up.
+		SetOrderMatters(false)
+	b := &mqttBus{}
+	b.busFanout = newBusFanout(b.subscribeTopic, b.unsubscribeTopic)
+	// The subscriptions are renewed on every reconnection, the broker
+	// forgets them with a clean session.
+	opts.SetOnConnectHandler(func(mqtt.Client) {
+		b.mu.Lock()
+		subjects := make([]string, 0, len(b.handlers))
+		for subject := range b.handlers {
+			subjects = append(subjects, subject)
+		}
+		b.mu.Unlock()
+		for _, subject := range subjects {
+			if err := b.subscribeTopic(subject); err != nil {
+				log.Printf("could not subscribe to %s again: %v", subject, err)
+			}
+		}
+	})
+	b.client = mqtt.NewClient(opts)
+	if err := mqttWait(b.client.Connect()); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// mqttTopic returns the topic of subject.
+func mqttTopic(subject string) string {
+	return strings.ReplaceAll(subject, ".", "/")
+}
+
+// mqttWait waits for the operation of t, busTimeout at most.
+func mqttWait(t mqtt.Token) error {
+	if !t.WaitTimeout(busTimeout) {
+		return fmt.Errorf("the MQTT broker didn't answer in %s", busTimeout)
+	}
+	return t.Error()
+}
+
+func (b *mqttBus) Publish(ctx context.Context, msg BusMessage) error {
+	return mqttWait(b.client.Publish(mqttTopic(msg.Subject), 0, false, msg.Data))
+}
+
+func (b *mqttBus) subscribeTopic(subject string) error {
+	return mqttWait(b.client.Subscribe(mqttTopic(subject), 0, func(_ mqtt.Client, m mqtt.Message) {
+		b.deliver(BusMessage{Subject: subject, Data: m.Payload()})
+	}))
+}
+
+func (b *mqttBus) unsubscribeTopic(subject string) error {
+	return mqttWait(b.client.Unsubscribe(mqttTopic(subject)))
+}
+
+func (b *mqttBus) Close() error {
+	b.client.Disconnect(250)
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// notifierTimeout bounds the post of a notice to a chat service.
+const notifierTimeout = 10 * time.Second
+
+// Notice is what a Notifier posts: a threshold alert or an admin notice,
+// in the default locale.
+type Notice struct {
+	Kind  NotificationKind
+	Level FlashLevel
+	Text  string
+	Time  time.Time
+}
+
+// icon returns the emoji the chat services show the notice with.
+func (n Notice) icon() string {
+	switch {
+	case n.Kind == NotifyAlert, n.Level == FlashError:
+		return "🔥"
+	case n.Level == FlashWarning:
+		return "⚠️"
+	case n.Level == FlashSuccess:
+		return "✅"
+	default:
+		return "ℹ️"
+	}
+}
+
+// Notifier posts the notices to a target outside of the app, such as the
+// channel of a chat service.
+type Notifier interface {
+	// Name names the target in the logs.
+	Name() string
+	Notify(ctx context.Context, n Notice) error
+}
+
+// Notifiers are the configured notifiers, a notice is posted to all of
+// them.
+type Notifiers []Notifier
+
+// newNotifiers creates the notifiers of the chat webhooks of cfg.
+func newNotifiers(cfg Config) Notifiers {
+	client := &http.Client{Timeout: notifierTimeout}
+	var n Notifiers
+	if cfg.SlackWebhook != "" {
+		n = append(n, slackNotifier{url: cfg.SlackWebhook, client: client})
+	}
+	if cfg.DiscordWebhook != "" {
+		n = append(n, discordNotifier{url: cfg.DiscordWebhook, client: client})
+	}
+	return n
+}
+
+// Send posts a notice to every notifier in the background, a failed post
+// is logged.
+func (n Notifiers) Send(notice Notice) {
+	if notice.Time.IsZero() {
+		notice.Time = time.Now()
+	}
+	for _, notifier := range n {
+		go func(notifier Notifier) {
+			ctx, cancel := context.WithTimeout(context.Background(), notifierTimeout)
+			defer cancel()
+			if err := notifier.Notify(ctx, notice); err != nil {
+				log.Printf("could not notify %s: %v", notifier.Name(), err)
+			}
+		}(notifier)
+	}
+}
+
+// slackNotifier posts to a Slack incoming webhook.
+type slackNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (s slackNotifier) Name() string { return "Slack" }
+
+// slackEscape escapes the characters Slack reads as markup.
+var slackEscape = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func (s slackNotifier) Notify(ctx context.Context, n Notice) error {
+	return postJSON(ctx, s.client, s.url, map[string]interface{}{
+		"text": n.icon() + " " + slackEscape.Replace(n.Text),
+	})
+}
+
+// discordNotifier posts to a Discord channel webhook.
+type discordNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (d discordNotifier) Name() string { return "Discord" }
+
+func (d discordNotifier) Notify(ctx context.Context, n Notice) error {
+	return postJSON(ctx, d.client, d.url, map[string]interface{}{
+		"content": n.icon() + " " + n.Text,
+		// An admin notice mustn't ping @everyone.
+		"allowed_mentions": map[string][]string{"parse": {}},
+	})
+}
+
+// postJSON posts v to url, failing unless the answer is a 2xx.
+func postJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jfyne/live"
+)
+
+const (
+	// notifyBacklog is the number of notifications the center keeps, for
+	// all sessions together.
+	notifyBacklog = 500
+	// notifyShown is the number of notifications the dropdown lists.
+	notifyShown = 10
+	// notificationsEvent is the self event telling the pages of a session,
+	// or of every session, to reload their notifications.
+	notificationsEvent = "notifications"
+)
+
+// NotificationKind is what a notification is about.
+type NotificationKind string
+
+const (
+	NotifyAlert   NotificationKind = "alert"
+	NotifyMention NotificationKind = "mention"
+	NotifySystem  NotificationKind = "system"
+)
+
+// Icon returns the symbol the dropdown shows the kind with.
+func (k NotificationKind) Icon() string {
+	switch k {
+	case NotifyAlert:
+		return "⚠"
+	case NotifyMention:
+		return "@"
+	default:
+		return "ℹ"
+	}
+}
+
+// Notification is an entry of the notification center.
+type Notification struct {
+	ID   int
+	Kind NotificationKind
+	Text Message
+	Time time.Time
+	// Session is the session the notification is for, empty for everyone.
+	Session string
+	// Read is set in the copies returned for a session.
+	Read bool
+}
+
+// Notifications is the notification center of the layout, fed by server
+// events: the temperature alerts, admin notices and messages sent to a
+// session. Every session keeps its own unread state, so a notice for
+// everyone is read once per session.
+type Notifications struct {
+	// broadcast tells the live pages a notification changed, see
+	// App.Broadcast.
+	broadcast func(event string, data interface{})
+	// OnNotify, when set, is called with every new notification.
+	OnNotify func(Notification)
+
+	mu     sync.Mutex
+	items  []Notification
+	read   map[string]map[int]bool
+	nextID int
+}
+
+// NewNotifications creates an empty notification center reloading the
+// pages with broadcast.
+func NewNotifications(broadcast func(event string, data interface{})) *Notifications {
+	return &Notifications{broadcast: broadcast, read: map[string]map[int]bool{}}
+}
+
+// Notify adds a notification for session, or for every session when it is
+// empty.
+func (n *Notifications) Notify(session string, kind NotificationKind, text Message) Notification {
+	n.mu.Lock()
+	n.nextID++
+	item := Notification{ID: n.nextID, Kind: kind, Text: text, Time: time.Now(), Session: session}
+	n.items = append(n.items, item)
+	if len(n.items) > notifyBacklog {
+		n.items = n.items[len(n.items)-notifyBacklog:]
+		oldest := n.items[0].ID
+		for _, read := range n.read {
+			for id := range read {
+				if id < oldest {
+					delete(read, id)
+				}
+			}
+		}
+	}
+	n.mu.Unlock()
+
+	n.broadcast(notificationsEvent, session)
+	if n.OnNotify != nil {
+		n.OnNotify(item)
+	}
+	return item
+}
+
+// For returns the notifications of session, newest first, and the number
+// of unread ones.
+func (n *Notifications) For(session string, limit int) ([]Notification, int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var items []Notification
+	unread := 0
+	for i := len(n.items) - 1; i >= 0; i-- {
+		item := n.items[i]
+		if item.Session != "" && item.Session != session {
+			continue
+		}
+		item.Read = n.read[session][item.ID]
+		if !item.Read {
+			unread++
+		}
+		if len(items) < limit {
+			items = append(items, item)
+		}
+	}
+	return items, unread
+}
+
+// MarkRead marks the notification id as read by session, or all of them
+// when id is 0.
+func (n *Notifications) MarkRead(session string, id int) {
+	n.mu.Lock()
+	read := n.read[session]
+	if read == nil {
+		read = map[int]bool{}
+		n.read[session] = read
+	}
+	for _, item := range n.items {
+		if (id == 0 || item.ID == id) && (item.Session == "" || item.Session == session) {
+			read[item.ID] = true
+		}
+	}
+	n.mu.Unlock()
+
+	n.broadcast(notificationsEvent, session)
+}
+
+// NotificationCenter is the state of the dropdown, part of Page.
+type NotificationCenter struct {
+	Items  []Notification
+	Unread int
+	Open   bool
+}
+
+// load refreshes the notifications of the page model of s.
+func (n *Notifications) load(s live.Socket, model interface{}) {
+	if m, ok := model.(pageModel); ok {
+		c := &m.page().Notifications
+		c.Items, c.Unread = n.For(live.SessionID(s.Session()), notifyShown)
+	}
+}
+
+// Mount is a mount middleware loading the notifications of the session
+// into the page.
+func (n *Notifications) Mount(mount live.MountHandler) live.MountHandler {
+	return func(ctx context.Context, s live.Socket) (interface{}, error) {
+		model, err := mount(ctx, s)
+		if err != nil {
+			return model, err
+		}
+		n.load(s, model)
+		return model, nil
+	}
+}
+
+// handle registers the events of the dropdown and the self event
+// reloading it on h.
+func (n *Notifications) handle(h *Handler) {
+	h.HandleEvent("notifications-toggle", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		if m, ok := s.Assigns().(pageModel); ok {
+			c := &m.page().Notifications
+			c.Open = !c.Open
+		}
+		return s.Assigns(), nil
+	})
+	h.HandleEvent("notification-read", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		n.MarkRead(live.SessionID(s.Session()), p.Int("id"))
+		n.load(s, s.Assigns())
+		return s.Assigns(), nil
+	})
+	h.HandleEvent("notifications-read-all", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		n.MarkRead(live.SessionID(s.Session()), 0)
+		n.load(s, s.Assigns())
+		return s.Assigns(), nil
+	})
+	h.HandleSelf(notificationsEvent, func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		if session, _ := data.(string); session == "" || session == live.SessionID(s.Session()) {
+			n.load(s, s.Assigns())
+		}
+		return s.Assigns(), nil
+	})
+}
+
+// notifyHandler adds a notification for a session, or for everyone
+// without one. It is mounted on the admin group.
+//
+//	curl -u admin:secret -X POST localhost:8080/admin/notify -d 'message=Hello&kind=mention&session=...'
+func notifyHandler(n *Notifications, audit *Audit) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		msg := r.FormValue("message")
+		if msg == "" {
+			http.Error(w, "message is required", http.StatusBadRequest)
+			return
+		}
+		kind := NotificationKind(r.FormValue("kind"))
+		switch kind {
+		case "":
+			kind = NotifySystem
+		case NotifyAlert, NotifyMention, NotifySystem:
+		default:
+			http.Error(w, fmt.Sprintf("unknown kind %q", kind), http.StatusBadRequest)
+			return
+		}
+
+		item := n.Notify(r.FormValue("session"), kind, Message{Key: msg})
+		audit.RecordRequest(r, AuditNotify, r.FormValue("session"), fmt.Sprintf("%s: %s", kind, msg))
+
+		fmt.Fprintf(w, "notification %d added\n", item.ID)
+	}
+}
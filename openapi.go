@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/swaggest/swgui/v5emb"
+)
+
+// apiRoute is a route of the API with what its OpenAPI operation needs. Body
+// and Response are values of the types of the bodies, nil without.
+type apiRoute struct {
+	Method, Path         string
+	Tag                  string
+	Summary, Description string
+	Handler              http.HandlerFunc
+	Params               []apiParam
+	Body                 interface{}
+	// Status is the status of a success, 200 by default.
+	Status   int
+	Response interface{}
+	// Errors are the statuses of the errors besides the 500.
+	Errors []int
+	// Auth routes take the basic auth of the admin pages, see Router.Auth.
+	Auth bool
+}
+
+// apiParam is a parameter of a route, in the path or the query, a string
+// by default.
+type apiParam struct {
+	Name, In, Type string
+	Description    string
+}
+
+// swaggerUI serves the embedded Swagger UI of the OpenAPI document.
+var swaggerUI = v5emb.New("Live API", "/api/openapi.json", "/api/docs/")
+
+// serveOpenAPI serves the OpenAPI document of routes, built once.
+func serveOpenAPI(routes []apiRoute) http.HandlerFunc {
+	doc, err := json.MarshalIndent(openAPI(routes), "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(doc)
+	}
+}
+
+// openAPI returns the OpenAPI 3 document of routes, the schemas of the
+// bodies are those of their Go types, with the descriptions of their doc
+// tags.
+func openAPI(routes []apiRoute) map[string]interface{} {
+	schemas := map[string]interface{}{}
+	paths := map[string]map[string]interface{}{}
+	for _, route := range routes {
+		op := map[string]interface{}{
+			"summary":     route.Summary,
+			"operationId": operationID(route),
+			"tags":        []string{route.Tag},
+		}
+		if route.Description != "" {
+			op["description"] = route.Description
+		}
+		var params []interface{}
+		for _, p := range route.Params {
+			typ := p.Type
+			if typ == "" {
+				typ = "string"
+			}
+			params = append(params, map[string]interface{}{
+				"name":        p.Name,
+				"in":          p.In,
+				"required":    p.In == "path",
+				"description": p.Description,
+				"schema":      map[string]string{"type": typ},
+			})
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+		if route.Body != nil {
+			op["requestBody"] = map[string]interface{}{
+				"content": jsonContent(schemaOf(reflect.TypeOf(route.Body), schemas)),
+			}
+		}
+
+		status := route.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		errorSchema := schemaOf(reflect.TypeOf(apiErrorBody{}), schemas)
+		responses := map[string]interface{}{
+			strconv.Itoa(status): map[string]interface{}{
+				"description": http.StatusText(status),
+				"content":     jsonContent(schemaOf(reflect.TypeOf(route.Response), schemas)),
+			},
+		}
+		codes := route.Errors
+		if route.Auth {
+			op["security"] = []interface{}{map[string][]string{"basicAuth": {}}}
+			codes = append(codes[:len(codes):len(codes)], http.StatusUnauthorized, http.StatusForbidden)
+		}
+		for _, code := range append(codes, http.StatusInternalServerError) {
+			responses[strconv.Itoa(code)] = map[string]interface{}{
+				"description": http.StatusText(code),
+				"content":     jsonContent(errorSchema),
+			}
+		}
+		op["responses"] = responses
+
+		path := "/api" + route.Path
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+		paths[path][strings.ToLower(route.Method)] = op
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]string{
+			"title":       "Live API",
+			"version":     Version,
+			"description": "The setpoints of the zones and the thermostat chat of the live app. The changes take the basic auth of the admin pages, their user is the actor in the audit log; they are forbidden without an admin password.",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas":         schemas,
+			"securitySchemes": map[string]interface{}{"basicAuth": map[string]string{"type": "http", "scheme": "basic"}},
+		},
+	}
+}
+
+// operationID names the operation of route after its method and path,
+// "putZonesZoneSetpoint": the setpoint changes share their handler.
+func operationID(route apiRoute) string {
+	id := strings.ToLower(route.Method)
+	for _, part := range strings.Split(route.Path, "/") {
+		part = strings.Trim(part, "{}")
+		if part != "" {
+			id += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return id
+}
+
+func jsonContent(schema interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaOf returns the JSON schema of t, the structs are added to schemas
+// and referenced by their name.
+func schemaOf(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Struct:
+		name := strings.TrimPrefix(t.Name(), "api")
+		if _, ok := schemas[name]; !ok {
+			// Named first, for the types referencing themselves.
+			schemas[name] = nil
+			schemas[name] = structSchema(t, schemas)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	case t.Kind() == reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case t.Kind() == reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem(), schemas)}
+	case t.Kind() == reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case t.Kind() == reflect.Float32:
+		return map[string]interface{}{"type": "number", "format": "float"}
+	case t.Kind() == reflect.Float64:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	}
+	return map[string]interface{}{"type": "string"}
+}
+
+// structSchema returns the schema of the struct t, the fields without
+// omitempty are required.
+func structSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		schema := schemaOf(f.Type, schemas)
+		if doc := f.Tag.Get("doc"); doc != "" {
+			if _, ref := schema["$ref"]; ref {
+				// A reference takes no sibling in OpenAPI 3.0.
+				schema = map[string]interface{}{"allOf": []interface{}{schema}}
+			}
+			schema["description"] = doc
+		}
+		properties[name] = schema
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	s := map[string]interface{}{"type": "object", "properties": properties}
+	if required != nil {
+		s["required"] = required
+	}
+	return s
+}
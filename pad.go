@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"github.com/jfyne/live"
+)
+
+// Limits of the shared pad.
+const (
+	padMaxLength = 20000
+	// padLogSize is how many edits the pad remembers to rebase the edits
+	// of clients lagging behind. Older clients have to reload the text.
+	padLogSize = 500
+)
+
+// errPadStale is returned for edits based on a version the pad forgot.
+var errPadStale = errors.New("pad: edit is based on a forgotten version")
+
+// PadOp replaces Del characters at Pos with Ins. Positions count UTF-16
+// code units, like the textarea of the browser does.
+type PadOp struct {
+	Pos int    `json:"pos"`
+	Del int    `json:"del"`
+	Ins string `json:"ins"`
+}
+
+// transformPos moves a position in the text before op to the text after
+// it. Positions inside the replaced range move past the inserted text.
+func (op PadOp) transformPos(pos int) int {
+	switch {
+	case pos <= op.Pos:
+		return pos
+	case pos >= op.Pos+op.Del:
+		return pos + len(utf16.Encode([]rune(op.Ins))) - op.Del
+	default:
+		return op.Pos + len(utf16.Encode([]rune(op.Ins)))
+	}
+}
+
+// transform rebases op, made on the text before prev, onto the text after
+// prev. When both insert at the same place, op's text goes in front.
+func (op PadOp) transform(prev PadOp) PadOp {
+	start := prev.transformPos(op.Pos)
+	end := prev.transformPos(op.Pos + op.Del)
+	if end < start {
+		end = start
+	}
+	return PadOp{Pos: start, Del: end - start, Ins: op.Ins}
+}
+
+// PadUser is a user editing the pad and where their cursor is.
+type PadUser struct {
+	ID     string
+	Name   string
+	Cursor int
+	Line   int
+	Column int
+}
+
+// Pad is the shared text buffer of the pad page. Edits carry the version
+// they were made on and are rebased onto the edits applied since, a simple
+// form of operational transformation.
+type Pad struct {
+	mu      sync.Mutex
+	text    []uint16
+	version int
+	log     []PadOp
+	users   map[string]*PadUser
+	guests  int
+}
+
+// NewPad creates an empty pad.
+func NewPad() *Pad {
+	return &Pad{users: map[string]*PadUser{}}
+}
+
+// Text returns the text and its version.
+func (p *Pad) Text() (string, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return string(utf16.Decode(p.text)), p.version
+}
+
+// Apply applies op made on version base and returns the op as it was
+// applied and the new version.
+func (p *Pad) Apply(base int, op PadOp) (PadOp, int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if base > p.version || base < p.version-len(p.log) {
+		return op, p.version, errPadStale
+	}
+	for _, prev := range p.log[len(p.log)-(p.version-base):] {
+		op = op.transform(prev)
+	}
+	ins := utf16.Encode([]rune(op.Ins))
+	if op.Pos < 0 || op.Del < 0 || op.Pos+op.Del > len(p.text) {
+		return op, p.version, fmt.Errorf("pad: edit out of range")
+	}
+	if len(p.text)-op.Del+len(ins) > padMaxLength {
+		return op, p.version, fmt.Errorf("pad: the text is limited to %d characters", padMaxLength)
+	}
+
+	text := make([]uint16, 0, len(p.text)-op.Del+len(ins))
+	text = append(text, p.text[:op.Pos]...)
+	text = append(text, ins...)
+	p.text = append(text, p.text[op.Pos+op.Del:]...)
+
+	p.version++
+	p.log = append(p.log, op)
+	if len(p.log) > padLogSize {
+		p.log = p.log[len(p.log)-padLogSize:]
+	}
+	for _, u := range p.users {
+		p.moveCursor(u, op.transformPos(u.Cursor))
+	}
+	return op, p.version, nil
+}
+
+// Join adds a user, named after the number of guests when name is empty.
+func (p *Pad) Join(id, name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if name == "" {
+		p.guests++
+		name = fmt.Sprintf("Guest %d", p.guests)
+	}
+	p.users[id] = &PadUser{ID: id, Name: name, Line: 1, Column: 1}
+}
+
+// Leave removes a user.
+func (p *Pad) Leave(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.users, id)
+}
+
+// MoveCursor records the cursor position of a user.
+func (p *Pad) MoveCursor(id string, pos int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if u := p.users[id]; u != nil {
+		p.moveCursor(u, pos)
+	}
+}
+
+func (p *Pad) moveCursor(u *PadUser, pos int) {
+	if pos < 0 {
+		pos = 0
+	}
+	if pos > len(p.text) {
+		pos = len(p.text)
+	}
+	u.Cursor, u.Line, u.Column = pos, 1, 1
+	for _, c := range p.text[:pos] {
+		if c == '\n' {
+			u.Line++
+			u.Column = 1
+		} else {
+			u.Column++
+		}
+	}
+}
+
+// Users returns the users editing the pad, by name.
+func (p *Pad) Users() []PadUser {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	users := make([]PadUser, 0, len(p.users))
+	for _, u := range p.users {
+		users = append(users, *u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	return users
+}
+
+// padUpdate is the broadcast of an applied edit.
+type padUpdate struct {
+	Version int    `json:"version"`
+	Op      PadOp  `json:"op"`
+	Author  string `json:"author"`
+}
+
+// PadModel is the model of the pad page. The text itself isn't part of
+// it: the pad hook owns the textarea and applies the edits it's sent, so
+// the cursor stays where it is.
+type PadModel struct {
+	Page
+	Users []PadUser
+	// Me is the ID of the socket in Users.
+	Me string
+}
+
+func padModel(s live.Socket) *PadModel {
+	if m, ok := s.Assigns().(*PadModel); ok {
+		return m
+	}
+	return &PadModel{}
+}
+
+// newPad creates the shared pad live handler.
+func newPad(app *App, pad *Pad) *Handler {
+	h := app.NewHandler()
+	h.HandleRender(app.Render("pad.html"))
+	h.HandleMount(func(ctx context.Context, s live.Socket) (interface{}, error) {
+		m := padModel(s)
+		if s.Connected() {
+			id := string(s.ID())
+			pad.Join(id, live.Request(ctx).URL.Query().Get("name"))
+			m.Me = id
+			s.Broadcast("pad-presence", nil)
+			go func() {
+				<-ctx.Done()
+				pad.Leave(id)
+				s.Broadcast("pad-presence", nil)
+			}()
+		}
+		m.Users = pad.Users()
+		return m, nil
+	})
+
+	// sendText sends the whole text to the hook, once mounted and whenever
+	// it lost track of the versions.
+	sendText := func(s live.Socket) (interface{}, error) {
+		text, version := pad.Text()
+		return s.Assigns(), s.Send("pad-text", map[string]interface{}{"text": text, "version": version, "me": string(s.ID())})
+	}
+	h.HandleEvent("pad-ready", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		return sendText(s)
+	})
+	h.HandleEvent("pad-edit", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		op := PadOp{Pos: p.Int("pos"), Del: p.Int("del"), Ins: p.String("ins")}
+		op, version, err := pad.Apply(p.Int("base"), op)
+		if err != nil {
+			// The hook starts over from the text of the server.
+			if _, serr := sendText(s); serr != nil || errors.Is(err, errPadStale) {
+				return s.Assigns(), serr
+			}
+			return s.Assigns(), err
+		}
+		s.Broadcast("pad-op", padUpdate{Version: version, Op: op, Author: string(s.ID())})
+		return s.Assigns(), nil
+	})
+	h.HandleThrottled("pad-cursor", 200*time.Millisecond, func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		pad.MoveCursor(string(s.ID()), p.Int("pos"))
+		s.Broadcast("pad-presence", nil)
+		return s.Assigns(), nil
+	})
+
+	h.HandleSelf("pad-op", func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		m := padModel(s)
+		m.Users = pad.Users()
+		return m, s.Send("pad-op", data)
+	})
+	h.HandleSelf("pad-presence", func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		m := padModel(s)
+		m.Users = pad.Users()
+		return m, nil
+	})
+	return h
+}
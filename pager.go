@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+
+	"github.com/jfyne/live"
+)
+
+// Pager is the state of a paginated list: the page shown and the page
+// size. The total is only known when rendering, see View.
+type Pager struct {
+	// ID identifies the list on the page, it is sent with the "paginate"
+	// event.
+	ID   string
+	Page int
+	Size int
+}
+
+// PageView is what the "pagination" partial renders.
+type PageView struct {
+	ID    string
+	Page  int
+	Pages int
+	Total int
+	// Start and End bound the items of the page.
+	Start, End int
+}
+
+// View computes the page of a list of total items. The current page is
+// clamped to the pages there are.
+func (p Pager) View(total int) PageView {
+	size := p.Size
+	if size < 1 {
+		size = 10
+	}
+	pages := (total + size - 1) / size
+	if pages < 1 {
+		pages = 1
+	}
+	page := p.Page
+	if page < 1 {
+		page = 1
+	}
+	if page > pages {
+		page = pages
+	}
+	start := (page - 1) * size
+	end := start + size
+	if end > total {
+		end = total
+	}
+	return PageView{ID: p.ID, Page: page, Pages: pages, Total: total, Start: start, End: end}
+}
+
+// Prev returns the previous page, 0 on the first one.
+func (v PageView) Prev() int {
+	return v.Page - 1
+}
+
+// Next returns the next page, 0 on the last one.
+func (v PageView) Next() int {
+	if v.Page >= v.Pages {
+		return 0
+	}
+	return v.Page + 1
+}
+
+// Numbers returns the page numbers to link: the first and last page and
+// the ones around the current page, with 0 standing for a gap.
+func (v PageView) Numbers() []int {
+	var numbers []int
+	for n := 1; n <= v.Pages; n++ {
+		if n == 1 || n == v.Pages || (n >= v.Page-1 && n <= v.Page+1) {
+			numbers = append(numbers, n)
+		} else if len(numbers) > 0 && numbers[len(numbers)-1] != 0 {
+			numbers = append(numbers, 0)
+		}
+	}
+	return numbers
+}
+
+// pagerModel is implemented by page models with paginated lists.
+type pagerModel interface {
+	// Pager returns the pager of the list with the given ID, nil if there
+	// is none.
+	Pager(id string) *Pager
+}
+
+// paginate shows the page in the "page" param of the list in the "id"
+// param.
+func paginate(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+	if m, ok := s.Assigns().(pagerModel); ok {
+		if pager := m.Pager(p.String("id")); pager != nil {
+			pager.Page = p.Int("page")
+		}
+	}
+	return s.Assigns(), nil
+}
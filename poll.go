@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/jfyne/live"
+)
+
+// pollQuestion and pollOptions are the poll of the poll page.
+var (
+	pollQuestion = "Which part of live views do you like best?"
+	pollOptions  = []string{"Server rendered HTML", "Diffs over a websocket", "Hooks", "Broadcasts"}
+)
+
+var (
+	errPollClosed = errors.New("poll: the poll is closed")
+	errPollVoted  = errors.New("poll: already voted")
+)
+
+// PollResult is the votes of an option.
+type PollResult struct {
+	Option string
+	Votes  int
+	// Ratio is the share of the votes, 0 to 1.
+	Ratio float64
+}
+
+// Width returns the ratio as a CSS width.
+func (r PollResult) Width() string {
+	return fmt.Sprintf("%.1f%%", r.Ratio*100)
+}
+
+// Poll is a poll every session votes in once, shared by all sockets.
+type Poll struct {
+	Question string
+	Options  []string
+
+	mu     sync.Mutex
+	votes  map[string]int
+	closed bool
+}
+
+// NewPoll creates an open poll.
+func NewPoll(question string, options []string) *Poll {
+	return &Poll{Question: question, Options: options, votes: map[string]int{}}
+}
+
+// Vote records the vote of a session for an option.
+func (p *Poll) Vote(session string, option int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if option < 0 || option >= len(p.Options) {
+		return fmt.Errorf("poll: unknown option %d", option)
+	}
+	if p.closed {
+		return errPollClosed
+	}
+	if _, ok := p.votes[session]; ok {
+		return errPollVoted
+	}
+	p.votes[session] = option
+	return nil
+}
+
+// Voted returns the option a session voted for.
+func (p *Poll) Voted(session string) (int, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	option, ok := p.votes[session]
+	return option, ok
+}
+
+// Results returns the votes of every option and their total.
+func (p *Poll) Results() ([]PollResult, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	results := make([]PollResult, len(p.Options))
+	for i, o := range p.Options {
+		results[i].Option = o
+	}
+	for _, option := range p.votes {
+		results[option].Votes++
+	}
+	for i := range results {
+		if len(p.votes) > 0 {
+			results[i].Ratio = float64(results[i].Votes) / float64(len(p.votes))
+		}
+	}
+	return results, len(p.votes)
+}
+
+// Closed reports whether the poll is closed.
+func (p *Poll) Closed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+// SetClosed closes or reopens the poll.
+func (p *Poll) SetClosed(closed bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = closed
+}
+
+// Reset drops every vote.
+func (p *Poll) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.votes = map[string]int{}
+}
+
+// PollModel is the model of the poll page.
+type PollModel struct {
+	Page
+	Question string
+	Options  []string
+	Results  []PollResult
+	Total    int
+	Closed   bool
+	// Voted is the option of the session, -1 until it voted.
+	Voted int
+}
+
+func pollModel(s live.Socket) *PollModel {
+	if m, ok := s.Assigns().(*PollModel); ok {
+		return m
+	}
+	return &PollModel{Voted: -1}
+}
+
+func (m *PollModel) load(s live.Socket, poll *Poll) {
+	m.Question, m.Options = poll.Question, poll.Options
+	m.Results, m.Total = poll.Results()
+	m.Closed = poll.Closed()
+	m.Voted = -1
+	if option, ok := poll.Voted(live.SessionID(s.Session())); ok {
+		m.Voted = option
+	}
+}
+
+// newPoll creates the poll live handler. Every vote is broadcast so the
+// results of all viewers update at once.
+func newPoll(app *App, poll *Poll) *Handler {
+	h := app.NewHandler()
+	h.HandleRender(app.Render("poll.html"))
+	h.HandleMount(func(ctx context.Context, s live.Socket) (interface{}, error) {
+		m := pollModel(s)
+		m.load(s, poll)
+		return m, nil
+	})
+	h.HandleEvent("poll-vote", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := pollModel(s)
+		err := poll.Vote(live.SessionID(s.Session()), p.Int("option"))
+		switch {
+		case errors.Is(err, errPollClosed):
+			Flash(s, FlashWarning, "The poll is closed.")
+		case errors.Is(err, errPollVoted):
+			Flash(s, FlashWarning, "You have already voted.")
+		case err != nil:
+			return m, err
+		default:
+			s.Broadcast("poll", nil)
+		}
+		m.load(s, poll)
+		return m, nil
+	})
+	h.HandleSelf("poll", func(ctx context.Context, s live.Socket, _ interface{}) (interface{}, error) {
+		m := pollModel(s)
+		m.load(s, poll)
+		return m, nil
+	})
+	return h
+}
+
+// pollAdminHandler resets, closes or reopens the poll and updates every
+// poll page. It is mounted on the admin group.
+//
+//	curl -u admin:secret -X POST 'localhost:8080/admin/poll?action=reset'
+func pollAdminHandler(poll *Poll, engine *live.HttpEngine, audit *Audit) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch action := r.FormValue("action"); action {
+		case "reset":
+			poll.Reset()
+		case "close":
+			poll.SetClosed(true)
+		case "open":
+			poll.SetClosed(false)
+		default:
+			http.Error(w, fmt.Sprintf("unknown action %q, use reset, close or open", action), http.StatusBadRequest)
+			return
+		}
+		if err := engine.Broadcast("poll", nil); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, total := poll.Results()
+		audit.RecordRequest(r, AuditPoll, "", r.FormValue("action"))
+		fmt.Fprintf(w, "poll closed=%t votes=%d\n", poll.Closed(), total)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/jfyne/live"
+)
+
+const (
+	// postsPageSize is how many posts a page of the feed loads.
+	postsPageSize = 20
+	// postsMaxLoaded is how many posts a feed page holds at most.
+	postsMaxLoaded = 500
+)
+
+// Post is an entry of the simulated feed, the newest posts having the
+// highest IDs.
+type Post struct {
+	ID     int
+	Author string
+	Text   string
+	Time   time.Time
+}
+
+// PostStore is a read-only list of posts paged by cursor: a page starts
+// after the ID of the last post of the previous one, so pages don't shift
+// when posts are added on top.
+type PostStore struct {
+	posts []Post // newest first
+}
+
+// NewPostStore creates a store of n simulated posts, one about every few
+// minutes going back from now.
+func NewPostStore(n int, seed int64) *PostStore {
+	r := rand.New(rand.NewSource(seed))
+	authors := []string{"Ada", "Alan", "Barbara", "Dennis", "Grace", "Ken", "Linus", "Margaret", "Rob"}
+	topics := []string{"the thermostat", "websockets", "diffing", "hooks", "NATS", "templates", "the pad", "Go"}
+	moods := []string{"I just tried %s and it works great.", "Anyone else debugging %s today?", "Wrote a blog post about %s.", "%s is faster than I thought.", "Thinking about %s again."}
+	s := &PostStore{}
+	t := time.Now()
+	for id := n; id > 0; id-- {
+		t = t.Add(-time.Duration(1+r.Intn(10)) * time.Minute)
+		text := fmt.Sprintf(moods[r.Intn(len(moods))], topics[r.Intn(len(topics))])
+		s.posts = append(s.posts, Post{ID: id, Author: authors[r.Intn(len(authors))], Text: text, Time: t})
+	}
+	return s
+}
+
+// Before returns up to n posts older than the post with ID cursor, all
+// from the newest when cursor is 0, and whether there are more.
+func (s *PostStore) Before(cursor, n int) ([]Post, bool) {
+	i := 0
+	if cursor > 0 {
+		// The posts are sorted by descending ID.
+		i = sort.Search(len(s.posts), func(i int) bool { return s.posts[i].ID < cursor })
+	}
+	end := i + n
+	if end > len(s.posts) {
+		end = len(s.posts)
+	}
+	return append([]Post(nil), s.posts[i:end]...), end < len(s.posts)
+}
+
+// PostsModel is the model of the feed page.
+type PostsModel struct {
+	Page
+	Posts []Post `json:"-"`
+	// Cursor is the ID of the last post loaded.
+	Cursor int
+	More   bool
+}
+
+func postsModel(s live.Socket) *PostsModel {
+	if m, ok := s.Assigns().(*PostsModel); ok {
+		return m
+	}
+	return &PostsModel{}
+}
+
+// loadMore appends the next page of posts.
+func (m *PostsModel) loadMore(store *PostStore) {
+	posts, more := store.Before(m.Cursor, postsPageSize)
+	m.Posts = append(m.Posts, posts...)
+	if n := len(posts); n > 0 {
+		m.Cursor = posts[n-1].ID
+	}
+	m.More = more && len(m.Posts) < postsMaxLoaded
+}
+
+// newPosts creates the infinite feed live handler. The infinite-scroll hook
+// sends load-more when the end of the list comes into view; only the new
+// posts are sent to the page, as the diff of a longer list.
+func newPosts(app *App, store *PostStore) *Handler {
+	h := app.NewHandler()
+	h.HandleRender(app.Render("posts.html"))
+	h.HandleMount(func(ctx context.Context, s live.Socket) (interface{}, error) {
+		// The posts aren't kept with the assigns, a mount starts over from
+		// the newest.
+		m := postsModel(s)
+		m.Posts, m.Cursor = nil, 0
+		m.loadMore(store)
+		return m, nil
+	})
+	h.HandleEvent("load-more", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := postsModel(s)
+		if m.More {
+			m.loadMore(store)
+		}
+		// The hook asks again while the end of the list is still in view.
+		return m, s.Send("posts-loaded", map[string]interface{}{"more": m.More})
+	})
+	return h
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jfyne/live"
+)
+
+// preferencesKey is the key of the user preferences in the store.
+const preferencesKey = "preferences"
+
+// Preferences are the email preferences of a user: the address and the
+// emails the user opted in to, in the language and timezone of the page
+// they were saved on.
+type Preferences struct {
+	Email string
+	// Alerts opts in to the threshold alerts, Summary to the daily
+	// summary.
+	Alerts   bool
+	Summary  bool
+	Locale   string
+	Timezone string
+}
+
+// UserPreferences are the preferences of the users by session, kept in the
+// app's store like the configured zones.
+type UserPreferences struct {
+	store AssignsStore
+
+	mu    sync.Mutex
+	prefs map[string]Preferences
+}
+
+// LoadUserPreferences loads the preferences from store.
+func LoadUserPreferences(ctx context.Context, store AssignsStore) (*UserPreferences, error) {
+	u := &UserPreferences{store: store, prefs: map[string]Preferences{}}
+	if _, err := store.Load(ctx, preferencesKey, &u.prefs); err != nil {
+		return u, fmt.Errorf("could not load the preferences: %w", err)
+	}
+	return u, nil
+}
+
+// Get returns the preferences of session, none opted in without.
+func (u *UserPreferences) Get(session string) Preferences {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.prefs[session]
+}
+
+// Save stores the preferences of session.
+func (u *UserPreferences) Save(ctx context.Context, session string, p Preferences) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	prefs := make(map[string]Preferences, len(u.prefs)+1)
+	for k, v := range u.prefs {
+		prefs[k] = v
+	}
+	prefs[session] = p
+	if err := u.store.Save(ctx, preferencesKey, prefs); err != nil {
+		return fmt.Errorf("could not save the preferences: %w", err)
+	}
+	u.prefs = prefs
+	return nil
+}
+
+// Subscribers returns the preferences opted in to the emails of opted, by
+// address; an address saved by several sessions gets one email.
+func (u *UserPreferences) Subscribers(opted func(Preferences) bool) []Preferences {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	byEmail := map[string]Preferences{}
+	for _, p := range u.prefs {
+		if p.Email != "" && opted(p) {
+			byEmail[strings.ToLower(p.Email)] = p
+		}
+	}
+	list := make([]Preferences, 0, len(byEmail))
+	for _, p := range byEmail {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Email < list[j].Email })
+	return list
+}
+
+// preferencesForm validates the preferences form, the address is only
+// required to opt in, see apply.
+var preferencesForm = Form{
+	"email": {Length(0, 254), Email()},
+}
+
+// PreferencesModel is the model of the preferences page.
+type PreferencesModel struct {
+	Page
+	Preferences Preferences
+	// Mail reports whether the server sends emails at all.
+	Mail  bool
+	Saved bool
+	// PushKey is the VAPID public key the browser subscribes with, empty
+	// without Web Push; Pushed is set once the browser of the socket is
+	// subscribed.
+	PushKey string
+	Pushed  bool
+	Errors  Errors `json:"-"`
+}
+
+func preferencesModel(s live.Socket, prefs *UserPreferences) *PreferencesModel {
+	if m, ok := s.Assigns().(*PreferencesModel); ok {
+		return m
+	}
+	return &PreferencesModel{Preferences: prefs.Get(live.SessionID(s.Session()))}
+}
+
+// newPreferences creates the preferences page, where a user opts in to the
+// alert and summary emails with "preferences-save", and to the push
+// notifications of the browser with the "push" hook. The hook sends
+// "push-subscribe" with the subscription of the browser, also on the mount
+// of a browser subscribed before, and "push-unsubscribe".
+func newPreferences(app *App, prefs *UserPreferences) *Handler {
+	h := app.NewHandler()
+	h.HandleRender(app.Render("preferences.html"))
+	h.HandleMount(func(ctx context.Context, s live.Socket) (interface{}, error) {
+		m := preferencesModel(s, prefs)
+		m.Mail = app.Mailer != nil
+		if app.Push != nil {
+			m.PushKey = app.Config.Push.PublicKey
+		}
+		return m, nil
+	})
+	h.HandleEvent("push-subscribe", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := preferencesModel(s, prefs)
+		if app.Push == nil {
+			return m, nil
+		}
+		sub := PushSubscription{Locale: m.Locale}
+		sub.Endpoint = p.String("endpoint")
+		sub.Keys.P256dh, sub.Keys.Auth = p.String("p256dh"), p.String("auth")
+		if err := app.Push.Subscribe(ctx, live.SessionID(s.Session()), sub); err != nil {
+			return m, err
+		}
+		m.Pushed = true
+		return m, nil
+	})
+	h.HandleEvent("push-unsubscribe", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := preferencesModel(s, prefs)
+		if app.Push == nil {
+			return m, nil
+		}
+		if err := app.Push.Unsubscribe(ctx, live.SessionID(s.Session()), p.String("endpoint")); err != nil {
+			return m, err
+		}
+		m.Pushed = false
+		return m, nil
+	})
+	h.HandleEvent("preferences-save", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := preferencesModel(s, prefs)
+		m.Saved = false
+		next := Preferences{
+			Email:    strings.TrimSpace(p.String("email")),
+			Alerts:   p.Checkbox("alerts"),
+			Summary:  p.Checkbox("summary"),
+			Locale:   m.Locale,
+			Timezone: m.location().String(),
+		}
+		m.Preferences = next
+		if m.Errors = preferencesForm.Validate(p); len(m.Errors) > 0 {
+			return m, nil
+		}
+		if next.Email == "" && (next.Alerts || next.Summary) {
+			m.Errors = Errors{"email": Message{Key: "Enter the address the emails go to."}}
+			return m, nil
+		}
+		if err := prefs.Save(ctx, live.SessionID(s.Session()), next); err != nil {
+			return m, err
+		}
+		m.Saved = true
+		return m, nil
+	})
+	return h
+}
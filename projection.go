@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jfyne/live"
+
+	"my-app.com/live/store"
+)
+
+const (
+	// projectionInterval is how often the projector reads the new events
+	// of the log.
+	projectionInterval = time.Second
+	// projectionBatch is the number of events read at once.
+	projectionBatch = 500
+)
+
+// Projection is a read model built from the event log.
+type Projection interface {
+	// Apply updates the model with e. replay is set while the model is
+	// rebuilt at startup from the events of earlier runs, whose side
+	// effects happened already.
+	Apply(e store.Event, replay bool)
+}
+
+// Projector feeds the events of the log to the projections, outside of
+// the event handlers. Rebuild replays the log once at startup, Run then
+// applies the events as they are appended, from every instance sharing the
+// database.
+type Projector struct {
+	repo        store.EventRepo
+	projections []Projection
+	last        int64
+}
+
+// NewProjector creates a projector of the log of repo.
+func NewProjector(repo store.EventRepo, projections ...Projection) *Projector {
+	return &Projector{repo: repo, projections: projections}
+}
+
+// Rebuild replays the whole log into the projections.
+func (p *Projector) Rebuild(ctx context.Context) error {
+	start := time.Now()
+	n, err := p.apply(ctx, true)
+	if err != nil {
+		return fmt.Errorf("could not rebuild the projections: %w", err)
+	}
+	log.Printf("projections rebuilt from %d events in %s", n, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// Run applies the new events of the log every interval until ctx is done.
+func (p *Projector) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if _, err := p.apply(ctx, false); err != nil {
+				log.Println("projection error:", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// apply applies the events after the last one applied, batch after batch,
+// and returns their number.
+func (p *Projector) apply(ctx context.Context, replay bool) (int, error) {
+	n := 0
+	for {
+		events, err := p.repo.After(ctx, p.last, projectionBatch)
+		if err != nil {
+			return n, err
+		}
+		for _, e := range events {
+			for _, projection := range p.projections {
+				projection.Apply(e, replay)
+			}
+			p.last = e.ID
+		}
+		n += len(events)
+		if len(events) < projectionBatch {
+			return n, nil
+		}
+	}
+}
+
+// tempControlEvents are the events of the temperature controls changing a
+// setpoint.
+var tempControlEvents = map[string]bool{
+	"temp-up":     true,
+	"temp-down":   true,
+	"temp-change": true,
+	"temp-set":    true,
+	"temp-slide":  true,
+}
+
+// historyProjection builds the zone history, the readings, alerts and
+// daily statistics of the report, from the setpoints the controls set.
+type historyProjection struct {
+	history *ZoneHistory
+	// last is the time of the latest reading of every zone, an event that
+	// didn't change the setpoint still carries the control.
+	last map[string]time.Time
+}
+
+func newHistoryProjection(history *ZoneHistory) *historyProjection {
+	return &historyProjection{history: history, last: map[string]time.Time{}}
+}
+
+func (p *historyProjection) Apply(e store.Event, replay bool) {
+	if e.Kind != store.EventClient || e.Error != "" || !tempControlEvents[e.Name] {
+		return
+	}
+	c, ok := eventControl(e)
+	if !ok || len(c.History) == 0 {
+		return
+	}
+	r := c.History[len(c.History)-1]
+	if !r.Time.After(p.last[c.Zone]) {
+		return
+	}
+	p.last[c.Zone] = r.Time
+	if replay {
+		p.history.Restore(c.Zone, r)
+		return
+	}
+	p.history.Record(c.Zone, r)
+}
+
+// eventControl finds the temperature control of the event in the fields
+// it changed. The pages keep their controls in different fields, so the
+// delta is searched for an object with the ID of the event params and the
+// fields of a control.
+func eventControl(e store.Event) (TempControl, bool) {
+	var p live.Params
+	var delta interface{}
+	if json.Unmarshal(e.Params, &p) != nil || json.Unmarshal(e.Delta, &delta) != nil {
+		return TempControl{}, false
+	}
+	id := p.String("id")
+	var found map[string]interface{}
+	var search func(v interface{})
+	search = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			_, zone := v["Zone"]
+			_, history := v["History"]
+			if v["ID"] == id && zone && history {
+				found = v
+				return
+			}
+			for _, field := range v {
+				if search(field); found != nil {
+					return
+				}
+			}
+		case []interface{}:
+			for _, item := range v {
+				if search(item); found != nil {
+					return
+				}
+			}
+		}
+	}
+	search(delta)
+	if found == nil {
+		return TempControl{}, false
+	}
+	var c TempControl
+	b, _ := json.Marshal(found)
+	return c, json.Unmarshal(b, &c) == nil
+}
+
+// setEvent is the temp-set event of a setpoint changed outside of the live
+// pages, by the seed command or the API. Its delta carries the control the
+// way the thermostat's does, so the projections read it like the events of
+// the pages. The caller fills in who made it.
+func setEvent(c TempControl) (store.Event, error) {
+	r := c.History[len(c.History)-1]
+	params, err := json.Marshal(map[string]string{"id": c.ID, "temperature": fmt.Sprintf("%.1f", r.Value)})
+	if err != nil {
+		return store.Event{}, err
+	}
+	delta, err := json.Marshal(map[string]interface{}{"Control": c})
+	if err != nil {
+		return store.Event{}, err
+	}
+	return store.Event{Kind: store.EventClient, Name: "temp-set", Params: params, Delta: delta, Time: r.Time}, nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	webpush "github.com/SherClockHolmes/webpush-go"
+)
+
+const (
+	// pushTimeout bounds the delivery of a push message to the push
+	// service of a browser.
+	pushTimeout = 10 * time.Second
+	// pushTTL is how long the push service keeps a message for a browser
+	// that is offline.
+	pushTTL = 24 * 60 * 60
+	// pushKey is the key of the push subscriptions in the store.
+	pushKey = "push-subscriptions"
+)
+
+// PushConfig configures the Web Push of the notifications, see
+// "live vapid".
+type PushConfig struct {
+	// PublicKey and PrivateKey are the VAPID keys identifying the server
+	// to the push services, Web Push is disabled without them.
+	PublicKey, PrivateKey string
+	// Subject is the email address the push services contact the admin of
+	// the server at.
+	Subject string
+}
+
+// PushSubscription is a browser subscribed to the push messages of a
+// session, in the language of the page it subscribed on.
+type PushSubscription struct {
+	webpush.Subscription
+	Locale string
+}
+
+// pushMessage is the payload the service worker shows a notification of.
+type pushMessage struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	Tag   string `json:"tag"`
+	URL   string `json:"url"`
+}
+
+// Push delivers the alerts and the mentions of the notification center by
+// Web Push, so a browser shows them with the tab closed. The subscriptions
+// are kept by session in the app's store like the preferences; one a push
+// service reports gone is dropped.
+type Push struct {
+	cfg     PushConfig
+	store   AssignsStore
+	locales *Locales
+	client  *http.Client
+
+	mu   sync.Mutex
+	subs map[string][]PushSubscription
+}
+
+// LoadPush loads the subscriptions from store.
+func LoadPush(ctx context.Context, cfg PushConfig, store AssignsStore, locales *Locales) (*Push, error) {
+	p := &Push{cfg: cfg, store: store, locales: locales, client: &http.Client{Timeout: pushTimeout}, subs: map[string][]PushSubscription{}}
+	if _, err := store.Load(ctx, pushKey, &p.subs); err != nil {
+		return p, fmt.Errorf("could not load the push subscriptions: %w", err)
+	}
+	return p, nil
+}
+
+// Subscribe subscribes a browser to the push messages of session, again
+// with its new keys and locale when it already is.
+func (p *Push) Subscribe(ctx context.Context, session string, sub PushSubscription) error {
+	if u, err := url.Parse(sub.Endpoint); err != nil || u.Scheme != "https" || u.Host == "" {
+		return errors.New("invalid push endpoint")
+	}
+	if sub.Keys.Auth == "" || sub.Keys.P256dh == "" {
+		return errors.New("the push subscription has no keys")
+	}
+	return p.update(ctx, session, sub.Endpoint, &sub)
+}
+
+// Unsubscribe drops the subscription of endpoint from session.
+func (p *Push) Unsubscribe(ctx context.Context, session, endpoint string) error {
+	return p.update(ctx, session, endpoint, nil)
+}
+
+// update replaces the subscription of endpoint of session with sub, or
+// drops it when sub is nil, and stores the subscriptions.
+func (p *Push) update(ctx context.Context, session, endpoint string, sub *PushSubscription) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	subs := make(map[string][]PushSubscription, len(p.subs)+1)
+	for k, v := range p.subs {
+		subs[k] = v
+	}
+	var list []PushSubscription
+	for _, s := range subs[session] {
+		if s.Endpoint != endpoint {
+			list = append(list, s)
+		}
+	}
+	if sub != nil {
+		list = append(list, *sub)
+	}
+	if len(list) == 0 {
+		delete(subs, session)
+	} else {
+		subs[session] = list
+	}
+	if err := p.store.Save(ctx, pushKey, subs); err != nil {
+		return fmt.Errorf("could not save the push subscriptions: %w", err)
+	}
+	p.subs = subs
+	return nil
+}
+
+// Notify pushes n to the browsers of its session, or of every session
+// when it is for everyone, in the background. Only the alerts and the
+// mentions are pushed.
+func (p *Push) Notify(n Notification) {
+	if n.Kind != NotifyAlert && n.Kind != NotifyMention {
+		return
+	}
+	type target struct {
+		session string
+		sub     PushSubscription
+	}
+	var targets []target
+	p.mu.Lock()
+	for session, subs := range p.subs {
+		if n.Session == "" || n.Session == session {
+			for _, sub := range subs {
+				targets = append(targets, target{session, sub})
+			}
+		}
+	}
+	p.mu.Unlock()
+	for _, t := range targets {
+		go func(session string, sub PushSubscription) {
+			ctx, cancel := context.WithTimeout(context.Background(), pushTimeout)
+			defer cancel()
+			if err := p.send(ctx, session, sub, n); err != nil {
+				log.Printf("could not push to %s: %v", sub.Endpoint, err)
+			}
+		}(t.session, t.sub)
+	}
+}
+
+// send pushes n to sub, dropping a subscription the push service no longer
+// knows.
+func (p *Push) send(ctx context.Context, session string, sub PushSubscription, n Notification) error {
+	loc := p.locales.Get(sub.Locale)
+	msg, err := json.Marshal(pushMessage{
+		Title: n.Kind.Icon() + " Go Live",
+		Body:  loc.Format(n.Text),
+		Tag:   fmt.Sprintf("%s-%d", n.Kind, n.ID),
+		URL:   "/",
+	})
+	if err != nil {
+		return err
+	}
+	urgency := webpush.UrgencyNormal
+	if n.Kind == NotifyAlert {
+		urgency = webpush.UrgencyHigh
+	}
+	resp, err := webpush.SendNotificationWithContext(ctx, msg, &sub.Subscription, &webpush.Options{
+		HTTPClient:      p.client,
+		Subscriber:      p.cfg.Subject,
+		TTL:             pushTTL,
+		Urgency:         urgency,
+		VAPIDPublicKey:  p.cfg.PublicKey,
+		VAPIDPrivateKey: p.cfg.PrivateKey,
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	switch {
+	case resp.StatusCode == http.StatusNotFound, resp.StatusCode == http.StatusGone:
+		return p.Unsubscribe(ctx, session, sub.Endpoint)
+	case resp.StatusCode/100 != 2:
+		return fmt.Errorf("push service answered %s", resp.Status)
+	}
+	return nil
+}
+
+// vapid prints a new pair of VAPID keys for --vapid-public-key and
+// --vapid-private-key.
+func vapid(args []string) error {
+	if len(args) > 0 {
+		return errors.New("usage: live vapid")
+	}
+	private, public, err := webpush.GenerateVAPIDKeys()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("VAPID_PUBLIC_KEY=%s\nVAPID_PRIVATE_KEY=%s\n", public, private)
+	return nil
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jfyne/live"
+)
+
+// Sockets tracks the websocket connections of the live handlers and
+// applies the keepalive settings to them.
+type Sockets struct {
+	keepalive Keepalive
+	state     *State
+	// Max is the maximum number of concurrent sockets, 0 means no limit.
+	Max int
+	// Overflow renders the page shown to new visitors while the server is
+	// full.
+	Overflow http.Handler
+
+	mu    sync.Mutex
+	conns map[*wsConn]struct{}
+	// pages counts the connections of every handler, see On.
+	pages    map[http.Handler]int
+	nextID   int
+	draining bool
+	// gone is closed once the last connection is removed, see Shutdown.
+	gone chan struct{}
+	// dropped and slow count the messages the send queues dropped and the
+	// connections closed for a full one.
+	dropped, slow int
+}
+
+// SocketInfo describes a websocket connection of the registry.
+type SocketInfo struct {
+	// ID identifies the connection in the registry.
+	ID int
+	// Socket and Session are the IDs of the live socket, empty until it is
+	// mounted.
+	Socket    string
+	Session   string
+	Page      string
+	Remote    string
+	UserAgent string
+	Connected time.Time
+	// LastActive is the time of the last user activity.
+	LastActive time.Time
+	// LastEvent is the last client event, background events included.
+	LastEvent   string
+	LastEventAt time.Time
+	// Queued and Dropped are the messages in the send queue and those it
+	// dropped, see Keepalive.SendQueue.
+	Queued, Dropped int
+}
+
+// NewSockets creates a registry accepting up to max sockets, sending the
+// messages of Message through st.
+func NewSockets(keepalive Keepalive, max int, st *State) *Sockets {
+	return &Sockets{
+		keepalive: keepalive,
+		state:     st,
+		Max:       max,
+		Overflow:  http.HandlerFunc(serverFull),
+		conns:     map[*wsConn]struct{}{},
+		pages:     map[http.Handler]int{},
+	}
+}
+
+// Count returns the number of connected sockets.
+func (s *Sockets) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// On returns the number of connected sockets of the page served by h, the
+// handler given to Handler: a broadcast to a page without any is skipped.
+func (s *Sockets) On(h http.Handler) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pages[h]
+}
+
+// Sockets returns the mounted sockets of the page served by h.
+func (s *Sockets) Sockets(h http.Handler) []live.Socket {
+	s.mu.Lock()
+	conns := make([]*wsConn, 0, s.pages[h])
+	for c := range s.conns {
+		if c.handler == h {
+			conns = append(conns, c)
+		}
+	}
+	s.mu.Unlock()
+	var sockets []live.Socket
+	for _, c := range conns {
+		if sock := c.Socket(); sock != nil {
+			sockets = append(sockets, sock)
+		}
+	}
+	return sockets
+}
+
+// List describes the connected sockets, in the order they connected.
+func (s *Sockets) List() []SocketInfo {
+	s.mu.Lock()
+	conns := make([]*wsConn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	list := make([]SocketInfo, len(conns))
+	for i, c := range conns {
+		list[i] = c.Info()
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+func (s *Sockets) conn(id int) *wsConn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		if c.id == id {
+			return c
+		}
+	}
+	return nil
+}
+
+// Message flashes msg on the page of the socket id. It reports whether
+// the socket is connected and mounted.
+func (s *Sockets) Message(id int, msg FlashMessage) bool {
+	c := s.conn(id)
+	if c == nil {
+		return false
+	}
+	sock := c.Socket()
+	if sock == nil {
+		return false
+	}
+	s.state.Send(sock, "flash", msg)
+	return true
+}
+
+// Disconnect closes the socket id, telling the page why. It reports
+// whether the socket was connected.
+func (s *Sockets) Disconnect(id int, notice string) bool {
+	c := s.conn(id)
+	if c == nil {
+		return false
+	}
+	go closeNotice(c, notice, "closed by admin")
+	return true
+}
+
+// Full reports whether the socket limit is reached.
+func (s *Sockets) Full() bool {
+	return s.Max > 0 && s.Count() >= s.Max
+}
+
+// Draining reports whether the server stopped accepting new sockets.
+func (s *Sockets) Draining() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.draining
+}
+
+// Drain stops accepting new sockets and closes the connected ones once
+// grace has passed.
+func (s *Sockets) Drain(grace time.Duration) {
+	s.mu.Lock()
+	s.draining = true
+	s.mu.Unlock()
+
+	time.AfterFunc(grace, func() {
+		n := s.CloseAll(closeGoingAway, "server maintenance")
+		log.Printf("drain: closed %d sockets", n)
+	})
+}
+
+// Shutdown stops accepting new sockets, closes the connected ones and
+// waits until they are gone, with the events they were handling, or ctx is
+// done.
+func (s *Sockets) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.draining = true
+	if len(s.conns) == 0 {
+		s.mu.Unlock()
+		return nil
+	}
+	if s.gone == nil {
+		s.gone = make(chan struct{})
+	}
+	gone := s.gone
+	s.mu.Unlock()
+
+	n := s.CloseAll(closeGoingAway, "server shutdown")
+	log.Printf("shutdown: closed %d sockets", n)
+	select {
+	case <-gone:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// CloseAll closes every connected socket with the close code and returns
+// how many were closed.
+func (s *Sockets) CloseAll(code uint16, reason string) int {
+	s.mu.Lock()
+	conns := make([]*wsConn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range conns {
+		c.CloseWith(code, reason)
+	}
+	return len(conns)
+}
+
+// ReapIdle closes sockets without user activity for longer than idle,
+// until ctx is done. The client is told why before the connection closes,
+// and closeGoingAway keeps it from reconnecting straight away.
+func (s *Sockets) ReapIdle(ctx context.Context, idle time.Duration) {
+	interval := idle / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+
+		s.mu.Lock()
+		var stale []*wsConn
+		for c := range s.conns {
+			if time.Since(c.LastActive()) > idle {
+				stale = append(stale, c)
+			}
+		}
+		s.mu.Unlock()
+
+		for _, c := range stale {
+			go closeNotice(c, "Disconnected due to inactivity. Reload the page to continue.", "idle timeout")
+		}
+	}
+}
+
+// closeNotice shows notice on the page of c, then closes it with
+// closeGoingAway and reason.
+func closeNotice(c *wsConn, notice, reason string) {
+	if sock := c.Socket(); sock != nil {
+		sock.Send("disconnected", map[string]string{"reason": notice})
+		// Give the writer a moment to flush the notice.
+		time.Sleep(250 * time.Millisecond)
+	}
+	c.CloseWith(closeGoingAway, reason)
+}
+
+// trackSocket is a mount middleware recording the socket of a websocket
+// connection on it.
+func trackSocket(mount live.MountHandler) live.MountHandler {
+	return func(ctx context.Context, s live.Socket) (interface{}, error) {
+		if c := connFromContext(ctx); c != nil && s.Connected() {
+			c.setSocket(s)
+		}
+		return mount(ctx, s)
+	}
+}
+
+// trackActivity is an event middleware recording the client events on the
+// socket's connection. Background events don't count as user activity.
+func trackActivity(kind, event string, next EventFunc) EventFunc {
+	if kind != "event" {
+		return next
+	}
+	active := !backgroundEvents[event]
+	return func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		if c := connFromContext(ctx); c != nil {
+			c.touch(event, active)
+		}
+		return next(ctx, s, data)
+	}
+}
+
+// Handler registers the websocket connections served by next. Once the
+// limit is reached, or while draining, page requests get the overflow page
+// and new websocket connections are refused, so the visitors already
+// connected keep a responsive server.
+func (s *Sockets) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isUpgrade(r) {
+			if r.Method == http.MethodGet && (s.Full() || s.Draining()) {
+				w.Header().Set("Retry-After", "10")
+				s.Overflow.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		now := time.Now()
+		c := &wsConn{
+			keepalive:  s.keepalive,
+			dropped:    s.sendDropped,
+			handler:    next,
+			page:       r.URL.Path,
+			remote:     r.RemoteAddr,
+			agent:      r.UserAgent(),
+			connected:  now,
+			lastActive: now,
+		}
+		c.state = s.state.open(func(err error) {
+			log.Println("socket render error:", err)
+			c.CloseWith(closeInternalError, "internal error")
+		})
+		c.queue = newSendQueue(s.keepalive.SendQueue, s.keepalive.SendPolicy, c.state.start)
+		if !s.add(c) {
+			w.Header().Set("Retry-After", "10")
+			http.Error(w, "server is full", http.StatusServiceUnavailable)
+			return
+		}
+		defer s.remove(c)
+
+		r = r.WithContext(context.WithValue(r.Context(), wsConnKey, c))
+		next.ServeHTTP(&hijackWriter{ResponseWriter: w, conn: c}, r)
+	})
+}
+
+// SendDrops returns the number of messages the send queues dropped and
+// of the connections they closed.
+func (s *Sockets) SendDrops() (dropped, disconnected int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped, s.slow
+}
+
+func (s *Sockets) sendDropped(n int, disconnect bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropped += n
+	if disconnect {
+		s.slow++
+	}
+}
+
+func (s *Sockets) add(c *wsConn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.draining || (s.Max > 0 && len(s.conns) >= s.Max) {
+		return false
+	}
+	s.nextID++
+	c.id = s.nextID
+	s.conns[c] = struct{}{}
+	s.pages[c.handler]++
+	return true
+}
+
+func (s *Sockets) remove(c *wsConn) {
+	c.state.close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, c)
+	if s.pages[c.handler]--; s.pages[c.handler] <= 0 {
+		delete(s.pages, c.handler)
+	}
+	if s.gone != nil && len(s.conns) == 0 {
+		close(s.gone)
+		s.gone = nil
+	}
+}
+
+func serverFull(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "server is full, retry shortly", http.StatusServiceUnavailable)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// reportHandler renders the printable report of a zone: the statistics
+// per day and the alert log, from the history the live views record. The
+// "tz" query param picks the timezone of the days, the server's by
+// default.
+func reportHandler(a *App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		zone := chi.URLParam(r, "zone")
+		loc := time.Local
+		if tz := r.URL.Query().Get("tz"); tz != "" {
+			l, err := time.LoadLocation(tz)
+			if err != nil {
+				http.Error(w, "unknown timezone", http.StatusBadRequest)
+				return
+			}
+			loc = l
+		}
+
+		tmpl, err := a.Templates.LookupLocale("report.html", a.Locales.Negotiate(r))
+		if err != nil {
+			log.Println("report:", err)
+			http.Error(w, genericError, http.StatusInternalServerError)
+			return
+		}
+		alerts := a.History.Alerts(zone)
+		for i := range alerts {
+			alerts[i].Time = alerts[i].Time.In(loc)
+		}
+		var buf bytes.Buffer
+		err = tmpl.Execute(&buf, map[string]interface{}{
+			"Zone":      zone,
+			"Days":      a.History.Daily(zone, loc),
+			"Alerts":    alerts,
+			"Limit":     float32(tempLimit),
+			"Timezone":  loc.String(),
+			"Generated": time.Now().In(loc),
+		})
+		if err != nil {
+			log.Println("report:", err)
+			http.Error(w, genericError, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		buf.WriteTo(w)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Router is the application router. Pages are registered on the embedded
+// chi.Router, so they can use path parameters ("/thermostat/{zone}") and
+// their own middleware. Routes that need authentication go on Admin, which
+// is mounted under /admin, or elsewhere behind Auth.
+type Router struct {
+	chi.Router
+	Admin chi.Router
+	// Auth is the basic auth of Admin, for the routes outside of it.
+	Auth func(http.Handler) http.Handler
+
+	adminUser, adminPassword string
+}
+
+// NewRouter creates the router with the default middleware chain and an
+// admin group protected by basic auth.
+func NewRouter(adminUser, adminPassword string) *Router {
+	r := chi.NewRouter()
+	r.Use(middleware.RequestID)
+	r.Use(middleware.RealIP)
+	r.Use(traceRequests)
+	// Requests are logged with the standard logger, so they show on the
+	// logs page too.
+	r.Use(middleware.RequestLogger(&middleware.DefaultLogFormatter{Logger: log.Default(), NoColor: true}))
+	r.Use(middleware.Recoverer)
+
+	auth := adminAuth(adminUser, adminPassword)
+	admin := chi.NewRouter()
+	admin.Use(auth)
+	r.Mount("/admin", admin)
+
+	return &Router{Router: r, Admin: admin, Auth: auth, adminUser: adminUser, adminPassword: adminPassword}
+}
+
+// User returns the admin user when the basic auth of req is that of Auth,
+// "" otherwise.
+func (r *Router) User(req *http.Request) string {
+	user, password, ok := req.BasicAuth()
+	if !ok || r.adminPassword == "" ||
+		subtle.ConstantTimeCompare([]byte(user), []byte(r.adminUser)) != 1 ||
+		subtle.ConstantTimeCompare([]byte(password), []byte(r.adminPassword)) != 1 {
+		return ""
+	}
+	return user
+}
+
+// adminAuth protects the admin group. Without a configured password
+// every admin request is rejected.
+func adminAuth(user, password string) func(http.Handler) http.Handler {
+	if password == "" {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "admin access is disabled", http.StatusForbidden)
+			})
+		}
+	}
+	return middleware.BasicAuth("admin", map[string]string{user: password})
+}
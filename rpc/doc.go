@@ -0,0 +1,10 @@
+// Package rpc is the gRPC service of the thermostat, generated from
+// thermostat.proto. The server is the live app itself, --grpc-addr; other Go
+// services use the client:
+//
+//	conn, err := grpc.Dial("localhost:9090", grpc.WithTransportCredentials(insecure.NewCredentials()))
+//	client := rpc.NewThermostatClient(conn)
+//	state, err := client.SetTemperature(ctx, &rpc.SetTemperatureRequest{Zone: "kitchen", Temperature: 21.5})
+package rpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative thermostat.proto
@@ -0,0 +1,226 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v4.24.0
+// source: thermostat.proto
+
+// The thermostat service of the live app, for other services to read and
+// change the setpoints of the zones and follow their changes.
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Thermostat_GetState_FullMethodName       = "/live.thermostat.v1.Thermostat/GetState"
+	Thermostat_SetTemperature_FullMethodName = "/live.thermostat.v1.Thermostat/SetTemperature"
+	Thermostat_WatchState_FullMethodName     = "/live.thermostat.v1.Thermostat/WatchState"
+)
+
+// ThermostatClient is the client API for Thermostat service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type ThermostatClient interface {
+	// GetState returns the setpoint of a zone.
+	GetState(ctx context.Context, in *GetStateRequest, opts ...grpc.CallOption) (*State, error)
+	// SetTemperature changes the setpoint of a zone, as the setpoint form of
+	// the thermostat does. A setpoint over the warning limit fails with
+	// FAILED_PRECONDITION unless it is confirmed.
+	SetTemperature(ctx context.Context, in *SetTemperatureRequest, opts ...grpc.CallOption) (*State, error)
+	// WatchState sends the state of a zone, of every zone when it is empty,
+	// then every change of its setpoint, whoever made it.
+	WatchState(ctx context.Context, in *WatchStateRequest, opts ...grpc.CallOption) (Thermostat_WatchStateClient, error)
+}
+
+type thermostatClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewThermostatClient(cc grpc.ClientConnInterface) ThermostatClient {
+	return &thermostatClient{cc}
+}
+
+func (c *thermostatClient) GetState(ctx context.Context, in *GetStateRequest, opts ...grpc.CallOption) (*State, error) {
+	out := new(State)
+	err := c.cc.Invoke(ctx, Thermostat_GetState_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *thermostatClient) SetTemperature(ctx context.Context, in *SetTemperatureRequest, opts ...grpc.CallOption) (*State, error) {
+	out := new(State)
+	err := c.cc.Invoke(ctx, Thermostat_SetTemperature_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *thermostatClient) WatchState(ctx context.Context, in *WatchStateRequest, opts ...grpc.CallOption) (Thermostat_WatchStateClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Thermostat_ServiceDesc.Streams[0], Thermostat_WatchState_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &thermostatWatchStateClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Thermostat_WatchStateClient interface {
+	Recv() (*State, error)
+	grpc.ClientStream
+}
+
+type thermostatWatchStateClient struct {
+	grpc.ClientStream
+}
+
+func (x *thermostatWatchStateClient) Recv() (*State, error) {
+	m := new(State)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ThermostatServer is the server API for Thermostat service.
+// All implementations must embed UnimplementedThermostatServer
+// for forward compatibility
+type ThermostatServer interface {
+	// GetState returns the setpoint of a zone.
+	GetState(context.Context, *GetStateRequest) (*State, error)
+	// SetTemperature changes the setpoint of a zone, as the setpoint form of
+	// the thermostat does. A setpoint over the warning limit fails with
+	// FAILED_PRECONDITION unless it is confirmed.
+	SetTemperature(context.Context, *SetTemperatureRequest) (*State, error)
+	// WatchState sends the state of a zone, of every zone when it is empty,
+	// then every change of its setpoint, whoever made it.
+	WatchState(*WatchStateRequest, Thermostat_WatchStateServer) error
+	mustEmbedUnimplementedThermostatServer()
+}
+
+// UnimplementedThermostatServer must be embedded to have forward compatible implementations.
+type UnimplementedThermostatServer struct {
+}
+
+func (UnimplementedThermostatServer) GetState(context.Context, *GetStateRequest) (*State, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetState not implemented")
+}
+func (UnimplementedThermostatServer) SetTemperature(context.Context, *SetTemperatureRequest) (*State, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetTemperature not implemented")
+}
+func (UnimplementedThermostatServer) WatchState(*WatchStateRequest, Thermostat_WatchStateServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchState not implemented")
+}
+func (UnimplementedThermostatServer) mustEmbedUnimplementedThermostatServer() {}
+
+// UnsafeThermostatServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ThermostatServer will
+// result in compilation errors.
+type UnsafeThermostatServer interface {
+	mustEmbedUnimplementedThermostatServer()
+}
+
+func RegisterThermostatServer(s grpc.ServiceRegistrar, srv ThermostatServer) {
+	s.RegisterService(&Thermostat_ServiceDesc, srv)
+}
+
+func _Thermostat_GetState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ThermostatServer).GetState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Thermostat_GetState_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ThermostatServer).GetState(ctx, req.(*GetStateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Thermostat_SetTemperature_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetTemperatureRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ThermostatServer).SetTemperature(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Thermostat_SetTemperature_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ThermostatServer).SetTemperature(ctx, req.(*SetTemperatureRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Thermostat_WatchState_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchStateRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ThermostatServer).WatchState(m, &thermostatWatchStateServer{stream})
+}
+
+type Thermostat_WatchStateServer interface {
+	Send(*State) error
+	grpc.ServerStream
+}
+
+type thermostatWatchStateServer struct {
+	grpc.ServerStream
+}
+
+func (x *thermostatWatchStateServer) Send(m *State) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Thermostat_ServiceDesc is the grpc.ServiceDesc for Thermostat service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Thermostat_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "live.thermostat.v1.Thermostat",
+	HandlerType: (*ThermostatServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetState",
+			Handler:    _Thermostat_GetState_Handler,
+		},
+		{
+			MethodName: "SetTemperature",
+			Handler:    _Thermostat_SetTemperature_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchState",
+			Handler:       _Thermostat_WatchState_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "thermostat.proto",
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jfyne/live"
+)
+
+const (
+	// rulesKey is the key of the zone rules in the store.
+	rulesKey = "rules"
+	// rulesTick is how often the rules are checked besides the changes of
+	// the setpoints, for the durations to pass.
+	rulesTick = 10 * time.Second
+	// rulesEvent is the self event telling the rules pages the rules or
+	// their state changed.
+	rulesEvent = "rules"
+	// rulesSocket is the socket of the events the setpoints the rules set
+	// log.
+	rulesSocket = "rules"
+)
+
+// The actions of the zone rules.
+const (
+	// RuleBroadcast flashes Text at Level on every page.
+	RuleBroadcast = "broadcast"
+	// RuleWebhook sends the "rule" event to the webhooks.
+	RuleWebhook = "webhook"
+	// RuleEmail emails Text to Email.
+	RuleEmail = "email"
+	// RuleSetpoint sets the setpoint of the zone to Setpoint.
+	RuleSetpoint = "setpoint"
+)
+
+// ruleActions are the actions a rule may have.
+var ruleActions = []string{RuleBroadcast, RuleWebhook, RuleEmail, RuleSetpoint}
+
+// ZoneRule is "when the temperature of Zone is above (or below) Threshold
+// for For, do Action". A rule fires once when its condition has held for
+// For and again only after the condition stopped holding. The texts may
+// have {zone} and {temperature}.
+type ZoneRule struct {
+	ID int
+	// Zone is the zone of the rule, every zone when empty.
+	Zone      string
+	Below     bool
+	Threshold float32
+	For       time.Duration
+	Action    string
+	Text      string
+	Level     FlashLevel
+	Email     string
+	Setpoint  float32
+	Enabled   bool
+}
+
+// Condition returns the condition of r as the page shows it.
+func (r ZoneRule) Condition() string {
+	op := ">"
+	if r.Below {
+		op = "<"
+	}
+	return fmt.Sprintf("%s %.1f °C", op, r.Threshold)
+}
+
+// holds reports whether the temperature v meets the condition of r.
+func (r ZoneRule) holds(v float32) bool {
+	if r.Below {
+		return v < r.Threshold
+	}
+	return v > r.Threshold
+}
+
+// text returns the Text of r for zone at v.
+func (r ZoneRule) text(zone string, v float32) string {
+	return strings.NewReplacer("{zone}", zone, "{temperature}", strconv.FormatFloat(float64(v), 'f', 1, 32)).Replace(r.Text)
+}
+
+// RuleState is the state of a rule in a zone its condition holds in.
+type RuleState struct {
+	Zone string
+	// Since is when the condition started to hold.
+	Since time.Time
+	// Fired is set once the rule fired, until the condition stops holding.
+	Fired bool
+}
+
+// ruleKey is a rule in a zone.
+type ruleKey struct {
+	id   int
+	zone string
+}
+
+// ZoneRules are the zone rules of the admin rules page, kept in the app's
+// store like the configured zones. Run checks them against the setpoints
+// of the zones; the durations of their states start with the server, the
+// states aren't kept.
+type ZoneRules struct {
+	app *App
+
+	mu      sync.Mutex
+	rules   []ZoneRule
+	nextID  int
+	values  map[string]float32
+	states  map[ruleKey]*RuleState
+	engines []*live.HttpEngine
+}
+
+// LoadZoneRules loads the rules from the store of app, their actions go
+// through app.
+func LoadZoneRules(ctx context.Context, app *App) (*ZoneRules, error) {
+	z := &ZoneRules{app: app, values: map[string]float32{}, states: map[ruleKey]*RuleState{}}
+	if _, err := app.Store.Load(ctx, rulesKey, &z.rules); err != nil {
+		return z, fmt.Errorf("could not load the rules: %w", err)
+	}
+	for _, r := range z.rules {
+		if r.ID > z.nextID {
+			z.nextID = r.ID
+		}
+	}
+	return z, nil
+}
+
+// Watch has the sockets of engine told about every change of the rules
+// and their states, see rulesEvent.
+func (z *ZoneRules) Watch(engine *live.HttpEngine) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	z.engines = append(z.engines, engine)
+}
+
+// List returns the rules, in the order they were added.
+func (z *ZoneRules) List() []ZoneRule {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return append([]ZoneRule(nil), z.rules...)
+}
+
+// States returns the states of the rule id, by zone.
+func (z *ZoneRules) States(id int) []RuleState {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	var states []RuleState
+	for k, st := range z.states {
+		if k.id == id {
+			states = append(states, *st)
+		}
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Zone < states[j].Zone })
+	return states
+}
+
+// Add adds r, enabled, and returns it with its ID.
+func (z *ZoneRules) Add(ctx context.Context, r ZoneRule) (ZoneRule, error) {
+	err := z.update(ctx, func(rules []ZoneRule) []ZoneRule {
+		z.nextID++
+		r.ID, r.Enabled = z.nextID, true
+		return append(rules, r)
+	})
+	return r, err
+}
+
+// Enable enables or disables the rule id, its states are dropped.
+func (z *ZoneRules) Enable(ctx context.Context, id int, enabled bool) error {
+	return z.update(ctx, func(rules []ZoneRule) []ZoneRule {
+		for i := range rules {
+			if rules[i].ID == id {
+				rules[i].Enabled = enabled
+			}
+		}
+		return rules
+	})
+}
+
+// Delete deletes the rule id.
+func (z *ZoneRules) Delete(ctx context.Context, id int) error {
+	return z.update(ctx, func(rules []ZoneRule) []ZoneRule {
+		kept := rules[:0]
+		for _, r := range rules {
+			if r.ID != id {
+				kept = append(kept, r)
+			}
+		}
+		return kept
+	})
+}
+
+// update stores the rules fn makes of a copy of the rules, then drops the
+// states of the rules it changed and checks them again.
+func (z *ZoneRules) update(ctx context.Context, fn func([]ZoneRule) []ZoneRule) error {
+	z.mu.Lock()
+	rules := fn(append([]ZoneRule(nil), z.rules...))
+	if err := z.app.Store.Save(ctx, rulesKey, rules); err != nil {
+		z.mu.Unlock()
+		return fmt.Errorf("could not save the rules: %w", err)
+	}
+	z.rules = rules
+	z.states = map[ruleKey]*RuleState{}
+	z.mu.Unlock()
+	z.check(time.Now())
+	return nil
+}
+
+// Run checks the rules on every change of the setpoints and every
+// rulesTick until ctx is done, starting with the setpoints of the zones
+// now.
+func (z *ZoneRules) Run(ctx context.Context) {
+	changes, cancel := z.app.Setpoints.Subscribe("")
+	defer cancel()
+	for _, zone := range z.app.Setpoints.Zones() {
+		c, err := z.app.Setpoints.Control(ctx, zone)
+		if err != nil {
+			log.Println("rules:", err)
+			continue
+		}
+		z.mu.Lock()
+		z.values[zone] = c.Temperature
+		z.mu.Unlock()
+	}
+	z.check(time.Now())
+
+	t := time.NewTicker(rulesTick)
+	defer t.Stop()
+	for {
+		select {
+		case change := <-changes:
+			z.mu.Lock()
+			z.values[change.Zone] = change.Reading.Value
+			z.mu.Unlock()
+			z.check(change.Reading.Time)
+		case now := <-t.C:
+			z.check(now)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// check moves the states of the rules to now and fires the rules whose
+// condition held for their duration, in the background.
+func (z *ZoneRules) check(now time.Time) {
+	type firing struct {
+		rule  ZoneRule
+		zone  string
+		value float32
+	}
+	var fire []firing
+	changed := false
+	z.mu.Lock()
+	for _, r := range z.rules {
+		for zone, v := range z.values {
+			if !r.Enabled || r.Zone != "" && r.Zone != zone {
+				continue
+			}
+			k := ruleKey{r.ID, zone}
+			st := z.states[k]
+			if !r.holds(v) {
+				if st != nil {
+					delete(z.states, k)
+					changed = true
+				}
+				continue
+			}
+			if st == nil {
+				st = &RuleState{Zone: zone, Since: now}
+				z.states[k] = st
+				changed = true
+			}
+			if !st.Fired && now.Sub(st.Since) >= r.For {
+				st.Fired = true
+				changed = true
+				fire = append(fire, firing{r, zone, v})
+			}
+		}
+	}
+	engines := append([]*live.HttpEngine(nil), z.engines...)
+	z.mu.Unlock()
+
+	for _, f := range fire {
+		go func(f firing) {
+			if err := z.fire(f.rule, f.zone, f.value); err != nil {
+				log.Printf("rule %d in %s: %v", f.rule.ID, f.zone, err)
+			}
+		}(f)
+	}
+	if changed {
+		for _, engine := range engines {
+			if err := engine.Broadcast(rulesEvent, nil); err != nil {
+				log.Println("broadcast error:", err)
+			}
+		}
+	}
+}
+
+// fire does the action of r for zone at the temperature v, the rule is the
+// actor of the audit log.
+func (z *ZoneRules) fire(r ZoneRule, zone string, v float32) error {
+	ctx := context.Background()
+	actor := fmt.Sprintf("rule %d", r.ID)
+	text := r.text(zone, v)
+	switch r.Action {
+	case RuleBroadcast:
+		z.app.Broadcast("flash", FlashMessage{Level: r.Level, Message: text})
+		z.app.Audit.RecordAs(ctx, actor, "", AuditNotice, zone, fmt.Sprintf("%s: %s", r.Level, text))
+	case RuleWebhook:
+		z.app.Webhooks.Send(WebhookRule, webhookRule{Rule: r.ID, Zone: zone, Condition: r.Condition(), Temperature: v, Text: text, Time: time.Now()})
+	case RuleEmail:
+		if z.app.Mailer == nil {
+			return errors.New("the server sends no emails")
+		}
+		return z.app.Mailer.Rule(r.Email, map[string]interface{}{
+			"Zone": zone, "Temperature": v, "Condition": r.Condition(), "Text": text, "Time": time.Now(),
+		})
+	case RuleSetpoint:
+		c, err := z.app.Setpoints.Control(ctx, zone)
+		if err != nil || c == nil {
+			return fmt.Errorf("could not load the zone: %v", err)
+		}
+		o := SetpointOrigin{Actor: actor, Socket: rulesSocket, Page: "/admin/rules"}
+		// The admin set the setpoint of the rule, over the limit too.
+		return z.app.Setpoints.Set(ctx, c, r.Setpoint, true, o)
+	}
+	return nil
+}
+
+// ruleForm validates the form of a new rule, the fields of the action are
+// checked by its action.
+var ruleForm = Form{
+	"threshold": {Required(), Range(-50, 100)},
+	"for":       {Required(), Range(0, 7*24*60)},
+	"text":      {Length(0, 200)},
+}
+
+// RuleView is a rule with its states, as the rules page lists it.
+type RuleView struct {
+	ZoneRule
+	States []RuleState
+}
+
+// RulesModel is the model of the admin rules page.
+type RulesModel struct {
+	Page
+	Rules []RuleView `json:"-"`
+	Zones []string
+	// Draft is the rule of the form.
+	Draft   ZoneRule
+	Actions []string
+	Levels  []FlashLevel
+	// Mail and Webhooks report whether the email and webhook actions can
+	// do anything.
+	Mail     bool
+	Webhooks bool
+	Errors   Errors `json:"-"`
+}
+
+func rulesModel(s live.Socket, app *App) *RulesModel {
+	if m, ok := s.Assigns().(*RulesModel); ok {
+		return m
+	}
+	return &RulesModel{
+		Draft:    ZoneRule{Threshold: tempLimit, For: 5 * time.Minute, Action: RuleBroadcast, Level: FlashWarning, Text: "{zone} is at {temperature} °C", Setpoint: 20},
+		Actions:  ruleActions,
+		Levels:   []FlashLevel{FlashInfo, FlashSuccess, FlashWarning, FlashError},
+		Mail:     app.Mailer != nil,
+		Webhooks: app.Webhooks.Enabled() && containsString(app.Config.Webhooks.Events, WebhookRule),
+	}
+}
+
+// load loads the rules and the zones.
+func (m *RulesModel) load(app *App, rules *ZoneRules) {
+	m.Rules = nil
+	for _, r := range rules.List() {
+		m.Rules = append(m.Rules, RuleView{ZoneRule: r, States: rules.States(r.ID)})
+	}
+	m.Zones = app.Setpoints.Zones()
+}
+
+// draft returns the rule of the form params, with the errors of the
+// fields.
+func (m *RulesModel) draft(p live.Params) (ZoneRule, Errors) {
+	r := ZoneRule{
+		Zone:      p.String("zone"),
+		Below:     p.String("op") == "<",
+		Threshold: p.Float32("threshold"),
+		For:       time.Duration(p.Float32("for") * float32(time.Minute)),
+		Action:    p.String("action"),
+		Text:      strings.TrimSpace(p.String("text")),
+		Level:     FlashLevel(p.String("level")),
+		Email:     strings.TrimSpace(p.String("email")),
+		Setpoint:  p.Float32("setpoint"),
+	}
+	errs := ruleForm.Validate(p)
+	if r.Zone != "" && !containsString(m.Zones, r.Zone) {
+		errs["zone"] = Message{Key: "Unknown zone."}
+	}
+	switch r.Action {
+	case RuleBroadcast:
+		switch r.Level {
+		case FlashInfo, FlashSuccess, FlashWarning, FlashError:
+		default:
+			errs["level"] = Message{Key: "Unknown level."}
+		}
+		if r.Text == "" {
+			errs["text"] = Message{Key: "This field is required."}
+		}
+	case RuleEmail:
+		if msg := Required()(r.Email); msg != nil {
+			errs["email"] = *msg
+		} else if msg := Email()(r.Email); msg != nil {
+			errs["email"] = *msg
+		}
+	case RuleSetpoint:
+		if errs2 := setpointForm.Validate(live.Params{"temperature": p.String("setpoint")}); len(errs2) > 0 {
+			errs["setpoint"] = errs2["temperature"]
+		}
+	case RuleWebhook:
+	default:
+		errs["action"] = Message{Key: "Unknown action."}
+	}
+	return r, errs
+}
+
+// newRulesPage creates the admin page of the zone rules, where the rules
+// are added with "rule-add", enabled and disabled with "rule-toggle" and
+// deleted with "rule-delete". The states of the rules follow the
+// setpoints.
+func newRulesPage(app *App, rules *ZoneRules) *Handler {
+	h := app.NewHandler()
+	h.HandleRender(app.Render("rules.html"))
+	h.HandleMount(func(ctx context.Context, s live.Socket) (interface{}, error) {
+		m := rulesModel(s, app)
+		m.load(app, rules)
+		return m, nil
+	})
+	h.HandleSelf(rulesEvent, func(ctx context.Context, s live.Socket, _ interface{}) (interface{}, error) {
+		m := rulesModel(s, app)
+		m.load(app, rules)
+		return m, nil
+	})
+	h.HandleEvent("rule-add", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := rulesModel(s, app)
+		r, errs := m.draft(p)
+		m.Draft, m.Errors = r, errs
+		if len(errs) > 0 {
+			return m, nil
+		}
+		r, err := rules.Add(ctx, r)
+		if err != nil {
+			return m, err
+		}
+		where := r.Zone
+		if where == "" {
+			where = "*"
+		}
+		app.Audit.Record(ctx, s, AuditRule, strconv.Itoa(r.ID), fmt.Sprintf("add: %s %s for %s: %s", where, r.Condition(), r.For, r.Action))
+		m.load(app, rules)
+		return m, nil
+	})
+	h.HandleEvent("rule-toggle", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := rulesModel(s, app)
+		id, enabled := p.Int("id"), p.String("enabled") == "true"
+		if err := rules.Enable(ctx, id, enabled); err != nil {
+			return m, err
+		}
+		detail := "disable"
+		if enabled {
+			detail = "enable"
+		}
+		app.Audit.Record(ctx, s, AuditRule, strconv.Itoa(id), detail)
+		m.load(app, rules)
+		return m, nil
+	})
+	h.HandleEvent("rule-delete", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := rulesModel(s, app)
+		id := p.Int("id")
+		if err := rules.Delete(ctx, id); err != nil {
+			return m, err
+		}
+		app.Audit.Record(ctx, s, AuditRule, strconv.Itoa(id), "delete")
+		m.load(app, rules)
+		return m, nil
+	})
+	return h
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"html/template"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// userContent is the allowlist for user-originated strings: basic inline
+// formatting and links, everything else is stripped.
+var userContent = func() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowElements("b", "strong", "i", "em", "u", "s", "code", "br")
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.RequireParseableURLs(true)
+	p.RequireNoFollowOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+	return p
+}()
+
+// htmlSpecial are the characters the sanitizer escapes or replaces in
+// text, a string without them is left as it is.
+const htmlSpecial = "<>&'\"\x00"
+
+// safeHTML sanitizes a user-originated string for the "safe" template
+// func. Templates must use it rather than template.HTML for anything a
+// user typed, such as chat messages and names. Plain text, most of it,
+// skips the sanitizer and its tokenizer buffers.
+func safeHTML(s string) template.HTML {
+	if !strings.ContainsAny(s, htmlSpecial) {
+		return template.HTML(s)
+	}
+	return template.HTML(userContent.Sanitize(s))
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jfyne/live"
+	"golang.org/x/text/unicode/norm"
+)
+
+// searchLimit is how many results the search page shows.
+const searchLimit = 25
+
+//go:embed data/cities.csv
+var citiesCSV []byte
+
+// cities is the dataset of the search page.
+var cities = mustLoadCities(citiesCSV)
+
+// City is a city and its average yearly temperature.
+type City struct {
+	Name        string
+	Country     string
+	Temperature float32
+}
+
+// LoadCities reads the cities of a CSV file with a header row.
+func LoadCities(data []byte) ([]City, error) {
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var list []City
+	for i, row := range rows {
+		if i == 0 {
+			continue
+		}
+		if len(row) != 3 {
+			return nil, fmt.Errorf("cities: line %d has %d fields", i+1, len(row))
+		}
+		t, err := strconv.ParseFloat(row[2], 32)
+		if err != nil {
+			return nil, fmt.Errorf("cities: line %d: %w", i+1, err)
+		}
+		list = append(list, City{Name: row[0], Country: row[1], Temperature: float32(t)})
+	}
+	return list, nil
+}
+
+func mustLoadCities(data []byte) []City {
+	list, err := LoadCities(data)
+	if err != nil {
+		panic(err)
+	}
+	return list
+}
+
+// foldRune lowercases r and strips its accents, so "plzen" finds "Plzeň".
+func foldRune(r rune) rune {
+	for _, d := range norm.NFD.String(string(r)) {
+		return unicode.ToLower(d)
+	}
+	return r
+}
+
+func fold(s string) []rune {
+	runes := []rune(s)
+	for i, r := range runes {
+		runes[i] = foldRune(r)
+	}
+	return runes
+}
+
+// runeIndex returns the index of sub in s, -1 if it isn't there.
+func runeIndex(s, sub []rune) int {
+	for i := 0; i+len(sub) <= len(s); i++ {
+		if string(s[i:i+len(sub)]) == string(sub) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Highlight is a part of a text, Match when it matches the query.
+type Highlight struct {
+	Text  string
+	Match bool
+}
+
+// highlight splits text around the first match of the folded query.
+func highlight(text string, query []rune) ([]Highlight, int) {
+	i := runeIndex(fold(text), query)
+	if i < 0 {
+		return []Highlight{{Text: text}}, -1
+	}
+	runes := []rune(text)
+	var parts []Highlight
+	if i > 0 {
+		parts = append(parts, Highlight{Text: string(runes[:i])})
+	}
+	parts = append(parts, Highlight{Text: string(runes[i : i+len(query)]), Match: true})
+	if end := i + len(query); end < len(runes) {
+		parts = append(parts, Highlight{Text: string(runes[end:])})
+	}
+	return parts, i
+}
+
+// SearchResult is a city matching the query with the matches highlighted.
+type SearchResult struct {
+	City
+	Name    []Highlight
+	Country []Highlight
+}
+
+// SearchCities returns the cities whose name or country contains query,
+// ignoring case and accents. Names starting with it come first, then the
+// other names matching it, then the countries.
+func SearchCities(list []City, query string) []SearchResult {
+	q := fold(strings.TrimSpace(query))
+	var results []SearchResult
+	var ranks []int
+	for _, c := range list {
+		if len(q) == 0 {
+			results = append(results, SearchResult{City: c, Name: []Highlight{{Text: c.Name}}, Country: []Highlight{{Text: c.Country}}})
+			ranks = append(ranks, 0)
+			continue
+		}
+		name, ni := highlight(c.Name, q)
+		country, ci := highlight(c.Country, q)
+		rank := 2
+		switch {
+		case ni == 0:
+			rank = 0
+		case ni > 0:
+			rank = 1
+		case ci < 0:
+			continue
+		}
+		results = append(results, SearchResult{City: c, Name: name, Country: country})
+		ranks = append(ranks, rank)
+	}
+	sort.Stable(byRank{results, ranks})
+	return results
+}
+
+// byRank sorts search results by their rank.
+type byRank struct {
+	results []SearchResult
+	ranks   []int
+}
+
+func (b byRank) Len() int           { return len(b.results) }
+func (b byRank) Less(i, j int) bool { return b.ranks[i] < b.ranks[j] }
+func (b byRank) Swap(i, j int) {
+	b.results[i], b.results[j] = b.results[j], b.results[i]
+	b.ranks[i], b.ranks[j] = b.ranks[j], b.ranks[i]
+}
+
+// SearchModel is the model of the search page.
+type SearchModel struct {
+	Page
+	Query   string
+	Results []SearchResult `json:"-"`
+	// Total is the number of matches, of which the first searchLimit are
+	// shown.
+	Total int
+}
+
+func searchModel(s live.Socket) *SearchModel {
+	if m, ok := s.Assigns().(*SearchModel); ok {
+		return m
+	}
+	return &SearchModel{}
+}
+
+func (m *SearchModel) search() {
+	m.Results = SearchCities(cities, m.Query)
+	m.Total = len(m.Results)
+	if len(m.Results) > searchLimit {
+		m.Results = m.Results[:searchLimit]
+	}
+}
+
+// newSearch creates the search live handler. The form sends search on
+// every keystroke, debounced by the page, and only the rows of the list
+// that changed are patched.
+func newSearch(app *App) *Handler {
+	h := app.NewHandler()
+	h.HandleRender(app.Render("search.html"))
+	h.HandleMount(func(ctx context.Context, s live.Socket) (interface{}, error) {
+		m := searchModel(s)
+		if m.Query == "" {
+			m.Query = live.Request(ctx).URL.Query().Get("q")
+		}
+		m.search()
+		return m, nil
+	})
+	h.HandleEvent("search", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := searchModel(s)
+		m.Query = p.String("q")
+		if len(m.Query) > 100 {
+			return m, fmt.Errorf("the query is too long")
+		}
+		m.search()
+		return m, nil
+	})
+	return h
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"my-app.com/live/store"
+)
+
+const (
+	// seedDays is how many days of setpoint changes are seeded, within the
+	// retention of the zone history.
+	seedDays = 6
+	// seedSocket is the socket of the seeded events.
+	seedSocket = "seed"
+)
+
+// seedSetpoints are the day setpoints of the seeded zones.
+var seedSetpoints = map[string]float32{
+	"main":    20.5,
+	"living":  21.5,
+	"kitchen": 20,
+	"bedroom": 18.5,
+	"office":  21,
+}
+
+// seedUsers are the users of the seeded chat and setpoint changes.
+var seedUsers = []string{"Alice", "Bob", "Chloé", "Daniel", "Emma"}
+
+// seedChat is the seeded chat of the thermostat, a line a few hours.
+var seedChat = []string{
+	"Morning! I turned the living room up a bit.",
+	"The office is too warm again.",
+	"Who set the kitchen to 25? I put it back.",
+	"Bedroom at 18 is perfect for sleeping.",
+	"Leaving for the weekend, lowering everything.",
+	"Back home, heating up again.",
+	"Can we keep the office at 21 during the day?",
+	"Sure, I'll set a schedule in the setup.",
+	"The report shows the living room was hot yesterday evening.",
+	"That was me, sorry. Movie night.",
+	"It's freezing outside, I raised the main zone.",
+	"Looks fine now, thanks!",
+}
+
+// seedChange is a setpoint change of the seeded days: the hour of the day
+// and the change from the day setpoint.
+type seedChange struct {
+	hour  float64
+	delta float32
+}
+
+// seedDay are the setpoint changes of a day: up in the morning, down during
+// the day, up in the evening and down for the night.
+var seedDay = []seedChange{{6.5, 0}, {9, -1}, {17.5, 0.5}, {22.5, -2.5}}
+
+// seed is the seed command, it fills the empty database of the flags with
+// demo data: the setpoints and a few days of readings of the zones, the
+// users and their chat, and the audit log of the changes. With the event
+// log the changes are logged too, so the zone history and the report show
+// them once the server starts.
+//
+//	live seed --db live.db
+func seed(args []string) error {
+	cfg, err := LoadConfig(args)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	db, err := openDatabase(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := db.Migrate(ctx); err != nil {
+		return err
+	}
+	repos := db.Repos()
+	empty, err := store.Empty(ctx, repos)
+	if err != nil {
+		return err
+	}
+	if !empty {
+		return fmt.Errorf("the database isn't empty, seed a new one")
+	}
+	counts, err := seedDemo(ctx, repos, cfg.EventLog, time.Now())
+	if err != nil {
+		return fmt.Errorf("could not seed: %w", err)
+	}
+	fmt.Println("seeded", counts)
+	return nil
+}
+
+// seedCounts are the number of records seedDemo added.
+type seedCounts struct {
+	zones, readings, users, messages, audit, events int
+}
+
+func (c seedCounts) String() string {
+	s := fmt.Sprintf("zones %d, readings %d, users %d, messages %d, audit %d", c.zones, c.readings, c.users, c.messages, c.audit)
+	if c.events > 0 {
+		s += fmt.Sprintf(", events %d", c.events)
+	}
+	return s
+}
+
+// seedDemo adds the demo data of the days before now to repos. The data is
+// the same on every run but for the times.
+func seedDemo(ctx context.Context, repos store.Repos, events bool, now time.Time) (seedCounts, error) {
+	var counts seedCounts
+	rnd := rand.New(rand.NewSource(1))
+	start := time.Date(now.Year(), now.Month(), now.Day()-seedDays, 0, 0, 0, 0, now.Location())
+
+	users := make([]store.User, len(seedUsers))
+	for i, name := range seedUsers {
+		users[i] = store.User{
+			Session: "seed-" + strings.ToLower(name),
+			Name:    name,
+			Seen:    now.Add(-time.Duration(rnd.Intn(48*60)) * time.Minute),
+		}
+		if err := repos.Users.Save(ctx, users[i]); err != nil {
+			return counts, err
+		}
+		counts.users++
+	}
+
+	// The changes of every zone are stored in the order they were made, as
+	// the audit log and the event log keep them.
+	var changes []seedSetpointChange
+	for _, zone := range append([]string{"main"}, dashboardZones...) {
+		day := seedSetpoints[zone]
+		from, updated := NewTempControl(zone).Temperature, start
+		for d := 0; d <= seedDays; d++ {
+			plan := seedDay
+			// A zone goes over the limit once, set back an hour later.
+			if d == len(zone)%seedDays {
+				plan = append(append([]seedChange(nil), plan[:3]...), seedChange{19, tempLimit + 1 - day}, seedChange{20, 0.5}, plan[3])
+			}
+			for _, c := range plan {
+				at := start.AddDate(0, 0, d).Add(time.Duration((c.hour + rnd.Float64()/2) * float64(time.Hour)))
+				if at.After(now) {
+					break
+				}
+				to := float32(math.Round(float64(day+c.delta+float32(rnd.Intn(5)-2)/10)*10) / 10)
+				changes = append(changes, seedSetpointChange{user: users[rnd.Intn(len(users))], zone: zone, from: from, to: Reading{Time: at, Value: to}})
+				from, updated = to, at
+			}
+		}
+		if err := repos.Thermostats.Save(ctx, store.Thermostat{Zone: zone, Setpoint: from, Updated: updated}); err != nil {
+			return counts, err
+		}
+		counts.zones++
+
+		// The humidity of the zone every hour, higher at night.
+		for at := start; at.Before(now); at = at.Add(time.Hour) {
+			humidity := 50 + 8*math.Cos(float64(at.Hour())/24*2*math.Pi) + rnd.Float64()*4 - 2
+			if err := repos.Readings.Add(ctx, store.Sample(zone, store.Humidity, at, math.Round(humidity*10)/10)); err != nil {
+				return counts, err
+			}
+			counts.readings++
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].to.Time.Before(changes[j].to.Time) })
+	for _, c := range changes {
+		if err := c.store(ctx, repos, events); err != nil {
+			return counts, err
+		}
+		counts.readings++
+		counts.audit++
+		if events {
+			counts.events++
+		}
+	}
+
+	at := start.Add(8 * time.Hour)
+	for i := 0; at.Before(now); i++ {
+		msg := store.Message{Room: chatRoom, Author: users[i%len(users)].Name, Text: seedChat[i%len(seedChat)], Time: at}
+		if _, err := repos.Messages.Add(ctx, msg); err != nil {
+			return counts, err
+		}
+		counts.messages++
+		at = at.Add(time.Duration(4+rnd.Intn(8)) * time.Hour)
+	}
+	return counts, nil
+}
+
+// seedSetpointChange is a seeded setpoint change of user.
+type seedSetpointChange struct {
+	user store.User
+	zone string
+	from float32
+	to   Reading
+}
+
+// store stores the change as the temperature controls do: a reading, an
+// audit entry and, with the event log, the temp-set event the zone history
+// is projected from.
+func (c seedSetpointChange) store(ctx context.Context, repos store.Repos, events bool) error {
+	r := c.to
+	if err := repos.Readings.Add(ctx, store.Sample(c.zone, store.Temperature, r.Time, float64(r.Value))); err != nil {
+		return err
+	}
+	entry := store.AuditEntry{
+		Time: r.Time, Actor: c.user.Name, Session: c.user.Session,
+		Action: AuditSetpoint, Target: c.zone, Detail: fmt.Sprintf("%.1f → %.1f", c.from, r.Value),
+	}
+	if _, err := repos.Audit.Add(ctx, entry); err != nil {
+		return err
+	}
+	if !events {
+		return nil
+	}
+	e, err := setEvent(TempControl{ID: c.zone, Zone: c.zone, Temperature: r.Value, History: []Reading{r}})
+	if err != nil {
+		return err
+	}
+	e.Session, e.Socket, e.Page = c.user.Session, seedSocket, "/thermostat/"+c.zone
+	_, err = repos.Events.Append(ctx, e)
+	return err
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"sync"
+
+	"github.com/jfyne/live"
+)
+
+// The policies of a full send queue, see Keepalive.SendPolicy.
+const (
+	// SendDisconnect closes the connection of the slow client, which
+	// reconnects and gets the page afresh.
+	SendDisconnect = "disconnect"
+	// SendDropOldest drops the oldest message the page can do without.
+	SendDropOldest = "drop-oldest"
+)
+
+var sendPolicies = []string{SendDisconnect, SendDropOldest}
+
+// sendKept are the events a full queue never drops: without a patch the
+// page goes out of sync with the diffs after it, without an ack the page
+// waits for its event forever. A queue full of them is disconnected under
+// any policy.
+var sendKept = map[string]bool{
+	live.EventPatch:    true,
+	live.EventAck:      true,
+	live.EventConnect:  true,
+	live.EventParams:   true,
+	live.EventRedirect: true,
+	live.EventError:    true,
+}
+
+// sendQueue queues the messages written to a websocket, so a slow client
+// neither holds up the live engine writing to it nor piles up messages
+// without bound. The writes of the websocket library are cut into
+// messages along the frames, queued up to max and sent by flush in order.
+// The stateReady event is taken out and calls ready instead.
+type sendQueue struct {
+	max    int
+	policy string
+	ready  func()
+	wake   chan struct{}
+
+	mu sync.Mutex
+	// buf are the bytes of a frame not written whole yet, frames those of
+	// the fragments of the message before it.
+	buf      []byte
+	frames   []byte
+	payload  []byte
+	messages []sendMessage
+	dropped  int
+	closed   bool
+}
+
+// sendMessage is a message of the queue: a data message with its frames,
+// or a control frame of the websocket library, which is never dropped.
+type sendMessage struct {
+	data    []byte
+	control bool
+	// event is the live event of a data message, for the policy.
+	event string
+}
+
+func newSendQueue(max int, policy string, ready func()) *sendQueue {
+	return &sendQueue{max: max, policy: policy, ready: ready, wake: make(chan struct{}, 1)}
+}
+
+// write queues the complete messages of p. It returns how many messages
+// it dropped for them, and reports the queue full without a message to
+// drop: the connection then has to be closed.
+func (q *sendQueue) write(p []byte) (n, dropped int, full bool, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return 0, 0, false, net.ErrClosed
+	}
+	before := q.dropped
+	defer func() { dropped = q.dropped - before }()
+	q.buf = append(q.buf, p...)
+	for {
+		size, ok := frameSize(q.buf)
+		if !ok {
+			break
+		}
+		frame := q.buf[:size:size]
+		q.buf = q.buf[size:]
+		if !q.push(frame) {
+			q.shut()
+			return len(p), 0, true, nil
+		}
+	}
+	if len(q.buf) == 0 {
+		q.buf = nil
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return len(p), 0, false, nil
+}
+
+// push adds a frame to the message written, queueing the message once its
+// last frame is in. It reports false when the queue is full and the policy
+// leaves nothing to drop.
+func (q *sendQueue) push(frame []byte) bool {
+	// Control frames (opcode >= 8) come between the fragments of a
+	// message. The frames of the server are never masked.
+	header := 2 + extendedLength(frame[1])
+	if frame[0]&0x0f >= 8 {
+		return q.queue(sendMessage{data: frame, control: true})
+	}
+	q.frames = append(q.frames, frame...)
+	q.payload = append(q.payload, frame[header:]...)
+	if frame[0]&0x80 == 0 {
+		return true
+	}
+	m := sendMessage{data: q.frames}
+	ready := bytes.HasPrefix(q.payload, readyPrefix)
+	if q.policy == SendDropOldest && !ready {
+		var e struct {
+			T string `json:"t"`
+		}
+		json.Unmarshal(q.payload, &e)
+		m.event = e.T
+	}
+	q.frames, q.payload = nil, nil
+	if ready {
+		if q.ready != nil {
+			q.ready()
+		}
+		return true
+	}
+	return q.queue(m)
+}
+
+// readyPrefix starts the message of the stateReady event, live.Event has
+// the event first.
+var readyPrefix = []byte(`{"t":"` + stateReady + `"`)
+
+func (q *sendQueue) queue(m sendMessage) bool {
+	if len(q.messages) >= q.max {
+		if q.policy != SendDropOldest || !q.drop() {
+			return false
+		}
+		q.dropped++
+	}
+	q.messages = append(q.messages, m)
+	return true
+}
+
+// drop drops the oldest message the page can do without, see sendKept.
+func (q *sendQueue) drop() bool {
+	for i, m := range q.messages {
+		if m.control || sendKept[m.event] {
+			continue
+		}
+		copy(q.messages[i:], q.messages[i+1:])
+		q.messages[len(q.messages)-1] = sendMessage{}
+		q.messages = q.messages[:len(q.messages)-1]
+		return true
+	}
+	return false
+}
+
+// next waits for the next message to send, false once the queue is
+// closed.
+func (q *sendQueue) next() ([]byte, bool) {
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return nil, false
+		}
+		if len(q.messages) > 0 {
+			m := q.messages[0]
+			q.messages[0] = sendMessage{}
+			q.messages = q.messages[1:]
+			q.mu.Unlock()
+			return m.data, true
+		}
+		q.mu.Unlock()
+		<-q.wake
+	}
+}
+
+// close drops the messages left and stops flush. It reports whether the
+// queue was open.
+func (q *sendQueue) close() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return false
+	}
+	q.shut()
+	return true
+}
+
+func (q *sendQueue) shut() {
+	q.closed = true
+	q.messages = nil
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// stats returns the number of messages queued and dropped.
+func (q *sendQueue) stats() (queued, dropped int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.messages), q.dropped
+}
+
+// frameSize returns the size of the frame at the start of b, false until
+// all of it is there.
+func frameSize(b []byte) (int, bool) {
+	header, length, ok := frameHeader(b)
+	if !ok || int64(len(b)-header) < length {
+		return 0, false
+	}
+	return header + int(length), true
+}
+
+// frameHeader returns the size of the header of the frame at the start of
+// b and the length of its payload, false until the header is there.
+func frameHeader(b []byte) (int, int64, bool) {
+	if len(b) < 2 {
+		return 0, 0, false
+	}
+	header := 2 + extendedLength(b[1])
+	if b[1]&0x80 != 0 {
+		header += 4
+	}
+	if len(b) < header {
+		return 0, 0, false
+	}
+	length := int64(b[1] & 0x7f)
+	switch length {
+	case 126:
+		length = int64(binary.BigEndian.Uint16(b[2:4]))
+	case 127:
+		length = int64(binary.BigEndian.Uint64(b[2:10]))
+	}
+	return header, length, true
+}
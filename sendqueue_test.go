@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jfyne/live"
+)
+
+// serverFrame returns a frame of the server, unmasked, with the opcode and
+// the payload.
+func serverFrame(opcode byte, fin bool, payload []byte) []byte {
+	b := []byte{opcode, 0}
+	if fin {
+		b[0] |= 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		b[1] = byte(n)
+	case n <= 0xffff:
+		b[1] = 126
+		b = append(b, byte(n>>8), byte(n))
+	default:
+		b[1] = 127
+		for i := 7; i >= 0; i-- {
+			b = append(b, byte(n>>(8*i)))
+		}
+	}
+	return append(b, payload...)
+}
+
+// eventFrame returns the text frame of the live event t, "ping" the ping
+// frame of the websocket library.
+func eventFrame(t string) []byte {
+	if t == "ping" {
+		return serverFrame(0x9, true, nil)
+	}
+	payload, _ := json.Marshal(live.Event{T: t})
+	return serverFrame(0x1, true, payload)
+}
+
+// queuedEvents returns the events of the messages of q, "ping" for the
+// control frames.
+func queuedEvents(q *sendQueue) []string {
+	var events []string
+	for _, m := range q.messages {
+		if m.control {
+			events = append(events, "ping")
+			continue
+		}
+		var payload []byte
+		for b := m.data; len(b) > 0; {
+			header, length, _ := frameHeader(b)
+			payload = append(payload, b[header:header+int(length)]...)
+			b = b[header+int(length):]
+		}
+		var e live.Event
+		json.Unmarshal(payload, &e)
+		events = append(events, e.T)
+	}
+	return events
+}
+
+func TestSendQueuePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		writes  []string
+		want    []string
+		dropped int
+		full    bool
+	}{
+		{
+			name:   "under the limit",
+			policy: SendDisconnect,
+			writes: []string{"a", "b", "c"},
+			want:   []string{"a", "b", "c"},
+		},
+		{
+			name:   "disconnect on overflow",
+			policy: SendDisconnect,
+			writes: []string{"a", "b", "c", "d"},
+			full:   true,
+		},
+		{
+			name:    "drop the oldest",
+			policy:  SendDropOldest,
+			writes:  []string{"a", "b", "c", "d", "e"},
+			want:    []string{"c", "d", "e"},
+			dropped: 2,
+		},
+		{
+			name:    "drop the oldest unkept",
+			policy:  SendDropOldest,
+			writes:  []string{live.EventPatch, "a", live.EventAck, "b"},
+			want:    []string{live.EventPatch, live.EventAck, "b"},
+			dropped: 1,
+		},
+		{
+			name:    "keep the control frames",
+			policy:  SendDropOldest,
+			writes:  []string{"ping", "a", "b", "c"},
+			want:    []string{"ping", "b", "c"},
+			dropped: 1,
+		},
+		{
+			name:   "never drop patch, ack or connect",
+			policy: SendDropOldest,
+			writes: []string{live.EventPatch, live.EventAck, live.EventConnect, "a"},
+			full:   true,
+		},
+		{
+			name:   "never drop for a kept event",
+			policy: SendDropOldest,
+			writes: []string{live.EventPatch, live.EventAck, live.EventConnect, live.EventPatch},
+			full:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newSendQueue(3, tt.policy, nil)
+			var dropped int
+			var full bool
+			for _, event := range tt.writes {
+				_, d, f, err := q.write(eventFrame(event))
+				if err != nil {
+					t.Fatalf("write %s: %v", event, err)
+				}
+				dropped += d
+				if f {
+					full = true
+					break
+				}
+			}
+			if full != tt.full {
+				t.Fatalf("full = %v, want %v", full, tt.full)
+			}
+			if got := queuedEvents(q); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("queued %q, want %q", got, tt.want)
+			}
+			if dropped != tt.dropped {
+				t.Errorf("dropped %d, want %d", dropped, tt.dropped)
+			}
+			if full {
+				if _, _, _, err := q.write(eventFrame("a")); !errors.Is(err, net.ErrClosed) {
+					t.Errorf("write after overflow: %v, want net.ErrClosed", err)
+				}
+				if _, ok := q.next(); ok {
+					t.Error("next after overflow found a message")
+				}
+			}
+		})
+	}
+}
+
+// TestSendQueueFrames writes a fragmented message a byte at a time with a
+// ping between its fragments: the ping goes first, the message whole once
+// its last fragment is in.
+func TestSendQueueFrames(t *testing.T) {
+	payload, _ := json.Marshal(live.Event{T: "a", Data: json.RawMessage(`"` + strings.Repeat("x", 200) + `"`)})
+	first := serverFrame(0x1, false, payload[:150])
+	last := serverFrame(0x0, true, payload[150:])
+	var stream []byte
+	stream = append(stream, first...)
+	stream = append(stream, eventFrame("ping")...)
+	stream = append(stream, last...)
+
+	q := newSendQueue(3, SendDropOldest, nil)
+	for i := range stream {
+		if _, _, full, err := q.write(stream[i : i+1]); err != nil || full {
+			t.Fatalf("write byte %d: full %v, %v", i, full, err)
+		}
+	}
+	if got, want := queuedEvents(q), []string{"ping", "a"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("queued %q, want %q", got, want)
+	}
+	if q.messages[1].event != "a" {
+		t.Errorf("event of the message %q, want a", q.messages[1].event)
+	}
+	b, _ := q.next()
+	if !bytes.Equal(b, eventFrame("ping")) {
+		t.Errorf("first message %x, want the ping", b)
+	}
+	b, _ = q.next()
+	if want := append(append([]byte{}, first...), last...); !bytes.Equal(b, want) {
+		t.Errorf("second message %x, want the fragments %x", b, want)
+	}
+}
+
+// TestSendQueueReady takes the stateReady event out of the queue.
+func TestSendQueueReady(t *testing.T) {
+	ready := 0
+	q := newSendQueue(1, SendDisconnect, func() { ready++ })
+	for _, event := range []string{"a", stateReady} {
+		if _, _, full, err := q.write(eventFrame(event)); err != nil || full {
+			t.Fatalf("write %s: full %v, %v", event, full, err)
+		}
+	}
+	if ready != 1 {
+		t.Errorf("ready called %d times, want 1", ready)
+	}
+	if got, want := queuedEvents(q), []string{"a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("queued %q, want %q", got, want)
+	}
+}
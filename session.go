@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/securecookie"
+	"github.com/jfyne/live"
+)
+
+var _ live.HttpSessionStore = &RedisStore{}
+
+// RedisStore keeps live sessions in Redis. The cookie only carries the
+// signed session ID, so sessions survive restarts and are shared by every
+// instance pointing at the same Redis.
+type RedisStore struct {
+	client *redis.Client
+	codec  *securecookie.SecureCookie
+	name   string
+	// TTL is how long an unused session is kept.
+	TTL time.Duration
+}
+
+// NewRedisStore creates a session store using the cookie name and the
+// secret to sign the session ID.
+func NewRedisStore(client *redis.Client, cookieName string, secret []byte) *RedisStore {
+	return &RedisStore{
+		client: client,
+		codec:  securecookie.New(secret, nil),
+		name:   cookieName,
+		TTL:    30 * 24 * time.Hour,
+	}
+}
+
+// Get loads the session of the request, or creates a new one.
+func (s *RedisStore) Get(r *http.Request) (live.Session, error) {
+	id, err := s.sessionID(r)
+	if err != nil {
+		return live.NewSession(), err
+	}
+	if id == "" {
+		return live.NewSession(), nil
+	}
+
+	data, err := s.client.Get(r.Context(), s.key(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return live.NewSession(), nil
+	}
+	if err != nil {
+		return live.NewSession(), fmt.Errorf("could not load session: %w", err)
+	}
+
+	var session live.Session
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&session); err != nil {
+		return live.NewSession(), fmt.Errorf("could not decode session: %w", err)
+	}
+	return session, nil
+}
+
+// Save stores the session and sets the session cookie.
+func (s *RedisStore) Save(w http.ResponseWriter, r *http.Request, session live.Session) error {
+	id := live.SessionID(session)
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(session); err != nil {
+		return fmt.Errorf("could not encode session: %w", err)
+	}
+	if err := s.client.Set(r.Context(), s.key(id), buf.Bytes(), s.TTL).Err(); err != nil {
+		return fmt.Errorf("could not save session: %w", err)
+	}
+
+	value, err := s.codec.Encode(s.name, id)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(s.TTL.Seconds()),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return nil
+}
+
+// Clear removes the session from Redis and expires the cookie.
+func (s *RedisStore) Clear(w http.ResponseWriter, r *http.Request) error {
+	if id, err := s.sessionID(r); err == nil && id != "" {
+		s.client.Del(r.Context(), s.key(id))
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.name,
+		Value:    "",
+		Path:     "/",
+		Expires:  time.Unix(0, 0),
+		HttpOnly: true,
+	})
+	return nil
+}
+
+// sessionID reads the session ID from the cookie, "" if there is none.
+func (s *RedisStore) sessionID(r *http.Request) (string, error) {
+	c, err := r.Cookie(s.name)
+	if errors.Is(err, http.ErrNoCookie) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	var id string
+	if err := s.codec.Decode(s.name, c.Value, &id); err != nil {
+		return "", fmt.Errorf("invalid session cookie: %w", err)
+	}
+	return id, nil
+}
+
+func (s *RedisStore) key(id string) string {
+	return "live:session:" + id
+}
+
+// AssignsStore persists the assigns of a socket between connections.
+type AssignsStore interface {
+	// Load restores the assigns stored under key into v. It reports false
+	// when nothing is stored.
+	Load(ctx context.Context, key string, v interface{}) (bool, error)
+	// Save stores v under key.
+	Save(ctx context.Context, key string, v interface{}) error
+}
+
+// RedisAssigns stores assigns in Redis as JSON.
+type RedisAssigns struct {
+	client *redis.Client
+	TTL    time.Duration
+}
+
+// NewRedisAssigns creates an assigns store on the Redis client.
+func NewRedisAssigns(client *redis.Client) *RedisAssigns {
+	return &RedisAssigns{client: client, TTL: 30 * 24 * time.Hour}
+}
+
+// Load restores the JSON stored under key into v.
+func (a *RedisAssigns) Load(ctx context.Context, key string, v interface{}) (bool, error) {
+	data, err := a.client.Get(ctx, "live:assigns:"+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+// Save stores v under key as JSON.
+func (a *RedisAssigns) Save(ctx context.Context, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return a.client.Set(ctx, "live:assigns:"+key, data, a.TTL).Err()
+}
+
+// MemoryAssigns stores assigns in memory as JSON, for running without
+// Redis. Nothing survives a restart.
+type MemoryAssigns struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+// NewMemoryAssigns creates an empty in-memory store.
+func NewMemoryAssigns() *MemoryAssigns {
+	return &MemoryAssigns{data: map[string][]byte{}}
+}
+
+// Load restores the JSON stored under key into v.
+func (a *MemoryAssigns) Load(ctx context.Context, key string, v interface{}) (bool, error) {
+	a.mu.Lock()
+	data, ok := a.data[key]
+	a.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+// Save stores v under key as JSON.
+func (a *MemoryAssigns) Save(ctx context.Context, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.data[key] = data
+	a.mu.Unlock()
+	return nil
+}
+
+// assignsKey identifies the assigns of a socket: the same session on the
+// same page gets its state back.
+func assignsKey(ctx context.Context, s live.Socket) string {
+	return live.SessionID(s.Session()) + ":" + live.Request(ctx).URL.Path
+}
+
+// restoreAssigns is a mount middleware filling the model returned by the
+// mount handler with the assigns stored for the session and page.
+func restoreAssigns(store AssignsStore) MountMiddleware {
+	return func(mount live.MountHandler) live.MountHandler {
+		return func(ctx context.Context, s live.Socket) (interface{}, error) {
+			model, err := mount(ctx, s)
+			if err != nil || model == nil {
+				return model, err
+			}
+			if _, err := store.Load(ctx, assignsKey(ctx, s), model); err != nil {
+				return nil, fmt.Errorf("could not restore assigns: %w", err)
+			}
+			return model, nil
+		}
+	}
+}
+
+// saveAssigns is an event middleware storing the assigns after every
+// client event.
+func saveAssigns(store AssignsStore) EventMiddleware {
+	return func(kind, event string, next EventFunc) EventFunc {
+		if kind != "event" {
+			return next
+		}
+		return func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+			result, err := next(ctx, s, data)
+			if err != nil {
+				return result, err
+			}
+			if err := store.Save(ctx, assignsKey(ctx, s), result); err != nil {
+				return nil, fmt.Errorf("could not save assigns: %w", err)
+			}
+			return result, nil
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"my-app.com/live/store"
+)
+
+// watchBuffer is the number of changes a watcher may fall behind by, the
+// changes after that are dropped for it.
+const watchBuffer = 16
+
+// ErrNotConfirmed is returned for a change taking a control over the
+// warning limit without the confirmation the controls ask for.
+var ErrNotConfirmed = errors.New("a setpoint over the warning limit has to be confirmed")
+
+// SetpointOrigin is who made a change of Setpoints.Set and where.
+type SetpointOrigin struct {
+	// Actor names the user in the audit log and the status feeds.
+	Actor string
+	// Socket and Page are those of the event logged for the change.
+	Socket, Page string
+	// Step is set for the ±0.1C steps, the status feeds don't show them.
+	Step bool
+}
+
+// Setpoints is the state of the zones shared by the pages and the services
+// outside of them, the API and the gRPC service. It records the setpoints
+// of the controls, so the App's Recorder is a Setpoints, and tells the
+// watchers about every change. The changes it makes itself are recorded
+// like those of the controls and show on the pages it watches.
+type Setpoints struct {
+	recorder    ReadingRecorder
+	thermostats store.ThermostatRepo
+	zones       *ZoneConfigs
+	// events is the event log, nil without one.
+	events store.EventRepo
+	audit  *Audit
+
+	mu       sync.Mutex
+	pages    []setpointPage
+	watchers map[chan SetpointChange]string
+}
+
+// setpointPage is a page the changes are pushed to, with the status its
+// feed shows for them.
+type setpointPage struct {
+	engine Broadcaster
+	status func(actor string, c *TempControl, from float32) string
+}
+
+// NewSetpoints creates the setpoints recording with recorder. With the event
+// log, events, the changes are logged too.
+func NewSetpoints(recorder ReadingRecorder, thermostats store.ThermostatRepo, zones *ZoneConfigs, events store.EventRepo, audit *Audit) *Setpoints {
+	return &Setpoints{
+		recorder:    recorder,
+		thermostats: thermostats,
+		zones:       zones,
+		events:      events,
+		audit:       audit,
+		watchers:    map[chan SetpointChange]string{},
+	}
+}
+
+// Watch has the controls on the pages of engine, a live engine, follow the changes of Set,
+// and their status feeds show the text status returns.
+func (s *Setpoints) Watch(engine Broadcaster, status func(actor string, c *TempControl, from float32) string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pages = append(s.pages, setpointPage{engine: engine, status: status})
+}
+
+// Zones are the known zones, those the thermostat links to.
+func (s *Setpoints) Zones() []string {
+	zones := append([]string{"main"}, dashboardZones...)
+	for _, c := range s.zones.List() {
+		zones = append(zones, c.ID)
+	}
+	return zones
+}
+
+// Control loads the control of zone as the thermostat mounts it, nil if
+// the zone is unknown.
+func (s *Setpoints) Control(ctx context.Context, zone string) (*TempControl, error) {
+	known := false
+	for _, id := range s.Zones() {
+		known = known || id == zone
+	}
+	if !known {
+		return nil, nil
+	}
+	c := NewTempControl(zone)
+	if config, ok := s.zones.Get(zone); ok {
+		c.Temperature = config.Setpoint
+		c.History = nil
+		c.record(time.Now())
+	}
+	return c, LoadSetpoint(ctx, s.thermostats, c)
+}
+
+// Set moves c to the setpoint and records it as the controls do, then
+// moves the controls of the zone on the pages. A change over the warning
+// limit fails with ErrNotConfirmed unless confirmed is set. With the event
+// log the change is logged, the zone history is projected from it.
+func (s *Setpoints) Set(ctx context.Context, c *TempControl, to float32, confirmed bool, o SetpointOrigin) error {
+	if c.NeedsConfirm(to) && !confirmed {
+		return fmt.Errorf("%w: %s to %.1f °C", ErrNotConfirmed, c.Zone, to)
+	}
+	from := c.Temperature
+	c.Temperature = to
+	reading := c.record(time.Now())
+	s.Record(c.Zone, reading)
+	if s.events != nil {
+		e, err := setEvent(*c)
+		if err != nil {
+			return err
+		}
+		e.Socket, e.Page = o.Socket, o.Page
+		if _, err := s.events.Append(ctx, e); err != nil {
+			return fmt.Errorf("could not log the setpoint: %w", err)
+		}
+	}
+	if from != to {
+		s.audit.RecordAs(ctx, o.Actor, "", AuditSetpoint, c.Zone, fmt.Sprintf("%.1f → %.1f", from, to))
+	}
+
+	s.mu.Lock()
+	pages := append([]setpointPage(nil), s.pages...)
+	s.mu.Unlock()
+	change := SetpointChange{Zone: c.Zone, Reading: reading}
+	for _, p := range pages {
+		if err := p.engine.Broadcast(setpointEvent, change); err != nil {
+			log.Println("broadcast error:", err)
+		}
+		if o.Step || from == to || p.status == nil {
+			continue
+		}
+		if err := p.engine.Broadcast("status", p.status(o.Actor, c, from)); err != nil {
+			log.Println("broadcast error:", err)
+		}
+	}
+	return nil
+}
+
+// Record records a setpoint of the controls and tells the watchers.
+func (s *Setpoints) Record(zone string, r Reading) {
+	s.recorder.Record(zone, r)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch, z := range s.watchers {
+		if z != "" && z != zone {
+			continue
+		}
+		select {
+		case ch <- SetpointChange{Zone: zone, Reading: r}:
+		default:
+		}
+	}
+}
+
+// Subscribe returns the changes of zone, of every zone when it is empty,
+// until cancel is called. A watcher falling behind misses changes.
+func (s *Setpoints) Subscribe(zone string) (changes <-chan SetpointChange, cancel func()) {
+	ch := make(chan SetpointChange, watchBuffer)
+	s.mu.Lock()
+	s.watchers[ch] = zone
+	s.mu.Unlock()
+	return ch, func() {
+		s.mu.Lock()
+		delete(s.watchers, ch)
+		s.mu.Unlock()
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jfyne/live"
+)
+
+// zonesKey is the key of the configured zones in the store.
+const zonesKey = "zones"
+
+// errZoneExists is returned when adding a zone whose ID is taken.
+var errZoneExists = errors.New("zones: the zone exists already")
+
+// ZoneConfig is a thermostat zone configured with the setup wizard.
+type ZoneConfig struct {
+	ID   string
+	Name string
+	// Setpoint is the temperature of the zone during the day.
+	Setpoint float32
+	// Night is the temperature from NightFrom to NightTo, in hours.
+	Night     float32
+	NightFrom int
+	NightTo   int
+}
+
+// ZoneConfigs are the zones configured with the setup wizard, kept in the
+// app's store.
+type ZoneConfigs struct {
+	store AssignsStore
+
+	mu    sync.Mutex
+	zones []ZoneConfig
+}
+
+// LoadZoneConfigs loads the configured zones from store.
+func LoadZoneConfigs(ctx context.Context, store AssignsStore) (*ZoneConfigs, error) {
+	z := &ZoneConfigs{store: store}
+	if _, err := store.Load(ctx, zonesKey, &z.zones); err != nil {
+		return z, fmt.Errorf("could not load the zones: %w", err)
+	}
+	return z, nil
+}
+
+// List returns the configured zones in the order they were added.
+func (z *ZoneConfigs) List() []ZoneConfig {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return append([]ZoneConfig(nil), z.zones...)
+}
+
+// Get returns the zone id.
+func (z *ZoneConfigs) Get(id string) (ZoneConfig, bool) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	for _, c := range z.zones {
+		if c.ID == id {
+			return c, true
+		}
+	}
+	return ZoneConfig{}, false
+}
+
+// Add stores a new zone.
+func (z *ZoneConfigs) Add(ctx context.Context, c ZoneConfig) error {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	for _, other := range z.zones {
+		if other.ID == c.ID {
+			return errZoneExists
+		}
+	}
+	zones := append(append([]ZoneConfig(nil), z.zones...), c)
+	if err := z.store.Save(ctx, zonesKey, zones); err != nil {
+		return fmt.Errorf("could not save the zones: %w", err)
+	}
+	z.zones = zones
+	return nil
+}
+
+// setupSteps are the titles of the steps of the wizard, the last one
+// reviews the zone.
+var setupSteps = []string{"Zone", "Temperatures", "Schedule", "Review"}
+
+// setupForms validate the fields of each step but the review.
+var setupForms = []Form{
+	{
+		"name": {Required(), Length(2, 40)},
+		"id":   {Required(), Length(2, 20), Slug()},
+	},
+	{
+		"setpoint": {Required(), Range(5, 35)},
+		"night":    {Required(), Range(5, 35)},
+	},
+	{
+		"night_from": {Required(), Range(0, 23)},
+		"night_to":   {Required(), Range(0, 23)},
+	},
+}
+
+// SetupStep is a step of the wizard as the progress bar shows it.
+type SetupStep struct {
+	Number  int
+	Title   string
+	Current bool
+	Done    bool
+}
+
+// SetupModel is the model of the setup wizard. The zone is kept in the
+// assigns until the review step stores it.
+type SetupModel struct {
+	Page
+	// Step is the index of the current step in setupSteps.
+	Step int
+	Zone ZoneConfig
+	// Created is the ID of the zone the wizard stored last.
+	Created string
+	Errors  Errors `json:"-"`
+}
+
+// Steps returns the steps of the wizard.
+func (m *SetupModel) Steps() []SetupStep {
+	steps := make([]SetupStep, len(setupSteps))
+	for i, title := range setupSteps {
+		steps[i] = SetupStep{Number: i + 1, Title: title, Current: i == m.Step, Done: i < m.Step}
+	}
+	return steps
+}
+
+// Last reports whether the wizard is at the review step.
+func (m *SetupModel) Last() bool {
+	return m.Step == len(setupSteps)-1
+}
+
+// reset starts the wizard over with the default zone.
+func (m *SetupModel) reset() {
+	m.Step = 0
+	m.Zone = ZoneConfig{Setpoint: 21, Night: 17, NightFrom: 22, NightTo: 6}
+	m.Errors = nil
+}
+
+// apply validates the fields of step and copies them to the zone.
+func (m *SetupModel) apply(step int, p live.Params, zones *ZoneConfigs) Errors {
+	errs := setupForms[step].Validate(p)
+	if len(errs) > 0 {
+		return errs
+	}
+	number := func(field string) float64 {
+		v, _ := strconv.ParseFloat(strings.TrimSpace(p.String(field)), 64)
+		return v
+	}
+	switch step {
+	case 0:
+		id := strings.TrimSpace(p.String("id"))
+		if _, ok := zones.Get(id); ok || id == "main" || containsString(dashboardZones, id) {
+			errs["id"] = Message{Key: "This zone exists already."}
+			return errs
+		}
+		m.Zone.Name, m.Zone.ID = strings.TrimSpace(p.String("name")), id
+	case 1:
+		setpoint, night := float32(number("setpoint")), float32(number("night"))
+		if night > setpoint {
+			errs["night"] = Message{Key: "The night temperature can't be above the day temperature."}
+			return errs
+		}
+		m.Zone.Setpoint, m.Zone.Night = setpoint, night
+	case 2:
+		from, to := int(number("night_from")), int(number("night_to"))
+		if from == to {
+			errs["night_to"] = Message{Key: "The night has to end at another hour than it starts."}
+			return errs
+		}
+		m.Zone.NightFrom, m.Zone.NightTo = from, to
+	}
+	return nil
+}
+
+func setupModel(s live.Socket) *SetupModel {
+	if m, ok := s.Assigns().(*SetupModel); ok {
+		return m
+	}
+	m := &SetupModel{}
+	m.reset()
+	return m
+}
+
+// newSetup creates the setup wizard creating thermostat zones. Each step
+// is a form validated on "setup-next"; "setup-back" returns to the
+// previous step without validating, and the review step stores the zone
+// with "setup-submit".
+func newSetup(app *App, zones *ZoneConfigs) *Handler {
+	h := app.NewHandler()
+	h.HandleRender(app.Render("setup.html"))
+	h.HandleMount(func(ctx context.Context, s live.Socket) (interface{}, error) {
+		return setupModel(s), nil
+	})
+	h.HandleEvent("setup-next", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := setupModel(s)
+		if m.Last() {
+			return m, nil
+		}
+		if m.Errors = m.apply(m.Step, p, zones); len(m.Errors) > 0 {
+			return m, nil
+		}
+		m.Step++
+		return m, nil
+	})
+	h.HandleEvent("setup-back", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := setupModel(s)
+		if m.Step > 0 {
+			m.Step--
+		}
+		m.Errors = nil
+		return m, nil
+	})
+	h.HandleEvent("setup-cancel", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := setupModel(s)
+		m.reset()
+		return m, nil
+	})
+	h.HandleEvent("setup-submit", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := setupModel(s)
+		if !m.Last() {
+			return m, fmt.Errorf("the zone isn't reviewed yet")
+		}
+		if err := zones.Add(ctx, m.Zone); err != nil {
+			if errors.Is(err, errZoneExists) {
+				// Someone else took the ID meanwhile.
+				m.Step = 0
+				m.Errors = Errors{"id": Message{Key: "This zone exists already."}}
+				return m, nil
+			}
+			return m, err
+		}
+		app.Audit.Record(ctx, s, AuditZoneAdd, m.Zone.ID, fmt.Sprintf("%s, %.1f by day, %.1f from %d to %d", m.Zone.Name, m.Zone.Setpoint, m.Zone.Night, m.Zone.NightFrom, m.Zone.NightTo))
+		m.Created = m.Zone.ID
+		m.reset()
+		Flash(s, FlashSuccess, "The zone is ready.")
+		return m, nil
+	})
+	return h
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jfyne/live"
+)
+
+// Pricing of the shop, in cents.
+const (
+	shopVATPercent   = 21
+	shopShipping     = 490
+	shopFreeShipping = 5000
+	shopMaxQuantity  = 99
+)
+
+// shopCartEvent is the self event telling the sockets of a session that
+// its cart changed.
+const shopCartEvent = "cart"
+
+// Product is an item of the shop. Prices are in cents.
+type Product struct {
+	ID    string
+	Name  string
+	Price int
+}
+
+// shopProducts is the catalog of the shop.
+var shopProducts = []Product{
+	{ID: "thermostat", Name: "Smart thermostat", Price: 8990},
+	{ID: "sensor", Name: "Temperature sensor", Price: 1490},
+	{ID: "valve", Name: "Radiator valve", Price: 3290},
+	{ID: "hub", Name: "Gateway hub", Price: 5990},
+	{ID: "batteries", Name: "Batteries (4 pack)", Price: 499},
+}
+
+func findProduct(id string) (Product, bool) {
+	for _, p := range shopProducts {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return Product{}, false
+}
+
+// CartLine is a product in the cart and its quantity.
+type CartLine struct {
+	Product  Product
+	Quantity int
+}
+
+// Total returns the price of the line.
+func (l CartLine) Total() int {
+	return l.Product.Price * l.Quantity
+}
+
+// Cart is the shopping cart of a session.
+type Cart struct {
+	Lines []CartLine
+}
+
+// Add adds quantity of a product, which may be negative. A line whose
+// quantity drops to zero is removed.
+func (c *Cart) Add(id string, quantity int) error {
+	p, ok := findProduct(id)
+	if !ok {
+		return fmt.Errorf("unknown product %q", id)
+	}
+	for i := range c.Lines {
+		if c.Lines[i].Product.ID != id {
+			continue
+		}
+		q := c.Lines[i].Quantity + quantity
+		if q > shopMaxQuantity {
+			q = shopMaxQuantity
+		}
+		if q <= 0 {
+			c.Lines = append(c.Lines[:i], c.Lines[i+1:]...)
+		} else {
+			// The price is the current one, even if it changed since.
+			c.Lines[i] = CartLine{Product: p, Quantity: q}
+		}
+		return nil
+	}
+	if quantity > shopMaxQuantity {
+		quantity = shopMaxQuantity
+	}
+	if quantity > 0 {
+		c.Lines = append(c.Lines, CartLine{Product: p, Quantity: quantity})
+	}
+	return nil
+}
+
+// Remove removes a product from the cart.
+func (c *Cart) Remove(id string) {
+	for i := range c.Lines {
+		if c.Lines[i].Product.ID == id {
+			c.Lines = append(c.Lines[:i], c.Lines[i+1:]...)
+			return
+		}
+	}
+}
+
+// Count returns the number of items in the cart.
+func (c *Cart) Count() int {
+	n := 0
+	for _, l := range c.Lines {
+		n += l.Quantity
+	}
+	return n
+}
+
+// Subtotal returns the price of the items, VAT included.
+func (c *Cart) Subtotal() int {
+	sum := 0
+	for _, l := range c.Lines {
+		sum += l.Total()
+	}
+	return sum
+}
+
+// Shipping returns the shipping fee, free above shopFreeShipping.
+func (c *Cart) Shipping() int {
+	if len(c.Lines) == 0 || c.Subtotal() >= shopFreeShipping {
+		return 0
+	}
+	return shopShipping
+}
+
+// Total returns the price to pay.
+func (c *Cart) Total() int {
+	return c.Subtotal() + c.Shipping()
+}
+
+// VAT returns the VAT included in the total.
+func (c *Cart) VAT() int {
+	t := c.Total()
+	return t - t*100/(100+shopVATPercent)
+}
+
+// ShopModel is the model of the shop page.
+type ShopModel struct {
+	Page
+	Cart Cart
+}
+
+// Products returns the catalog.
+func (m *ShopModel) Products() []Product {
+	return shopProducts
+}
+
+// FreeShipping returns the subtotal from which shipping is free.
+func (m *ShopModel) FreeShipping() int {
+	return shopFreeShipping
+}
+
+func shopModel(s live.Socket) *ShopModel {
+	if m, ok := s.Assigns().(*ShopModel); ok {
+		return m
+	}
+	return &ShopModel{}
+}
+
+// cartKey is where the cart of the socket's session is stored.
+func cartKey(s live.Socket) string {
+	return "cart:" + live.SessionID(s.Session())
+}
+
+// newShop creates the shop live handler. The cart belongs to the session:
+// it's kept in the app store and every change is broadcast with the
+// session ID, so the other tabs of the session reload it.
+func newShop(app *App) *Handler {
+	// update applies a change to the cart of the socket and stores it.
+	update := func(ctx context.Context, s live.Socket, change func(c *Cart) error) (interface{}, error) {
+		m := shopModel(s)
+		if err := change(&m.Cart); err != nil {
+			return m, err
+		}
+		if err := app.Store.Save(ctx, cartKey(s), m.Cart); err != nil {
+			return m, fmt.Errorf("could not save the cart: %w", err)
+		}
+		s.Broadcast(shopCartEvent, live.SessionID(s.Session()))
+		return m, nil
+	}
+	load := func(ctx context.Context, s live.Socket) (interface{}, error) {
+		m := shopModel(s)
+		m.Cart = Cart{}
+		if _, err := app.Store.Load(ctx, cartKey(s), &m.Cart); err != nil {
+			return nil, fmt.Errorf("could not load the cart: %w", err)
+		}
+		return m, nil
+	}
+
+	h := app.NewHandler()
+	h.HandleRender(app.Render("shop.html"))
+	h.HandleMount(load)
+	h.HandleEvent("cart-add", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		return update(ctx, s, func(c *Cart) error {
+			return c.Add(p.String("id"), 1)
+		})
+	})
+	h.HandleEvent("cart-quantity", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		return update(ctx, s, func(c *Cart) error {
+			return c.Add(p.String("id"), p.Int("change"))
+		})
+	})
+	h.HandleEvent("cart-remove", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		return update(ctx, s, func(c *Cart) error {
+			c.Remove(p.String("id"))
+			return nil
+		})
+	})
+	h.HandleEvent("cart-clear", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		return update(ctx, s, func(c *Cart) error {
+			c.Lines = nil
+			return nil
+		})
+	})
+	h.HandleSelf(shopCartEvent, func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		if data != live.SessionID(s.Session()) {
+			return s.Assigns(), nil
+		}
+		return load(ctx, s)
+	})
+	return h
+}
@@ -0,0 +1,33 @@
+package main
+
+import "encoding/json"
+
+// Shortcut binds a key, as in KeyboardEvent.key, to an event of the page
+// or to focusing an element. Pages register them with AddShortcut and the
+// layout renders them for the "shortcuts" hook, so no element needs its
+// own live-window-keyup attributes.
+type Shortcut struct {
+	Key string `json:"key"`
+	// Event is sent with Params when the key is pressed.
+	Event  string            `json:"event,omitempty"`
+	Params map[string]string `json:"params,omitempty"`
+	// Focus is the CSS selector of the element to focus instead.
+	Focus string `json:"focus,omitempty"`
+	// Label describes the shortcut in the shortcut help.
+	Label Message `json:"-"`
+}
+
+// AddShortcut registers shortcuts on the page.
+func (p *Page) AddShortcut(shortcuts ...Shortcut) {
+	p.Shortcuts = append(p.Shortcuts, shortcuts...)
+}
+
+// shortcutsJSON encodes shortcuts for the data attribute of the
+// "shortcuts" hook.
+func shortcutsJSON(shortcuts []Shortcut) (string, error) {
+	if shortcuts == nil {
+		shortcuts = []Shortcut{}
+	}
+	b, err := json.Marshal(shortcuts)
+	return string(b), err
+}
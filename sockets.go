@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jfyne/live"
+)
+
+// socketsRefresh is how often the sockets page lists the sockets again.
+const socketsRefresh = 2 * time.Second
+
+// socketMessageForm validates the message sent to a socket.
+var socketMessageForm = Form{
+	"message": {Required(), Length(1, 200)},
+}
+
+// ShortSession returns the start of the session ID, enough to tell the
+// sessions apart.
+func (i SocketInfo) ShortSession() string {
+	if len(i.Session) > 8 {
+		return i.Session[:8]
+	}
+	return i.Session
+}
+
+// SocketsModel is the model of the admin sockets page.
+type SocketsModel struct {
+	Page
+	Sockets []SocketInfo `json:"-"`
+	// Me is the registry ID of the page's own socket.
+	Me int
+	// Target is the socket the message form is open for, 0 when closed.
+	Target int
+	Errors Errors `json:"-"`
+}
+
+// auditTarget names socket id in the audit log, with its page and session.
+func (m *SocketsModel) auditTarget(id int) string {
+	for _, i := range m.Sockets {
+		if i.ID == id {
+			return fmt.Sprintf("%d %s %s", id, i.Page, i.ShortSession())
+		}
+	}
+	return strconv.Itoa(id)
+}
+
+func socketsModel(s live.Socket) *SocketsModel {
+	if m, ok := s.Assigns().(*SocketsModel); ok {
+		return m
+	}
+	return &SocketsModel{}
+}
+
+// newSocketsPage creates the admin page listing the connected sockets,
+// with the actions sending a socket a message and disconnecting it.
+func newSocketsPage(app *App, sockets *Sockets) *Handler {
+	h := app.NewHandler()
+	h.HandleRender(app.Render("sockets.html"))
+	h.HandleMount(func(ctx context.Context, s live.Socket) (interface{}, error) {
+		m := socketsModel(s)
+		if c := connFromContext(ctx); c != nil && s.Connected() {
+			m.Me = c.id
+			go func() {
+				t := time.NewTicker(socketsRefresh)
+				defer t.Stop()
+				for {
+					select {
+					case <-t.C:
+						app.State.Send(s, "sockets-refresh", nil)
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+		}
+		m.Sockets = sockets.List()
+		return m, nil
+	})
+	h.HandleTick("sockets-refresh", func(ctx context.Context, s live.Socket, _ interface{}) (interface{}, error) {
+		m := socketsModel(s)
+		m.Sockets = sockets.List()
+		return m, nil
+	})
+
+	h.HandleEvent("sockets-message", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := socketsModel(s)
+		m.Target, m.Errors = p.Int("id"), nil
+		return m, nil
+	})
+	h.HandleEvent("sockets-cancel", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := socketsModel(s)
+		m.Target, m.Errors = 0, nil
+		return m, nil
+	})
+	h.HandleEvent("sockets-send", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := socketsModel(s)
+		if m.Errors = socketMessageForm.Validate(p); len(m.Errors) > 0 {
+			return m, nil
+		}
+		id := p.Int("id")
+		if !sockets.Message(id, FlashMessage{Level: FlashInfo, Message: p.String("message")}) {
+			return m, fmt.Errorf("socket %d is gone", id)
+		}
+		app.Audit.Record(ctx, s, AuditSocketMessage, m.auditTarget(id), p.String("message"))
+		m.Target = 0
+		Flash(s, FlashSuccess, "Message sent.")
+		return m, nil
+	})
+	h.HandleEvent("sockets-disconnect", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := socketsModel(s)
+		id := p.Int("id")
+		if id == m.Me {
+			return m, fmt.Errorf("socket %d is this page", id)
+		}
+		if !Confirmed(s, p) {
+			Confirm(s, Modal{
+				Title:   Message{Key: "Disconnect"},
+				Message: Message{Key: "Really disconnect socket %d?", Args: []interface{}{id}},
+				Event:   "sockets-disconnect",
+				Params:  map[string]string{"id": strconv.Itoa(id)},
+			})
+			return m, nil
+		}
+		if !sockets.Disconnect(id, "The administrator closed this page. Reload it to continue.") {
+			return m, fmt.Errorf("socket %d is gone", id)
+		}
+		app.Audit.Record(ctx, s, AuditSocketDisconnect, m.auditTarget(id), "")
+		Flash(s, FlashSuccess, "Socket disconnected.")
+		return m, nil
+	})
+	return h
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// sseKeepalive is how often an idle event stream sends a comment, so the
+// proxies on the way don't close it.
+const sseKeepalive = 15 * time.Second
+
+// sseStatus is the data of a "status" event, a line of a status feed.
+type sseStatus struct {
+	Page string `json:"page"`
+	Text string `json:"text"`
+}
+
+// sseTemperature is the data of a "temperature" event, a new setpoint.
+type sseTemperature struct {
+	Zone     string    `json:"zone"`
+	Setpoint float32   `json:"setpoint"`
+	Time     time.Time `json:"time"`
+}
+
+// sseHandler streams the status feeds of the thermostat and the
+// dashboard and the setpoint changes of the zones as server-sent events,
+// for the clients without websockets: "status" events from the bus of the
+// broadcasts and "temperature" events from the setpoints, those of a zone
+// only with ?zone=. The streams end when the bus is closed, on shutdown.
+//
+//	curl -N localhost:8080/events?zone=kitchen
+func sseHandler(broadcasts *Broadcasts, setpoints *Setpoints) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+		zone := r.URL.Query().Get("zone")
+		statuses, cancelStatuses := broadcasts.Subscribe()
+		defer cancelStatuses()
+		changes, cancelChanges := setpoints.Subscribe(zone)
+		defer cancelChanges()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		// nginx buffers the responses otherwise.
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, ": connected\n\n")
+		flusher.Flush()
+
+		send := func(event string, v interface{}) bool {
+			data, err := json.Marshal(v)
+			if err != nil {
+				log.Println("could not encode the event:", err)
+				return true
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+				return false
+			}
+			flusher.Flush()
+			return true
+		}
+		keepalive := time.NewTicker(sseKeepalive)
+		defer keepalive.Stop()
+		for {
+			ok := true
+			select {
+			case b, open := <-statuses:
+				if !open {
+					return
+				}
+				if text, isText := b.Data.(string); b.Event == "status" && isText {
+					ok = send("status", sseStatus{Page: b.Page, Text: text})
+				}
+			case c := <-changes:
+				ok = send("temperature", sseTemperature{Zone: c.Zone, Setpoint: c.Reading.Value, Time: c.Reading.Time})
+			case <-keepalive.C:
+				_, err := fmt.Fprint(w, ": keepalive\n\n")
+				ok = err == nil
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			}
+			if !ok {
+				return
+			}
+		}
+	}
+}
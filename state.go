@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/jfyne/live"
+)
+
+// stateReady is the event a mounted socket sends itself to open its queue,
+// see State. It never reaches the client.
+const stateReady = "state-ready"
+
+// stateEvents bounds the client events queued for a socket, reading more
+// of them waits for the socket.
+const stateEvents = 64
+
+// State runs the events of every connected socket one at a time and in the
+// order they come in: the events of the client, the self events, the
+// patches and the updates. Each goes through the whole cycle in the queue
+// of its socket, the handler, the render, the diff sent to the client and
+// the render kept for the next diff, so no two cycles of a socket overlap
+// and a handler may change its model without a lock of its own. The
+// stores shared by the sockets keep their locks.
+//
+// The connection hands the events of the client to the queue instead of
+// the live engine, see wsConn. The engine still mounts the connected
+// socket and renders it first; the queue waits for that render, which
+// the socket tells with stateReady once it's written.
+//
+// A handler doesn't call Self, whose event would bypass the queue, and
+// sends the self events of its socket or of another one with Send. The
+// broadcasts of a page go through the queues of its sockets.
+type State struct {
+	mu      sync.Mutex
+	sockets map[live.SocketID]*socketState
+}
+
+// NewState creates the state of the sockets.
+func NewState() *State {
+	return &State{sockets: map[live.SocketID]*socketState{}}
+}
+
+// socketState is the queue of a socket, from its connection to its close.
+type socketState struct {
+	st     *State
+	events chan struct{}
+	done   chan struct{}
+	// fail closes the connection after a cycle failed.
+	fail func(error)
+
+	// running is the goroutine running the tasks, close waits for it.
+	running sync.WaitGroup
+
+	mu     sync.Mutex
+	tasks  []func()
+	busy   bool
+	ready  bool
+	closed bool
+
+	// ctx, sock, engine and handler are those of the mounted socket,
+	// set before the queue runs.
+	ctx     context.Context
+	sock    live.Socket
+	engine  live.Engine
+	handler *Handler
+}
+
+// open creates the queue of a connection, fail closes it. The queue runs
+// once the socket is mounted and ready.
+func (st *State) open(fail func(error)) *socketState {
+	return &socketState{st: st, events: make(chan struct{}, stateEvents), done: make(chan struct{}), fail: fail}
+}
+
+// mount registers the mounted socket s of the queue, which the engine
+// serves with handler h.
+func (ss *socketState) mount(ctx context.Context, s live.Socket, engine live.Engine, h *Handler) {
+	ss.mu.Lock()
+	ss.ctx, ss.sock, ss.engine, ss.handler = ctx, s, engine, h
+	ss.mu.Unlock()
+	ss.st.mu.Lock()
+	ss.st.sockets[s.ID()] = ss
+	ss.st.mu.Unlock()
+}
+
+// start runs the queue, after the first render of the socket.
+func (ss *socketState) start() {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.ready = true
+	ss.run()
+}
+
+// close drops the tasks left and waits for the one running, the socket is
+// gone.
+func (ss *socketState) close() {
+	ss.mu.Lock()
+	if ss.closed {
+		ss.mu.Unlock()
+		return
+	}
+	ss.closed = true
+	ss.tasks = nil
+	sock := ss.sock
+	close(ss.done)
+	ss.mu.Unlock()
+	ss.running.Wait()
+	if sock != nil {
+		ss.st.mu.Lock()
+		if ss.st.sockets[sock.ID()] == ss {
+			delete(ss.st.sockets, sock.ID())
+		}
+		ss.st.mu.Unlock()
+	}
+}
+
+// queue adds a task, run after those queued before. It reports false once
+// the socket is gone.
+func (ss *socketState) queue(task func()) bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.closed {
+		return false
+	}
+	ss.tasks = append(ss.tasks, task)
+	ss.run()
+	return true
+}
+
+// run starts the goroutine running the tasks, unless it runs or the
+// socket isn't ready. The caller holds mu.
+func (ss *socketState) run() {
+	if ss.busy || !ss.ready || ss.closed || len(ss.tasks) == 0 {
+		return
+	}
+	ss.busy = true
+	ss.running.Add(1)
+	go func() {
+		defer ss.running.Done()
+		for {
+			ss.mu.Lock()
+			if len(ss.tasks) == 0 || ss.closed {
+				ss.busy = false
+				ss.mu.Unlock()
+				return
+			}
+			task := ss.tasks[0]
+			ss.tasks[0] = nil
+			ss.tasks = ss.tasks[1:]
+			ss.mu.Unlock()
+			task()
+		}
+	}()
+}
+
+// event queues an event of the client. It waits while stateEvents of them
+// are queued, which holds up the reading of the connection.
+func (ss *socketState) event(m live.Event) {
+	select {
+	case ss.events <- struct{}{}:
+	case <-ss.done:
+		return
+	}
+	if !ss.queue(func() {
+		defer func() { <-ss.events }()
+		ss.handleEvent(m)
+	}) {
+		<-ss.events
+	}
+}
+
+// handleEvent runs the cycle of an event of the client, as the engine
+// would: the error of the handler is sent to the client, the event is
+// acknowledged after the render.
+func (ss *socketState) handleEvent(m live.Event) {
+	var err error
+	if m.T == live.EventParams {
+		err = ss.engine.CallParams(ss.ctx, ss.sock, m)
+	} else {
+		err = ss.engine.CallEvent(ss.ctx, m.T, ss.sock, m)
+	}
+	switch {
+	case errors.Is(err, live.ErrNoEventHandler):
+		log.Println("event error", m, err)
+	case err != nil:
+		ss.sock.Send(live.EventError, live.ErrorEvent{Source: m, Err: err.Error()})
+	}
+	if !ss.render() {
+		return
+	}
+	ss.sock.Send(live.EventAck, nil, live.WithID(m.ID))
+}
+
+// handleSelf runs the cycle of a self event.
+func (ss *socketState) handleSelf(event string, data interface{}) {
+	handler, ok := ss.handler.selfs[event]
+	if !ok {
+		log.Printf("no self event handler for %s", event)
+		return
+	}
+	assigns, err := handler(ss.ctx, ss.sock, data)
+	if err != nil {
+		log.Printf("self event %s: %v", event, err)
+	} else {
+		ss.sock.Assign(assigns)
+	}
+	ss.render()
+}
+
+// render renders the socket, sending the diff to the client and keeping
+// the render for the next one. A failed render closes the connection.
+func (ss *socketState) render() bool {
+	render, err := live.RenderSocket(ss.ctx, ss.engine, ss.sock)
+	if err != nil {
+		ss.fail(err)
+		return false
+	}
+	ss.sock.UpdateRender(render)
+	return true
+}
+
+// get returns the queue of the connected socket s, nil when it isn't
+// connected or gone.
+func (st *State) get(s live.Socket) *socketState {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.sockets[s.ID()]
+}
+
+// Send sends the self event to s without waiting for it, after the events
+// queued for s before. The events of a socket gone are dropped.
+func (st *State) Send(s live.Socket, event string, data interface{}) {
+	if ss := st.get(s); ss != nil {
+		ss.queue(func() { ss.handleSelf(event, data) })
+	}
+}
+
+// Patch sends the patch event to s, see Handler.HandlePatch.
+func (st *State) Patch(s live.Socket, event string, data interface{}) {
+	if ss := st.get(s); ss != nil {
+		ss.queue(func() {
+			if err := ss.handler.patch(ss.ctx, ss.sock, event, data); err != nil {
+				log.Println("patch error:", err)
+			}
+		})
+	}
+}
+
+// Update changes the model of s with fn in its queue and renders it,
+// without waiting for it. A failing fn leaves the model unchanged.
+func (st *State) Update(s live.Socket, fn func(assigns interface{}) (interface{}, error)) {
+	if ss := st.get(s); ss != nil {
+		ss.queue(func() {
+			assigns, err := fn(ss.sock.Assigns())
+			if err != nil {
+				log.Printf("update of socket %s: %v", ss.sock.ID(), err)
+				return
+			}
+			ss.sock.Assign(assigns)
+			ss.render()
+		})
+	}
+}
+
+// Read runs fn with the model of s in its queue and waits for it. It
+// reports false when s isn't connected or goes before fn runs. A handler
+// doesn't call it, it would wait for its own socket, or deadlock with
+// another socket reading its model.
+func (st *State) Read(s live.Socket, fn func(assigns interface{})) bool {
+	ss := st.get(s)
+	if ss == nil {
+		return false
+	}
+	read := make(chan struct{})
+	if !ss.queue(func() {
+		fn(ss.sock.Assigns())
+		close(read)
+	}) {
+		return false
+	}
+	select {
+	case <-read:
+		return true
+	case <-ss.done:
+		return false
+	}
+}
+
+// broadcast returns the broadcast handler of the engine of a page, sending
+// the self event to the queues of the sockets it gets from sockets.
+func (st *State) broadcast(sockets func() []live.Socket) live.BroadcastHandler {
+	return func(ctx context.Context, _ live.Engine, msg live.Event) {
+		for _, s := range sockets() {
+			st.Send(s, msg.T, msg.SelfData)
+		}
+	}
+}
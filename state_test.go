@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jfyne/live"
+)
+
+// seenModel is the model of the test page, the data of its "seen" events.
+type seenModel struct {
+	Seen []int
+	// running counts the cycles of the socket running.
+	running int32
+}
+
+// statePage returns the handler and the engine of a page counting its
+// "seen" self and client events, failing t when two cycles of a socket
+// overlap. With count the page shows the number of events, each event then
+// sends a patch: a socket holds 16 messages, which nobody reads here.
+func statePage(t *testing.T, st *State, count bool) (*Handler, live.Engine) {
+	seen := func(s live.Socket, n int) (interface{}, error) {
+		m := s.Assigns().(*seenModel)
+		if atomic.AddInt32(&m.running, 1) != 1 {
+			t.Error("two cycles of a socket ran at once")
+		}
+		defer atomic.AddInt32(&m.running, -1)
+		m.Seen = append(m.Seen, n)
+		return m, nil
+	}
+	h := NewHandler()
+	h.UseState(st)
+	h.HandleRender(func(ctx context.Context, rc *live.RenderContext) (io.Reader, error) {
+		if !count {
+			return strings.NewReader("<div></div>"), nil
+		}
+		return strings.NewReader(fmt.Sprintf("<div>%d</div>", len(rc.Assigns.(*seenModel).Seen))), nil
+	})
+	h.HandleSelf("seen", func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		return seen(s, data.(int))
+	})
+	h.HandleEvent("seen", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		return seen(s, p.Int("n"))
+	})
+	return h, live.NewHttpHandler(live.NewCookieStore("test", []byte("test")), h)
+}
+
+// connectState mounts a connected socket of the page on st and starts its
+// queue, as the connection does.
+func connectState(t *testing.T, st *State, h *Handler, engine live.Engine) *socketState {
+	ss := st.open(func(err error) { t.Errorf("cycle failed: %v", err) })
+	s := live.NewHttpSocket(live.NewSession(), engine, true)
+	s.Assign(&seenModel{})
+	ctx := context.Background()
+	ss.mount(ctx, s, engine, h)
+	render, err := live.RenderSocket(ctx, engine, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.UpdateRender(render)
+	ss.start()
+	t.Cleanup(ss.close)
+	return ss
+}
+
+// seenOf returns the model of the socket of ss once its queue ran the
+// events sent before.
+func seenOf(t *testing.T, st *State, ss *socketState) []int {
+	var seen []int
+	if !st.Read(ss.sock, func(assigns interface{}) {
+		seen = append(seen, assigns.(*seenModel).Seen...)
+	}) {
+		t.Fatal("the socket is gone")
+	}
+	return seen
+}
+
+// TestStateSend sends the self events of a socket from several goroutines:
+// they run one at a time, those of a goroutine in the order it sent them.
+func TestStateSend(t *testing.T) {
+	st := NewState()
+	h, engine := statePage(t, st, false)
+	ss := connectState(t, st, h, engine)
+
+	const senders, events = 4, 100
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for n := 0; n < events; n++ {
+				st.Send(ss.sock, "seen", i*events+n)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	seen := seenOf(t, st, ss)
+	if len(seen) != senders*events {
+		t.Fatalf("ran %d events, want %d", len(seen), senders*events)
+	}
+	next := make([]int, senders)
+	for _, n := range seen {
+		i := n / events
+		if n%events != next[i] {
+			t.Fatalf("event %d of sender %d ran after %d", n%events, i, next[i]-1)
+		}
+		next[i]++
+	}
+}
+
+// TestStateEvents queues the events of the client between the self events:
+// they run in the order they came, each acknowledged after its render.
+func TestStateEvents(t *testing.T) {
+	st := NewState()
+	h, engine := statePage(t, st, true)
+	ss := connectState(t, st, h, engine)
+
+	// 10 patches and 5 acks, under the 16 messages a socket holds.
+	const events = 10
+	for n := 0; n < events; n++ {
+		if n%2 == 0 {
+			ss.event(live.Event{T: "seen", ID: n, Data: []byte(fmt.Sprintf(`{"n":%d}`, n))})
+		} else {
+			st.Send(ss.sock, "seen", n)
+		}
+	}
+	seen := seenOf(t, st, ss)
+	if len(seen) != events {
+		t.Fatalf("ran %d events, want %d", len(seen), events)
+	}
+	for n, got := range seen {
+		if got != n {
+			t.Fatalf("ran %v, want them in order", seen)
+		}
+	}
+
+	// Every event renders a patch, the acks follow those of their events.
+	var sent []string
+	for msgs := ss.sock.Messages(); len(msgs) > 0; {
+		m := <-msgs
+		if m.T == live.EventAck {
+			sent = append(sent, fmt.Sprintf("ack %d", m.ID))
+		} else {
+			sent = append(sent, m.T)
+		}
+	}
+	var want []string
+	for n := 0; n < events; n++ {
+		want = append(want, live.EventPatch)
+		if n%2 == 0 {
+			want = append(want, fmt.Sprintf("ack %d", n))
+		}
+	}
+	if strings.Join(sent, ", ") != strings.Join(want, ", ") {
+		t.Errorf("sent %v, want %v", sent, want)
+	}
+}
+
+// TestStateBroadcast broadcasts to the sockets of a page: every socket
+// connected runs the events in order, those gone are left out.
+func TestStateBroadcast(t *testing.T) {
+	st := NewState()
+	h, engine := statePage(t, st, false)
+	var queues []*socketState
+	for i := 0; i < 3; i++ {
+		queues = append(queues, connectState(t, st, h, engine))
+	}
+	gone := queues[2]
+	gone.close()
+	broadcast := st.broadcast(func() []live.Socket {
+		var sockets []live.Socket
+		for _, ss := range queues {
+			sockets = append(sockets, ss.sock)
+		}
+		return sockets
+	})
+
+	for n := 0; n < 50; n++ {
+		broadcast(context.Background(), engine, live.Event{T: "seen", SelfData: n})
+	}
+	for i, ss := range queues[:2] {
+		seen := seenOf(t, st, ss)
+		if len(seen) != 50 {
+			t.Fatalf("socket %d ran %d events, want 50", i, len(seen))
+		}
+		for n, got := range seen {
+			if got != n {
+				t.Fatalf("socket %d ran %v, want 0 to 49 in order", i, seen)
+			}
+		}
+	}
+	if st.Read(gone.sock, func(interface{}) { t.Error("read a socket gone") }) {
+		t.Error("read a socket gone")
+	}
+}
@@ -0,0 +1,25 @@
+// Page behaviour shared by every live page, see templates/layout.html.
+
+// Drop clicks and submits on elements whose event is still in
+// flight, so a double click doesn't apply twice.
+document.addEventListener("click", (e) => {
+	if (e.target.closest && e.target.closest(".live-click-loading, form.live-submit-loading")) {
+		e.preventDefault();
+		e.stopImmediatePropagation();
+	}
+}, true);
+// Window shortcuts don't apply while typing in a form field.
+window.addEventListener("keyup", (e) => {
+	if (e.target.closest && e.target.closest("input, textarea, select")) {
+		e.stopImmediatePropagation();
+	}
+}, true);
+document.addEventListener("submit", (e) => {
+	if (e.target.classList.contains("live-submit-loading")) {
+		e.preventDefault();
+		e.stopImmediatePropagation();
+	}
+}, true);
+
+// The hooks in static/hooks add themselves, they load after this script.
+window.Hooks = {};
@@ -0,0 +1,31 @@
+// Lets the cards of the board be dragged between and within the columns.
+// A drop reports the card, the column and the index it was dropped at;
+// the server moves it and re-renders every board.
+window.Hooks["board"] = {
+	mounted: function() {
+		const el = this.el;
+		el.addEventListener("dragstart", (e) => {
+			const card = e.target.closest("[data-card]");
+			if (!card) return;
+			e.dataTransfer.setData("text/plain", card.dataset.card);
+			e.dataTransfer.effectAllowed = "move";
+		});
+		el.addEventListener("dragover", (e) => {
+			if (e.target.closest("[data-column]")) e.preventDefault();
+		});
+		el.addEventListener("drop", (e) => {
+			const column = e.target.closest("[data-column]");
+			if (!column) return;
+			e.preventDefault();
+			const card = e.dataTransfer.getData("text/plain");
+			// Drop before the first card whose middle is below the pointer.
+			const cards = Array.from(column.querySelectorAll("[data-card]")).filter((c) => c.dataset.card !== card);
+			let index = cards.findIndex((c) => {
+				const r = c.getBoundingClientRect();
+				return e.clientY < r.top + r.height / 2;
+			});
+			if (index < 0) index = cards.length;
+			window.Live.send("board-move", {card: card, column: column.dataset.column, index: index});
+		});
+	}
+};
@@ -0,0 +1,83 @@
+// Runs the WebRTC call of the call page. The live socket is the signaling
+// channel: call-signal sends the offer, answer and ICE candidates to the
+// server, which hands them to the other peer of the room. The server says
+// with call-peer when a peer is there and whether this side makes the
+// offer.
+window.Hooks["call"] = {
+	mounted: function() {
+		const local = this.el.querySelector("[data-local]");
+		const remote = this.el.querySelector("[data-remote]");
+		let pc = null, stream = null, pending = [];
+
+		const signal = (kind, data) => window.Live.send("call-signal", {kind: kind, data: JSON.stringify(data)});
+		const close = () => {
+			if (pc) pc.close();
+			pc = null;
+			pending = [];
+			remote.srcObject = null;
+		};
+		// connect creates the peer connection, with the camera and the
+		// microphone when the browser allows them.
+		const connect = async () => {
+			close();
+			pc = new RTCPeerConnection({iceServers: [{urls: "stun:stun.l.google.com:19302"}]});
+			pc.onicecandidate = (e) => { if (e.candidate) signal("candidate", e.candidate); };
+			pc.ontrack = (e) => { remote.srcObject = e.streams[0]; };
+			if (!stream) {
+				try {
+					stream = await navigator.mediaDevices.getUserMedia({video: true, audio: true});
+					local.srcObject = stream;
+				} catch (err) {
+					console.warn("call: no camera", err);
+				}
+			}
+			if (stream) {
+				stream.getTracks().forEach((t) => pc.addTrack(t, stream));
+			} else {
+				pc.addTransceiver("video", {direction: "recvonly"});
+				pc.addTransceiver("audio", {direction: "recvonly"});
+			}
+			return pc;
+		};
+
+		this.handleEvent("call-peer", async (data) => {
+			if (!data.peer) {
+				close();
+				return;
+			}
+			if (data.offer) {
+				const conn = await connect();
+				await conn.setLocalDescription(await conn.createOffer());
+				signal("offer", conn.localDescription);
+			}
+		});
+		this.handleEvent("call-signal", async (s) => {
+			const data = JSON.parse(s.data);
+			if (s.kind === "offer") {
+				const conn = await connect();
+				await conn.setRemoteDescription(data);
+				await conn.setLocalDescription(await conn.createAnswer());
+				signal("answer", conn.localDescription);
+				pending.forEach((c) => conn.addIceCandidate(c));
+				pending = [];
+			} else if (s.kind === "answer" && pc) {
+				await pc.setRemoteDescription(data);
+				pending.forEach((c) => pc.addIceCandidate(c));
+				pending = [];
+			} else if (s.kind === "candidate") {
+				// Candidates may come before the description they belong to.
+				if (pc && pc.remoteDescription) pc.addIceCandidate(data);
+				else pending.push(data);
+			}
+		});
+		this.handleEvent("call-hangup", close);
+		this.stop = () => {
+			close();
+			if (stream) stream.getTracks().forEach((t) => t.stop());
+		};
+		window.Live.send("call-ready", {});
+	},
+	destroyed: function() {
+		this.stop();
+	}
+};
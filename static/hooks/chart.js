@@ -0,0 +1,33 @@
+// Draws the temperature chart of a control, filled by the chart-points
+// and chart-point events, see SendChart and PushPoint.
+window.Hooks["chart"] = {
+	mounted: function() {
+		const id = this.el.dataset.chart, max = 60;
+		const chart = new Chart(this.el, {
+			type: "line",
+			data: {labels: [], datasets: [{label: this.el.dataset.label, data: [], tension: 0.3}]},
+			options: {animation: {duration: 300}, scales: {y: {suggestedMin: 15, suggestedMax: 30}}}
+		});
+		const add = (p) => {
+			chart.data.labels.push(new Date(p.t).toLocaleTimeString());
+			chart.data.datasets[0].data.push(p.v);
+			if (chart.data.labels.length > max) {
+				chart.data.labels.shift();
+				chart.data.datasets[0].data.shift();
+			}
+		};
+		this.handleEvent("chart-points", (data) => {
+			if (data.chart !== id) return;
+			chart.data.labels = [];
+			chart.data.datasets[0].data = [];
+			(data.points || []).forEach(add);
+			chart.update();
+		});
+		this.handleEvent("chart-point", (p) => {
+			if (p.chart !== id) return;
+			add(p);
+			chart.update();
+		});
+		window.Live.send("chart-ready", {chart: id});
+	}
+};
@@ -0,0 +1,62 @@
+// Draws on the shared whiteboard. A stroke is previewed while it's drawn
+// and sent with draw-stroke once the pointer is released; the server
+// sends it back with every other user's strokes as draw-stroke, and the
+// whole drawing as draw-strokes after an undo or clear.
+window.Hooks["draw"] = {
+	mounted: function() {
+		const canvas = this.el, ctx = canvas.getContext("2d");
+		let pen = {color: "#212529", width: 4}, points = null, strokes = [];
+		ctx.lineCap = "round";
+		ctx.lineJoin = "round";
+
+		const stroke = (s) => {
+			if (!s.points.length) return;
+			ctx.strokeStyle = s.color;
+			ctx.lineWidth = s.width;
+			ctx.beginPath();
+			ctx.moveTo(s.points[0][0] * canvas.width, s.points[0][1] * canvas.height);
+			s.points.forEach((p) => ctx.lineTo(p[0] * canvas.width, p[1] * canvas.height));
+			ctx.stroke();
+		};
+		const redraw = () => {
+			ctx.clearRect(0, 0, canvas.width, canvas.height);
+			strokes.forEach(stroke);
+		};
+		// point returns the pointer position relative to the canvas.
+		const point = (e) => {
+			const r = canvas.getBoundingClientRect();
+			return [(e.clientX - r.left) / r.width, (e.clientY - r.top) / r.height];
+		};
+
+		canvas.addEventListener("pointerdown", (e) => {
+			canvas.setPointerCapture(e.pointerId);
+			points = [point(e)];
+		});
+		canvas.addEventListener("pointermove", (e) => {
+			if (!points || points.length >= 1000) return;
+			const p = point(e), last = points[points.length - 1];
+			// Skip the moves of less than a pixel or two.
+			if (Math.hypot((p[0] - last[0]) * canvas.width, (p[1] - last[1]) * canvas.height) < 2) return;
+			points.push(p);
+			stroke({color: pen.color, width: pen.width, points: [last, p]});
+		});
+		const end = () => {
+			if (!points) return;
+			window.Live.send("draw-stroke", {points: points});
+			points = null;
+		};
+		canvas.addEventListener("pointerup", end);
+		canvas.addEventListener("pointercancel", end);
+
+		this.handleEvent("draw-pen", (data) => pen = data);
+		this.handleEvent("draw-stroke", (s) => {
+			strokes.push(s);
+			stroke(s);
+		});
+		this.handleEvent("draw-strokes", (data) => {
+			strokes = data.strokes || [];
+			redraw();
+		});
+		window.Live.send("draw-ready", {});
+	}
+};
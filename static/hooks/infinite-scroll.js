@@ -0,0 +1,21 @@
+// Sends load-more when its element, at the end of a list, comes into view,
+// and again after posts-loaded while it's still in view and there are more.
+window.Hooks["infinite-scroll"] = {
+	mounted: function() {
+		let visible = false, loading = false, more = true;
+		const load = () => {
+			if (!visible || loading || !more) return;
+			loading = true;
+			window.Live.send("load-more", {});
+		};
+		new IntersectionObserver((entries) => {
+			visible = entries[0].isIntersecting;
+			load();
+		}, {rootMargin: "200px"}).observe(this.el);
+		this.handleEvent("posts-loaded", (data) => {
+			loading = false;
+			more = data.more;
+			load();
+		});
+	}
+};
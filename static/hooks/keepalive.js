@@ -0,0 +1,13 @@
+// Answers the server pings and shows why the server closed the socket.
+window.Hooks["keepalive"] = {
+	mounted: function() {
+		this.handleEvent("ping", () => window.Live.send("pong", {}));
+		this.handleEvent("disconnected", (data) => {
+			const notice = document.createElement("div");
+			notice.className = "alert alert-secondary text-center";
+			notice.setAttribute("role", "alert");
+			notice.textContent = data.reason;
+			document.body.prepend(notice);
+		});
+	}
+};
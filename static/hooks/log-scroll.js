@@ -0,0 +1,15 @@
+// Keeps the log scrolled to the latest line while it's at the bottom, so
+// scrolling up to read older lines isn't undone by the new ones.
+window.Hooks["log-scroll"] = {
+	mounted: function() {
+		const el = this.el;
+		let bottom = true;
+		el.addEventListener("scroll", () => {
+			bottom = el.scrollHeight - el.scrollTop - el.clientHeight < 20;
+		});
+		new MutationObserver(() => {
+			if (bottom) el.scrollTop = el.scrollHeight;
+		}).observe(el, {childList: true, subtree: true});
+		el.scrollTop = el.scrollHeight;
+	}
+};
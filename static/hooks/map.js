@@ -0,0 +1,25 @@
+// Shows the devices on a Leaflet map. The server sends map-positions with
+// every device and the one the map follows; markers are created the first
+// time a device shows up and moved after.
+window.Hooks["map"] = {
+	mounted: function() {
+		const map = L.map(this.el).setView([Number(this.el.dataset.lat), Number(this.el.dataset.lng)], 13);
+		L.tileLayer("https://tile.openstreetmap.org/{z}/{x}/{y}.png", {
+			maxZoom: 19,
+			attribution: "&copy; <a href=\"https://www.openstreetmap.org/copyright\">OpenStreetMap</a>"
+		}).addTo(map);
+		const markers = {};
+		this.handleEvent("map-positions", (data) => {
+			(data.devices || []).forEach((d) => {
+				if (!markers[d.id]) {
+					markers[d.id] = L.marker([d.lat, d.lng], {title: d.name}).bindTooltip(d.name).addTo(map);
+				}
+				markers[d.id].setLatLng([d.lat, d.lng]);
+			});
+			if (data.follow && markers[data.follow]) {
+				map.panTo(markers[data.follow].getLatLng());
+			}
+		});
+		window.Live.send("map-ready", {});
+	}
+};
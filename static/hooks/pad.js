@@ -0,0 +1,72 @@
+// Keeps the textarea of the shared pad in sync. The hook sends one edit at
+// a time, made on the last text of the server it knows (the shadow), and
+// rebases the edits of others onto what was typed meanwhile. Positions
+// count UTF-16 code units on both ends, see PadOp.
+window.Hooks["pad"] = {
+	mounted: function() {
+		const el = this.el;
+		let shadow = "", base = -1, me = "", pending = false, queue = {};
+
+		// diff returns the single edit turning a into b.
+		const diff = (a, b) => {
+			let start = 0, end = 0;
+			while (start < a.length && start < b.length && a[start] === b[start]) start++;
+			while (end < a.length - start && end < b.length - start && a[a.length - 1 - end] === b[b.length - 1 - end]) end++;
+			return {pos: start, del: a.length - start - end, ins: b.slice(start, b.length - end)};
+		};
+		const apply = (text, op) => text.slice(0, op.pos) + op.ins + text.slice(op.pos + op.del);
+		const movePos = (pos, op) => {
+			if (pos <= op.pos) return pos;
+			if (pos >= op.pos + op.del) return pos + op.ins.length - op.del;
+			return op.pos + op.ins.length;
+		};
+		const transform = (op, prev) => {
+			const start = movePos(op.pos, prev), end = Math.max(start, movePos(op.pos + op.del, prev));
+			return {pos: start, del: end - start, ins: op.ins};
+		};
+
+		const flush = () => {
+			if (pending || base < 0 || el.value === shadow) return;
+			const op = diff(shadow, el.value);
+			pending = true;
+			window.Live.send("pad-edit", {base: base, pos: op.pos, del: op.del, ins: op.ins});
+		};
+		const drain = () => {
+			while (queue[base + 1]) {
+				const u = queue[base + 1];
+				delete queue[base + 1];
+				if (u.author === me) {
+					pending = false;
+				} else {
+					const op = transform(u.op, diff(shadow, el.value));
+					const start = el.selectionStart, end = el.selectionEnd;
+					el.value = apply(el.value, op);
+					el.setSelectionRange(movePos(start, op), movePos(end, op));
+				}
+				shadow = apply(shadow, u.op);
+				base = u.version;
+			}
+			flush();
+		};
+
+		this.handleEvent("pad-text", (data) => {
+			shadow = el.value = data.text;
+			base = data.version;
+			me = data.me;
+			pending = false;
+			Object.keys(queue).forEach((v) => { if (v <= base) delete queue[v]; });
+			el.disabled = false;
+			drain();
+		});
+		this.handleEvent("pad-op", (u) => {
+			queue[u.version] = u;
+			if (base >= 0) drain();
+		});
+
+		el.addEventListener("input", flush);
+		const cursor = () => window.Live.send("pad-cursor", {pos: el.selectionStart});
+		el.addEventListener("keyup", cursor);
+		el.addEventListener("click", cursor);
+		window.Live.send("pad-ready", {});
+	}
+};
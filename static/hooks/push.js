@@ -0,0 +1,40 @@
+// Subscribes the browser to the push notifications with the VAPID key of
+// data-key, through the service worker of data-worker, and tells the
+// server with push-subscribe; the data-push="off" button sends
+// push-unsubscribe. A browser subscribed before is sent again on mount, as
+// the server may have lost it.
+window.Hooks["push"] = {
+	mounted: function() {
+		if (!("serviceWorker" in navigator) || !("PushManager" in window)) {
+			return;
+		}
+		const registration = navigator.serviceWorker.register(this.el.dataset.worker);
+		const send = (sub) => {
+			const json = sub.toJSON();
+			window.Live.send("push-subscribe", {endpoint: json.endpoint, p256dh: json.keys.p256dh, auth: json.keys.auth});
+		};
+		registration.then((r) => r.pushManager.getSubscription()).then((sub) => {
+			if (sub) send(sub);
+		});
+		this.el.addEventListener("click", (e) => {
+			const button = e.target.closest("[data-push]");
+			if (!button) return;
+			registration.then((r) => {
+				if (button.dataset.push === "on") {
+					return r.pushManager.subscribe({userVisibleOnly: true, applicationServerKey: decodeKey(this.el.dataset.key)}).then(send);
+				}
+				return r.pushManager.getSubscription().then((sub) => {
+					if (!sub) return;
+					window.Live.send("push-unsubscribe", {endpoint: sub.endpoint});
+					return sub.unsubscribe();
+				});
+			}).catch((err) => console.warn("push:", err));
+		});
+	}
+};
+
+// decodeKey decodes the base64url VAPID key of the server.
+function decodeKey(key) {
+	const base64 = (key + "=".repeat((4 - key.length % 4) % 4)).replace(/-/g, "+").replace(/_/g, "/");
+	return Uint8Array.from(atob(base64), (c) => c.charCodeAt(0));
+}
@@ -0,0 +1,13 @@
+// Replaces the text of the regions the server patches without a render,
+// the elements with a data-region attribute.
+window.Hooks["regions"] = {
+	mounted: function() {
+		this.handleEvent("regions", (regions) => {
+			for (const [name, text] of Object.entries(regions)) {
+				document.querySelectorAll(`[data-region="${CSS.escape(name)}"]`).forEach((el) => {
+					el.textContent = text;
+				});
+			}
+		});
+	}
+};
@@ -0,0 +1,17 @@
+// Binds the keyboard shortcuts of the page, see Page.AddShortcut. A
+// shortcut either focuses an element or sends an event.
+window.Hooks["shortcuts"] = {
+	mounted: function() {
+		const shortcuts = JSON.parse(this.el.dataset.shortcuts);
+		window.addEventListener("keyup", (e) => {
+			const s = shortcuts.find((s) => s.key === e.key);
+			if (!s || e.ctrlKey || e.altKey || e.metaKey) return;
+			if (s.focus) {
+				const el = document.querySelector(s.focus);
+				if (el) el.focus();
+			} else {
+				window.Live.send(s.event, s.params || {});
+			}
+		});
+	}
+};
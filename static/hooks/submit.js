@@ -0,0 +1,8 @@
+// Clears the first input of a form once it's submitted.
+window.Hooks["submit"] = {
+	mounted: function() {
+		this.el.addEventListener("submit", () => {
+			this.el.querySelector("input").value = "";
+		});
+	}
+};
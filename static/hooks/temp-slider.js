@@ -0,0 +1,17 @@
+// Keeps the slider of a temperature control at its setpoint. The server
+// sends the value on every change, and asks for it once mounted, since the
+// slider isn't re-rendered. Values arriving while it's dragged are skipped.
+window.Hooks["temp-slider"] = {
+	mounted: function() {
+		const id = this.el.dataset.id;
+		let dragging = false;
+		this.el.addEventListener("pointerdown", () => dragging = true);
+		this.el.addEventListener("pointerup", () => dragging = false);
+		this.el.addEventListener("pointercancel", () => dragging = false);
+		this.handleEvent("temp-slider", (data) => {
+			if (data.id !== id || dragging) return;
+			this.el.value = data.temperature;
+		});
+		window.Live.send("temp-slider-ready", {id: id});
+	}
+};
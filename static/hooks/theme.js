@@ -0,0 +1,8 @@
+// Stores the toggled theme in the session, so it survives a reload.
+window.Hooks["theme"] = {
+	mounted: function() {
+		this.handleEvent("theme", (data) => {
+			fetch("/session/theme", {method: "POST", body: new URLSearchParams(data)});
+		});
+	}
+};
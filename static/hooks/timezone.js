@@ -0,0 +1,6 @@
+// Tells the server the timezone of the browser.
+window.Hooks["timezone"] = {
+	mounted: function() {
+		window.Live.send("timezone", {timezone: Intl.DateTimeFormat().resolvedOptions().timeZone});
+	}
+};
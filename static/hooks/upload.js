@@ -0,0 +1,32 @@
+// Uploads the files picked in its file input in chunks. Every file is
+// announced with upload-start, then the server asks for one chunk after
+// the other with upload-next until it sends upload-done.
+window.Hooks["upload"] = {
+	mounted: function() {
+		const files = {};
+		let seq = 0;
+		this.el.addEventListener("change", () => {
+			for (const file of this.el.files) {
+				const ref = "u" + (++seq);
+				files[ref] = file;
+				window.Live.send("upload-start", {ref: ref, name: file.name, type: file.type, size: file.size});
+			}
+			this.el.value = "";
+		});
+		this.handleEvent("upload-next", (data) => {
+			const file = files[data.ref];
+			if (!file) return;
+			const reader = new FileReader();
+			reader.onload = () => {
+				// Strip the "data:...;base64," prefix of the data URL.
+				const url = reader.result;
+				window.Live.send("upload-chunk", {ref: data.ref, offset: data.offset, data: url.slice(url.indexOf(",") + 1)});
+			};
+			reader.onerror = () => window.Live.send("upload-cancel", {ref: data.ref});
+			reader.readAsDataURL(file.slice(data.offset, data.offset + data.size));
+		});
+		this.handleEvent("upload-done", (data) => {
+			delete files[data.ref];
+		});
+	}
+};
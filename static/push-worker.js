@@ -0,0 +1,23 @@
+// The service worker of the push notifications, see push.go: it shows the
+// messages of the server, also with the tab closed, and opens the app when
+// one is clicked.
+self.addEventListener("push", (event) => {
+	const msg = event.data ? event.data.json() : {};
+	event.waitUntil(self.registration.showNotification(msg.title || "Go Live", {
+		body: msg.body,
+		tag: msg.tag,
+		icon: "/favicon.ico",
+		data: {url: msg.url || "/"},
+	}));
+});
+
+self.addEventListener("notificationclick", (event) => {
+	event.notification.close();
+	const url = event.notification.data.url;
+	event.waitUntil(clients.matchAll({type: "window", includeUncontrolled: true}).then((windows) => {
+		for (const w of windows) {
+			if (new URL(w.url).pathname === url && "focus" in w) return w.focus();
+		}
+		return clients.openWindow(url);
+	}));
+});
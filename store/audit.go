@@ -0,0 +1,63 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// AuditEntry is a change a user made, as kept in the audit log.
+type AuditEntry struct {
+	ID   int64
+	Time time.Time
+	// Actor is the name of the user, the admin user for the admin actions.
+	Actor string
+	// Session is the session of the user, empty for the admin actions.
+	Session string
+	// Action is what was done, such as "setpoint" or "socket-disconnect".
+	Action string
+	// Target is what it was done to, a zone or a socket.
+	Target string
+	// Detail tells the change, such as the old and new setpoint.
+	Detail string
+}
+
+// AuditFilter selects the entries of the audit log, the empty fields select
+// every entry.
+type AuditFilter struct {
+	// Actor and Target match the entries containing them, ignoring case.
+	Actor  string
+	Target string
+	// Action matches the entries with that action.
+	Action string
+}
+
+// Match reports whether e is selected by f.
+func (f AuditFilter) Match(e AuditEntry) bool {
+	contains := func(s, sub string) bool {
+		return strings.Contains(strings.ToLower(s), strings.ToLower(sub))
+	}
+	return contains(e.Actor, f.Actor) && contains(e.Target, f.Target) && (f.Action == "" || e.Action == f.Action)
+}
+
+// likePatterns returns the LIKE patterns of the SQL databases matching the
+// actor, action and target of f.
+func (f AuditFilter) likePatterns() (actor, action, target string) {
+	escape := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace
+	actor = "%" + escape(f.Actor) + "%"
+	target = "%" + escape(f.Target) + "%"
+	action = escape(f.Action)
+	if f.Action == "" {
+		action = "%"
+	}
+	return actor, action, target
+}
+
+// AuditRepo keeps the audit log, append only.
+type AuditRepo interface {
+	// Add stores e and returns it with its ID.
+	Add(ctx context.Context, e AuditEntry) (AuditEntry, error)
+	// List returns up to n entries selected by f, newest first, after
+	// skipping the first skip ones, and the number of entries selected.
+	List(ctx context.Context, f AuditFilter, skip, n int) ([]AuditEntry, int, error)
+}
@@ -0,0 +1,282 @@
+package store
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// backupVersion is the format of the archives Backup writes.
+const backupVersion = 1
+
+// errStop ends an Each early.
+var errStop = errors.New("stop")
+
+// Manifest describes a backup archive, it is its first file.
+type Manifest struct {
+	Version int
+	Created time.Time
+	// Counts are the number of records of every file.
+	Counts map[string]int
+}
+
+// backupFiles are the files of an archive after the manifest, JSON lines
+// of the records.
+var backupFiles = []string{"zones.jsonl", "readings.jsonl", "messages.jsonl", "users.jsonl", "audit.jsonl", "events.jsonl"}
+
+// Backup writes every record of repos to w as a gzipped tar archive: a
+// manifest, then a JSON-lines file per repository. Any database can be
+// restored from it, whatever it was made from.
+func Backup(ctx context.Context, repos Repos, w io.Writer) (Manifest, error) {
+	m := Manifest{Version: backupVersion, Created: time.Now().UTC(), Counts: map[string]int{}}
+	all := time.Unix(0, 0)
+	end := time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// The files are built in memory first, tar needs their size upfront.
+	files := map[string]*bytes.Buffer{}
+	for _, name := range backupFiles {
+		files[name] = &bytes.Buffer{}
+		m.Counts[name] = 0
+	}
+	add := func(name string, v interface{}) error {
+		m.Counts[name]++
+		return json.NewEncoder(files[name]).Encode(v)
+	}
+	zones, err := repos.Thermostats.List(ctx)
+	if err != nil {
+		return m, err
+	}
+	for _, t := range zones {
+		if err := add("zones.jsonl", t); err != nil {
+			return m, err
+		}
+	}
+	if err := repos.Readings.Each(ctx, all, end, func(a Aggregate) error { return add("readings.jsonl", a) }); err != nil {
+		return m, err
+	}
+	if err := repos.Messages.Each(ctx, all, end, func(msg Message) error { return add("messages.jsonl", msg) }); err != nil {
+		return m, err
+	}
+	if err := repos.Users.Each(ctx, all, end, func(u User) error { return add("users.jsonl", u) }); err != nil {
+		return m, err
+	}
+	if err := eachAudit(ctx, repos.Audit, func(e AuditEntry) error { return add("audit.jsonl", e) }); err != nil {
+		return m, err
+	}
+	if err := eachEvent(ctx, repos.Events, func(e Event) error { return add("events.jsonl", e) }); err != nil {
+		return m, err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	manifest, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return m, err
+	}
+	write := func(name string, data []byte) error {
+		hdr := &tar.Header{Name: name, Mode: 0o600, Size: int64(len(data)), ModTime: m.Created}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	if err := write("manifest.json", manifest); err != nil {
+		return m, err
+	}
+	for _, name := range backupFiles {
+		if err := write(name, files[name].Bytes()); err != nil {
+			return m, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return m, err
+	}
+	return m, gz.Close()
+}
+
+// eachAudit calls fn with every entry of the audit log, oldest first, so
+// they are restored in order. An entry added meanwhile shifts the pages,
+// the entries seen already are skipped.
+func eachAudit(ctx context.Context, repo AuditRepo, fn func(AuditEntry) error) error {
+	var list []AuditEntry
+	seen := map[int64]bool{}
+	for skip := 0; ; skip += eachPage {
+		page, total, err := repo.List(ctx, AuditFilter{}, skip, eachPage)
+		if err != nil {
+			return err
+		}
+		for _, e := range page {
+			if !seen[e.ID] {
+				seen[e.ID] = true
+				list = append(list, e)
+			}
+		}
+		if skip+eachPage >= total {
+			break
+		}
+	}
+	for i := len(list) - 1; i >= 0; i-- {
+		if err := fn(list[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eachEvent calls fn with every event of the log, oldest first.
+func eachEvent(ctx context.Context, repo EventRepo, fn func(Event) error) error {
+	var after int64
+	for {
+		page, err := repo.After(ctx, after, eachPage)
+		if err != nil {
+			return err
+		}
+		for _, e := range page {
+			if err := fn(e); err != nil {
+				return err
+			}
+			after = e.ID
+		}
+		if len(page) < eachPage {
+			return nil
+		}
+	}
+}
+
+// Empty reports whether repos hold no records, the only database Restore
+// writes to.
+func Empty(ctx context.Context, repos Repos) (bool, error) {
+	zones, err := repos.Thermostats.List(ctx)
+	if err != nil || len(zones) > 0 {
+		return false, err
+	}
+	found := false
+	stop := func() error { found = true; return errStop }
+	all, end := time.Unix(0, 0), time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, each := range []func() error{
+		func() error { return repos.Readings.Each(ctx, all, end, func(Aggregate) error { return stop() }) },
+		func() error { return repos.Messages.Each(ctx, all, end, func(Message) error { return stop() }) },
+		func() error { return repos.Users.Each(ctx, all, end, func(User) error { return stop() }) },
+		func() error { return eachEvent(ctx, repos.Events, func(Event) error { return stop() }) },
+	} {
+		if err := each(); err != nil && !errors.Is(err, errStop) {
+			return false, err
+		}
+		if found {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Restore loads the archive of Backup from r into repos, which must be
+// empty. The messages, audit entries and events get new IDs in the order
+// they were made.
+func Restore(ctx context.Context, repos Repos, r io.Reader) (Manifest, error) {
+	var m Manifest
+	empty, err := Empty(ctx, repos)
+	if err != nil {
+		return m, err
+	}
+	if !empty {
+		return m, errors.New("the database isn't empty, restore into a new one")
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return m, fmt.Errorf("not a backup archive: %w", err)
+	}
+	tr := tar.NewReader(gz)
+	restored := map[string]int{}
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return m, err
+		}
+		if hdr.Name == "manifest.json" {
+			if err := json.NewDecoder(tr).Decode(&m); err != nil {
+				return m, fmt.Errorf("invalid manifest: %w", err)
+			}
+			if m.Version != backupVersion {
+				return m, fmt.Errorf("unknown backup version %d", m.Version)
+			}
+			continue
+		}
+		if m.Version == 0 {
+			return m, errors.New("the manifest isn't the first file of the archive")
+		}
+		lines := bufio.NewScanner(tr)
+		// A message or a reading is far below this.
+		lines.Buffer(nil, 1<<20)
+		for lines.Scan() {
+			if err := restoreRecord(ctx, repos, hdr.Name, lines.Bytes()); err != nil {
+				return m, fmt.Errorf("%s line %d: %w", hdr.Name, restored[hdr.Name]+1, err)
+			}
+			restored[hdr.Name]++
+		}
+		if err := lines.Err(); err != nil {
+			return m, fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+	}
+	for name, n := range m.Counts {
+		if restored[name] != n {
+			return m, fmt.Errorf("%s has %d records, the manifest says %d", name, restored[name], n)
+		}
+	}
+	return m, nil
+}
+
+func restoreRecord(ctx context.Context, repos Repos, file string, line []byte) error {
+	switch file {
+	case "zones.jsonl":
+		var t Thermostat
+		if err := json.Unmarshal(line, &t); err != nil {
+			return err
+		}
+		return repos.Thermostats.Save(ctx, t)
+	case "readings.jsonl":
+		var a Aggregate
+		if err := json.Unmarshal(line, &a); err != nil {
+			return err
+		}
+		return repos.Readings.Add(ctx, a)
+	case "messages.jsonl":
+		var msg Message
+		if err := json.Unmarshal(line, &msg); err != nil {
+			return err
+		}
+		_, err := repos.Messages.Add(ctx, msg)
+		return err
+	case "users.jsonl":
+		var u User
+		if err := json.Unmarshal(line, &u); err != nil {
+			return err
+		}
+		return repos.Users.Save(ctx, u)
+	case "audit.jsonl":
+		var e AuditEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return err
+		}
+		_, err := repos.Audit.Add(ctx, e)
+		return err
+	case "events.jsonl":
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			return err
+		}
+		_, err := repos.Events.Append(ctx, e)
+		return err
+	}
+	return fmt.Errorf("unknown file %s", file)
+}
@@ -0,0 +1,578 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var _ Database = &Bolt{}
+
+var (
+	boltMeta        = []byte("meta")
+	boltVersion     = []byte("version")
+	boltThermostats = []byte("thermostats")
+	boltMessages    = []byte("messages")
+	boltUsers       = []byte("users")
+	boltReadings    = []byte("readings")
+	boltEvents      = []byte("events")
+	boltAudit       = []byte("audit")
+)
+
+// boltMigrations create the buckets, version for version with the SQL
+// migrations. The records are JSON; the messages bucket holds a bucket
+// per room keyed by message ID, and the readings bucket one per resolution
+// keyed by zone, kind and start. The events bucket holds a bucket per
+// session keyed by event ID, the audit bucket the entries by ID.
+var boltMigrations = []func(tx *bolt.Tx) error{
+	func(tx *bolt.Tx) error { _, err := tx.CreateBucketIfNotExists(boltThermostats); return err },
+	func(tx *bolt.Tx) error { _, err := tx.CreateBucketIfNotExists(boltMessages); return err },
+	func(tx *bolt.Tx) error { _, err := tx.CreateBucketIfNotExists(boltUsers); return err },
+	func(tx *bolt.Tx) error { _, err := tx.CreateBucketIfNotExists(boltReadings); return err },
+	func(tx *bolt.Tx) error { _, err := tx.CreateBucketIfNotExists(boltEvents); return err },
+	func(tx *bolt.Tx) error { _, err := tx.CreateBucketIfNotExists(boltAudit); return err },
+}
+
+// Bolt is an embedded bbolt database implementing the repositories, pure
+// Go, for a single binary without cgo or a database server.
+type Bolt struct {
+	DB *bolt.DB
+}
+
+// OpenBolt opens the database file at path, creating it if needed. Only
+// one process can have it open. The buckets aren't created, see Migrate.
+func OpenBolt(path string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("could not open %s, another process has it open: %w", path, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not open %s: %w", path, err)
+	}
+	return &Bolt{DB: db}, nil
+}
+
+// Close closes the database.
+func (b *Bolt) Close() error {
+	return b.DB.Close()
+}
+
+// Version returns the number of migrations applied, kept in the meta
+// bucket.
+func (b *Bolt) Version(ctx context.Context) (int, error) {
+	version := 0
+	err := b.DB.View(func(tx *bolt.Tx) error {
+		version = boltVersionOf(tx)
+		return nil
+	})
+	return version, err
+}
+
+func boltVersionOf(tx *bolt.Tx) int {
+	if meta := tx.Bucket(boltMeta); meta != nil {
+		if v := meta.Get(boltVersion); len(v) == 8 {
+			return int(binary.BigEndian.Uint64(v))
+		}
+	}
+	return 0
+}
+
+// Pending returns the number of migrations not applied yet. It fails when
+// the database is newer than this build.
+func (b *Bolt) Pending(ctx context.Context) (int, error) {
+	version, err := b.Version(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if version > len(boltMigrations) {
+		return 0, fmt.Errorf("the schema version %d is newer than this build, %d", version, len(boltMigrations))
+	}
+	return len(boltMigrations) - version, nil
+}
+
+// Migrate applies the pending migrations in one transaction.
+func (b *Bolt) Migrate(ctx context.Context) error {
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		version := boltVersionOf(tx)
+		if version > len(boltMigrations) {
+			return fmt.Errorf("the schema version %d is newer than this build, %d", version, len(boltMigrations))
+		}
+		for v := version; v < len(boltMigrations); v++ {
+			if err := boltMigrations[v](tx); err != nil {
+				return fmt.Errorf("migration %d: %w", v+1, err)
+			}
+		}
+		meta, err := tx.CreateBucketIfNotExists(boltMeta)
+		if err != nil {
+			return err
+		}
+		return meta.Put(boltVersion, boltID(uint64(len(boltMigrations))))
+	})
+}
+
+// Repos returns the repositories kept in the database.
+func (b *Bolt) Repos() Repos {
+	return Repos{
+		Thermostats: boltThermostatRepo{b.DB},
+		Messages:    boltMessageRepo{b.DB},
+		Users:       boltUserRepo{b.DB},
+		Readings:    boltReadingRepo{b.DB},
+		Events:      boltEventRepo{b.DB},
+		Audit:       boltAuditRepo{b.DB},
+	}
+}
+
+// boltID encodes an ID as a key sorting in numeric order.
+func boltID(id uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, id)
+	return k
+}
+
+// boltGet decodes the record of key in bucket into v.
+func boltGet(db *bolt.DB, bucket, key []byte, v interface{}) error {
+	return db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucket).Get(key)
+		if data == nil {
+			return ErrNotFound
+		}
+		return json.Unmarshal(data, v)
+	})
+}
+
+// boltPut stores v as the record of key in bucket.
+func boltPut(db *bolt.DB, bucket, key []byte, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put(key, data)
+	})
+}
+
+type boltThermostatRepo struct{ db *bolt.DB }
+
+func (r boltThermostatRepo) Get(ctx context.Context, zone string) (Thermostat, error) {
+	t := Thermostat{Zone: zone}
+	err := boltGet(r.db, boltThermostats, []byte(zone), &t)
+	return t, err
+}
+
+func (r boltThermostatRepo) Save(ctx context.Context, t Thermostat) error {
+	return boltPut(r.db, boltThermostats, []byte(t.Zone), t)
+}
+
+func (r boltThermostatRepo) List(ctx context.Context) ([]Thermostat, error) {
+	var list []Thermostat
+	err := r.db.View(func(tx *bolt.Tx) error {
+		// Keys are sorted, so is the list.
+		return tx.Bucket(boltThermostats).ForEach(func(k, v []byte) error {
+			var t Thermostat
+			if err := json.Unmarshal(v, &t); err != nil {
+				return err
+			}
+			list = append(list, t)
+			return nil
+		})
+	})
+	return list, err
+}
+
+type boltMessageRepo struct{ db *bolt.DB }
+
+func (r boltMessageRepo) Add(ctx context.Context, m Message) (Message, error) {
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		messages := tx.Bucket(boltMessages)
+		room, err := messages.CreateBucketIfNotExists([]byte(m.Room))
+		if err != nil {
+			return err
+		}
+		// The IDs count across the rooms, like the SQL ones.
+		id, err := messages.NextSequence()
+		if err != nil {
+			return err
+		}
+		m.ID = int64(id)
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		return room.Put(boltID(id), data)
+	})
+	return m, err
+}
+
+func (r boltMessageRepo) Recent(ctx context.Context, room string, n int) ([]Message, error) {
+	var list []Message
+	err := r.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltMessages).Bucket([]byte(room))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Last(); k != nil && len(list) < n; k, v = c.Prev() {
+			var m Message
+			if err := json.Unmarshal(v, &m); err != nil {
+				return err
+			}
+			list = append(list, m)
+		}
+		return nil
+	})
+	// Newest first from the cursor, oldest first for the caller.
+	for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
+		list[i], list[j] = list[j], list[i]
+	}
+	return list, err
+}
+
+type boltUserRepo struct{ db *bolt.DB }
+
+func (r boltUserRepo) Get(ctx context.Context, session string) (User, error) {
+	u := User{Session: session}
+	err := boltGet(r.db, boltUsers, []byte(session), &u)
+	return u, err
+}
+
+func (r boltUserRepo) Save(ctx context.Context, u User) error {
+	return boltPut(r.db, boltUsers, []byte(u.Session), u)
+}
+
+type boltReadingRepo struct{ db *bolt.DB }
+
+// boltReadingPrefix returns the start of the keys of the readings of zone
+// and kind.
+func boltReadingPrefix(zone, kind string) []byte {
+	return []byte(zone + "\x00" + kind + "\x00")
+}
+
+// boltMergeReading stores a in its resolution bucket, merged with the
+// reading of the same span if there is one.
+func boltMergeReading(tx *bolt.Tx, a Aggregate) error {
+	b, err := tx.Bucket(boltReadings).CreateBucketIfNotExists([]byte(a.Resolution))
+	if err != nil {
+		return err
+	}
+	key := append(boltReadingPrefix(a.Zone, a.Kind), boltID(uint64(a.Start.UnixMilli()))...)
+	if data := b.Get(key); data != nil {
+		var stored Aggregate
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return err
+		}
+		stored.merge(a)
+		a = stored
+	}
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
+
+func (r boltReadingRepo) Add(ctx context.Context, a Aggregate) error {
+	return r.db.Update(func(tx *bolt.Tx) error { return boltMergeReading(tx, a) })
+}
+
+func (r boltReadingRepo) Range(ctx context.Context, zone, kind string, res Resolution, from, to time.Time) ([]Aggregate, error) {
+	var list []Aggregate
+	err := r.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltReadings).Bucket([]byte(res))
+		if b == nil {
+			return nil
+		}
+		prefix := boltReadingPrefix(zone, kind)
+		end := append(append([]byte(nil), prefix...), boltID(uint64(to.UnixMilli()))...)
+		c := b.Cursor()
+		for k, v := c.Seek(append(prefix, boltID(uint64(from.UnixMilli()))...)); k != nil && bytes.Compare(k, end) < 0; k, v = c.Next() {
+			var a Aggregate
+			if err := json.Unmarshal(v, &a); err != nil {
+				return err
+			}
+			list = append(list, a)
+		}
+		return nil
+	})
+	return list, err
+}
+
+// Before scans every reading of the resolution, what is compacted is most
+// of it anyway.
+func (r boltReadingRepo) Before(ctx context.Context, res Resolution, t time.Time) ([]Aggregate, error) {
+	var list []Aggregate
+	err := r.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltReadings).Bucket([]byte(res))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var a Aggregate
+			if err := json.Unmarshal(v, &a); err != nil {
+				return err
+			}
+			if a.Start.Before(t) {
+				list = append(list, a)
+			}
+			return nil
+		})
+	})
+	return list, err
+}
+
+func (r boltReadingRepo) Replace(ctx context.Context, res Resolution, t time.Time, into []Aggregate) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		if b := tx.Bucket(boltReadings).Bucket([]byte(res)); b != nil {
+			// Keys can't be deleted while ForEach runs.
+			var old [][]byte
+			err := b.ForEach(func(k, v []byte) error {
+				if len(k) >= 8 && int64(binary.BigEndian.Uint64(k[len(k)-8:])) < t.UnixMilli() {
+					old = append(old, append([]byte(nil), k...))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, k := range old {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+		}
+		for _, a := range into {
+			if err := boltMergeReading(tx, a); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Each runs fn in a read transaction, the messages are read one by one.
+func (r boltMessageRepo) Each(ctx context.Context, from, to time.Time, fn func(Message) error) error {
+	return r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltMessages).ForEach(func(room, v []byte) error {
+			b := tx.Bucket(boltMessages).Bucket(room)
+			if v != nil || b == nil {
+				return nil
+			}
+			return b.ForEach(func(k, v []byte) error {
+				var m Message
+				if err := json.Unmarshal(v, &m); err != nil {
+					return err
+				}
+				if m.Time.Before(from) || !m.Time.Before(to) {
+					return nil
+				}
+				return fn(m)
+			})
+		})
+	})
+}
+
+func (r boltUserRepo) Each(ctx context.Context, from, to time.Time, fn func(User) error) error {
+	return r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltUsers).ForEach(func(k, v []byte) error {
+			var u User
+			if err := json.Unmarshal(v, &u); err != nil {
+				return err
+			}
+			if u.Seen.Before(from) || !u.Seen.Before(to) {
+				return nil
+			}
+			return fn(u)
+		})
+	})
+}
+
+func (r boltReadingRepo) Each(ctx context.Context, from, to time.Time, fn func(Aggregate) error) error {
+	return r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltReadings).ForEach(func(res, v []byte) error {
+			b := tx.Bucket(boltReadings).Bucket(res)
+			if v != nil || b == nil {
+				return nil
+			}
+			return b.ForEach(func(k, v []byte) error {
+				var a Aggregate
+				if err := json.Unmarshal(v, &a); err != nil {
+					return err
+				}
+				if a.Start.Before(from) || !a.Start.Before(to) {
+					return nil
+				}
+				return fn(a)
+			})
+		})
+	})
+}
+
+type boltEventRepo struct{ db *bolt.DB }
+
+func (r boltEventRepo) Append(ctx context.Context, e Event) (Event, error) {
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		events := tx.Bucket(boltEvents)
+		session, err := events.CreateBucketIfNotExists([]byte(e.Session))
+		if err != nil {
+			return err
+		}
+		id, err := events.NextSequence()
+		if err != nil {
+			return err
+		}
+		e.ID = int64(id)
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		return session.Put(boltID(id), data)
+	})
+	return e, err
+}
+
+func (r boltEventRepo) Session(ctx context.Context, session string, after int64, fn func(Event) error) error {
+	return r.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltEvents).Bucket([]byte(session))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Seek(boltID(uint64(after) + 1)); k != nil; k, v = c.Next() {
+			var e Event
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// After takes the first n events after after of every session, the
+// buckets are by session, and keeps the first n of them all.
+func (r boltEventRepo) After(ctx context.Context, after int64, n int) ([]Event, error) {
+	var list []Event
+	err := r.db.View(func(tx *bolt.Tx) error {
+		events := tx.Bucket(boltEvents)
+		return events.ForEach(func(session, v []byte) error {
+			b := events.Bucket(session)
+			if v != nil || b == nil {
+				return nil
+			}
+			c := b.Cursor()
+			taken := 0
+			for k, v := c.Seek(boltID(uint64(after) + 1)); k != nil && taken < n; k, v = c.Next() {
+				var e Event
+				if err := json.Unmarshal(v, &e); err != nil {
+					return err
+				}
+				list = append(list, e)
+				taken++
+			}
+			return nil
+		})
+	})
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	if len(list) > n {
+		list = list[:n]
+	}
+	return list, err
+}
+
+// Prune deletes the old events of every session, and the sessions left
+// without events.
+func (r boltEventRepo) Prune(ctx context.Context, before time.Time) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		events := tx.Bucket(boltEvents)
+		var empty [][]byte
+		err := events.ForEach(func(session, v []byte) error {
+			b := events.Bucket(session)
+			if v != nil || b == nil {
+				return nil
+			}
+			var old [][]byte
+			err := b.ForEach(func(k, v []byte) error {
+				var e Event
+				if err := json.Unmarshal(v, &e); err != nil {
+					return err
+				}
+				if e.Time.Before(before) {
+					old = append(old, k)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, k := range old {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			if k, _ := b.Cursor().First(); k == nil {
+				empty = append(empty, session)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, session := range empty {
+			if err := events.DeleteBucket(session); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+type boltAuditRepo struct{ db *bolt.DB }
+
+func (r boltAuditRepo) Add(ctx context.Context, e AuditEntry) (AuditEntry, error) {
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltAudit)
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		e.ID = int64(id)
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		return b.Put(boltID(id), data)
+	})
+	return e, err
+}
+
+// List walks the whole log backwards, the filter has no index.
+func (r boltAuditRepo) List(ctx context.Context, f AuditFilter, skip, n int) ([]AuditEntry, int, error) {
+	var list []AuditEntry
+	total := 0
+	err := r.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltAudit).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var e AuditEntry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			if !f.Match(e) {
+				continue
+			}
+			if total >= skip && len(list) < n {
+				list = append(list, e)
+			}
+			total++
+		}
+		return nil
+	})
+	return list, total, err
+}
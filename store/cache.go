@@ -0,0 +1,133 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// cacheMissing is cached for a record that doesn't exist, most zones never
+// have their setpoint changed.
+const cacheMissing = "-"
+
+// Cache is a read-through Redis cache in front of the repositories, for
+// the reads every mounting socket makes: the setpoint of a zone and the
+// latest messages of a room. Writes go to the repository and drop the
+// cached entries they change. When Redis fails, reads go to the
+// repository.
+type Cache struct {
+	rdb *redis.Client
+	ttl time.Duration
+	// prefix starts every key of the cache.
+	prefix string
+}
+
+// NewCache creates a cache keeping entries in rdb for ttl at most.
+func NewCache(rdb *redis.Client, ttl time.Duration) *Cache {
+	return &Cache{rdb: rdb, ttl: ttl, prefix: "store:"}
+}
+
+// Wrap returns repos with the thermostats and messages cached.
+func (c *Cache) Wrap(repos Repos) Repos {
+	repos.Thermostats = cachedThermostats{c, repos.Thermostats}
+	repos.Messages = cachedMessages{c, repos.Messages}
+	return repos
+}
+
+// get loads the cached entry of key into v. It reports whether there was
+// one, and whether it was cacheMissing.
+func (c *Cache) get(ctx context.Context, key, field string, v interface{}) (hit, missing bool) {
+	data, err := c.rdb.HGet(ctx, c.prefix+key, field).Result()
+	if err != nil {
+		return false, false
+	}
+	if data == cacheMissing {
+		return true, true
+	}
+	return json.Unmarshal([]byte(data), v) == nil, false
+}
+
+// set caches v, or cacheMissing when v is nil. Errors are ignored, the
+// next read goes to the repository again.
+func (c *Cache) set(ctx context.Context, key, field string, v interface{}) {
+	data := []byte(cacheMissing)
+	if v != nil {
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return
+		}
+	}
+	pipe := c.rdb.TxPipeline()
+	pipe.HSet(ctx, c.prefix+key, field, data)
+	pipe.Expire(ctx, c.prefix+key, c.ttl)
+	pipe.Exec(ctx)
+}
+
+// drop removes the cached entries of key.
+func (c *Cache) drop(ctx context.Context, key string) error {
+	if err := c.rdb.Del(ctx, c.prefix+key).Err(); err != nil {
+		return fmt.Errorf("could not invalidate the cache of %s: %w", key, err)
+	}
+	return nil
+}
+
+type cachedThermostats struct {
+	cache *Cache
+	ThermostatRepo
+}
+
+func (r cachedThermostats) Get(ctx context.Context, zone string) (Thermostat, error) {
+	var t Thermostat
+	if hit, missing := r.cache.get(ctx, "thermostat:"+zone, "state", &t); missing {
+		return Thermostat{Zone: zone}, ErrNotFound
+	} else if hit {
+		return t, nil
+	}
+	t, err := r.ThermostatRepo.Get(ctx, zone)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		r.cache.set(ctx, "thermostat:"+zone, "state", nil)
+	case err == nil:
+		r.cache.set(ctx, "thermostat:"+zone, "state", t)
+	}
+	return t, err
+}
+
+func (r cachedThermostats) Save(ctx context.Context, t Thermostat) error {
+	if err := r.ThermostatRepo.Save(ctx, t); err != nil {
+		return err
+	}
+	return r.cache.drop(ctx, "thermostat:"+t.Zone)
+}
+
+type cachedMessages struct {
+	cache *Cache
+	MessageRepo
+}
+
+// Recent caches the messages of a room by n, in a hash per room so Add
+// drops every n at once.
+func (r cachedMessages) Recent(ctx context.Context, room string, n int) ([]Message, error) {
+	var list []Message
+	field := fmt.Sprint(n)
+	if hit, _ := r.cache.get(ctx, "messages:"+room, field, &list); hit {
+		return list, nil
+	}
+	list, err := r.MessageRepo.Recent(ctx, room, n)
+	if err == nil {
+		r.cache.set(ctx, "messages:"+room, field, list)
+	}
+	return list, err
+}
+
+func (r cachedMessages) Add(ctx context.Context, m Message) (Message, error) {
+	m, err := r.MessageRepo.Add(ctx, m)
+	if err != nil {
+		return m, err
+	}
+	return m, r.cache.drop(ctx, "messages:"+m.Room)
+}
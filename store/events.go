@@ -0,0 +1,80 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Event kinds, as the event middleware of the pages names them.
+const (
+	// EventMount is the mount of a connected socket, its delta is the
+	// whole model.
+	EventMount  = "mount"
+	EventClient = "event"
+	EventParams = "params"
+	EventSelf   = "self"
+)
+
+// Event is a live event handled by a socket, as kept in the event log.
+type Event struct {
+	ID      int64
+	Session string
+	Socket  string
+	// Page is the path of the page the socket is on.
+	Page string
+	Kind string
+	Name string
+	// Params are the params of a client event, the data of a self event.
+	Params json.RawMessage
+	// Delta holds the fields of the model the handler changed with their
+	// new value, null for the fields it removed.
+	Delta json.RawMessage
+	// Error is the error the handler returned, empty if it succeeded.
+	Error string
+	Time  time.Time
+}
+
+// EventRepo keeps the event log, append only.
+type EventRepo interface {
+	// Append stores e and returns it with its ID. The IDs grow in the
+	// order the events are appended.
+	Append(ctx context.Context, e Event) (Event, error)
+	// Session calls fn with the events of session whose ID is after after,
+	// oldest first, until fn fails.
+	Session(ctx context.Context, session string, after int64, fn func(Event) error) error
+	// After returns up to n events of every session whose ID is after
+	// after, oldest first.
+	After(ctx context.Context, after int64, n int) ([]Event, error)
+	// Prune deletes the events older than before.
+	Prune(ctx context.Context, before time.Time) error
+}
+
+// Replay replays the events of session after after: fn gets every event
+// with the model of its socket once the event was handled, rebuilt from
+// the deltas since the socket mounted. The model is only complete for the
+// sockets whose mount is in the log.
+func Replay(ctx context.Context, repo EventRepo, session string, after int64, fn func(e Event, model map[string]json.RawMessage) error) error {
+	models := map[string]map[string]json.RawMessage{}
+	return repo.Session(ctx, session, after, func(e Event) error {
+		model := models[e.Socket]
+		if model == nil || e.Kind == EventMount {
+			model = map[string]json.RawMessage{}
+			models[e.Socket] = model
+		}
+		var delta map[string]json.RawMessage
+		if len(e.Delta) > 0 {
+			if err := json.Unmarshal(e.Delta, &delta); err != nil {
+				return err
+			}
+		}
+		for field, v := range delta {
+			if string(v) == "null" {
+				delete(model, field)
+				continue
+			}
+			model[field] = v
+		}
+		return fn(e, model)
+	})
+}
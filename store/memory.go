@@ -0,0 +1,470 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+var _ Database = &Memory{}
+
+const (
+	// memoryMessages is the number of messages a room keeps in memory.
+	memoryMessages = 1000
+	// memoryEvents is the number of events the event log keeps in memory,
+	// for all sessions together.
+	memoryEvents = 10000
+)
+
+// memoryData is everything the memory store holds, as it is snapshotted.
+type memoryData struct {
+	Thermostats map[string]Thermostat
+	// Messages are the messages of every room, oldest first.
+	Messages    map[string][]Message
+	Users       map[string]User
+	LastMessage int64
+	// Readings are keyed by resolution, then by zone, kind and start.
+	Readings map[Resolution]map[string]Aggregate
+	// Events are the latest events of the log, oldest first.
+	Events    []Event
+	LastEvent int64
+	// Audit is the audit log, oldest first. It is kept whole.
+	Audit     []AuditEntry
+	LastAudit int64
+}
+
+// Memory keeps the repositories in memory, without any dependency, and
+// snapshots them to a JSON file every interval and when it's closed. The
+// snapshot is loaded when it's opened again.
+type Memory struct {
+	path string
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	mu    sync.Mutex
+	data  memoryData
+	dirty bool
+}
+
+// OpenMemory restores the snapshot at path, if there is one, and starts
+// snapshotting every interval. Without a path nothing is snapshotted.
+func OpenMemory(path string, interval time.Duration) (*Memory, error) {
+	m := &Memory{path: path, done: make(chan struct{})}
+	m.data = memoryData{
+		Thermostats: map[string]Thermostat{},
+		Messages:    map[string][]Message{},
+		Users:       map[string]User{},
+		Readings:    map[Resolution]map[string]Aggregate{},
+	}
+	if path == "" {
+		return m, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &m.data); err != nil {
+			return nil, fmt.Errorf("could not restore %s: %w", path, err)
+		}
+	}
+	if interval > 0 {
+		m.wg.Add(1)
+		go m.run(interval)
+	}
+	return m, nil
+}
+
+func (m *Memory) run(interval time.Duration) {
+	defer m.wg.Done()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := m.Snapshot(); err != nil {
+				log.Println("snapshot error:", err)
+			}
+		case <-m.done:
+			return
+		}
+	}
+}
+
+// Snapshot writes the data to the file if it changed since the last
+// snapshot. The file is replaced at once, a crash leaves the previous one.
+func (m *Memory) Snapshot() error {
+	m.mu.Lock()
+	if !m.dirty || m.path == "" {
+		m.mu.Unlock()
+		return nil
+	}
+	b, err := json.Marshal(m.data)
+	m.dirty = false
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(m.path), filepath.Base(m.path)+".*")
+	if err == nil {
+		_, err = tmp.Write(b)
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), m.path)
+		}
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}
+	if err != nil {
+		// Try again with the next snapshot.
+		m.mu.Lock()
+		m.dirty = true
+		m.mu.Unlock()
+		return fmt.Errorf("could not snapshot to %s: %w", m.path, err)
+	}
+	return nil
+}
+
+// Close stops the snapshots and writes the last one.
+func (m *Memory) Close() error {
+	select {
+	case <-m.done:
+	default:
+		close(m.done)
+	}
+	m.wg.Wait()
+	return m.Snapshot()
+}
+
+// Pending returns 0, the snapshot has no schema to migrate.
+func (m *Memory) Pending(ctx context.Context) (int, error) {
+	return 0, nil
+}
+
+// Migrate does nothing, see Pending.
+func (m *Memory) Migrate(ctx context.Context) error {
+	return nil
+}
+
+// Repos returns the repositories kept in memory.
+func (m *Memory) Repos() Repos {
+	return Repos{Thermostats: memoryThermostats{m}, Messages: memoryMessageRepo{m}, Users: memoryUsers{m}, Readings: memoryReadings{m}, Events: memoryEventRepo{m}, Audit: memoryAudit{m}}
+}
+
+type memoryThermostats struct{ m *Memory }
+
+func (r memoryThermostats) Get(ctx context.Context, zone string) (Thermostat, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	t, ok := r.m.data.Thermostats[zone]
+	if !ok {
+		return Thermostat{Zone: zone}, ErrNotFound
+	}
+	return t, nil
+}
+
+func (r memoryThermostats) Save(ctx context.Context, t Thermostat) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	r.m.data.Thermostats[t.Zone] = t
+	r.m.dirty = true
+	return nil
+}
+
+func (r memoryThermostats) List(ctx context.Context) ([]Thermostat, error) {
+	r.m.mu.Lock()
+	list := make([]Thermostat, 0, len(r.m.data.Thermostats))
+	for _, t := range r.m.data.Thermostats {
+		list = append(list, t)
+	}
+	r.m.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Zone < list[j].Zone })
+	return list, nil
+}
+
+type memoryMessageRepo struct{ m *Memory }
+
+func (r memoryMessageRepo) Add(ctx context.Context, msg Message) (Message, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	r.m.data.LastMessage++
+	msg.ID = r.m.data.LastMessage
+	messages := append(r.m.data.Messages[msg.Room], msg)
+	if len(messages) > memoryMessages {
+		messages = messages[len(messages)-memoryMessages:]
+	}
+	r.m.data.Messages[msg.Room] = messages
+	r.m.dirty = true
+	return msg, nil
+}
+
+func (r memoryMessageRepo) Recent(ctx context.Context, room string, n int) ([]Message, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	messages := r.m.data.Messages[room]
+	if len(messages) > n {
+		messages = messages[len(messages)-n:]
+	}
+	return append([]Message(nil), messages...), nil
+}
+
+type memoryUsers struct{ m *Memory }
+
+func (r memoryUsers) Get(ctx context.Context, session string) (User, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	u, ok := r.m.data.Users[session]
+	if !ok {
+		return User{Session: session}, ErrNotFound
+	}
+	return u, nil
+}
+
+func (r memoryUsers) Save(ctx context.Context, u User) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	r.m.data.Users[u.Session] = u
+	r.m.dirty = true
+	return nil
+}
+
+type memoryReadings struct{ m *Memory }
+
+// merge stores a, merged with the reading of the same span if there is
+// one. The lock is held by the caller.
+func (r memoryReadings) merge(a Aggregate) {
+	readings := r.m.data.Readings[a.Resolution]
+	if readings == nil {
+		readings = map[string]Aggregate{}
+		r.m.data.Readings[a.Resolution] = readings
+	}
+	key := fmt.Sprintf("%s\x00%s\x00%d", a.Zone, a.Kind, a.Start.UnixMilli())
+	if stored, ok := readings[key]; ok {
+		stored.merge(a)
+		a = stored
+	}
+	readings[key] = a
+	r.m.dirty = true
+}
+
+func (r memoryReadings) Add(ctx context.Context, a Aggregate) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	r.merge(a)
+	return nil
+}
+
+func (r memoryReadings) Range(ctx context.Context, zone, kind string, res Resolution, from, to time.Time) ([]Aggregate, error) {
+	r.m.mu.Lock()
+	var list []Aggregate
+	for _, a := range r.m.data.Readings[res] {
+		if a.Zone == zone && a.Kind == kind && !a.Start.Before(from) && a.Start.Before(to) {
+			list = append(list, a)
+		}
+	}
+	r.m.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Start.Before(list[j].Start) })
+	return list, nil
+}
+
+func (r memoryReadings) Before(ctx context.Context, res Resolution, t time.Time) ([]Aggregate, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var list []Aggregate
+	for _, a := range r.m.data.Readings[res] {
+		if a.Start.Before(t) {
+			list = append(list, a)
+		}
+	}
+	return list, nil
+}
+
+func (r memoryReadings) Replace(ctx context.Context, res Resolution, t time.Time, into []Aggregate) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for key, a := range r.m.data.Readings[res] {
+		if a.Start.Before(t) {
+			delete(r.m.data.Readings[res], key)
+			r.m.dirty = true
+		}
+	}
+	for _, a := range into {
+		r.merge(a)
+	}
+	return nil
+}
+
+// Each copies the matching messages first, fn runs without the lock.
+func (r memoryMessageRepo) Each(ctx context.Context, from, to time.Time, fn func(Message) error) error {
+	r.m.mu.Lock()
+	var list []Message
+	for _, messages := range r.m.data.Messages {
+		for _, msg := range messages {
+			if !msg.Time.Before(from) && msg.Time.Before(to) {
+				list = append(list, msg)
+			}
+		}
+	}
+	r.m.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	for _, msg := range list {
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r memoryUsers) Each(ctx context.Context, from, to time.Time, fn func(User) error) error {
+	r.m.mu.Lock()
+	var list []User
+	for _, u := range r.m.data.Users {
+		if !u.Seen.Before(from) && u.Seen.Before(to) {
+			list = append(list, u)
+		}
+	}
+	r.m.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Session < list[j].Session })
+	for _, u := range list {
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r memoryReadings) Each(ctx context.Context, from, to time.Time, fn func(Aggregate) error) error {
+	r.m.mu.Lock()
+	var list []Aggregate
+	for _, readings := range r.m.data.Readings {
+		for _, a := range readings {
+			if !a.Start.Before(from) && a.Start.Before(to) {
+				list = append(list, a)
+			}
+		}
+	}
+	r.m.mu.Unlock()
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Resolution != b.Resolution {
+			return a.Resolution < b.Resolution
+		}
+		if a.Zone != b.Zone {
+			return a.Zone < b.Zone
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Start.Before(b.Start)
+	})
+	for _, a := range list {
+		if err := fn(a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type memoryEventRepo struct{ m *Memory }
+
+func (r memoryEventRepo) Append(ctx context.Context, e Event) (Event, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	r.m.data.LastEvent++
+	e.ID = r.m.data.LastEvent
+	events := append(r.m.data.Events, e)
+	if len(events) > memoryEvents {
+		events = events[len(events)-memoryEvents:]
+	}
+	r.m.data.Events = events
+	r.m.dirty = true
+	return e, nil
+}
+
+// Session copies the matching events first, fn runs without the lock.
+func (r memoryEventRepo) Session(ctx context.Context, session string, after int64, fn func(Event) error) error {
+	r.m.mu.Lock()
+	var list []Event
+	for _, e := range r.m.data.Events {
+		if e.Session == session && e.ID > after {
+			list = append(list, e)
+		}
+	}
+	r.m.mu.Unlock()
+	for _, e := range list {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r memoryEventRepo) Prune(ctx context.Context, before time.Time) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	events := r.m.data.Events[:0]
+	for _, e := range r.m.data.Events {
+		if !e.Time.Before(before) {
+			events = append(events, e)
+		}
+	}
+	if len(events) < len(r.m.data.Events) {
+		r.m.data.Events = events
+		r.m.dirty = true
+	}
+	return nil
+}
+
+func (r memoryEventRepo) After(ctx context.Context, after int64, n int) ([]Event, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	events := r.m.data.Events
+	// The events are by ID.
+	i := sort.Search(len(events), func(i int) bool { return events[i].ID > after })
+	events = events[i:]
+	if len(events) > n {
+		events = events[:n]
+	}
+	return append([]Event(nil), events...), nil
+}
+
+type memoryAudit struct{ m *Memory }
+
+func (r memoryAudit) Add(ctx context.Context, e AuditEntry) (AuditEntry, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	r.m.data.LastAudit++
+	e.ID = r.m.data.LastAudit
+	r.m.data.Audit = append(r.m.data.Audit, e)
+	r.m.dirty = true
+	return e, nil
+}
+
+func (r memoryAudit) List(ctx context.Context, f AuditFilter, skip, n int) ([]AuditEntry, int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var list []AuditEntry
+	total := 0
+	for i := len(r.m.data.Audit) - 1; i >= 0; i-- {
+		e := r.m.data.Audit[i]
+		if !f.Match(e) {
+			continue
+		}
+		if total >= skip && len(list) < n {
+			list = append(list, e)
+		}
+		total++
+	}
+	return list, total, nil
+}
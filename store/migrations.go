@@ -0,0 +1,39 @@
+package store
+
+import (
+	"embed"
+	"io/fs"
+	"sort"
+)
+
+//go:generate sqlc generate
+
+// The migrations of the SQL databases, a file per version numbered in
+// order. They are also the schema sqlc generates the queries from. A
+// migration is never changed once released, a new file is added instead.
+//
+//go:embed migrations
+var migrationFS embed.FS
+
+var (
+	sqliteMigrations   = loadMigrations("migrations/sqlite")
+	postgresMigrations = loadMigrations("migrations/postgres")
+)
+
+// loadMigrations reads the migrations of dir, by file name.
+func loadMigrations(dir string) []string {
+	files, err := fs.Glob(migrationFS, dir+"/*.sql")
+	if err != nil {
+		panic(err)
+	}
+	sort.Strings(files)
+	migrations := make([]string, len(files))
+	for i, file := range files {
+		b, err := migrationFS.ReadFile(file)
+		if err != nil {
+			panic(err)
+		}
+		migrations[i] = string(b)
+	}
+	return migrations
+}
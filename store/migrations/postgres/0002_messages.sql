@@ -0,0 +1,8 @@
+CREATE TABLE messages (
+	id BIGSERIAL PRIMARY KEY,
+	room TEXT NOT NULL,
+	author TEXT NOT NULL,
+	text TEXT NOT NULL,
+	time TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX messages_room ON messages (room, id);
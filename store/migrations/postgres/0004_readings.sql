@@ -0,0 +1,11 @@
+CREATE TABLE readings (
+	resolution TEXT NOT NULL,
+	zone TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	start TIMESTAMPTZ NOT NULL,
+	min DOUBLE PRECISION NOT NULL,
+	max DOUBLE PRECISION NOT NULL,
+	sum DOUBLE PRECISION NOT NULL,
+	count INTEGER NOT NULL,
+	PRIMARY KEY (resolution, zone, kind, start)
+);
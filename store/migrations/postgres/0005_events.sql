@@ -0,0 +1,13 @@
+CREATE TABLE events (
+	id BIGSERIAL PRIMARY KEY,
+	session TEXT NOT NULL,
+	socket TEXT NOT NULL,
+	page TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	name TEXT NOT NULL,
+	params JSONB NOT NULL,
+	delta JSONB NOT NULL,
+	error TEXT NOT NULL,
+	time TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX events_session ON events (session, id);
@@ -0,0 +1,9 @@
+CREATE TABLE audit_log (
+	id BIGSERIAL PRIMARY KEY,
+	time TIMESTAMPTZ NOT NULL,
+	actor TEXT NOT NULL,
+	session TEXT NOT NULL,
+	action TEXT NOT NULL,
+	target TEXT NOT NULL,
+	detail TEXT NOT NULL
+);
@@ -0,0 +1,5 @@
+CREATE TABLE thermostats (
+	zone TEXT PRIMARY KEY,
+	setpoint REAL NOT NULL,
+	updated INTEGER NOT NULL
+);
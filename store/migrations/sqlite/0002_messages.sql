@@ -0,0 +1,8 @@
+CREATE TABLE messages (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	room TEXT NOT NULL,
+	author TEXT NOT NULL,
+	text TEXT NOT NULL,
+	time INTEGER NOT NULL
+);
+CREATE INDEX messages_room ON messages (room, id);
@@ -0,0 +1,5 @@
+CREATE TABLE users (
+	session TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	seen INTEGER NOT NULL
+);
@@ -0,0 +1,11 @@
+CREATE TABLE readings (
+	resolution TEXT NOT NULL,
+	zone TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	start INTEGER NOT NULL,
+	min REAL NOT NULL,
+	max REAL NOT NULL,
+	sum REAL NOT NULL,
+	count INTEGER NOT NULL,
+	PRIMARY KEY (resolution, zone, kind, start)
+);
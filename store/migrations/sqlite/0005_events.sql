@@ -0,0 +1,13 @@
+CREATE TABLE events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	session TEXT NOT NULL,
+	socket TEXT NOT NULL,
+	page TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	name TEXT NOT NULL,
+	params TEXT NOT NULL,
+	delta TEXT NOT NULL,
+	error TEXT NOT NULL,
+	time INTEGER NOT NULL
+);
+CREATE INDEX events_session ON events (session, id);
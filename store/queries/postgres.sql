@@ -0,0 +1,88 @@
+-- name: GetThermostat :one
+SELECT setpoint, updated FROM thermostats WHERE zone = $1;
+
+-- name: SaveThermostat :exec
+INSERT INTO thermostats (zone, setpoint, updated) VALUES ($1, $2, $3)
+ON CONFLICT (zone) DO UPDATE SET setpoint = excluded.setpoint, updated = excluded.updated;
+
+-- name: ListThermostats :many
+SELECT zone, setpoint, updated FROM thermostats ORDER BY zone;
+
+-- name: AddMessage :one
+INSERT INTO messages (room, author, text, time) VALUES ($1, $2, $3, $4)
+RETURNING id;
+
+-- name: RecentMessages :many
+SELECT id, room, author, text, time FROM messages WHERE room = $1 ORDER BY id DESC LIMIT $2;
+
+-- name: MessagesPage :many
+SELECT id, room, author, text, time FROM messages
+WHERE time >= sqlc.arg(since) AND time < sqlc.arg(until) AND id > sqlc.arg(after_id)
+ORDER BY id LIMIT sqlc.arg(page_size);
+
+-- name: GetUser :one
+SELECT session, name, seen FROM users WHERE session = $1;
+
+-- name: SaveUser :exec
+INSERT INTO users (session, name, seen) VALUES ($1, $2, $3)
+ON CONFLICT (session) DO UPDATE SET name = excluded.name, seen = excluded.seen;
+
+-- name: UsersPage :many
+SELECT session, name, seen FROM users
+WHERE seen >= sqlc.arg(since) AND seen < sqlc.arg(until) AND session > sqlc.arg(after_session)
+ORDER BY session LIMIT sqlc.arg(page_size);
+
+-- name: MergeReading :exec
+INSERT INTO readings (resolution, zone, kind, start, min, max, sum, count)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+ON CONFLICT (resolution, zone, kind, start) DO UPDATE SET
+	min = LEAST(readings.min, excluded.min), max = GREATEST(readings.max, excluded.max),
+	sum = readings.sum + excluded.sum, count = readings.count + excluded.count;
+
+-- name: RangeReadings :many
+SELECT resolution, zone, kind, start, min, max, sum, count FROM readings
+WHERE resolution = sqlc.arg(resolution) AND zone = sqlc.arg(zone) AND kind = sqlc.arg(kind)
+	AND start >= sqlc.arg(since) AND start < sqlc.arg(until)
+ORDER BY start;
+
+-- name: ReadingsBefore :many
+SELECT resolution, zone, kind, start, min, max, sum, count FROM readings
+WHERE resolution = $1 AND start < $2;
+
+-- name: DeleteReadingsBefore :exec
+DELETE FROM readings WHERE resolution = $1 AND start < $2;
+
+-- name: ReadingsPage :many
+SELECT resolution, zone, kind, start, min, max, sum, count FROM readings
+WHERE start >= sqlc.arg(since) AND start < sqlc.arg(until)
+ORDER BY resolution, zone, kind, start LIMIT sqlc.arg(page_size) OFFSET sqlc.arg(skip);
+
+-- name: AppendEvent :one
+INSERT INTO events (session, socket, page, kind, name, params, delta, error, time)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING id;
+
+-- name: SessionEvents :many
+SELECT id, session, socket, page, kind, name, params, delta, error, time FROM events
+WHERE session = $1 AND id > $2 ORDER BY id LIMIT $3;
+
+-- name: EventsAfter :many
+SELECT id, session, socket, page, kind, name, params, delta, error, time FROM events
+WHERE id > $1 ORDER BY id LIMIT $2;
+
+-- name: DeleteEventsBefore :exec
+DELETE FROM events WHERE time < sqlc.arg(before);
+
+-- name: AddAudit :one
+INSERT INTO audit_log (time, actor, session, action, target, detail)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id;
+
+-- name: AuditPage :many
+SELECT id, time, actor, session, action, target, detail FROM audit_log
+WHERE actor ILIKE sqlc.arg(actor) ESCAPE '\' AND action LIKE sqlc.arg(action) ESCAPE '\' AND target ILIKE sqlc.arg(target) ESCAPE '\'
+ORDER BY id DESC LIMIT sqlc.arg(page_size) OFFSET sqlc.arg(skip);
+
+-- name: CountAudit :one
+SELECT count(*) FROM audit_log
+WHERE actor ILIKE sqlc.arg(actor) ESCAPE '\' AND action LIKE sqlc.arg(action) ESCAPE '\' AND target ILIKE sqlc.arg(target) ESCAPE '\';
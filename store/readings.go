@@ -0,0 +1,180 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Resolution is the time span of an aggregate.
+type Resolution string
+
+const (
+	// Raw aggregates are single samples.
+	Raw    Resolution = "raw"
+	Hourly Resolution = "hour"
+	Daily  Resolution = "day"
+)
+
+// Truncate returns the start of the aggregate of resolution r t is in.
+// Days are UTC.
+func (r Resolution) Truncate(t time.Time) time.Time {
+	switch r {
+	case Hourly:
+		return t.UTC().Truncate(time.Hour)
+	case Daily:
+		return t.UTC().Truncate(24 * time.Hour)
+	}
+	return t
+}
+
+// Kinds of samples.
+const (
+	Temperature = "temperature"
+	Humidity    = "humidity"
+)
+
+// Aggregate is the summary of the samples of a zone and kind in a time
+// span; a raw aggregate is a single sample.
+type Aggregate struct {
+	Zone       string
+	Kind       string
+	Resolution Resolution
+	// Start is when the span starts, the time of a raw sample.
+	Start    time.Time
+	Min, Max float64
+	Sum      float64
+	Count    int
+}
+
+// Avg returns the average of the samples.
+func (a Aggregate) Avg() float64 {
+	if a.Count == 0 {
+		return 0
+	}
+	return a.Sum / float64(a.Count)
+}
+
+// merge adds the samples of b to a.
+func (a *Aggregate) merge(b Aggregate) {
+	if a.Count == 0 {
+		*a = b
+		return
+	}
+	if b.Min < a.Min {
+		a.Min = b.Min
+	}
+	if b.Max > a.Max {
+		a.Max = b.Max
+	}
+	a.Sum += b.Sum
+	a.Count += b.Count
+}
+
+// Sample returns the raw aggregate of a sample.
+func Sample(zone, kind string, at time.Time, value float64) Aggregate {
+	return Aggregate{Zone: zone, Kind: kind, Resolution: Raw, Start: at, Min: value, Max: value, Sum: value, Count: 1}
+}
+
+// ReadingRepo stores the samples of the zones as a time series. New
+// samples are raw; Compact downsamples them to hourly then daily
+// aggregates as they age.
+type ReadingRepo interface {
+	// Add stores a, a raw sample usually, merged with the stored aggregate
+	// of its span if there is one.
+	Add(ctx context.Context, a Aggregate) error
+	// Range returns the aggregates of zone and kind at resolution r
+	// starting from from until before to, oldest first.
+	Range(ctx context.Context, zone, kind string, r Resolution, from, to time.Time) ([]Aggregate, error)
+	// Before returns the aggregates of every zone at resolution r starting
+	// before t.
+	Before(ctx context.Context, r Resolution, t time.Time) ([]Aggregate, error)
+	// Replace deletes the aggregates at resolution r starting before t and
+	// merges into, coarser aggregates, with the stored ones, at once.
+	Replace(ctx context.Context, r Resolution, t time.Time, into []Aggregate) error
+	// Each calls fn with the aggregates of every zone and resolution
+	// starting from from until before to, until fn fails.
+	Each(ctx context.Context, from, to time.Time, fn func(Aggregate) error) error
+}
+
+// Retention is how long the samples are kept at each resolution. Raw
+// samples older than Raw are merged into hourly aggregates, those older
+// than Hourly into daily ones, and daily ones older than Daily are
+// dropped. The events of the event log older than Events are dropped.
+type Retention struct {
+	Raw, Hourly, Daily time.Duration
+	Events             time.Duration
+}
+
+// Compact downsamples the readings past their retention, as of now.
+func Compact(ctx context.Context, repo ReadingRepo, retention Retention, now time.Time) error {
+	steps := []struct {
+		from, to Resolution
+		keep     time.Duration
+	}{
+		{Raw, Hourly, retention.Raw},
+		{Hourly, Daily, retention.Hourly},
+	}
+	for _, step := range steps {
+		// Only whole spans of the coarser resolution are compacted, so a
+		// span is merged once.
+		cutoff := step.to.Truncate(now.Add(-step.keep))
+		old, err := repo.Before(ctx, step.from, cutoff)
+		if err != nil {
+			return fmt.Errorf("could not compact the %s readings: %w", step.from, err)
+		}
+		if len(old) == 0 {
+			continue
+		}
+		type span struct {
+			zone, kind string
+			start      int64
+		}
+		merged := map[span]*Aggregate{}
+		var into []*Aggregate
+		for _, a := range old {
+			a.Resolution, a.Start = step.to, step.to.Truncate(a.Start)
+			key := span{a.Zone, a.Kind, a.Start.Unix()}
+			m := merged[key]
+			if m == nil {
+				m = &Aggregate{}
+				merged[key] = m
+				into = append(into, m)
+			}
+			m.merge(a)
+		}
+		aggregates := make([]Aggregate, len(into))
+		for i, m := range into {
+			aggregates[i] = *m
+		}
+		if err := repo.Replace(ctx, step.from, cutoff, aggregates); err != nil {
+			return fmt.Errorf("could not compact the %s readings: %w", step.from, err)
+		}
+	}
+	if err := repo.Replace(ctx, Daily, now.Add(-retention.Daily), nil); err != nil {
+		return fmt.Errorf("could not drop the old daily readings: %w", err)
+	}
+	return nil
+}
+
+// RunCompaction compacts the readings of repos and prunes their event log
+// every interval until ctx is done.
+func RunCompaction(ctx context.Context, repos Repos, retention Retention, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		now := time.Now()
+		if err := Compact(ctx, repos.Readings, retention, now); err != nil {
+			log.Println("compaction error:", err)
+		}
+		if err := repos.Events.Prune(ctx, now.Add(-retention.Events)); err != nil {
+			log.Println("could not prune the event log:", err)
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	// The SQLite driver registers itself as "sqlite3".
+	_ "github.com/mattn/go-sqlite3"
+
+	"my-app.com/live/store/internal/sqlitedb"
+)
+
+var _ Database = &SQLite{}
+
+// SQLite is the SQLite database implementing the repositories.
+type SQLite struct {
+	DB *sql.DB
+}
+
+// OpenSQLite opens the database file at path, creating it if needed. The
+// schema isn't migrated, see Migrate.
+func OpenSQLite(path string) (*SQLite, error) {
+	// The writes are small and few, a single connection avoids "database
+	// is locked" errors without tuning.
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000&_foreign_keys=on")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not open %s: %w", path, err)
+	}
+	return &SQLite{DB: db}, nil
+}
+
+// Close closes the database.
+func (s *SQLite) Close() error {
+	return s.DB.Close()
+}
+
+// Version returns the schema version of the database, the number of
+// migrations applied.
+func (s *SQLite) Version(ctx context.Context) (int, error) {
+	var version int
+	err := s.DB.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version)
+	return version, err
+}
+
+// Pending returns the number of migrations not applied yet. It fails when
+// the database is newer than this build.
+func (s *SQLite) Pending(ctx context.Context) (int, error) {
+	version, err := s.Version(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if version > len(sqliteMigrations) {
+		return 0, fmt.Errorf("the schema version %d is newer than this build, %d", version, len(sqliteMigrations))
+	}
+	return len(sqliteMigrations) - version, nil
+}
+
+// Migrate applies the pending migrations, each in its own transaction.
+func (s *SQLite) Migrate(ctx context.Context) error {
+	version, err := s.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if _, err := s.Pending(ctx); err != nil {
+		return err
+	}
+	for v := version; v < len(sqliteMigrations); v++ {
+		tx, err := s.DB.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, sqliteMigrations[v]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", v+1, err)
+		}
+		// PRAGMA doesn't take parameters.
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", v+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", v+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d: %w", v+1, err)
+		}
+	}
+	return nil
+}
+
+// Repos returns the repositories kept in the database.
+func (s *SQLite) Repos() Repos {
+	q := sqlitedb.New(s.DB)
+	return Repos{
+		Thermostats: sqliteThermostats{q},
+		Messages:    sqliteMessages{q},
+		Users:       sqliteUsers{q},
+		Readings:    sqliteReadings{s.DB, q},
+		Events:      sqliteEvents{q},
+		Audit:       sqliteAudit{q},
+	}
+}
+
+type sqliteThermostats struct{ q *sqlitedb.Queries }
+
+func (r sqliteThermostats) Get(ctx context.Context, zone string) (Thermostat, error) {
+	row, err := r.q.GetThermostat(ctx, zone)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Thermostat{Zone: zone}, ErrNotFound
+	}
+	return Thermostat{Zone: zone, Setpoint: float32(row.Setpoint), Updated: time.UnixMilli(row.Updated)}, err
+}
+
+func (r sqliteThermostats) Save(ctx context.Context, t Thermostat) error {
+	return r.q.SaveThermostat(ctx, sqlitedb.SaveThermostatParams{Zone: t.Zone, Setpoint: float64(t.Setpoint), Updated: t.Updated.UnixMilli()})
+}
+
+func (r sqliteThermostats) List(ctx context.Context) ([]Thermostat, error) {
+	rows, err := r.q.ListThermostats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var list []Thermostat
+	for _, row := range rows {
+		list = append(list, Thermostat{Zone: row.Zone, Setpoint: float32(row.Setpoint), Updated: time.UnixMilli(row.Updated)})
+	}
+	return list, nil
+}
+
+type sqliteMessages struct{ q *sqlitedb.Queries }
+
+func sqliteMessage(row sqlitedb.Message) Message {
+	return Message{ID: row.ID, Room: row.Room, Author: row.Author, Text: row.Text, Time: time.UnixMilli(row.Time)}
+}
+
+func (r sqliteMessages) Add(ctx context.Context, m Message) (Message, error) {
+	var err error
+	m.ID, err = r.q.AddMessage(ctx, sqlitedb.AddMessageParams{Room: m.Room, Author: m.Author, Text: m.Text, Time: m.Time.UnixMilli()})
+	return m, err
+}
+
+func (r sqliteMessages) Recent(ctx context.Context, room string, n int) ([]Message, error) {
+	rows, err := r.q.RecentMessages(ctx, sqlitedb.RecentMessagesParams{Room: room, Limit: int64(n)})
+	if err != nil {
+		return nil, err
+	}
+	// Newest first from the query, oldest first for the caller.
+	list := make([]Message, len(rows))
+	for i, row := range rows {
+		list[len(rows)-1-i] = sqliteMessage(row)
+	}
+	return list, nil
+}
+
+func (r sqliteMessages) Each(ctx context.Context, from, to time.Time, fn func(Message) error) error {
+	var after int64
+	for {
+		rows, err := r.q.MessagesPage(ctx, sqlitedb.MessagesPageParams{Since: from.UnixMilli(), Until: to.UnixMilli(), AfterID: after, PageSize: eachPage})
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := fn(sqliteMessage(row)); err != nil {
+				return err
+			}
+			after = row.ID
+		}
+		if len(rows) < eachPage {
+			return nil
+		}
+	}
+}
+
+type sqliteUsers struct{ q *sqlitedb.Queries }
+
+func (r sqliteUsers) Get(ctx context.Context, session string) (User, error) {
+	row, err := r.q.GetUser(ctx, session)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{Session: session}, ErrNotFound
+	}
+	return User{Session: session, Name: row.Name, Seen: time.UnixMilli(row.Seen)}, err
+}
+
+func (r sqliteUsers) Save(ctx context.Context, u User) error {
+	return r.q.SaveUser(ctx, sqlitedb.SaveUserParams{Session: u.Session, Name: u.Name, Seen: u.Seen.UnixMilli()})
+}
+
+func (r sqliteUsers) Each(ctx context.Context, from, to time.Time, fn func(User) error) error {
+	after := ""
+	for {
+		rows, err := r.q.UsersPage(ctx, sqlitedb.UsersPageParams{Since: from.UnixMilli(), Until: to.UnixMilli(), AfterSession: after, PageSize: eachPage})
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := fn(User{Session: row.Session, Name: row.Name, Seen: time.UnixMilli(row.Seen)}); err != nil {
+				return err
+			}
+			after = row.Session
+		}
+		if len(rows) < eachPage {
+			return nil
+		}
+	}
+}
+
+type sqliteReadings struct {
+	db *sql.DB
+	q  *sqlitedb.Queries
+}
+
+func sqliteReading(row sqlitedb.Reading) Aggregate {
+	return Aggregate{
+		Resolution: Resolution(row.Resolution), Zone: row.Zone, Kind: row.Kind, Start: time.UnixMilli(row.Start).UTC(),
+		Min: row.Min, Max: row.Max, Sum: row.Sum, Count: int(row.Count),
+	}
+}
+
+func sqliteReadingList(rows []sqlitedb.Reading) []Aggregate {
+	var list []Aggregate
+	for _, row := range rows {
+		list = append(list, sqliteReading(row))
+	}
+	return list
+}
+
+// sqliteMergeReading stores a, merged with the reading of the same span if
+// there is one.
+func sqliteMergeReading(ctx context.Context, q *sqlitedb.Queries, a Aggregate) error {
+	return q.MergeReading(ctx, sqlitedb.MergeReadingParams{
+		Resolution: string(a.Resolution), Zone: a.Zone, Kind: a.Kind, Start: a.Start.UnixMilli(),
+		Min: a.Min, Max: a.Max, Sum: a.Sum, Count: int64(a.Count),
+	})
+}
+
+func (r sqliteReadings) Add(ctx context.Context, a Aggregate) error {
+	return sqliteMergeReading(ctx, r.q, a)
+}
+
+func (r sqliteReadings) Range(ctx context.Context, zone, kind string, res Resolution, from, to time.Time) ([]Aggregate, error) {
+	rows, err := r.q.RangeReadings(ctx, sqlitedb.RangeReadingsParams{
+		Resolution: string(res), Zone: zone, Kind: kind, Since: from.UnixMilli(), Until: to.UnixMilli(),
+	})
+	return sqliteReadingList(rows), err
+}
+
+func (r sqliteReadings) Before(ctx context.Context, res Resolution, t time.Time) ([]Aggregate, error) {
+	rows, err := r.q.ReadingsBefore(ctx, sqlitedb.ReadingsBeforeParams{Resolution: string(res), Start: t.UnixMilli()})
+	return sqliteReadingList(rows), err
+}
+
+func (r sqliteReadings) Replace(ctx context.Context, res Resolution, t time.Time, into []Aggregate) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	q := r.q.WithTx(tx)
+	if err := q.DeleteReadingsBefore(ctx, sqlitedb.DeleteReadingsBeforeParams{Resolution: string(res), Start: t.UnixMilli()}); err != nil {
+		return err
+	}
+	for _, a := range into {
+		if err := sqliteMergeReading(ctx, q, a); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Each pages with an offset, the readings have no single key to seek.
+func (r sqliteReadings) Each(ctx context.Context, from, to time.Time, fn func(Aggregate) error) error {
+	for skip := int64(0); ; skip += eachPage {
+		rows, err := r.q.ReadingsPage(ctx, sqlitedb.ReadingsPageParams{Since: from.UnixMilli(), Until: to.UnixMilli(), PageSize: eachPage, Skip: skip})
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := fn(sqliteReading(row)); err != nil {
+				return err
+			}
+		}
+		if len(rows) < eachPage {
+			return nil
+		}
+	}
+}
+
+type sqliteEvents struct{ q *sqlitedb.Queries }
+
+func sqliteEvent(row sqlitedb.Event) Event {
+	return Event{
+		ID: row.ID, Session: row.Session, Socket: row.Socket, Page: row.Page, Kind: row.Kind, Name: row.Name,
+		Params: json.RawMessage(row.Params), Delta: json.RawMessage(row.Delta), Error: row.Error, Time: time.UnixMilli(row.Time),
+	}
+}
+
+func (r sqliteEvents) Append(ctx context.Context, e Event) (Event, error) {
+	var err error
+	e.ID, err = r.q.AppendEvent(ctx, sqlitedb.AppendEventParams{
+		Session: e.Session, Socket: e.Socket, Page: e.Page, Kind: e.Kind, Name: e.Name,
+		Params: string(e.Params), Delta: string(e.Delta), Error: e.Error, Time: e.Time.UnixMilli(),
+	})
+	return e, err
+}
+
+func (r sqliteEvents) Session(ctx context.Context, session string, after int64, fn func(Event) error) error {
+	for {
+		rows, err := r.q.SessionEvents(ctx, sqlitedb.SessionEventsParams{Session: session, ID: after, Limit: eachPage})
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := fn(sqliteEvent(row)); err != nil {
+				return err
+			}
+			after = row.ID
+		}
+		if len(rows) < eachPage {
+			return nil
+		}
+	}
+}
+
+func (r sqliteEvents) After(ctx context.Context, after int64, n int) ([]Event, error) {
+	rows, err := r.q.EventsAfter(ctx, sqlitedb.EventsAfterParams{ID: after, Limit: int64(n)})
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Event, len(rows))
+	for i, row := range rows {
+		list[i] = sqliteEvent(row)
+	}
+	return list, nil
+}
+
+func (r sqliteEvents) Prune(ctx context.Context, before time.Time) error {
+	return r.q.DeleteEventsBefore(ctx, before.UnixMilli())
+}
+
+type sqliteAudit struct{ q *sqlitedb.Queries }
+
+func (r sqliteAudit) Add(ctx context.Context, e AuditEntry) (AuditEntry, error) {
+	var err error
+	e.ID, err = r.q.AddAudit(ctx, sqlitedb.AddAuditParams{
+		Time: e.Time.UnixMilli(), Actor: e.Actor, Session: e.Session, Action: e.Action, Target: e.Target, Detail: e.Detail,
+	})
+	return e, err
+}
+
+func (r sqliteAudit) List(ctx context.Context, f AuditFilter, skip, n int) ([]AuditEntry, int, error) {
+	actor, action, target := f.likePatterns()
+	total, err := r.q.CountAudit(ctx, sqlitedb.CountAuditParams{Actor: actor, Action: action, Target: target})
+	if err != nil {
+		return nil, 0, err
+	}
+	rows, err := r.q.AuditPage(ctx, sqlitedb.AuditPageParams{Actor: actor, Action: action, Target: target, PageSize: int64(n), Skip: int64(skip)})
+	if err != nil {
+		return nil, 0, err
+	}
+	list := make([]AuditEntry, len(rows))
+	for i, row := range rows {
+		list[i] = AuditEntry{
+			ID: row.ID, Time: time.UnixMilli(row.Time), Actor: row.Actor, Session: row.Session,
+			Action: row.Action, Target: row.Target, Detail: row.Detail,
+		}
+	}
+	return list, int(total), nil
+}
@@ -0,0 +1,97 @@
+// Package store keeps the data of the live pages that outlives a socket:
+// the setpoints of the thermostat zones, the chat messages and the names of
+// the users. The pages use the repository interfaces, SQLite implements
+// them by default, Postgres for shared deployments and Bolt without cgo.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when a record doesn't exist.
+var ErrNotFound = errors.New("store: not found")
+
+// eachPage is the number of records the SQL databases read at once in the
+// Each methods.
+const eachPage = 500
+
+// Thermostat is the stored setpoint of a zone.
+type Thermostat struct {
+	Zone     string
+	Setpoint float32
+	Updated  time.Time
+}
+
+// Message is a chat message sent in a room.
+type Message struct {
+	ID     int64
+	Room   string
+	Author string
+	Text   string
+	Time   time.Time
+}
+
+// User is the user of a session.
+type User struct {
+	Session string
+	Name    string
+	Seen    time.Time
+}
+
+// ThermostatRepo stores the setpoints of the zones.
+type ThermostatRepo interface {
+	// Get returns the thermostat of zone, ErrNotFound if its setpoint was
+	// never changed.
+	Get(ctx context.Context, zone string) (Thermostat, error)
+	// Save stores the setpoint of the thermostat's zone.
+	Save(ctx context.Context, t Thermostat) error
+	// List returns the stored thermostats by zone.
+	List(ctx context.Context) ([]Thermostat, error)
+}
+
+// MessageRepo stores the chat messages.
+type MessageRepo interface {
+	// Add stores m and returns it with its ID.
+	Add(ctx context.Context, m Message) (Message, error)
+	// Recent returns the latest n messages of room, oldest first.
+	Recent(ctx context.Context, room string, n int) ([]Message, error)
+	// Each calls fn with the messages of every room sent from from until
+	// before to, oldest first, until fn fails.
+	Each(ctx context.Context, from, to time.Time, fn func(Message) error) error
+}
+
+// UserRepo stores the users by session.
+type UserRepo interface {
+	// Get returns the user of session, ErrNotFound if the session has none.
+	Get(ctx context.Context, session string) (User, error)
+	// Save stores u, replacing the user of its session.
+	Save(ctx context.Context, u User) error
+	// Each calls fn with the users seen from from until before to, by
+	// session, until fn fails.
+	Each(ctx context.Context, from, to time.Time, fn func(User) error) error
+}
+
+// Repos are the repositories the pages use.
+type Repos struct {
+	Thermostats ThermostatRepo
+	Messages    MessageRepo
+	Users       UserRepo
+	Readings    ReadingRepo
+	Events      EventRepo
+	Audit       AuditRepo
+}
+
+// Database is a database keeping the repositories: SQLite, Postgres or
+// Bolt.
+type Database interface {
+	// Repos returns the repositories kept in the database.
+	Repos() Repos
+	// Pending returns the number of migrations not applied yet. It fails
+	// when the database is newer than this build.
+	Pending(ctx context.Context) (int, error)
+	// Migrate applies the pending migrations.
+	Migrate(ctx context.Context) error
+	Close() error
+}
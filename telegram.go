@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jfyne/live"
+)
+
+const (
+	// telegramPoll is how long a getUpdates call waits for an update.
+	telegramPoll = 30 * time.Second
+	// telegramRetry is the wait after a failed getUpdates call.
+	telegramRetry = 5 * time.Second
+	// telegramSocket is the socket of the events the bot logs.
+	telegramSocket = "telegram"
+)
+
+// TelegramConfig configures the Telegram bot.
+type TelegramConfig struct {
+	// Token is the token of the bot, the bot is disabled without one.
+	Token string
+	// Chats are the IDs of the chats allowed to use the bot.
+	Chats []int64
+	// API is the URL of the Bot API server.
+	API string
+}
+
+// telegramUpdate is an update of the Bot API, the bot only reads the text
+// messages.
+type telegramUpdate struct {
+	ID      int64 `json:"update_id"`
+	Message *struct {
+		From struct {
+			Username     string `json:"username"`
+			FirstName    string `json:"first_name"`
+			LanguageCode string `json:"language_code"`
+		} `json:"from"`
+		Chat struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+		Text string `json:"text"`
+	} `json:"message"`
+}
+
+// telegramPending is a setpoint over the warning limit waiting for
+// /confirm.
+type telegramPending struct {
+	zone string
+	to   float32
+}
+
+// TelegramBot controls the thermostat from the allowed Telegram chats:
+// /temp reports the setpoints and /set 21.5 changes one through the
+// Setpoints, with the validation, the confirmation and the broadcasts of
+// the setpoint form. It long polls the Bot API, so it needs no public URL.
+// The replies are in the language of the Telegram user.
+type TelegramBot struct {
+	cfg       TelegramConfig
+	setpoints *Setpoints
+	locales   *Locales
+	client    *http.Client
+	// pending are the setpoints to confirm by chat, only Run touches them.
+	pending map[int64]telegramPending
+}
+
+// NewTelegramBot creates the bot of cfg over setpoints.
+func NewTelegramBot(cfg TelegramConfig, setpoints *Setpoints, locales *Locales) *TelegramBot {
+	return &TelegramBot{
+		cfg:       cfg,
+		setpoints: setpoints,
+		locales:   locales,
+		client:    &http.Client{Timeout: telegramPoll + 10*time.Second},
+		pending:   map[int64]telegramPending{},
+	}
+}
+
+// Run answers the commands until ctx is done.
+func (b *TelegramBot) Run(ctx context.Context) {
+	var offset int64
+	for {
+		updates, err := b.updates(ctx, offset)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Println("telegram:", err)
+			select {
+			case <-time.After(telegramRetry):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+		for _, u := range updates {
+			offset = u.ID + 1
+			if u.Message == nil || u.Message.Text == "" {
+				continue
+			}
+			loc := b.locales.Get(u.Message.From.LanguageCode)
+			actor := u.Message.From.Username
+			if actor == "" {
+				actor = u.Message.From.FirstName
+			}
+			reply := b.handle(ctx, loc, u.Message.Chat.ID, "Telegram "+actor, u.Message.Text)
+			if err := b.send(ctx, u.Message.Chat.ID, reply); err != nil {
+				log.Println("telegram:", err)
+			}
+		}
+	}
+}
+
+// handle runs a command of chat and returns the reply.
+func (b *TelegramBot) handle(ctx context.Context, loc *Locale, chat int64, actor, text string) string {
+	allowed := false
+	for _, id := range b.cfg.Chats {
+		allowed = allowed || id == chat
+	}
+	if !allowed {
+		return loc.T("This chat may not use the thermostat, its ID is %d.", chat)
+	}
+	args := strings.Fields(text)
+	// In groups the commands may name the bot, /set@thermostat_bot.
+	cmd, _, _ := strings.Cut(args[0], "@")
+	args = args[1:]
+	switch cmd {
+	case "/start", "/help":
+		return strings.Join([]string{
+			loc.T("/temp [zone] - the setpoints, of every zone or of one"),
+			loc.T("/set 21.5 [zone] - sets the setpoint of a zone, main by default"),
+			loc.T("/confirm - sets a setpoint over the warning limit"),
+		}, "\n")
+	case "/temp":
+		zones := b.setpoints.Zones()
+		if len(args) > 0 {
+			zones = args[:1]
+		}
+		var lines []string
+		for _, zone := range zones {
+			c, err := b.setpoints.Control(ctx, zone)
+			if err != nil {
+				return b.fail(loc, err)
+			}
+			if c == nil {
+				return loc.T("Unknown zone %s.", zone)
+			}
+			lines = append(lines, b.state(loc, c))
+		}
+		return strings.Join(lines, "\n")
+	case "/set":
+		if len(args) == 0 {
+			return loc.T("Usage: /set 21.5 [zone]")
+		}
+		p := live.Params{"temperature": args[0]}
+		if errs := setpointForm.Validate(p); len(errs) > 0 {
+			return loc.Format(errs["temperature"])
+		}
+		zone := "main"
+		if len(args) > 1 {
+			zone = args[1]
+		}
+		delete(b.pending, chat)
+		return b.set(ctx, loc, chat, actor, zone, p.Float32("temperature"), false)
+	case "/confirm":
+		pending, ok := b.pending[chat]
+		if !ok {
+			return loc.T("Nothing to confirm.")
+		}
+		delete(b.pending, chat)
+		return b.set(ctx, loc, chat, actor, pending.zone, pending.to, true)
+	default:
+		return loc.T("Unknown command, see /help.")
+	}
+}
+
+// set changes the setpoint of zone. An unconfirmed setpoint over the
+// warning limit waits for /confirm.
+func (b *TelegramBot) set(ctx context.Context, loc *Locale, chat int64, actor, zone string, to float32, confirmed bool) string {
+	c, err := b.setpoints.Control(ctx, zone)
+	if err != nil {
+		return b.fail(loc, err)
+	}
+	if c == nil {
+		return loc.T("Unknown zone %s.", zone)
+	}
+	o := SetpointOrigin{Actor: actor, Socket: telegramSocket, Page: "/set"}
+	err = b.setpoints.Set(ctx, c, to, confirmed, o)
+	if errors.Is(err, ErrNotConfirmed) {
+		b.pending[chat] = telegramPending{zone: zone, to: to}
+		return loc.T("%s is over the warning limit of %s, send /confirm to set it anyway.", loc.Temp(to), loc.Temp(tempLimit))
+	}
+	if err != nil {
+		return b.fail(loc, err)
+	}
+	return b.state(loc, c)
+}
+
+// state is the line of the setpoint of c.
+func (b *TelegramBot) state(loc *Locale, c *TempControl) string {
+	line := loc.T("%s is set to %s.", c.Zone, loc.Temp(c.Temperature))
+	if c.TooHot() {
+		line += " ⚠"
+	}
+	return line
+}
+
+func (b *TelegramBot) fail(loc *Locale, err error) string {
+	log.Println("telegram:", err)
+	return loc.T(genericError)
+}
+
+// updates long polls the updates after offset.
+func (b *TelegramBot) updates(ctx context.Context, offset int64) ([]telegramUpdate, error) {
+	q := url.Values{
+		"offset":          {strconv.FormatInt(offset, 10)},
+		"timeout":         {strconv.Itoa(int(telegramPoll / time.Second))},
+		"allowed_updates": {`["message"]`},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.method("getUpdates")+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	var updates []telegramUpdate
+	return updates, b.call(req, &updates)
+}
+
+// send sends text to chat.
+func (b *TelegramBot) send(ctx context.Context, chat int64, text string) error {
+	body, err := json.Marshal(map[string]interface{}{"chat_id": chat, "text": text})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.method("sendMessage"), strings.NewReader(string(body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return b.call(req, nil)
+}
+
+func (b *TelegramBot) method(name string) string {
+	return strings.TrimSuffix(b.cfg.API, "/") + "/bot" + b.cfg.Token + "/" + name
+}
+
+// call sends a request of the Bot API and decodes its result into v.
+func (b *TelegramBot) call(req *http.Request, v interface{}) error {
+	resp, err := b.client.Do(req)
+	if err != nil {
+		// The error would include the URL, and the token with it.
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	var answer struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return fmt.Errorf("%s: %w", resp.Status, err)
+	}
+	if !answer.OK {
+		return fmt.Errorf("%s: %s", resp.Status, answer.Description)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(answer.Result, v)
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jfyne/live"
+
+	"my-app.com/live/store"
+)
+
+// tempLimit is the temperature above which a control shows its warning.
+const tempLimit = 25.0
+
+// historySize is the number of readings a control keeps.
+const historySize = 60
+
+// slideInterval is how often a control applies the values of its slider
+// while it's dragged.
+const slideInterval = 150 * time.Millisecond
+
+// setpointEvent is the self event moving the controls of a zone to a
+// setpoint set outside of the page, by the API.
+const setpointEvent = "setpoint"
+
+// TempControl is the temperature control component: the setpoint of a
+// zone with the +/- buttons and the warning banner. A page keeps its
+// instances in its model and renders each one with the
+// "temperature-control" partial. Events carry the instance ID, so several
+// controls can share a page.
+type TempControl struct {
+	ID          string
+	Zone        string
+	Temperature float32
+	// History holds the latest setpoints, oldest first.
+	History []Reading
+	// Errors are the errors of the setpoint form.
+	Errors Errors `json:"-"`
+}
+
+// setpointForm validates the setpoint form of a control.
+var setpointForm = Form{
+	"temperature": {Required(), Range(5, 35)},
+}
+
+// validSetpoint validates the setpoint a step leads to with setpointForm,
+// the steps stay in the range of the form.
+func validSetpoint(to float32) Errors {
+	return setpointForm.Validate(live.Params{"temperature": strconv.FormatFloat(float64(to), 'f', -1, 32)})
+}
+
+// ReadingRecorder records the setpoints the controls set.
+type ReadingRecorder interface {
+	Record(zone string, r Reading)
+}
+
+// RecorderFunc adapts a function to ReadingRecorder.
+type RecorderFunc func(zone string, r Reading)
+
+// Record calls f.
+func (f RecorderFunc) Record(zone string, r Reading) {
+	f(zone, r)
+}
+
+// SetpointChange is the data of setpointEvent, the new setpoint of Zone.
+type SetpointChange struct {
+	Zone    string
+	Reading Reading
+}
+
+// TempControls is implemented by page models holding temperature controls.
+type TempControls interface {
+	// TempControl returns the control with the given ID, nil if there is
+	// none.
+	TempControl(id string) *TempControl
+}
+
+// NewTempControl mounts a control for zone at the default setpoint.
+func NewTempControl(zone string) *TempControl {
+	c := &TempControl{
+		ID:          zone,
+		Zone:        zone,
+		Temperature: 19.5,
+	}
+	c.record(time.Now())
+	return c
+}
+
+// record appends the current setpoint to the history.
+func (c *TempControl) record(at time.Time) Reading {
+	r := Reading{Time: at, Value: c.Temperature}
+	c.History = append(c.History, r)
+	if len(c.History) > historySize {
+		c.History = c.History[len(c.History)-historySize:]
+	}
+	return r
+}
+
+// LoadSetpoint starts c at the stored setpoint of its zone, if it was
+// ever changed.
+func LoadSetpoint(ctx context.Context, repo store.ThermostatRepo, c *TempControl) error {
+	t, err := repo.Get(ctx, c.Zone)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not load the setpoint of %s: %w", c.Zone, err)
+	}
+	c.Temperature = t.Setpoint
+	c.History = nil
+	c.record(t.Updated)
+	return nil
+}
+
+// Changed returns when the setpoint last changed.
+func (c *TempControl) Changed() time.Time {
+	if len(c.History) == 0 {
+		return time.Time{}
+	}
+	return c.History[len(c.History)-1].Time
+}
+
+// Shortcuts returns the keyboard shortcuts of the control: the arrow keys
+// for the ±0.1C steps, PageUp and PageDown for ±2C and "s" for the
+// setpoint form. Only one control on a page should register them.
+func (c *TempControl) Shortcuts() []Shortcut {
+	id := map[string]string{"id": c.ID}
+	return []Shortcut{
+		{Key: "ArrowUp", Event: "temp-up", Params: id, Label: Message{Key: "Raise by %.1f °C", Args: []interface{}{0.1}}},
+		{Key: "ArrowDown", Event: "temp-down", Params: id, Label: Message{Key: "Lower by %.1f °C", Args: []interface{}{0.1}}},
+		{Key: "PageUp", Event: "temp-change", Params: map[string]string{"id": c.ID, "temperature": "2"}, Label: Message{Key: "Raise by %.1f °C", Args: []interface{}{2.0}}},
+		{Key: "PageDown", Event: "temp-change", Params: map[string]string{"id": c.ID, "temperature": "-2"}, Label: Message{Key: "Lower by %.1f °C", Args: []interface{}{2.0}}},
+		{Key: "s", Focus: "#setpoint-" + c.ID + " input[name=temperature]", Label: Message{Key: "Setpoint"}},
+	}
+}
+
+// sendSlider moves the slider of the control to its setpoint. The slider
+// isn't re-rendered, so it keeps working while it's dragged.
+func sendSlider(s live.Socket, c *TempControl) error {
+	return s.Send("temp-slider", map[string]interface{}{"id": c.ID, "temperature": c.Temperature})
+}
+
+// TooHot reports whether the setpoint is over the warning limit.
+func (c *TempControl) TooHot() bool {
+	return c.Temperature > tempLimit
+}
+
+// NeedsConfirm reports whether moving the setpoint to the given temperature
+// has to be confirmed: it takes the control over the warning limit.
+func (c *TempControl) NeedsConfirm(to float32) bool {
+	return to > tempLimit && !c.TooHot()
+}
+
+// TempChangeFunc is called after a temp-change event moved the setpoint of
+// a control away from the given temperature.
+type TempChangeFunc func(ctx context.Context, s live.Socket, c *TempControl, from float32)
+
+// confirmHot asks to confirm a change taking the control over the warning
+// limit. It reports whether the event has to wait for the confirmation.
+func confirmHot(s live.Socket, p live.Params, event string, c *TempControl, to float32) bool {
+	if !c.NeedsConfirm(to) || Confirmed(s, p) {
+		return false
+	}
+	params := map[string]string{}
+	for k := range p {
+		params[k] = p.String(k)
+	}
+	Confirm(s, Modal{
+		Title:   Message{Key: "Confirm temperature"},
+		Message: Message{Key: "Really set the temperature to %.1f °C?", Args: []interface{}{to}},
+		Event:   event,
+		Params:  params,
+	})
+	return true
+}
+
+// HandleTempControl registers the events of the temperature control
+// component on h. model returns the page model of the socket, changed is
+// called after each temp-change event and may be nil. The ±0.1C steps
+// don't report. The setpoint form sends temp-set, which reports like
+// temp-change. The slider sends temp-slide while it's dragged, applied at
+// most every slideInterval, and reports too. Every change is pushed to the
+// chart and the slider of the control and recorded with recorder, unless
+// it is nil. The controls of a zone follow its setpointEvent.
+func HandleTempControl(h *Handler, model func(ctx context.Context, s live.Socket) TempControls, changed TempChangeFunc, recorder ReadingRecorder) {
+	set := func(s live.Socket, c *TempControl, to float32) error {
+		c.Temperature = to
+		r := c.record(time.Now())
+		if recorder != nil {
+			recorder.Record(c.Zone, r)
+		}
+		if err := sendSlider(s, c); err != nil {
+			return err
+		}
+		return PushPoint(s, c.ID, r)
+	}
+
+	step := func(event string, delta func(p live.Params) float32, report bool) live.EventHandler {
+		return func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+			m := model(ctx, s)
+			c := m.TempControl(p.String("id"))
+			if c == nil {
+				return m, fmt.Errorf("unknown temperature control %q", p.String("id"))
+			}
+			to := c.Temperature + delta(p)
+			if c.Errors = validSetpoint(to); len(c.Errors) > 0 {
+				return m, nil
+			}
+			if confirmHot(s, p, event, c, to) {
+				return m, nil
+			}
+			from := c.Temperature
+			if err := set(s, c, to); err != nil {
+				return m, err
+			}
+			if report && changed != nil {
+				changed(ctx, s, c, from)
+			}
+			return m, nil
+		}
+	}
+
+	h.HandleEvent("temp-up", step("temp-up", func(live.Params) float32 { return 0.1 }, false))
+	h.HandleEvent("temp-down", step("temp-down", func(live.Params) float32 { return -0.1 }, false))
+	h.HandleEvent("temp-change", step("temp-change", func(p live.Params) float32 { return p.Float32("temperature") }, true))
+
+	h.HandleEvent("temp-set", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := model(ctx, s)
+		c := m.TempControl(p.String("id"))
+		if c == nil {
+			return m, fmt.Errorf("unknown temperature control %q", p.String("id"))
+		}
+		if c.Errors = setpointForm.Validate(p); len(c.Errors) > 0 {
+			return m, nil
+		}
+		to := p.Float32("temperature")
+		if confirmHot(s, p, "temp-set", c, to) {
+			return m, nil
+		}
+		from := c.Temperature
+		if err := set(s, c, to); err != nil {
+			return m, err
+		}
+		if changed != nil {
+			changed(ctx, s, c, from)
+		}
+		return m, nil
+	})
+
+	h.HandleThrottled("temp-slide", slideInterval, func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := model(ctx, s)
+		c := m.TempControl(p.String("id"))
+		if c == nil {
+			return m, fmt.Errorf("unknown temperature control %q", p.String("id"))
+		}
+		to := p.Float32("temperature")
+		if len(setpointForm.Validate(p)) > 0 || to == c.Temperature {
+			return m, nil
+		}
+		if confirmHot(s, p, "temp-slide", c, to) {
+			// Back to the current setpoint until it's confirmed.
+			return m, sendSlider(s, c)
+		}
+		from := c.Temperature
+		if err := set(s, c, to); err != nil {
+			return m, err
+		}
+		if changed != nil {
+			changed(ctx, s, c, from)
+		}
+		return m, nil
+	})
+
+	// The setpoint was recorded already, the control only shows it.
+	h.HandleSelf(setpointEvent, func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		m := model(ctx, s)
+		change := data.(SetpointChange)
+		c := m.TempControl(change.Zone)
+		if c == nil || c.Zone != change.Zone {
+			return m, nil
+		}
+		c.Temperature = change.Reading.Value
+		r := c.record(change.Reading.Time)
+		if err := sendSlider(s, c); err != nil {
+			return m, err
+		}
+		return m, PushPoint(s, c.ID, r)
+	})
+
+	h.HandleEvent("temp-slider-ready", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := model(ctx, s)
+		if c := m.TempControl(p.String("id")); c != nil {
+			return m, sendSlider(s, c)
+		}
+		return m, nil
+	})
+
+	h.HandleEvent("chart-ready", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := model(ctx, s)
+		if c := m.TempControl(p.String("chart")); c != nil {
+			return m, SendChart(s, c.ID, c.History)
+		}
+		return m, nil
+	})
+}
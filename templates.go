@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jfyne/live"
+)
+
+//go:embed templates
+var embeddedTemplates embed.FS
+
+// templateFS returns the file system templates are loaded from. In dev
+// mode this is the template directory on disk, so edits are picked up
+// without restarting the server.
+func templateFS(cfg Config) fs.FS {
+	if cfg.Dev {
+		return os.DirFS(cfg.TemplateDir)
+	}
+	sub, err := fs.Sub(embeddedTemplates, "templates")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// layoutFiles are parsed along with every page template: the base layout
+// and the partials pages can include.
+var layoutFiles = []string{"layout.html", "partials/*.html"}
+
+// parseTemplate parses the named page template from fsys together with
+// the layout and partials. A page starts with {{template "layout" .}} and
+// defines the "content" block, and optionally "head" and "hooks". funcs
+// are the functions of the locale the template renders.
+func parseTemplate(fsys fs.FS, name string, funcs template.FuncMap) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Funcs(funcs).ParseFS(fsys, append(layoutFiles, name)...)
+}
+
+// Templates is the registry of page templates. Templates are parsed on
+// first use and cached by name and locale. In dev mode a cached template
+// is dropped as soon as its file changes on disk, so edits show up on the
+// next render without restarting the server.
+type Templates struct {
+	fsys    fs.FS
+	dev     bool
+	locales *Locales
+
+	mu    sync.RWMutex
+	cache map[string]*cachedTemplate
+}
+
+type cachedTemplate struct {
+	tmpl    *template.Template
+	modTime time.Time
+}
+
+// NewTemplates creates a registry reading templates from fsys and
+// rendering them in the given locales.
+func NewTemplates(fsys fs.FS, dev bool, locales *Locales) *Templates {
+	return &Templates{
+		fsys:    fsys,
+		dev:     dev,
+		locales: locales,
+		cache:   map[string]*cachedTemplate{},
+	}
+}
+
+// Lookup returns the named template in the default locale.
+func (t *Templates) Lookup(name string) (*template.Template, error) {
+	return t.LookupLocale(name, t.locales.Get(defaultLocale))
+}
+
+// LookupLocale returns the named template in a locale, parsing it when it
+// is not cached.
+func (t *Templates) LookupLocale(name string, loc *Locale) (*template.Template, error) {
+	key := name + "@" + loc.Code()
+	t.mu.RLock()
+	c, ok := t.cache[key]
+	t.mu.RUnlock()
+
+	if ok && !t.dev {
+		return c.tmpl, nil
+	}
+
+	modTime := t.modTime(name)
+	if ok && !modTime.After(c.modTime) {
+		return c.tmpl, nil
+	}
+
+	tmpl, err := parseTemplate(t.fsys, name, localeFuncs(t.locales, loc))
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	t.cache[key] = &cachedTemplate{tmpl: tmpl, modTime: modTime}
+	t.mu.Unlock()
+	return tmpl, nil
+}
+
+// Invalidate drops the named templates from the cache, in every locale,
+// or every template when no name is given.
+func (t *Templates) Invalidate(names ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(names) == 0 {
+		t.cache = map[string]*cachedTemplate{}
+		return
+	}
+	for _, name := range names {
+		for _, loc := range t.locales.All() {
+			delete(t.cache, name+"@"+loc.Code())
+		}
+	}
+}
+
+// ParseAll parses every template in every locale, reporting the first
+// invalid one.
+func (t *Templates) ParseAll() error {
+	names, err := fs.Glob(t.fsys, "*.html")
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return errors.New("no templates found")
+	}
+	for _, name := range names {
+		if name == layoutFiles[0] {
+			continue
+		}
+		for _, loc := range t.locales.All() {
+			if _, err := t.LookupLocale(name, loc); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Render returns a render handler executing the named template in the
+// locale of the page.
+func (t *Templates) Render(name string) live.RenderHandler {
+	return func(ctx context.Context, data *live.RenderContext) (io.Reader, error) {
+		var code string
+		if m, ok := data.Assigns.(pageModel); ok {
+			code = m.page().Locale
+		}
+		tmpl, err := t.LookupLocale(name, t.locales.Get(code))
+		if err != nil {
+			return nil, err
+		}
+		buf := renderBuffers.Get().(*bytes.Buffer)
+		if err := tmpl.Execute(buf, data); err != nil {
+			putRenderBuffer(buf)
+			return nil, err
+		}
+		return &renderReader{buf: buf}, nil
+	}
+}
+
+// maxRenderBuffer is the capacity of the largest buffer put back in the
+// pool, a page rendering a huge table mustn't hold its buffer forever.
+const maxRenderBuffer = 1 << 20
+
+// renderBuffers are the buffers the templates render into. A render of
+// every socket every second would otherwise grow a new buffer each time.
+var renderBuffers = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+// putRenderBuffer puts buf back in the pool, empty.
+func putRenderBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxRenderBuffer {
+		return
+	}
+	buf.Reset()
+	renderBuffers.Put(buf)
+}
+
+// renderReader reads a render from a buffer of the pool, the buffer goes
+// back to the pool once it is read to the end. The live engine and the
+// render memo read every render to the end.
+type renderReader struct {
+	buf *bytes.Buffer
+}
+
+func (r *renderReader) Read(p []byte) (int, error) {
+	if r.buf == nil {
+		return 0, io.EOF
+	}
+	n, err := r.buf.Read(p)
+	if err == io.EOF {
+		r.release()
+	}
+	return n, err
+}
+
+func (r *renderReader) WriteTo(w io.Writer) (int64, error) {
+	if r.buf == nil {
+		return 0, nil
+	}
+	n, err := r.buf.WriteTo(w)
+	r.release()
+	return n, err
+}
+
+// bytes returns a copy of the unread render, releasing the buffer.
+func (r *renderReader) bytes() []byte {
+	if r.buf == nil {
+		return nil
+	}
+	b := append([]byte(nil), r.buf.Bytes()...)
+	r.release()
+	return b
+}
+
+func (r *renderReader) release() {
+	putRenderBuffer(r.buf)
+	r.buf = nil
+}
+
+// readRender reads the render r to the end, copying a pooled render once
+// rather than growing a slice for it.
+func readRender(r io.Reader) ([]byte, error) {
+	if rr, ok := r.(*renderReader); ok {
+		return rr.bytes(), nil
+	}
+	return io.ReadAll(r)
+}
+
+// modTime returns the latest modification time of the files the named
+// template is parsed from, the zero time when it is unknown.
+func (t *Templates) modTime(name string) time.Time {
+	var latest time.Time
+	for _, pattern := range append(layoutFiles, name) {
+		files, _ := fs.Glob(t.fsys, pattern)
+		for _, file := range files {
+			info, err := fs.Stat(t.fsys, file)
+			if err != nil {
+				continue
+			}
+			if info.ModTime().After(latest) {
+				latest = info.ModTime()
+			}
+		}
+	}
+	return latest
+}
+
+// overflowPage renders the page shown by Sockets to new visitors once the
+// socket limit is reached or the server is draining.
+func overflowPage(templates *Templates, sockets *Sockets) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tmpl, err := templates.Lookup("full.html")
+		if err != nil {
+			serverFull(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		tmpl.Execute(w, map[string]interface{}{
+			"Connected": sockets.Count(),
+			"Draining":  sockets.Draining(),
+		})
+	})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jfyne/live"
+)
+
+// benchRenderContext is the render context of a thermostat page with a
+// full history and feed, the page most events render.
+func benchRenderContext() *live.RenderContext {
+	c := &TempControl{ID: "main", Zone: "main", Temperature: 21.5}
+	now := time.Now()
+	for i := 0; i < historySize; i++ {
+		c.History = append(c.History, Reading{Time: now.Add(time.Duration(i-historySize) * time.Minute), Value: 20 + float32(i%10)/10})
+	}
+	m := &ThermoModel{Page: Page{Time: now.Format("15:04:05"), Locale: defaultLocale}, Name: "Main", Zone: "main", PathZone: "main", Control: c}
+	for i := 0; i < 20; i++ {
+		m.Feed.Entries = append(m.Feed.Entries, fmt.Sprintf("Main: setpoint %d", i))
+	}
+	return &live.RenderContext{Assigns: m}
+}
+
+// BenchmarkRenderParse renders the thermostat page parsing its template on
+// every render, as the pages did before the template registry.
+func BenchmarkRenderParse(b *testing.B) {
+	fsys := templateFS(Config{})
+	locales := mustLoadLocales()
+	loc := locales.Get(defaultLocale)
+	data := benchRenderContext()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		tmpl, err := parseTemplate(fsys, "thermostat.html", localeFuncs(locales, loc))
+		if err != nil {
+			b.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkRender renders the thermostat page with the template the
+// registry parsed once.
+func BenchmarkRender(b *testing.B) {
+	templates := NewTemplates(templateFS(Config{}), false, mustLoadLocales())
+	if err := templates.ParseAll(); err != nil {
+		b.Fatal(err)
+	}
+	render := templates.Render("thermostat.html")
+	data := benchRenderContext()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r, err := render(context.Background(), data)
+		if err != nil {
+			b.Fatal(err)
+		}
+		io.Copy(io.Discard, r)
+	}
+}
+
+// BenchmarkRenderMemo renders the thermostat page through the render memo
+// with a change of the model every render, the per-second broadcast of the
+// clock.
+func BenchmarkRenderMemo(b *testing.B) {
+	templates := NewTemplates(templateFS(Config{}), false, mustLoadLocales())
+	if err := templates.ParseAll(); err != nil {
+		b.Fatal(err)
+	}
+	render := NewRenderMemo(templates.Render("thermostat.html")).Render
+	data := benchRenderContext()
+	m := data.Assigns.(*ThermoModel)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Time = strconv.Itoa(i)
+		r, err := render(context.Background(), data)
+		if err != nil {
+			b.Fatal(err)
+		}
+		io.Copy(io.Discard, r)
+	}
+}
+
+// BenchmarkRenderMemoHash hashes the model of an upload page with a full
+// file list and uploads under way, as every upload-chunk event does.
+func BenchmarkRenderMemoHash(b *testing.B) {
+	m := &UploadModel{Page: Page{Locale: defaultLocale}}
+	for i := 0; i < uploadMaxFiles; i++ {
+		m.Files = append(m.Files, UploadedFile{ID: i, Name: fmt.Sprintf("file%d.png", i), Size: uploadMaxSize, content: make([]byte, uploadMaxSize)})
+		m.Pending = append(m.Pending, &Upload{Ref: strconv.Itoa(i), Size: uploadMaxSize, Received: uploadMaxSize / 2, data: make([]byte, uploadMaxSize/2)})
+	}
+	memo := NewRenderMemo(nil)
+	data := &live.RenderContext{Assigns: m}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		memo.hash(data)
+	}
+}
+
+// BenchmarkRenderParallel renders the thermostat page of many sockets at
+// once.
+func BenchmarkRenderParallel(b *testing.B) {
+	templates := NewTemplates(templateFS(Config{}), false, mustLoadLocales())
+	if err := templates.ParseAll(); err != nil {
+		b.Fatal(err)
+	}
+	render := templates.Render("thermostat.html")
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		data := benchRenderContext()
+		for pb.Next() {
+			r, err := render(context.Background(), data)
+			if err != nil {
+				b.Fatal(err)
+			}
+			io.Copy(io.Discard, r)
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/jfyne/live"
+)
+
+// Themes of the layout.
+const (
+	themeLight = "light"
+	themeDark  = "dark"
+)
+
+// sessionTheme is a mount middleware applying the theme stored in the
+// session to the page.
+func sessionTheme(mount live.MountHandler) live.MountHandler {
+	return func(ctx context.Context, s live.Socket) (interface{}, error) {
+		model, err := mount(ctx, s)
+		if err != nil {
+			return model, err
+		}
+		if m, ok := model.(pageModel); ok {
+			theme, _ := s.Session()["theme"].(string)
+			m.page().Theme = validTheme(theme)
+		}
+		return model, nil
+	}
+}
+
+// toggleTheme flips the theme of the page. The session can't be saved from
+// a websocket event, so the page is asked to store the theme with a
+// request to themeHandler.
+func toggleTheme(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+	m, ok := s.Assigns().(pageModel)
+	if !ok {
+		return s.Assigns(), nil
+	}
+	page := m.page()
+	if page.Theme == themeDark {
+		page.Theme = themeLight
+	} else {
+		page.Theme = themeDark
+	}
+	s.Session()["theme"] = page.Theme
+	if err := s.Send("theme", map[string]string{"theme": page.Theme}); err != nil {
+		return s.Assigns(), err
+	}
+	return s.Assigns(), nil
+}
+
+// themeHandler stores the "theme" form value in the session of the
+// request.
+func themeHandler(store live.HttpSessionStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session, err := store.Get(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		session["theme"] = validTheme(r.FormValue("theme"))
+		if err := store.Save(w, r, session); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func validTheme(theme string) string {
+	if theme == themeDark {
+		return themeDark
+	}
+	return themeLight
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jfyne/live"
+
+	"my-app.com/live/store"
+)
+
+type ThermoModel struct {
+	Page
+	Name string
+	Zone string
+	// PathZone is the zone of the URL path the page was loaded at, the
+	// zone the history goes back to without a zone param.
+	PathZone string
+	Control  *TempControl
+	Feed     Feed
+	// configured are the IDs of the zones added with the setup wizard.
+	configured []string
+	// Errors are the errors of the chat form.
+	Errors Errors `json:"-"`
+	// LastMessage is when the user last sent a chat message.
+	LastMessage time.Time `json:"-"`
+}
+
+// messageInterval is the minimum time between two chat messages of a user.
+const messageInterval = time.Second
+
+// chatForm validates the chat form.
+var chatForm = Form{
+	"message": {Required(), Length(1, 280)},
+}
+
+type NatsMessage struct {
+	Name  string
+	Value int64
+}
+
+func NewThermoModel(ctx context.Context, s live.Socket) *ThermoModel {
+	return newThermoModel(ctx, s, nil)
+}
+
+// newThermoModel returns the model of the socket, or mounts one for the
+// zone of the URL starting at its configured setpoint.
+func newThermoModel(ctx context.Context, s live.Socket, zones *ZoneConfigs) *ThermoModel {
+	m, ok := s.Assigns().(*ThermoModel)
+
+	if !ok {
+		r := live.Request(ctx)
+		zone := chi.URLParam(r, "zone")
+		if zone == "" {
+			zone = "main"
+		}
+		m = &ThermoModel{
+			Name:     r.URL.Query().Get("name"),
+			PathZone: zone,
+			Feed:     NewFeed("feed"),
+		}
+		if q := r.URL.Query().Get("zone"); q != "" {
+			zone = q
+		}
+		m.SwitchZone(zone, zones)
+	}
+
+	return m
+}
+
+// SwitchZone moves the thermostat to another zone. The name, the chat and
+// the status feed stay as they are. A zone of zones starts at its
+// setpoint.
+func (m *ThermoModel) SwitchZone(zone string, zones *ZoneConfigs) {
+	var config *ZoneConfig
+	if zones != nil {
+		m.configured = nil
+		for _, c := range zones.List() {
+			m.configured = append(m.configured, c.ID)
+			if c.ID == zone {
+				c := c
+				config = &c
+			}
+		}
+	}
+	if m.Control != nil && zone == m.Zone {
+		return
+	}
+	m.Zone = zone
+	m.Control = NewTempControl(zone)
+	if config != nil {
+		m.Control.Temperature = config.Setpoint
+		m.Control.History = nil
+		m.Control.record(time.Now())
+	}
+	m.Shortcuts = nil
+	m.AddShortcut(m.Control.Shortcuts()...)
+	m.AddShortcut(Shortcut{Key: "m", Focus: "#chat input[name=message]", Label: Message{Key: "Message"}})
+}
+
+// Zones returns the zones the page links to.
+func (m *ThermoModel) Zones() []string {
+	zones := append([]string{"main"}, dashboardZones...)
+	return append(zones, m.configured...)
+}
+
+// StatusFeed returns the status feed of the thermostat.
+func (m *ThermoModel) StatusFeed() *Feed {
+	return &m.Feed
+}
+
+// Pager returns the pager of the status feed.
+func (m *ThermoModel) Pager(id string) *Pager {
+	if m.Feed.Pager.ID == id {
+		return &m.Feed.Pager
+	}
+	return nil
+}
+
+// TempControl returns the thermostat's control.
+func (m *ThermoModel) TempControl(id string) *TempControl {
+	if m.Control != nil && m.Control.ID == id {
+		return m.Control
+	}
+	return nil
+}
+
+// newThermostat creates the thermostat live handler.
+func newThermostat(app *App) *Handler {
+	h := app.NewHandler()
+	h.HandleRender(app.Render("thermostat.html"))
+	h.HandlePatch("time", patchTime(true))
+	h.HandleMount(thermoMount(app))
+
+	HandleTempControl(h, func(ctx context.Context, s live.Socket) TempControls {
+		return NewThermoModel(ctx, s)
+	}, tempChanged(app), app.Recorder)
+	h.HandleEvent("save", saveEvent(app))
+	// The zone links patch the URL, /thermostat?zone=kitchen, so moving
+	// between zones keeps the socket.
+	h.HandleParams(func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		model := NewThermoModel(ctx, s)
+		zone := p.String("zone")
+		if zone == "" {
+			zone = model.PathZone
+		}
+		model.SwitchZone(zone, app.Zones)
+		return model, LoadSetpoint(ctx, app.Repos.Thermostats, model.Control)
+	})
+
+	app.Invites.handle(h, func(ctx context.Context, s live.Socket) string {
+		return "/thermostat?zone=" + url.QueryEscape(NewThermoModel(ctx, s).Zone)
+	})
+
+	h.HandleSelf("status", func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		model := NewThermoModel(ctx, s)
+		model.Feed.Add(data.(string))
+
+		return model, nil
+	})
+
+	return h
+}
+
+func thermoMount(app *App) live.MountHandler {
+	return func(ctx context.Context, s live.Socket) (interface{}, error) {
+		log.Println("Mounting application")
+
+		// Only connected sockets listen to the bus, the subscription ends with
+		// the connection.
+		if app.Bus != nil && s.Connected() {
+			sub, err := subscribeTraced(ctx, app.Bus, "go-live", func() interface{} { return &NatsMessage{} }, func(ctx context.Context, v interface{}) {
+				timeUnix := time.UnixMilli(v.(*NatsMessage).Value)
+				app.State.Send(s, "status", "Nats message: "+timeUnix.Format(time.RFC1123))
+			})
+			if err != nil {
+				return nil, fmt.Errorf("could not subscribe to the bus: %w", err)
+			}
+			go func() {
+				<-ctx.Done()
+				sub.Unsubscribe()
+			}()
+		}
+
+		m := newThermoModel(ctx, s, app.Zones)
+		if err := loadThermo(ctx, app, s, m); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+}
+
+// chatRoom is the room of the thermostat chat in the message repository,
+// the chat is shared by every zone.
+const chatRoom = "thermostat"
+
+// loadThermo fills m with the stored data: the setpoint of the zone, the
+// name of the user and the latest chat messages. A name in the URL is
+// remembered for the session.
+func loadThermo(ctx context.Context, app *App, s live.Socket, m *ThermoModel) error {
+	if err := LoadSetpoint(ctx, app.Repos.Thermostats, m.Control); err != nil {
+		return err
+	}
+	session := live.SessionID(s.Session())
+	if m.Name != "" {
+		if err := app.Repos.Users.Save(ctx, store.User{Session: session, Name: m.Name, Seen: time.Now()}); err != nil {
+			return fmt.Errorf("could not save the user: %w", err)
+		}
+	} else if u, err := app.Repos.Users.Get(ctx, session); err == nil {
+		m.Name = u.Name
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("could not load the user: %w", err)
+	}
+	if len(m.Feed.Entries) == 0 {
+		messages, err := app.Repos.Messages.Recent(ctx, chatRoom, feedBacklog)
+		if err != nil {
+			return fmt.Errorf("could not load the messages: %w", err)
+		}
+		for _, msg := range messages {
+			m.Feed.Add(msg.Author + ": " + msg.Text)
+		}
+	}
+	return nil
+}
+
+// tempChanged shares the setpoint changes of the thermostat.
+func tempChanged(app *App) TempChangeFunc {
+	return func(ctx context.Context, s live.Socket, c *TempControl, from float32) {
+		model := NewThermoModel(ctx, s)
+
+		// local
+		//model.Feed.Add(fmt.Sprintf("Temperature changed from %f to %f", from, c.Temperature))
+
+		// shared
+		app.Broadcasts.On("thermostat", s).Broadcast("status", thermoStatus(model.Name, from, c.Temperature))
+	}
+}
+
+// thermoStatus is the status of a setpoint change of the user with the
+// given name.
+func thermoStatus(name string, from, to float32) string {
+	return fmt.Sprintf(name+": Temperature changed from %f to %f", from, to)
+}
+
+// Broadcaster sends a self event to every socket of a page, a socket and
+// an engine both do.
+type Broadcaster interface {
+	Broadcast(event string, data interface{}) error
+}
+
+// postMessage stores a message of the thermostat chat and shows it on the pages
+// of b.
+func postMessage(ctx context.Context, repo store.MessageRepo, b Broadcaster, msg store.Message) (store.Message, error) {
+	msg.Room = chatRoom
+	msg, err := repo.Add(ctx, msg)
+	if err != nil {
+		return msg, fmt.Errorf("could not save the message: %w", err)
+	}
+	return msg, b.Broadcast("status", msg.Author+": "+msg.Text)
+}
+
+// send chat like event, the messages are stored for the pages loaded later
+func saveEvent(app *App) live.EventHandler {
+	return func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		model := NewThermoModel(ctx, s)
+		if model.Errors = chatForm.Validate(p); len(model.Errors) > 0 {
+			return model, nil
+		}
+		message := strings.TrimSpace(p.String("message"))
+
+		if time.Since(model.LastMessage) < messageInterval {
+			Flash(s, FlashWarning, "You are sending messages too fast, slow down.")
+			return model, nil
+		}
+		model.LastMessage = time.Now()
+
+		msg := store.Message{Author: model.Name, Text: message, Time: model.LastMessage}
+		_, err := postMessage(ctx, app.Repos.Messages, app.Broadcasts.On("thermostat", s), msg)
+		return model, err
+	}
+}
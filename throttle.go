@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jfyne/live"
+)
+
+// HandleThrottled registers a client event handler that runs at most once
+// per interval for each socket. Events arriving faster are coalesced: the
+// handler runs once more with the params of the last one when the
+// interval is over, so the final value of an input is never lost. Pair it
+// with live-debounce on the input to also spare the round trips.
+func (h *Handler) HandleThrottled(event string, interval time.Duration, handler live.EventHandler) {
+	t := &throttle{
+		interval: interval,
+		self:     event + ":throttled",
+		sockets:  map[live.SocketID]*throttleState{},
+		send: func(ctx context.Context, s live.Socket, event string, data interface{}) {
+			s.Self(ctx, event, data)
+		},
+	}
+	if h.state != nil {
+		t.send = func(_ context.Context, s live.Socket, event string, data interface{}) {
+			h.state.Send(s, event, data)
+		}
+	}
+	h.HandleEvent(event, func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		if !t.allow(ctx, s, p) {
+			return s.Assigns(), nil
+		}
+		return handler(ctx, s, p)
+	})
+	h.HandleSelf(t.self, func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		return handler(ctx, s, data.(live.Params))
+	})
+}
+
+type throttle struct {
+	interval time.Duration
+	self     string
+	// send sends the trailing run as a self event.
+	send func(ctx context.Context, s live.Socket, event string, data interface{})
+
+	mu      sync.Mutex
+	sockets map[live.SocketID]*throttleState
+}
+
+type throttleState struct {
+	last      time.Time
+	pending   live.Params
+	scheduled bool
+}
+
+// allow reports whether the event can run now. Otherwise its params are
+// kept and the trailing run is scheduled.
+func (t *throttle) allow(ctx context.Context, s live.Socket, p live.Params) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	st, ok := t.sockets[s.ID()]
+	if !ok {
+		st = &throttleState{}
+		t.sockets[s.ID()] = st
+		go func() {
+			<-ctx.Done()
+			t.mu.Lock()
+			delete(t.sockets, s.ID())
+			t.mu.Unlock()
+		}()
+	}
+
+	wait := t.interval - time.Since(st.last)
+	if wait <= 0 && !st.scheduled {
+		st.last = time.Now()
+		return true
+	}
+
+	st.pending = p
+	if !st.scheduled {
+		st.scheduled = true
+		time.AfterFunc(wait, func() {
+			t.mu.Lock()
+			p := st.pending
+			st.pending, st.scheduled, st.last = nil, false, time.Now()
+			t.mu.Unlock()
+			t.send(ctx, s, t.self, p)
+		})
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// Ticker sends the time to the pages on every tick, for the clock of the
+// layout. It pauses while no socket is connected: nobody would see the
+// ticks, and every page would render for nothing.
+type Ticker struct {
+	interval time.Duration
+	send     func(time.Time)
+	// idle reports whether the ticker pauses, never when nil.
+	idle func() bool
+}
+
+// NewTicker creates a ticker calling send every interval, from Run.
+func NewTicker(interval time.Duration, send func(time.Time)) *Ticker {
+	return &Ticker{interval: interval, send: send}
+}
+
+// PauseWhen pauses the ticker while idle reports true. The ticker checks
+// it on every tick, so the first tick after a pause is sent within the
+// interval.
+func (t *Ticker) PauseWhen(idle func() bool) {
+	t.idle = idle
+}
+
+// Run ticks until ctx is done.
+func (t *Ticker) Run(ctx context.Context) {
+	tick := time.NewTicker(t.interval)
+	defer tick.Stop()
+	for {
+		select {
+		case now := <-tick.C:
+			if t.idle == nil || !t.idle() {
+				t.send(now)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/jfyne/live"
+)
+
+// tickInterval is how often the simulated prices move.
+const tickInterval = 500 * time.Millisecond
+
+// tickerSymbols are the symbols of the simulated price feed.
+var tickerSymbols = []string{"GOPH", "LIVE", "CHAN", "MUTX", "CTXT", "DEFR"}
+
+// Quote is the price of a symbol and the price before the last tick.
+type Quote struct {
+	Symbol string
+	Price  float64
+	Prev   float64
+}
+
+// Change returns the change of the last tick.
+func (q Quote) Change() float64 {
+	return q.Price - q.Prev
+}
+
+// ChangeRatio returns the change of the last tick relative to the price
+// before it.
+func (q Quote) ChangeRatio() float64 {
+	if q.Prev == 0 {
+		return 0
+	}
+	return q.Change() / q.Prev
+}
+
+// PriceFeed is a simulated stream of prices, moving every symbol by a
+// random walk on each tick and sending the quotes to its subscribers.
+type PriceFeed struct {
+	interval time.Duration
+
+	mu     sync.Mutex
+	quotes []Quote
+	subs   map[chan []Quote]struct{}
+}
+
+// NewPriceFeed creates a feed for the symbols ticking at interval. It
+// starts with Run.
+func NewPriceFeed(symbols []string, interval time.Duration) *PriceFeed {
+	f := &PriceFeed{interval: interval, subs: map[chan []Quote]struct{}{}}
+	for _, s := range symbols {
+		price := 50 + rand.Float64()*150
+		f.quotes = append(f.quotes, Quote{Symbol: s, Price: price, Prev: price})
+	}
+	return f
+}
+
+// Run ticks until ctx is done. Without subscribers the prices stand still,
+// nobody would see them move; the first subscriber gets a tick at once, see
+// Subscribe.
+func (f *PriceFeed) Run(ctx context.Context) {
+	t := time.NewTicker(f.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+
+		f.mu.Lock()
+		if len(f.subs) == 0 {
+			f.mu.Unlock()
+			continue
+		}
+		quotes := f.tick()
+		for c := range f.subs {
+			// A subscriber still busy with the previous tick skips this one.
+			select {
+			case c <- quotes:
+			default:
+			}
+		}
+		f.mu.Unlock()
+	}
+}
+
+// tick moves the prices and returns the quotes. The caller holds mu.
+func (f *PriceFeed) tick() []Quote {
+	for i := range f.quotes {
+		q := &f.quotes[i]
+		q.Prev = q.Price
+		q.Price = math.Max(1, math.Round(q.Price*(1+rand.NormFloat64()*0.004)*100)/100)
+	}
+	return append([]Quote(nil), f.quotes...)
+}
+
+// Quotes returns the current quotes.
+func (f *PriceFeed) Quotes() []Quote {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Quote(nil), f.quotes...)
+}
+
+// Subscribe returns a channel receiving the quotes on every tick, and the
+// function ending the subscription. The first subscriber of an idle feed
+// gets a tick right away, the prices stood still since the last one left.
+func (f *PriceFeed) Subscribe() (<-chan []Quote, func()) {
+	c := make(chan []Quote, 1)
+	f.mu.Lock()
+	if len(f.subs) == 0 {
+		c <- f.tick()
+	}
+	f.subs[c] = struct{}{}
+	f.mu.Unlock()
+	return c, func() {
+		f.mu.Lock()
+		delete(f.subs, c)
+		f.mu.Unlock()
+	}
+}
+
+// TickerModel is the model of the ticker page.
+type TickerModel struct {
+	Page
+	Quotes []Quote
+	// Paused stops the updates of the socket, the feed keeps ticking.
+	Paused bool
+}
+
+func tickerModel(s live.Socket) *TickerModel {
+	if m, ok := s.Assigns().(*TickerModel); ok {
+		return m
+	}
+	return &TickerModel{}
+}
+
+// newTicker creates the ticker live handler. Every connected socket
+// subscribes to the feed and gets each tick as a self event, so a page
+// re-renders only the rows whose price moved.
+func newTicker(app *App, feed *PriceFeed) *Handler {
+	h := app.NewHandler()
+	h.HandleRender(app.Render("ticker.html"))
+	h.HandleMount(func(ctx context.Context, s live.Socket) (interface{}, error) {
+		m := tickerModel(s)
+		m.Quotes = feed.Quotes()
+		if s.Connected() {
+			ticks, stop := feed.Subscribe()
+			go func() {
+				defer stop()
+				for {
+					select {
+					case quotes := <-ticks:
+						app.State.Send(s, "tick", quotes)
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+		}
+		return m, nil
+	})
+	h.HandleTick("tick", func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		m := tickerModel(s)
+		if !m.Paused {
+			m.Quotes = data.([]Quote)
+		}
+		return m, nil
+	})
+	h.HandleEvent("ticker-pause", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := tickerModel(s)
+		m.Paused = !m.Paused
+		if !m.Paused {
+			m.Quotes = feed.Quotes()
+		}
+		return m, nil
+	})
+	return h
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jfyne/live"
+)
+
+// Todo filters.
+const (
+	todoAll    = "all"
+	todoActive = "active"
+	todoDone   = "done"
+)
+
+// TodoFilter is a filter as the page offers it.
+type TodoFilter struct {
+	Value string
+	Label string
+}
+
+// todoFilters are the filters in the order the page shows them.
+var todoFilters = []TodoFilter{
+	{todoAll, "All"},
+	{todoActive, "Active"},
+	{todoDone, "Done"},
+}
+
+// todoForm validates the form adding a todo.
+var todoForm = Form{
+	"title": {Required(), Length(1, 200)},
+}
+
+// Todo is an item of a todo list.
+type Todo struct {
+	ID    int
+	Title string
+	Done  bool
+}
+
+// TodoList is the todo list of a session, as it's stored.
+type TodoList struct {
+	Items  []Todo
+	NextID int
+}
+
+// TodoModel is the model of the todos page.
+type TodoModel struct {
+	Page
+	List   TodoList
+	Filter string
+	// Errors are the errors of the form adding a todo.
+	Errors Errors `json:"-"`
+}
+
+// Visible returns the items matching the filter.
+func (m *TodoModel) Visible() []Todo {
+	var items []Todo
+	for _, t := range m.List.Items {
+		if m.Filter == todoAll || (m.Filter == todoDone) == t.Done {
+			items = append(items, t)
+		}
+	}
+	return items
+}
+
+// Left returns the number of items not done yet.
+func (m *TodoModel) Left() int {
+	n := 0
+	for _, t := range m.List.Items {
+		if !t.Done {
+			n++
+		}
+	}
+	return n
+}
+
+// Filters returns the filters the page offers.
+func (m *TodoModel) Filters() []TodoFilter {
+	return todoFilters
+}
+
+// todoKey is where the list of the socket's session is stored.
+func todoKey(s live.Socket) string {
+	return "todos:" + live.SessionID(s.Session())
+}
+
+// newTodos creates the todos live handler. The list of every session is
+// kept in the app store, so it survives reloads, and restarts with Redis.
+func newTodos(app *App) *Handler {
+	model := func(s live.Socket) *TodoModel {
+		if m, ok := s.Assigns().(*TodoModel); ok {
+			return m
+		}
+		return &TodoModel{Filter: todoAll}
+	}
+	// update applies a change to the list of the socket and stores it.
+	update := func(ctx context.Context, s live.Socket, change func(m *TodoModel) error) (interface{}, error) {
+		m := model(s)
+		if err := change(m); err != nil {
+			return m, err
+		}
+		if err := app.Store.Save(ctx, todoKey(s), m.List); err != nil {
+			return m, fmt.Errorf("could not save the todos: %w", err)
+		}
+		return m, nil
+	}
+	item := func(m *TodoModel, p live.Params) (int, error) {
+		id := p.Int("id")
+		for i, t := range m.List.Items {
+			if t.ID == id {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("unknown todo %d", id)
+	}
+
+	h := app.NewHandler()
+	h.HandleRender(app.Render("todos.html"))
+	h.HandleMount(func(ctx context.Context, s live.Socket) (interface{}, error) {
+		m := model(s)
+		if _, err := app.Store.Load(ctx, todoKey(s), &m.List); err != nil {
+			return nil, fmt.Errorf("could not load the todos: %w", err)
+		}
+		return m, nil
+	})
+
+	h.HandleEvent("todo-add", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := model(s)
+		if m.Errors = todoForm.Validate(p); len(m.Errors) > 0 {
+			return m, nil
+		}
+		return update(ctx, s, func(m *TodoModel) error {
+			m.List.NextID++
+			m.List.Items = append(m.List.Items, Todo{ID: m.List.NextID, Title: strings.TrimSpace(p.String("title"))})
+			return nil
+		})
+	})
+	h.HandleEvent("todo-toggle", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		return update(ctx, s, func(m *TodoModel) error {
+			i, err := item(m, p)
+			if err != nil {
+				return err
+			}
+			m.List.Items[i].Done = !m.List.Items[i].Done
+			return nil
+		})
+	})
+	h.HandleEvent("todo-delete", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		return update(ctx, s, func(m *TodoModel) error {
+			i, err := item(m, p)
+			if err != nil {
+				return err
+			}
+			m.List.Items = append(m.List.Items[:i], m.List.Items[i+1:]...)
+			return nil
+		})
+	})
+	h.HandleEvent("todo-filter", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := model(s)
+		switch f := p.String("filter"); f {
+		case todoAll, todoActive, todoDone:
+			m.Filter = f
+		default:
+			return m, fmt.Errorf("unknown filter %q", f)
+		}
+		return m, nil
+	})
+	return h
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jfyne/live"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation name of the spans of the app.
+const tracerName = "my-app.com/live"
+
+// tracer returns the tracer of the app. Until setupTracing installs a
+// provider it is the global no-op one, the spans cost next to nothing.
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// setupTracing exports the spans to the OTLP/HTTP collector at endpoint,
+// "http://localhost:4318" for example, the traces are posted to its
+// /v1/traces unless it has a path. The trace context is propagated in the
+// W3C headers. The returned provider has to be shut down to flush the last
+// spans.
+func setupTracing(ctx context.Context, endpoint string) (*sdktrace.TracerProvider, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q", endpoint)
+	}
+	path := u.Path
+	if path == "" || path == "/" {
+		path = "/v1/traces"
+	}
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host), otlptracehttp.WithURLPath(path)}
+	if u.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("could not create the OTLP exporter: %w", err)
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName("live"),
+		semconv.ServiceVersion(Version),
+	))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp, nil
+}
+
+// connSpanKey is the context key of the span of a websocket connection.
+type connSpanKey struct{}
+
+// traceRequests is the HTTP middleware starting a span for every request,
+// continuing the trace of the caller. The span of a websocket connection
+// lasts as long as it, so the events of the socket start their own traces
+// linked to it, see traceEvents.
+func traceRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer().Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			semconv.HTTPMethod(r.Method),
+			semconv.HTTPTarget(r.URL.RequestURI()),
+		))
+		defer span.End()
+		if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			ctx = context.WithValue(ctx, connSpanKey{}, span.SpanContext())
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		// The route is known once chi has routed the request.
+		if route := chi.RouteContext(r.Context()).RoutePattern(); route != "" {
+			span.SetName(r.Method + " " + route)
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(semconv.HTTPStatusCode(status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
+
+// socketSpan starts a span of socket s, a new trace linked to the
+// connection when ctx is that of the connection.
+func socketSpan(ctx context.Context, name string, s live.Socket, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	opts := []trace.SpanStartOption{trace.WithAttributes(append(attrs, attribute.String("live.socket", string(s.ID())))...)}
+	if conn, ok := ctx.Value(connSpanKey{}).(trace.SpanContext); ok && conn.Equal(trace.SpanContextFromContext(ctx)) {
+		opts = append(opts, trace.WithNewRoot(), trace.WithLinks(trace.Link{SpanContext: conn}))
+	}
+	return tracer().Start(ctx, name, opts...)
+}
+
+// endSpan records err on span, if any, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceMount is the mount middleware tracing the mounts, those of the
+// page requests and of the connected sockets.
+func traceMount(next live.MountHandler) live.MountHandler {
+	return func(ctx context.Context, s live.Socket) (interface{}, error) {
+		ctx, span := socketSpan(ctx, "live mount", s, attribute.Bool("live.connected", s.Connected()))
+		m, err := next(ctx, s)
+		endSpan(span, err)
+		return m, err
+	}
+}
+
+// traceEvents is the event middleware tracing the events. It comes first,
+// so the span covers the other middleware; the engine renders after the
+// handler returned, the render has its own span.
+func traceEvents(kind, event string, next EventFunc) EventFunc {
+	name := "live " + kind + " " + event
+	return func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		ctx, span := socketSpan(ctx, name, s, attribute.String("live.kind", kind), attribute.String("live.event", event))
+		m, err := next(ctx, s, data)
+		endSpan(span, err)
+		return m, err
+	}
+}
+
+// traceRender traces the render handler of the named page.
+func traceRender(name string, next live.RenderHandler) live.RenderHandler {
+	return func(ctx context.Context, data *live.RenderContext) (io.Reader, error) {
+		ctx, span := tracer().Start(ctx, "live render "+name, trace.WithAttributes(attribute.String("live.page", name)))
+		r, err := next(ctx, data)
+		endSpan(span, err)
+		return r, err
+	}
+}
+
+// publishTraced publishes v as JSON on subject, with the trace context of
+// ctx in the headers of the message.
+func publishTraced(ctx context.Context, bus Bus, subject string, v interface{}) error {
+	ctx, span := tracer().Start(ctx, subject+" publish", trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(
+		semconv.MessagingDestinationName(subject),
+	))
+	data, err := json.Marshal(v)
+	if err != nil {
+		endSpan(span, err)
+		return err
+	}
+	msg := BusMessage{Subject: subject, Data: data, Header: http.Header{}}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(msg.Header))
+	err = bus.Publish(ctx, msg)
+	endSpan(span, err)
+	return err
+}
+
+// subscribeTraced subscribes handler to the JSON messages of subject. The
+// handler runs in the span of the message, continuing the trace of its
+// publisher, under parent for the rest; v decodes the message.
+func subscribeTraced(parent context.Context, bus Bus, subject string, v func() interface{}, handler func(ctx context.Context, v interface{})) (Subscription, error) {
+	return bus.Subscribe(subject, func(msg BusMessage) {
+		ctx := otel.GetTextMapPropagator().Extract(parent, propagation.HeaderCarrier(msg.Header))
+		ctx, span := tracer().Start(ctx, subject+" receive", trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(
+			semconv.MessagingDestinationName(subject),
+		))
+		value := v()
+		err := json.Unmarshal(msg.Data, value)
+		if err == nil {
+			handler(ctx, value)
+		}
+		endSpan(span, err)
+	})
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/jfyne/live"
+)
+
+// tttLines are the rows, columns and diagonals that win a game.
+var tttLines = [][3]int{
+	{0, 1, 2}, {3, 4, 5}, {6, 7, 8},
+	{0, 3, 6}, {1, 4, 7}, {2, 5, 8},
+	{0, 4, 8}, {2, 4, 6},
+}
+
+var tttMarks = [2]string{"X", "O"}
+
+var (
+	errTTTNotYourTurn = errors.New("ttt: it's not your turn")
+	errTTTOver        = errors.New("ttt: the game is over")
+)
+
+// TTTGame is a game of tic-tac-toe between two sessions. The first player
+// plays X and starts.
+type TTTGame struct {
+	ID      string
+	Board   [9]string
+	Players [2]string
+	// Turn is the index of the player to move.
+	Turn int
+	// Winner is "X", "O", "draw" or empty while the game goes on.
+	Winner string
+	// Line are the cells of the winning line.
+	Line []int
+	// Rematch are the players asking for a rematch.
+	Rematch [2]bool
+	// Left is set when a player left the game.
+	Left bool
+}
+
+// Ready reports whether both players joined.
+func (g *TTTGame) Ready() bool {
+	return g.Players[1] != ""
+}
+
+// Over reports whether the game ended.
+func (g *TTTGame) Over() bool {
+	return g.Winner != "" || g.Left
+}
+
+// player returns the index of session in the game, -1 if it doesn't play.
+func (g *TTTGame) player(session string) int {
+	for i, p := range g.Players {
+		if p != "" && p == session {
+			return i
+		}
+	}
+	return -1
+}
+
+// Mark returns the mark of session, empty if it doesn't play.
+func (g *TTTGame) Mark(session string) string {
+	if i := g.player(session); i >= 0 {
+		return tttMarks[i]
+	}
+	return ""
+}
+
+// InLine reports whether cell is part of the winning line.
+func (g *TTTGame) InLine(cell int) bool {
+	for _, c := range g.Line {
+		if c == cell {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *TTTGame) score() {
+	for _, l := range tttLines {
+		if m := g.Board[l[0]]; m != "" && m == g.Board[l[1]] && m == g.Board[l[2]] {
+			g.Winner, g.Line = m, l[:]
+			return
+		}
+	}
+	for _, c := range g.Board {
+		if c == "" {
+			return
+		}
+	}
+	g.Winner = "draw"
+}
+
+// TTTGames pairs sessions into games: a session joins the game waiting for
+// a second player, or opens one.
+type TTTGames struct {
+	mu        sync.Mutex
+	games     map[string]*TTTGame
+	bySession map[string]string
+	waiting   string
+	nextID    int
+}
+
+// NewTTTGames creates an empty lobby.
+func NewTTTGames() *TTTGames {
+	return &TTTGames{games: map[string]*TTTGame{}, bySession: map[string]string{}}
+}
+
+// Join returns the game of session, pairing it into one if it has none.
+func (t *TTTGames) Join(session string) TTTGame {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if g := t.games[t.bySession[session]]; g != nil && !g.Left {
+		return *g
+	}
+	if g := t.games[t.waiting]; g != nil && g.Players[0] != session {
+		g.Players[1] = session
+		t.bySession[session] = g.ID
+		t.waiting = ""
+		return *g
+	}
+	t.nextID++
+	g := &TTTGame{ID: fmt.Sprintf("g%d", t.nextID), Players: [2]string{session}}
+	t.games[g.ID] = g
+	t.bySession[session] = g.ID
+	t.waiting = g.ID
+	return *g
+}
+
+// Game returns the game with id.
+func (t *TTTGames) Game(id string) (TTTGame, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if g := t.games[id]; g != nil {
+		return *g, true
+	}
+	return TTTGame{}, false
+}
+
+// update applies a change to the game of session.
+func (t *TTTGames) update(session string, change func(g *TTTGame, player int) error) (TTTGame, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	g := t.games[t.bySession[session]]
+	if g == nil {
+		return TTTGame{}, fmt.Errorf("ttt: not in a game")
+	}
+	if err := change(g, g.player(session)); err != nil {
+		return *g, err
+	}
+	return *g, nil
+}
+
+// Move puts the mark of session on cell.
+func (t *TTTGames) Move(session string, cell int) (TTTGame, error) {
+	return t.update(session, func(g *TTTGame, player int) error {
+		switch {
+		case g.Over():
+			return errTTTOver
+		case !g.Ready() || player != g.Turn:
+			return errTTTNotYourTurn
+		case cell < 0 || cell >= len(g.Board):
+			return fmt.Errorf("ttt: unknown cell %d", cell)
+		case g.Board[cell] != "":
+			return fmt.Errorf("ttt: cell %d is taken", cell)
+		}
+		g.Board[cell] = tttMarks[player]
+		g.Turn = 1 - g.Turn
+		g.score()
+		return nil
+	})
+}
+
+// Rematch asks for a rematch. Once both players asked, the board is
+// cleared and the players swap marks, so the other one starts.
+func (t *TTTGames) Rematch(session string) (TTTGame, error) {
+	return t.update(session, func(g *TTTGame, player int) error {
+		if g.Winner == "" || g.Left {
+			return fmt.Errorf("ttt: no game to replay")
+		}
+		g.Rematch[player] = true
+		if g.Rematch[0] && g.Rematch[1] {
+			*g = TTTGame{ID: g.ID, Players: [2]string{g.Players[1], g.Players[0]}}
+		}
+		return nil
+	})
+}
+
+// Leave ends the game of session, so it's paired anew when it joins.
+func (t *TTTGames) Leave(session string) (TTTGame, error) {
+	game, err := t.update(session, func(g *TTTGame, player int) error {
+		g.Left = true
+		return nil
+	})
+	if err == nil {
+		t.mu.Lock()
+		delete(t.bySession, session)
+		if t.waiting == game.ID {
+			t.waiting = ""
+		}
+		t.mu.Unlock()
+	}
+	return game, err
+}
+
+// TTTModel is the model of the tic-tac-toe page.
+type TTTModel struct {
+	Page
+	Game TTTGame `json:"-"`
+	// Mark is the mark of the socket's session.
+	Mark string
+}
+
+// TTTCell is a cell of the board as the page shows it.
+type TTTCell struct {
+	Index int
+	// Number counts the cells from 1, for screen readers.
+	Number int
+	Mark   string
+	// Win is set for the cells of the winning line.
+	Win bool
+}
+
+// Cells returns the cells of the board.
+func (m *TTTModel) Cells() []TTTCell {
+	cells := make([]TTTCell, len(m.Game.Board))
+	for i, mark := range m.Game.Board {
+		cells[i] = TTTCell{Index: i, Number: i + 1, Mark: mark, Win: m.Game.InLine(i)}
+	}
+	return cells
+}
+
+// MyTurn reports whether the socket's session moves next.
+func (m *TTTModel) MyTurn() bool {
+	return m.Game.Ready() && !m.Game.Over() && tttMarks[m.Game.Turn] == m.Mark
+}
+
+// AskedRematch reports whether the socket's session asked for a rematch.
+func (m *TTTModel) AskedRematch() bool {
+	for p, mark := range tttMarks {
+		if mark == m.Mark {
+			return m.Game.Rematch[p]
+		}
+	}
+	return false
+}
+
+func tttModel(s live.Socket) *TTTModel {
+	if m, ok := s.Assigns().(*TTTModel); ok {
+		return m
+	}
+	return &TTTModel{}
+}
+
+// newTTT creates the tic-tac-toe live handler. Every change of a game is
+// broadcast with its ID, only the sockets of that game reload it.
+func newTTT(app *App, games *TTTGames) *Handler {
+	// show puts a game in the model of the socket.
+	show := func(s live.Socket, g TTTGame) *TTTModel {
+		m := tttModel(s)
+		m.Game = g
+		m.Mark = g.Mark(live.SessionID(s.Session()))
+		return m
+	}
+	// changed shows the game after a change and tells its other sockets.
+	changed := func(s live.Socket, g TTTGame, err error) (interface{}, error) {
+		switch {
+		case errors.Is(err, errTTTNotYourTurn):
+			Flash(s, FlashWarning, "It's not your turn.")
+			return show(s, g), nil
+		case err != nil:
+			return show(s, g), err
+		}
+		s.Broadcast("ttt", g.ID)
+		return show(s, g), nil
+	}
+
+	h := app.NewHandler()
+	h.HandleRender(app.Render("ttt.html"))
+	h.HandleMount(func(ctx context.Context, s live.Socket) (interface{}, error) {
+		g := games.Join(live.SessionID(s.Session()))
+		if s.Connected() {
+			// The opponent's page learns it has been paired.
+			s.Broadcast("ttt", g.ID)
+		}
+		return show(s, g), nil
+	})
+	h.HandleEvent("ttt-move", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		g, err := games.Move(live.SessionID(s.Session()), p.Int("cell"))
+		return changed(s, g, err)
+	})
+	h.HandleEvent("ttt-rematch", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		g, err := games.Rematch(live.SessionID(s.Session()))
+		return changed(s, g, err)
+	})
+	h.HandleEvent("ttt-leave", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		g, err := games.Leave(live.SessionID(s.Session()))
+		if err != nil {
+			return changed(s, g, err)
+		}
+		s.Broadcast("ttt", g.ID)
+		// Pair the session into a new game right away.
+		g = games.Join(live.SessionID(s.Session()))
+		s.Broadcast("ttt", g.ID)
+		return show(s, g), nil
+	})
+	h.HandleSelf("ttt", func(ctx context.Context, s live.Socket, data interface{}) (interface{}, error) {
+		m := tttModel(s)
+		if data != m.Game.ID {
+			return m, nil
+		}
+		g, _ := games.Game(m.Game.ID)
+		return show(s, g), nil
+	})
+	return h
+}
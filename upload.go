@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jfyne/live"
+)
+
+// Limits of the upload page.
+const (
+	uploadMaxSize = 2 << 20
+	// uploadChunkSize is the size of the chunks the upload hook sends. Base64
+	// encoded they stay below the default max-message-size.
+	uploadChunkSize = 16 << 10
+	// uploadMaxPending is how many uploads a socket may run at once.
+	uploadMaxPending = 3
+	// uploadMaxFiles is how many files are kept, the oldest are dropped.
+	uploadMaxFiles = 20
+)
+
+// uploadTypes are the media types that may be uploaded.
+var uploadTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"application/pdf": true,
+	"text/plain":      true,
+}
+
+// UploadedFile is a file uploaded on the upload page.
+type UploadedFile struct {
+	ID   int
+	Name string
+	Type string
+	Size int
+	Time time.Time
+
+	content []byte `memo:"-"`
+}
+
+// KB returns the size in kilobytes.
+func (f UploadedFile) KB() float64 {
+	return float64(f.Size) / 1024
+}
+
+// Uploads keeps the uploaded files in memory, shared by every socket.
+type Uploads struct {
+	mu     sync.Mutex
+	files  []*UploadedFile
+	nextID int
+}
+
+// NewUploads creates an empty file list.
+func NewUploads() *Uploads {
+	return &Uploads{}
+}
+
+// Add adds a file, dropping the oldest beyond uploadMaxFiles.
+func (u *Uploads) Add(name, typ string, content []byte) *UploadedFile {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.nextID++
+	f := &UploadedFile{ID: u.nextID, Name: name, Type: typ, Size: len(content), Time: time.Now(), content: content}
+	u.files = append(u.files, f)
+	if len(u.files) > uploadMaxFiles {
+		u.files = u.files[len(u.files)-uploadMaxFiles:]
+	}
+	return f
+}
+
+// Files returns the files, newest first.
+func (u *Uploads) Files() []UploadedFile {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	files := make([]UploadedFile, len(u.files))
+	for i, f := range u.files {
+		files[len(files)-1-i] = *f
+	}
+	return files
+}
+
+// Get returns the file with id.
+func (u *Uploads) Get(id int) (*UploadedFile, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, f := range u.files {
+		if f.ID == id {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// Delete removes the file with id.
+func (u *Uploads) Delete(id int) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for i, f := range u.files {
+		if f.ID == id {
+			u.files = append(u.files[:i], u.files[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// ServeHTTP serves the file whose ID is the "id" URL param.
+func (u *Uploads) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	f, ok := u.Get(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", f.Type)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": f.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(f.content)
+}
+
+// Upload is a file a socket is uploading.
+type Upload struct {
+	// Ref is the reference of the upload in the hook.
+	Ref      string
+	Name     string
+	Type     string
+	Size     int
+	Received int
+
+	data []byte `memo:"-"`
+}
+
+// Percent returns how much of the file was received.
+func (u *Upload) Percent() int {
+	return u.Received * 100 / u.Size
+}
+
+// UploadModel is the model of the upload page.
+type UploadModel struct {
+	Page
+	Pending []*Upload
+	Files   []UploadedFile
+	// Rejected are the messages of the files that were refused.
+	Rejected []Message
+}
+
+// MaxMB returns the largest size of a file in megabytes.
+func (m *UploadModel) MaxMB() int {
+	return uploadMaxSize >> 20
+}
+
+func uploadModel(s live.Socket) *UploadModel {
+	if m, ok := s.Assigns().(*UploadModel); ok {
+		return m
+	}
+	return &UploadModel{}
+}
+
+func (m *UploadModel) pending(ref string) (*Upload, int) {
+	for i, u := range m.Pending {
+		if u.Ref == ref {
+			return u, i
+		}
+	}
+	return nil, -1
+}
+
+// checkUpload validates the name, type and size of a file to upload and
+// returns why it's refused, nil if it isn't.
+func checkUpload(name, typ string, size int) *Message {
+	switch {
+	case strings.TrimSpace(name) == "" || name == "." || name == "/":
+		return &Message{Key: "Every file needs a name."}
+	case !uploadTypes[typ]:
+		return &Message{Key: "%s: files of this type can't be uploaded.", Args: []interface{}{name}}
+	case size <= 0:
+		return &Message{Key: "%s is empty.", Args: []interface{}{name}}
+	case size > uploadMaxSize:
+		return &Message{Key: "%s is larger than %d MB.", Args: []interface{}{name, uploadMaxSize >> 20}}
+	}
+	return nil
+}
+
+// newUpload creates the upload live handler. The upload hook announces a
+// file with upload-start and the server asks for its chunks one after the
+// other with upload-next, so the socket isn't flooded and the progress bar
+// is rendered from what the server received.
+func newUpload(app *App, uploads *Uploads) *Handler {
+	// next asks the hook for the chunk at the offset of the upload.
+	next := func(s live.Socket, u *Upload) error {
+		return s.Send("upload-next", map[string]interface{}{"ref": u.Ref, "offset": u.Received, "size": uploadChunkSize})
+	}
+	// reject drops an upload and tells the user and the hook why.
+	reject := func(s live.Socket, m *UploadModel, ref string, msg Message) error {
+		if _, i := m.pending(ref); i >= 0 {
+			m.Pending = append(m.Pending[:i], m.Pending[i+1:]...)
+		}
+		m.Rejected = append(m.Rejected, msg)
+		return s.Send("upload-done", map[string]interface{}{"ref": ref})
+	}
+
+	h := app.NewHandler()
+	h.HandleRender(app.Render("upload.html"))
+	h.HandleMount(func(ctx context.Context, s live.Socket) (interface{}, error) {
+		m := uploadModel(s)
+		// Uploads don't survive a reconnect, the hook starts them over.
+		m.Pending = nil
+		m.Files = uploads.Files()
+		return m, nil
+	})
+	h.HandleEvent("upload-start", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := uploadModel(s)
+		ref, name, typ, size := p.String("ref"), path.Base(p.String("name")), p.String("type"), p.Int("size")
+		if ref == "" {
+			return m, fmt.Errorf("upload without a reference")
+		}
+		if len(m.Pending) >= uploadMaxPending {
+			return m, reject(s, m, ref, Message{Key: "%s: wait for the other uploads to finish.", Args: []interface{}{name}})
+		}
+		if msg := checkUpload(name, typ, size); msg != nil {
+			return m, reject(s, m, ref, *msg)
+		}
+		u := &Upload{Ref: ref, Name: name, Type: typ, Size: size}
+		m.Pending = append(m.Pending, u)
+		return m, next(s, u)
+	})
+	h.HandleEvent("upload-chunk", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := uploadModel(s)
+		u, _ := m.pending(p.String("ref"))
+		if u == nil {
+			return m, fmt.Errorf("unknown upload %q", p.String("ref"))
+		}
+		if p.Int("offset") != u.Received {
+			return m, fmt.Errorf("upload %q: chunk at %d, expected %d", u.Ref, p.Int("offset"), u.Received)
+		}
+		chunk, err := base64.StdEncoding.DecodeString(p.String("data"))
+		if err != nil || len(chunk) == 0 || len(chunk) > uploadChunkSize || u.Received+len(chunk) > u.Size {
+			return m, reject(s, m, u.Ref, Message{Key: "%s: the upload failed.", Args: []interface{}{u.Name}})
+		}
+		u.data = append(u.data, chunk...)
+		u.Received += len(chunk)
+		if u.Received < u.Size {
+			return m, next(s, u)
+		}
+
+		// The content has to match the announced type, not only the name.
+		if typ, _, _ := mime.ParseMediaType(http.DetectContentType(u.data)); typ != u.Type {
+			return m, reject(s, m, u.Ref, Message{Key: "%s doesn't look like a file of its type.", Args: []interface{}{u.Name}})
+		}
+		uploads.Add(u.Name, u.Type, u.data)
+		_, i := m.pending(u.Ref)
+		m.Pending = append(m.Pending[:i], m.Pending[i+1:]...)
+		m.Files = uploads.Files()
+		s.Broadcast("uploads", nil)
+		return m, s.Send("upload-done", map[string]interface{}{"ref": u.Ref})
+	})
+	h.HandleEvent("upload-cancel", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := uploadModel(s)
+		if _, i := m.pending(p.String("ref")); i >= 0 {
+			m.Pending = append(m.Pending[:i], m.Pending[i+1:]...)
+		}
+		return m, s.Send("upload-done", map[string]interface{}{"ref": p.String("ref")})
+	})
+	h.HandleEvent("upload-delete", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := uploadModel(s)
+		if !uploads.Delete(p.Int("id")) {
+			return m, fmt.Errorf("unknown file %d", p.Int("id"))
+		}
+		m.Files = uploads.Files()
+		s.Broadcast("uploads", nil)
+		return m, nil
+	})
+	h.HandleEvent("upload-dismiss", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := uploadModel(s)
+		m.Rejected = nil
+		return m, nil
+	})
+	h.HandleSelf("uploads", func(ctx context.Context, s live.Socket, _ interface{}) (interface{}, error) {
+		m := uploadModel(s)
+		m.Files = uploads.Files()
+		return m, nil
+	})
+	return h
+}
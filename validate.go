@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/mail"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jfyne/live"
+)
+
+// Rule checks the value of a form field, returning nil when it is valid.
+type Rule func(value string) *Message
+
+// Required rejects empty values.
+func Required() Rule {
+	return func(value string) *Message {
+		if strings.TrimSpace(value) == "" {
+			return &Message{Key: "This field is required."}
+		}
+		return nil
+	}
+}
+
+// Length rejects values shorter than min or longer than max characters.
+func Length(min, max int) Rule {
+	return func(value string) *Message {
+		n := utf8.RuneCountInString(value)
+		if n < min {
+			return &Message{Key: "Use at least %d characters.", Args: []interface{}{min}}
+		}
+		if n > max {
+			return &Message{Key: "Use at most %d characters.", Args: []interface{}{max}}
+		}
+		return nil
+	}
+}
+
+// Slug rejects values that aren't lowercase letters, digits and dashes,
+// as used in URLs.
+func Slug() Rule {
+	return func(value string) *Message {
+		for _, r := range value {
+			if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+				return &Message{Key: "Use lowercase letters, digits and dashes only."}
+			}
+		}
+		return nil
+	}
+}
+
+// Email rejects values that aren't a bare email address, an empty value
+// passes.
+func Email() Rule {
+	return func(value string) *Message {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return nil
+		}
+		if addr, err := mail.ParseAddress(value); err != nil || addr.Address != value {
+			return &Message{Key: "Enter an email address."}
+		}
+		return nil
+	}
+}
+
+// Range rejects values that aren't numbers between min and max.
+func Range(min, max float64) Rule {
+	return func(value string) *Message {
+		v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return &Message{Key: "Enter a number."}
+		}
+		if v < min || v > max {
+			return &Message{Key: "Enter a number between %v and %v.", Args: []interface{}{min, max}}
+		}
+		return nil
+	}
+}
+
+// Form declares the rules of the fields of a live form.
+type Form map[string][]Rule
+
+// Validate checks the form params. The first failing rule of a field sets
+// its error; the result is empty when the form is valid.
+func (f Form) Validate(p live.Params) Errors {
+	errs := Errors{}
+	for field, rules := range f {
+		value := p.String(field)
+		for _, rule := range rules {
+			if msg := rule(value); msg != nil {
+				errs[field] = *msg
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// Errors maps the fields of a form to their error. Page models keep it in
+// their assigns so the template renders each error next to its input.
+type Errors map[string]Message
+
+// Field returns the error of the field, nil if it is valid.
+func (e Errors) Field(name string) *Message {
+	if msg, ok := e[name]; ok {
+		return &msg
+	}
+	return nil
+}
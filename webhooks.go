@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jfyne/live"
+
+	"my-app.com/live/store"
+)
+
+const (
+	// webhookAttempts is how often a delivery is tried before it fails.
+	webhookAttempts = 6
+	// webhookBackoff is the wait before the first retry, doubled after
+	// every failed attempt.
+	webhookBackoff = 5 * time.Second
+	// webhookTimeout bounds an attempt.
+	webhookTimeout = 10 * time.Second
+	// webhookLogSize is the number of deliveries the delivery log keeps.
+	webhookLogSize = 200
+	// webhooksEvent is the self event telling the webhooks pages about a
+	// delivery.
+	webhooksEvent = "webhooks"
+)
+
+// The event types of the webhooks.
+const (
+	WebhookAlert   = "alert"
+	WebhookMessage = "message"
+	WebhookRule    = "rule"
+)
+
+// webhookEvents are the event types a webhook may be sent for.
+var webhookEvents = []string{WebhookAlert, WebhookMessage, WebhookRule}
+
+// WebhookConfig configures the webhooks: every event of Events is posted
+// to every URL, signed with Secret.
+type WebhookConfig struct {
+	URLs   []string
+	Secret string
+	Events []string
+}
+
+// The statuses of a delivery.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is the delivery of an event to a webhook URL.
+type WebhookDelivery struct {
+	ID       int64
+	Event    string
+	URL      string
+	Body     []byte
+	Created  time.Time
+	Status   string
+	Attempts int
+	// Code and Error are those of the last attempt.
+	Code  int
+	Error string
+	// Next is when a pending delivery is tried next.
+	Next time.Time
+}
+
+// webhookPayload is the body of a delivery.
+type webhookPayload struct {
+	Event string      `json:"event"`
+	Time  time.Time   `json:"time"`
+	Data  interface{} `json:"data"`
+}
+
+// Webhooks posts the events of the app to the configured URLs. Run sends
+// the deliveries in the background, retrying the failed ones with an
+// exponential backoff. The body is signed with HMAC-SHA256 of the secret
+// in the X-Webhook-Signature header, "sha256=" and the hex digest, so the
+// receiver can verify it came from the app. The latest deliveries are kept
+// in the delivery log of the admin page.
+type Webhooks struct {
+	cfg    WebhookConfig
+	client *http.Client
+	wake   chan struct{}
+
+	mu         sync.Mutex
+	last       int64
+	deliveries []*WebhookDelivery
+	engines    []*live.HttpEngine
+}
+
+// NewWebhooks creates the webhooks of cfg.
+func NewWebhooks(cfg WebhookConfig) *Webhooks {
+	return &Webhooks{
+		cfg:    cfg,
+		client: &http.Client{Timeout: webhookTimeout},
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Enabled reports whether any URL is configured.
+func (w *Webhooks) Enabled() bool {
+	return len(w.cfg.URLs) > 0
+}
+
+// Watch has the sockets of engine told about every change of a delivery,
+// see webhooksEvent.
+func (w *Webhooks) Watch(engine *live.HttpEngine) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.engines = append(w.engines, engine)
+}
+
+// Send queues the delivery of an event to every URL, if the event type is
+// configured.
+func (w *Webhooks) Send(event string, data interface{}) {
+	if !w.Enabled() || !containsString(w.cfg.Events, event) {
+		return
+	}
+	body, err := json.Marshal(webhookPayload{Event: event, Time: time.Now(), Data: data})
+	if err != nil {
+		log.Printf("could not encode the %s webhook: %v", event, err)
+		return
+	}
+	w.mu.Lock()
+	now := time.Now()
+	for _, url := range w.cfg.URLs {
+		w.last++
+		w.deliveries = append(w.deliveries, &WebhookDelivery{ID: w.last, Event: event, URL: url, Body: body, Created: now, Status: DeliveryPending, Next: now})
+	}
+	w.trim()
+	w.mu.Unlock()
+	w.changed()
+}
+
+// trim drops the oldest finished deliveries past webhookLogSize, the
+// pending ones stay until they're done.
+func (w *Webhooks) trim() {
+	over := len(w.deliveries) - webhookLogSize
+	kept := w.deliveries[:0]
+	for _, d := range w.deliveries {
+		if over > 0 && d.Status != DeliveryPending {
+			over--
+			continue
+		}
+		kept = append(kept, d)
+	}
+	w.deliveries = kept
+}
+
+// Retry tries a failed delivery again, from its first attempt.
+func (w *Webhooks) Retry(id int64) bool {
+	w.mu.Lock()
+	found := false
+	for _, d := range w.deliveries {
+		if d.ID == id && d.Status == DeliveryFailed {
+			d.Status, d.Attempts, d.Next = DeliveryPending, 0, time.Now()
+			found = true
+		}
+	}
+	w.mu.Unlock()
+	if found {
+		w.changed()
+	}
+	return found
+}
+
+// List returns the delivery log, newest first.
+func (w *Webhooks) List() []WebhookDelivery {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	list := make([]WebhookDelivery, 0, len(w.deliveries))
+	for i := len(w.deliveries) - 1; i >= 0; i-- {
+		list = append(list, *w.deliveries[i])
+	}
+	return list
+}
+
+// changed wakes Run and tells the watching pages.
+func (w *Webhooks) changed() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	w.mu.Lock()
+	engines := append([]*live.HttpEngine(nil), w.engines...)
+	w.mu.Unlock()
+	for _, engine := range engines {
+		if err := engine.Broadcast(webhooksEvent, nil); err != nil {
+			log.Println("broadcast error:", err)
+		}
+	}
+}
+
+// Run sends the due deliveries until ctx is done, one at a time.
+func (w *Webhooks) Run(ctx context.Context) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		d, wait := w.due()
+		if d != nil {
+			w.attempt(ctx, d)
+			continue
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-w.wake:
+		case <-timer.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// due returns a copy of the next pending delivery due, or how long until
+// one is.
+func (w *Webhooks) due() (*WebhookDelivery, time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now, wait := time.Now(), time.Hour
+	for _, d := range w.deliveries {
+		if d.Status != DeliveryPending {
+			continue
+		}
+		if !d.Next.After(now) {
+			c := *d
+			return &c, 0
+		}
+		if until := d.Next.Sub(now); until < wait {
+			wait = until
+		}
+	}
+	return nil, wait
+}
+
+// attempt posts d once and updates it in the log.
+func (w *Webhooks) attempt(ctx context.Context, d *WebhookDelivery) {
+	code, err := w.post(ctx, d)
+	w.mu.Lock()
+	for _, e := range w.deliveries {
+		if e.ID != d.ID {
+			continue
+		}
+		e.Attempts++
+		e.Code, e.Error = code, ""
+		switch {
+		case err == nil:
+			e.Status = DeliveryDelivered
+		case e.Attempts >= webhookAttempts:
+			e.Status, e.Error = DeliveryFailed, err.Error()
+		default:
+			e.Error = err.Error()
+			e.Next = time.Now().Add(webhookBackoff << (e.Attempts - 1))
+		}
+	}
+	w.mu.Unlock()
+	if err != nil {
+		log.Printf("webhook %d to %s: %v", d.ID, d.URL, err)
+	}
+	w.changed()
+}
+
+func (w *Webhooks) post(ctx context.Context, d *WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "live-webhooks")
+	req.Header.Set("X-Webhook-Event", d.Event)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(d.ID, 10))
+	req.Header.Set("X-Webhook-Signature", SignWebhook(w.cfg.Secret, d.Body))
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("the receiver answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhook returns the signature of a delivery body, as the
+// X-Webhook-Signature header carries it.
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookAlert is the data of an alert webhook.
+type webhookAlert struct {
+	Zone     string    `json:"zone"`
+	Setpoint float32   `json:"setpoint"`
+	Limit    float32   `json:"limit"`
+	Time     time.Time `json:"time"`
+}
+
+// webhookMessage is the data of a message webhook.
+type webhookMessage struct {
+	ID     int64     `json:"id"`
+	Room   string    `json:"room"`
+	Author string    `json:"author"`
+	Text   string    `json:"text"`
+	Time   time.Time `json:"time"`
+}
+
+// webhookRule is the data of a rule webhook, see ZoneRules.
+type webhookRule struct {
+	Rule        int       `json:"rule"`
+	Zone        string    `json:"zone"`
+	Condition   string    `json:"condition"`
+	Temperature float32   `json:"temperature"`
+	Text        string    `json:"text,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// webhookMessages sends the messages added to the repository to the
+// webhooks, those of the chat and of the API alike.
+type webhookMessages struct {
+	store.MessageRepo
+	hooks *Webhooks
+}
+
+func (r webhookMessages) Add(ctx context.Context, m store.Message) (store.Message, error) {
+	m, err := r.MessageRepo.Add(ctx, m)
+	if err == nil {
+		r.hooks.Send(WebhookMessage, webhookMessage{ID: m.ID, Room: m.Room, Author: m.Author, Text: m.Text, Time: m.Time})
+	}
+	return m, err
+}
+
+// WebhooksModel is the model of the admin webhooks page.
+type WebhooksModel struct {
+	Page
+	Enabled    bool
+	URLs       []string
+	Events     []string
+	Deliveries []WebhookDelivery `json:"-"`
+}
+
+func webhooksModel(s live.Socket, hooks *Webhooks) *WebhooksModel {
+	if m, ok := s.Assigns().(*WebhooksModel); ok {
+		return m
+	}
+	return &WebhooksModel{Enabled: hooks.Enabled(), URLs: hooks.cfg.URLs, Events: hooks.cfg.Events}
+}
+
+// newWebhooksPage creates the admin page of the delivery log, following
+// the deliveries as they're tried. A failed delivery can be retried.
+func newWebhooksPage(app *App, hooks *Webhooks) *Handler {
+	h := app.NewHandler()
+	h.HandleRender(app.Render("webhooks.html"))
+	h.HandleMount(func(ctx context.Context, s live.Socket) (interface{}, error) {
+		m := webhooksModel(s, hooks)
+		m.Deliveries = hooks.List()
+		return m, nil
+	})
+	h.HandleSelf(webhooksEvent, func(ctx context.Context, s live.Socket, _ interface{}) (interface{}, error) {
+		m := webhooksModel(s, hooks)
+		m.Deliveries = hooks.List()
+		return m, nil
+	})
+	h.HandleEvent("webhook-retry", func(ctx context.Context, s live.Socket, p live.Params) (interface{}, error) {
+		m := webhooksModel(s, hooks)
+		id := int64(p.Int("id"))
+		if !hooks.Retry(id) {
+			return m, fmt.Errorf("delivery %d isn't failed", id)
+		}
+		app.Audit.Record(ctx, s, AuditWebhookRetry, strconv.FormatInt(id, 10), "")
+		m.Deliveries = hooks.List()
+		return m, nil
+	})
+	return h
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jfyne/live"
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+
+	"my-app.com/live/store"
+)
+
+// wsCommand is a message of a client of /ws/api.
+type wsCommand struct {
+	// Type is subscribe, unsubscribe, set, up, down, change, message or
+	// ping.
+	Type string `json:"type"`
+	// Ref is sent back with the reply, to match it with the command.
+	Ref         string   `json:"ref,omitempty"`
+	Zone        string   `json:"zone,omitempty"`
+	Temperature *float32 `json:"temperature,omitempty"`
+	Confirmed   bool     `json:"confirmed,omitempty"`
+	// Name and Message are those of a chat message.
+	Name    string `json:"name,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// wsReply is a message of /ws/api to its client: the reply to a command,
+// ok, error or pong, or the state of a subscribed zone.
+type wsReply struct {
+	Type    string      `json:"type"`
+	Ref     string      `json:"ref,omitempty"`
+	State   *apiZone    `json:"state,omitempty"`
+	Message *apiMessage `json:"message,omitempty"`
+	// Code is that of an error: bad_request, unauthorized, not_found,
+	// invalid, not_confirmed or internal.
+	Code   string            `json:"code,omitempty"`
+	Error  string            `json:"error,omitempty"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+func newAPIZonePtr(c *TempControl) *apiZone {
+	z := newAPIZone(c)
+	return &z
+}
+
+func wsError(ref, code, msg string) wsReply {
+	return wsReply{Type: "error", Ref: ref, Code: code, Error: msg}
+}
+
+// wsClient is a connection of /ws/api.
+type wsClient struct {
+	api    *API
+	conn   *websocket.Conn
+	locale *Locale
+	// actor is the admin user of the basic auth of the upgrade, "" without
+	// it: the client then only reads.
+	actor string
+
+	writeMu sync.Mutex
+	// zones are the subscribed zones, "" subscribes to all of them.
+	zonesMu sync.Mutex
+	zones   map[string]bool
+}
+
+// socket serves /ws/api, the JSON protocol of the native clients over a
+// plain websocket, apart from the live pages: the client subscribes to
+// zones, gets their states and every change, and sends the commands of the
+// API. The commands go through the same validation, audit and broadcasts.
+//
+//	{"type": "subscribe", "zone": "kitchen"}
+//	{"type": "set", "ref": "1", "zone": "kitchen", "temperature": 21.5}
+//	{"type": "message", "ref": "2", "name": "Alice", "message": "Hello"}
+//
+// A command is answered with an "ok" or an "error" with its ref, a change
+// of a subscribed zone is pushed as a "state".
+func (a *API) socket(w http.ResponseWriter, r *http.Request) {
+	// The native clients send no Origin, the browsers are checked by the
+	// library.
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close(websocket.StatusInternalError, "")
+	k := a.app.Config.Keepalive
+	if k.MaxMessageSize > 0 {
+		conn.SetReadLimit(k.MaxMessageSize)
+	}
+	c := &wsClient{api: a, conn: conn, locale: a.app.Locales.Negotiate(r), actor: a.app.Router.User(r), zones: map[string]bool{}}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	changes, stop := a.app.Setpoints.Subscribe("")
+	defer stop()
+	go c.push(ctx, changes)
+	if k.PingInterval > 0 {
+		go c.ping(ctx, k.PingInterval, k.PongTimeout)
+	}
+	for {
+		// Read, as wsjson would close the connection on a message that
+		// isn't JSON.
+		typ, data, err := conn.Read(ctx)
+		if err != nil {
+			return
+		}
+		var cmd wsCommand
+		reply := wsError("", "bad_request", "invalid JSON message")
+		if typ == websocket.MessageText && json.Unmarshal(data, &cmd) == nil {
+			reply = c.run(ctx, cmd)
+		}
+		if err := c.write(ctx, reply); err != nil {
+			return
+		}
+	}
+}
+
+// push sends the changes of the subscribed zones.
+func (c *wsClient) push(ctx context.Context, changes <-chan SetpointChange) {
+	for {
+		select {
+		case change := <-changes:
+			if !c.subscribed(change.Zone) {
+				continue
+			}
+			z := apiZone{Zone: change.Zone, Setpoint: change.Reading.Value, Updated: change.Reading.Time, TooHot: change.Reading.Value > tempLimit}
+			if err := c.write(ctx, wsReply{Type: "state", State: &z}); err != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// ping pings the client every interval, closing the connection when it
+// doesn't answer within timeout.
+func (c *wsClient) ping(ctx context.Context, interval, timeout time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+		pctx, cancel := context.WithTimeout(ctx, interval+timeout)
+		err := c.conn.Ping(pctx)
+		cancel()
+		if err != nil {
+			c.conn.Close(websocket.StatusPolicyViolation, "ping timeout")
+			return
+		}
+	}
+}
+
+func (c *wsClient) unsubscribe(zone string) {
+	c.zonesMu.Lock()
+	defer c.zonesMu.Unlock()
+	delete(c.zones, zone)
+}
+
+func (c *wsClient) subscribed(zone string) bool {
+	c.zonesMu.Lock()
+	defer c.zonesMu.Unlock()
+	return c.zones[""] || c.zones[zone]
+}
+
+// write sends v, the writes of push and of the replies don't interleave.
+func (c *wsClient) write(ctx context.Context, v wsReply) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if timeout := c.api.app.Config.Keepalive.WriteTimeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return wsjson.Write(ctx, c.conn, v)
+}
+
+// run runs a command and returns the reply.
+func (c *wsClient) run(ctx context.Context, cmd wsCommand) wsReply {
+	switch cmd.Type {
+	case "set", "up", "down", "change", "message":
+		// The changes take the basic auth of the admin pages, as on /api.
+		if c.actor == "" {
+			return wsError(cmd.Ref, "unauthorized", "the changes need the basic auth of the admin pages")
+		}
+	}
+	switch cmd.Type {
+	case "ping":
+		return wsReply{Type: "pong", Ref: cmd.Ref}
+	case "subscribe":
+		zones := []string{cmd.Zone}
+		if cmd.Zone == "" {
+			zones = c.api.app.Setpoints.Zones()
+		}
+		// Subscribed first, a change made meanwhile follows the states.
+		c.zonesMu.Lock()
+		already := c.zones[cmd.Zone]
+		c.zones[cmd.Zone] = true
+		c.zonesMu.Unlock()
+		for _, zone := range zones {
+			ctrl, err := c.api.app.Setpoints.Control(ctx, zone)
+			if err == nil && ctrl == nil {
+				if !already {
+					c.unsubscribe(cmd.Zone)
+				}
+				return wsError(cmd.Ref, "not_found", "unknown zone")
+			}
+			if err != nil {
+				return c.fail(cmd, err)
+			}
+			if err := c.write(ctx, wsReply{Type: "state", State: newAPIZonePtr(ctrl)}); err != nil {
+				return c.fail(cmd, err)
+			}
+		}
+		return wsReply{Type: "ok", Ref: cmd.Ref}
+	case "unsubscribe":
+		c.unsubscribe(cmd.Zone)
+		return wsReply{Type: "ok", Ref: cmd.Ref}
+	case "set":
+		return c.set(ctx, cmd, func(ctrl *TempControl, v float32) float32 { return v }, setpointForm)
+	case "up":
+		return c.set(ctx, cmd, func(ctrl *TempControl, _ float32) float32 { return ctrl.Temperature + 0.1 }, nil)
+	case "down":
+		return c.set(ctx, cmd, func(ctrl *TempControl, _ float32) float32 { return ctrl.Temperature - 0.1 }, nil)
+	case "change":
+		return c.set(ctx, cmd, func(ctrl *TempControl, v float32) float32 { return ctrl.Temperature + v }, changeForm)
+	case "message":
+		if errs := chatForm.Validate(live.Params{"message": cmd.Message}); len(errs) > 0 {
+			return c.invalid(cmd, errs)
+		}
+		msg := store.Message{Author: strings.TrimSpace(cmd.Name), Text: strings.TrimSpace(cmd.Message), Time: time.Now()}
+		msg, err := postMessage(ctx, c.api.app.Repos.Messages, c.api.thermostat, msg)
+		if err != nil {
+			return c.fail(cmd, err)
+		}
+		return wsReply{Type: "ok", Ref: cmd.Ref, Message: &apiMessage{ID: msg.ID, Author: msg.Author, Text: msg.Text, Time: msg.Time}}
+	}
+	return wsError(cmd.Ref, "bad_request", "unknown command type")
+}
+
+// set changes the setpoint of the zone of cmd like the API, to the
+// temperature to returns. The steps, up and down, have no form.
+func (c *wsClient) set(ctx context.Context, cmd wsCommand, to func(ctrl *TempControl, value float32) float32, form Form) wsReply {
+	var v float32
+	if form != nil {
+		p := live.Params{}
+		if cmd.Temperature != nil {
+			v = *cmd.Temperature
+			p["temperature"] = strconv.FormatFloat(float64(v), 'f', -1, 32)
+		}
+		if errs := form.Validate(p); len(errs) > 0 {
+			return c.invalid(cmd, errs)
+		}
+	}
+	ctrl, err := c.api.app.Setpoints.Control(ctx, cmd.Zone)
+	if err != nil {
+		return c.fail(cmd, err)
+	}
+	if ctrl == nil {
+		return wsError(cmd.Ref, "not_found", "unknown zone")
+	}
+	setpoint := to(ctrl, v)
+	if errs := validSetpoint(setpoint); len(errs) > 0 {
+		return c.invalid(cmd, errs)
+	}
+	o := SetpointOrigin{Actor: c.actor, Socket: apiSocket, Page: "/ws/api", Step: form == nil}
+	err = c.api.app.Setpoints.Set(ctx, ctrl, setpoint, cmd.Confirmed, o)
+	if errors.Is(err, ErrNotConfirmed) {
+		return wsError(cmd.Ref, "not_confirmed", err.Error())
+	}
+	if err != nil {
+		return c.fail(cmd, err)
+	}
+	return wsReply{Type: "ok", Ref: cmd.Ref, State: newAPIZonePtr(ctrl)}
+}
+
+// invalid returns the errors of a form, translated for the client.
+func (c *wsClient) invalid(cmd wsCommand, errs Errors) wsReply {
+	reply := wsError(cmd.Ref, "invalid", "invalid request")
+	reply.Fields = map[string]string{}
+	for field, msg := range errs {
+		reply.Fields[field] = c.locale.Format(msg)
+	}
+	return reply
+}
+
+// fail logs an internal error, the client only learns it failed.
+func (c *wsClient) fail(cmd wsCommand, err error) wsReply {
+	log.Println("ws api error:", err)
+	return wsError(cmd.Ref, "internal", genericError)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+
+	"my-app.com/live/store"
+)
+
+// pushJob is the job of the zone gauges on the Pushgateway.
+const pushJob = "live"
+
+// ZoneGauges are the temperature and the setpoint of every zone as
+// Prometheus gauges, for the monitoring stacks to alert on: served at
+// /metrics with the metrics of the app, and pushed to a Pushgateway with
+// Push. The setpoints follow the Setpoints, the temperatures the raw
+// readings added to the repository.
+type ZoneGauges struct {
+	// Registry holds the zone gauges only, those Push pushes.
+	Registry *prometheus.Registry
+
+	temperature *prometheus.GaugeVec
+	setpoint    *prometheus.GaugeVec
+}
+
+// NewZoneGauges creates the zone gauges, registered with the metrics of
+// the app too.
+func NewZoneGauges(metrics *Metrics) *ZoneGauges {
+	g := &ZoneGauges{
+		Registry: prometheus.NewRegistry(),
+		temperature: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "live_zone_temperature_celsius",
+			Help: "Latest temperature reading of the zone.",
+		}, []string{"zone"}),
+		setpoint: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "live_zone_setpoint_celsius",
+			Help: "Setpoint of the zone.",
+		}, []string{"zone"}),
+	}
+	g.Registry.MustRegister(g.temperature, g.setpoint)
+	metrics.Registry.MustRegister(g.temperature, g.setpoint)
+	return g
+}
+
+// Follow sets the setpoint gauges to the setpoints of the zones, then to
+// every change until ctx is done.
+func (g *ZoneGauges) Follow(ctx context.Context, setpoints *Setpoints) {
+	changes, cancel := setpoints.Subscribe("")
+	defer cancel()
+	for _, zone := range setpoints.Zones() {
+		c, err := setpoints.Control(ctx, zone)
+		if err != nil {
+			log.Println("could not load the setpoint of", zone, err)
+			continue
+		}
+		g.setpoint.WithLabelValues(zone).Set(float64(c.Temperature))
+	}
+	for {
+		select {
+		case c := <-changes:
+			g.setpoint.WithLabelValues(c.Zone).Set(float64(c.Reading.Value))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Push pushes the zone gauges to the Pushgateway at url every interval,
+// from one interval on, until ctx is done, grouped by the host name as the
+// instance. A push replaces the gauges of the last one.
+func (g *ZoneGauges) Push(ctx context.Context, url string, interval time.Duration) {
+	pusher := push.New(url, pushJob).Gatherer(g.Registry).Grouping("instance", hostname())
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+		if err := pusher.PushContext(ctx); err != nil && ctx.Err() == nil {
+			log.Println("could not push the zone gauges:", err)
+		}
+	}
+}
+
+// gaugedReadings sets the temperature gauges to the raw temperature
+// readings added to the repository.
+type gaugedReadings struct {
+	store.ReadingRepo
+	gauges *ZoneGauges
+}
+
+func (r gaugedReadings) Add(ctx context.Context, a store.Aggregate) error {
+	err := r.ReadingRepo.Add(ctx, a)
+	if err == nil && a.Kind == store.Temperature && a.Resolution == store.Raw {
+		r.gauges.temperature.WithLabelValues(a.Zone).Set(a.Avg())
+	}
+	return err
+}